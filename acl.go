@@ -0,0 +1,130 @@
+package main
+
+/*
+ * acl.go
+ * Only serve files to the right networks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+/* prefixList is a flag.Value holding networks set with -allow or -deny */
+type prefixList []netip.Prefix
+
+/* String implements flag.Value. */
+func (p *prefixList) String() string {
+	ss := make([]string, len(*p))
+	for i, pfx := range *p {
+		ss[i] = pfx.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+/* Set implements flag.Value.  It adds the comma-separated networks in v to p.
+A bare address is taken to be a single-address network. */
+func (p *prefixList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if "" == s {
+			continue
+		}
+		pfx, err := netip.ParsePrefix(s)
+		if nil != err {
+			a, aerr := netip.ParseAddr(s)
+			if nil != aerr {
+				return fmt.Errorf("invalid network %q: %w", s, err)
+			}
+			pfx = netip.PrefixFrom(a, a.BitLen())
+		}
+		*p = append(*p, pfx.Masked())
+	}
+	return nil
+}
+
+/* contains returns the first network in p which contains a, if any. */
+func (p prefixList) contains(a netip.Addr) (netip.Prefix, bool) {
+	for _, pfx := range p {
+		if pfx.Contains(a) {
+			return pfx, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+var (
+	/* allowNets and denyNets are set with -allow and -deny */
+	allowNets prefixList
+	denyNets  prefixList
+
+	/* aclAction is what happens to queries from networks which don't get
+	files, set with -unauthorized. */
+	aclAction = geoRefuse
+)
+
+/* setACLAction sets aclAction from the action named by a, which must be
+refuse or decoy. */
+func setACLAction(a string) error {
+	act, err := parseACLAction(a)
+	if nil != err {
+		return err
+	}
+	aclAction = act
+	return nil
+}
+
+/* parseACLAction parses a, the value of -unauthorized. */
+func parseACLAction(a string) (geoAction, error) {
+	act, ok := geoActions[strings.ToLower(a)]
+	if !ok || geoServe == act {
+		return 0, fmt.Errorf("unknown action %q", a)
+	}
+	return act, nil
+}
+
+/* aclEnabled returns true if -allow or -deny was given. */
+func aclEnabled() bool { return 0 != len(allowNets) || 0 != len(denyNets) }
+
+/* aclCheck returns what to do with a query from addr according to the
+networks in s, as well as why, for logging.  Denied networks take precedence
+over allowed networks.  If there are allowed networks, addresses not in one
+are treated as denied. */
+func aclCheck(s settings, addr net.Addr) (geoAction, string) {
+	if 0 == len(s.allow) && 0 == len(s.deny) {
+		return geoServe, ""
+	}
+
+	/* Work out the IP address */
+	var a netip.Addr
+	switch v := addr.(type) {
+	case *net.UDPAddr:
+		a = v.AddrPort().Addr()
+	case *net.TCPAddr:
+		a = v.AddrPort().Addr()
+	default:
+		ap, err := netip.ParseAddrPort(addr.String())
+		if nil != err {
+			return s.unauth, "unknown network"
+		}
+		a = ap.Addr()
+	}
+	a = a.Unmap()
+
+	/* Work out what to do with it */
+	if pfx, ok := s.deny.contains(a); ok {
+		return s.unauth, "denied network " + pfx.String()
+	}
+	if 0 == len(s.allow) {
+		return geoServe, ""
+	}
+	if pfx, ok := s.allow.contains(a); ok {
+		return geoServe, "allowed network " + pfx.String()
+	}
+	return s.unauth, "unallowed network"
+}
@@ -0,0 +1,125 @@
+package main
+
+/*
+ * acl_test.go
+ * Tests for access control lists
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleACL(t *testing.T) {
+	testServe(t)
+	defer func() {
+		allowNets, denyNets, aclAction = nil, nil, geoRefuse
+		decoyDir = ""
+	}()
+	decoyDir = t.TempDir()
+	if err := ioutil.WriteFile(
+		filepath.Join(decoyDir, "payload"),
+		[]byte("puppies"),
+		0600,
+	); nil != err {
+		t.Fatalf("Writing decoy: %s", err)
+	}
+
+	for _, c := range []struct {
+		allow  string
+		deny   string
+		action string
+		rcode  dnsmessage.RCode
+		want   string
+	}{
+		{want: "kit"},
+		{allow: "192.0.2.0/24", want: "kit"},
+		{allow: "192.0.2.1", want: "kit"},
+		{allow: "198.51.100.0/24", rcode: dnsmessage.RCodeRefused},
+		{
+			allow: "10.0.0.0/8,198.51.100.0/24",
+			rcode: dnsmessage.RCodeRefused,
+		},
+		{deny: "192.0.2.0/24", rcode: dnsmessage.RCodeRefused},
+		{deny: "198.51.100.0/24", want: "kit"},
+		{
+			allow: "192.0.0.0/8",
+			deny:  "192.0.2.0/28",
+			rcode: dnsmessage.RCodeRefused,
+		},
+		{deny: "192.0.2.0/24", action: "decoy", want: "pup"},
+	} {
+		allowNets, denyNets, aclAction = nil, nil, geoRefuse
+		if err := allowNets.Set(c.allow); nil != err {
+			t.Fatalf("Setting allow %q: %s", c.allow, err)
+		}
+		if err := denyNets.Set(c.deny); nil != err {
+			t.Fatalf("Setting deny %q: %s", c.deny, err)
+		}
+		if "" != c.action {
+			if err := setACLAction(c.action); nil != err {
+				t.Fatalf("Setting action %q: %s", c.action, err)
+			}
+		}
+		m := testQuery(
+			t,
+			"0-payload.files.example.com.",
+			dnsmessage.TypeA,
+		)
+		if nil == m {
+			t.Errorf(
+				"allow:%q deny:%q: no response",
+				c.allow,
+				c.deny,
+			)
+			continue
+		}
+		if c.rcode != m.RCode {
+			t.Errorf(
+				"allow:%q deny:%q: got %s",
+				c.allow,
+				c.deny,
+				m.RCode,
+			)
+			continue
+		}
+		if "" == c.want {
+			continue
+		}
+		if 1 != len(m.Answers) {
+			t.Errorf(
+				"allow:%q deny:%q: got %d answers",
+				c.allow,
+				c.deny,
+				len(m.Answers),
+			)
+			continue
+		}
+		if got := string(
+			m.Answers[0].Body.(*dnsmessage.AResource).A[1:],
+		); c.want != got {
+			t.Errorf(
+				"allow:%q deny:%q: got %q, want %q",
+				c.allow,
+				c.deny,
+				got,
+				c.want,
+			)
+		}
+	}
+
+	/* Bad networks and actions */
+	var pl prefixList
+	if err := pl.Set("kittens"); nil == err {
+		t.Errorf("Bad network accepted")
+	}
+	if err := setACLAction("serve"); nil == err {
+		t.Errorf("Serve accepted as an unauthorized action")
+	}
+}
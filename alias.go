@@ -0,0 +1,114 @@
+package main
+
+/*
+ * alias.go
+ * Map innocuous query names to served files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* aliasFile is the file from which aliases are loaded, or the empty string
+if there isn't one */
+var aliasFile string
+
+/* aliases holds the dnsfservget.Aliases loaded from aliasFile */
+var aliases atomic.Value
+
+/* loadAliases reads aliases from the named file, in the format read by
+dnsfservget.ParseAliases. */
+func loadAliases(fn string) (dnsfservget.Aliases, error) {
+	f, err := os.Open(fn)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	return dnsfservget.ParseAliases(f)
+}
+
+/* reloadAliases (re)loads the aliases from aliasFile.  On error, the current
+aliases are kept. */
+func reloadAliases() error {
+	m, err := loadAliases(aliasFile)
+	if nil != err {
+		return err
+	}
+	aliases.Store(m)
+	log.Printf("Loaded %d aliases from %s", len(m), aliasFile)
+	return nil
+}
+
+/* resolveAlias returns the served file name for the name in a query, which is
+either the file (or stripe) for which name is an alias or name itself. */
+func resolveAlias(name string) string {
+	as, _ := aliases.Load().(dnsfservget.Aliases)
+	return as.File(name)
+}
+
+/* aliasesMain generates aliases for files and writes them to stdout in the
+format read with -aliases.  It is called with the arguments after "aliases"
+on the command line. */
+func aliasesMain(args []string) {
+	fs := flag.NewFlagSet("aliases", flag.ExitOnError)
+	wordsFile := fs.String(
+		"words",
+		"",
+		"Optional `file` with words to use as aliases, one per line",
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v aliases [options] file [file...]
+
+Gives each file an alias picked at random from a list of words and writes the
+aliases to stdout, for use with -aliases.  Getters should use the aliases as
+their Names.
+
+Options:
+`,
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if 0 == fs.NArg() {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	/* Work out which words to use */
+	var words []string
+	if "" != *wordsFile {
+		b, err := ioutil.ReadFile(*wordsFile)
+		if nil != err {
+			log.Fatalf("Error reading words: %s", err)
+		}
+		for _, w := range strings.Split(string(b), "\n") {
+			if w = strings.TrimSpace(w); "" != w &&
+				!strings.HasPrefix(w, "#") {
+				words = append(words, w)
+			}
+		}
+	}
+
+	/* Make the aliases */
+	as, err := dnsfservget.GenerateAliases(fs.Args(), words)
+	if nil != err {
+		log.Fatalf("Error generating aliases: %s", err)
+	}
+	if _, err := as.WriteTo(os.Stdout); nil != err {
+		log.Fatalf("Error writing aliases: %s", err)
+	}
+}
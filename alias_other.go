@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+/*
+ * alias_other.go
+ * No SIGHUP to reload aliases
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+/* watchAliasSignal is a no-op, as there's no SIGHUP. */
+func watchAliasSignal() {}
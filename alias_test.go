@@ -0,0 +1,90 @@
+package main
+
+/*
+ * alias_test.go
+ * Tests for file aliases
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleAliases(t *testing.T) {
+	testServe(t)
+	aliasFile = filepath.Join(t.TempDir(), "aliases")
+	defer aliases.Store(dnsfservget.Aliases(nil))
+
+	/* setAliases writes the alias file and reloads it */
+	setAliases := func(s string) {
+		t.Helper()
+		if err := ioutil.WriteFile(
+			aliasFile,
+			[]byte(s),
+			0600,
+		); nil != err {
+			t.Fatalf("Writing aliases: %s", err)
+		}
+		if err := reloadAliases(); nil != err {
+			t.Fatalf("Loading aliases: %s", err)
+		}
+	}
+	/* served returns the first answer's payload for the name */
+	served := func(name string) string {
+		t.Helper()
+		m := testQuery(t, name, dnsmessage.TypeA)
+		if nil == m || 0 == len(m.Answers) {
+			return ""
+		}
+		a, ok := m.Answers[0].Body.(*dnsmessage.AResource)
+		if !ok {
+			t.Fatalf("%s: got %T answer", name, m.Answers[0].Body)
+		}
+		return string(a.A[1:])
+	}
+
+	setAliases("# Comment\n\nWeather payload\n")
+	for _, n := range []string{"weather", "payload"} {
+		q := "0-" + n + ".files.example.com."
+		if got := served(q); "kit" != got {
+			t.Errorf("%s: got %q", q, got)
+		}
+	}
+
+	/* Reloading should replace the old aliases */
+	setAliases("news payload\n")
+	if got := served("0-news.files.example.com."); "kit" != got {
+		t.Errorf("New alias: got %q", got)
+	}
+	if got := served("0-weather.files.example.com."); "" != got {
+		t.Errorf("Old alias: got %q", got)
+	}
+
+	/* Bad files shouldn't replace the current aliases */
+	for _, s := range []string{
+		"news\n",
+		"a.b payload\n",
+		"news payload\nnews payload\n",
+	} {
+		if err := ioutil.WriteFile(
+			aliasFile,
+			[]byte(s),
+			0600,
+		); nil != err {
+			t.Fatalf("Writing aliases: %s", err)
+		}
+		if err := reloadAliases(); nil == err {
+			t.Errorf("No error loading %q", s)
+		}
+	}
+	if got := served("0-news.files.example.com."); "kit" != got {
+		t.Errorf("Alias after bad reload: got %q", got)
+	}
+}
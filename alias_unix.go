@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+/*
+ * alias_unix.go
+ * Reload aliases with SIGHUP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/* watchAliasSignal reloads the aliases every time we get a SIGHUP. */
+func watchAliasSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := reloadAliases(); nil != err {
+			log.Printf("Error reloading aliases: %s", err)
+		}
+	}
+}
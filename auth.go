@@ -0,0 +1,107 @@
+package main
+
+/*
+ * auth.go
+ * Require a MAC in query names
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/hmac"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* authInterval is how often counts of unauthenticated queries are logged */
+const authInterval = time.Hour
+
+/* authKey, if set, is the key with which queries for files must be
+authenticated with a MAC in a label after the first.  Unlike TSIG, this
+survives being sent through resolvers. */
+var authKey []byte
+
+/* authLabel starts the label holding the MAC */
+const authLabel = dnsfservget.AuthLabel
+
+/* badAuth counts queries with missing or bad MACs, which are refused.  As
+with out-of-zone queries, only the first from each client between summaries
+is logged. */
+var badAuth = struct {
+	l    sync.Mutex
+	n    uint64
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+/* authZone splits a MAC label off the front of the zone from a query, or
+after the CNAME label for CNAME targets, if there is one, and returns the MAC
+and the rest of the zone. */
+func authZone(zone string) (mac, rest string) {
+	mac, rest, _ = cutZoneLabel(zone, authLabel+"-")
+	return mac, rest
+}
+
+/* authOK returns true if we don't need a MAC or mac is the MAC of the first
+label of a query, label. */
+func authOK(label, mac string) bool {
+	if nil == authKey {
+		return true
+	}
+	return hmac.Equal(
+		[]byte(dnsfservget.AuthMAC(authKey, label)),
+		[]byte(mac),
+	)
+}
+
+/* summarizeBadAuth logs and resets the count of unauthenticated queries every
+interval, if there were any.  It never returns. */
+func summarizeBadAuth(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		badAuth.l.Lock()
+		n, clients := badAuth.n, len(badAuth.seen)
+		badAuth.n = 0
+		badAuth.seen = make(map[string]bool)
+		badAuth.l.Unlock()
+		if 0 == n {
+			continue
+		}
+		log.Printf(
+			"Refused %d unauthenticated queries from %d clients in "+
+				"the last %s",
+			n,
+			clients,
+			interval,
+		)
+	}
+}
+
+/* sendBadAuth refuses the query in msg, which came from addr via pc, which
+didn't have a good MAC.  The buffer buf is used to send the response. */
+func sendBadAuth(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	badAuth.l.Lock()
+	badAuth.n++
+	first := !badAuth.seen[campaignClient(addr)]
+	badAuth.seen[campaignClient(addr)] = true
+	badAuth.l.Unlock()
+	if first {
+		log.Printf("[%s] Refusing unauthenticated query for %q", la, q)
+	}
+	msg.RCode = dnsmessage.RCodeRefused
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending refusal: %s", la, err)
+	}
+}
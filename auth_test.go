@@ -0,0 +1,64 @@
+package main
+
+/*
+ * auth_test.go
+ * Tests for query authentication
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleAuth(t *testing.T) {
+	testServe(t)
+	authKey = []byte("kittens")
+	defer func() { authKey = nil }()
+	an := func(n string) string { return dnsfservget.AuthName(authKey, n) }
+	mn := metaLabel + "-payload.example.com."
+	bad := "0-payload." + authLabel + "-aaaaaaaaaaaaa.example.com."
+	for _, c := range []struct {
+		name    string
+		qtype   dnsmessage.Type
+		refused bool
+		answers int
+	}{
+		{an("0-payload.example.com."), dnsmessage.TypeA, false, 1},
+		{an("0-PayLoad.example.com."), dnsmessage.TypeA, false, 1},
+		{an(mn), dnsmessage.TypeTXT, false, 1},
+		{an("0-payload.example.com."), dnsmessage.TypeCNAME, false, 1},
+		{"0-payload.example.com.", dnsmessage.TypeA, true, 0},
+		{mn, dnsmessage.TypeTXT, true, 0},
+		{bad, dnsmessage.TypeA, true, 0},
+		{strings.Replace(
+			an("0-payload.example.com."),
+			"0-",
+			"3-",
+			1,
+		), dnsmessage.TypeA, true, 0},
+		{"example.com.", dnsmessage.TypeA, false, 0},
+	} {
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Errorf("%s %s: no response", c.name, c.qtype)
+			continue
+		}
+		if c.refused != (dnsmessage.RCodeRefused == m.RCode) {
+			t.Errorf("%s %s: got RCode %s", c.name, c.qtype, m.RCode)
+		}
+		if c.answers != len(m.Answers) {
+			t.Errorf(
+				"%s %s: got %d answers",
+				c.name,
+				c.qtype,
+				len(m.Answers),
+			)
+		}
+	}
+}
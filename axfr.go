@@ -0,0 +1,396 @@
+package main
+
+/*
+ * axfr.go
+ * Handle zone transfer attempts
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* defaultDecoyZone is served as the decoy zone if -axfr-zone isn't given. */
+const defaultDecoyZone = `
+@    NS    ns1
+@    NS    ns2
+@    A     192.0.2.10
+@    MX    10 mail
+@    TXT   v=spf1 mx -all
+ns1  A     192.0.2.2
+ns2  A     192.0.2.3
+www  CNAME @
+mail A     192.0.2.25
+vpn  A     192.0.2.40
+`
+
+/* Things to do with zone transfer attempts */
+const (
+	axfrRefuse = "refuse"
+	axfrDecoy  = "decoy"
+)
+
+/* typeIXFR is the IXFR type, which dnsmessage doesn't have */
+const typeIXFR dnsmessage.Type = 251
+
+/* zoneRecord is a record in the decoy zone.  Names are relative to the zone
+unless they end in a dot. */
+type zoneRecord struct {
+	name  string
+	rtype dnsmessage.Type
+	data  []string
+}
+
+var (
+	/* axfrMode is what to do with zone transfer attempts */
+	axfrMode = axfrRefuse
+
+	/* axfrWebhook, if set, is POSTed to on zone transfer attempts */
+	axfrWebhook string
+
+	/* decoyZone is the zone served to zone transfer attempts if axfrMode
+	is axfrDecoy */
+	decoyZone []zoneRecord
+)
+
+/* setAXFR sets axfrMode and the decoy zone.  The decoy zone is read from the
+named file, or defaultDecoyZone if zfile is empty. */
+func setAXFR(mode, zfile string) error {
+	switch mode {
+	case axfrRefuse:
+	case axfrDecoy:
+	default:
+		return fmt.Errorf("unknown zone transfer action %q", mode)
+	}
+	axfrMode = mode
+
+	/* Load the decoy zone */
+	var r io.Reader = strings.NewReader(defaultDecoyZone)
+	if "" != zfile {
+		f, err := os.Open(zfile)
+		if nil != err {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	zrs, err := parseZone(r)
+	if nil != err {
+		return err
+	}
+
+	/* Make sure it works */
+	if _, err := zoneResources(zrs, dnsmessage.MustNewName(
+		"example.com.",
+	)); nil != err {
+		return err
+	}
+	decoyZone = zrs
+
+	return nil
+}
+
+/* parseZone parses a zone made of lines of the form name type data.  Blank
+lines and lines starting with # are ignored. */
+func parseZone(r io.Reader) ([]zoneRecord, error) {
+	var (
+		zrs []zoneRecord
+		s   = bufio.NewScanner(r)
+		ln  int
+	)
+	for s.Scan() {
+		ln++
+		l := strings.TrimSpace(s.Text())
+		if "" == l || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fs := strings.Fields(l)
+		if 3 > len(fs) {
+			return nil, fmt.Errorf("line %d: too few fields", ln)
+		}
+		zr := zoneRecord{name: fs[0], data: fs[2:]}
+		switch strings.ToUpper(fs[1]) {
+		case "A":
+			zr.rtype = dnsmessage.TypeA
+		case "AAAA":
+			zr.rtype = dnsmessage.TypeAAAA
+		case "NS":
+			zr.rtype = dnsmessage.TypeNS
+		case "CNAME":
+			zr.rtype = dnsmessage.TypeCNAME
+		case "MX":
+			zr.rtype = dnsmessage.TypeMX
+		case "TXT":
+			zr.rtype = dnsmessage.TypeTXT
+			zr.data = []string{strings.Join(fs[2:], " ")}
+		default:
+			return nil, fmt.Errorf(
+				"line %d: unsupported type %q",
+				ln,
+				fs[1],
+			)
+		}
+		zrs = append(zrs, zr)
+	}
+	if err := s.Err(); nil != err {
+		return nil, err
+	}
+	return zrs, nil
+}
+
+/* zoneResources turns the records in zrs into resources in the zone named
+origin, bracketed with SOA records as in a zone transfer. */
+func zoneResources(
+	zrs []zoneRecord,
+	origin dnsmessage.Name,
+) ([]dnsmessage.Resource, error) {
+	/* Work out full names */
+	fqdn := func(n string) (dnsmessage.Name, error) {
+		switch {
+		case "@" == n:
+			return origin, nil
+		case strings.HasSuffix(n, "."):
+			return dnsmessage.NewName(n)
+		default:
+			return dnsmessage.NewName(n + "." + origin.String())
+		}
+	}
+
+	/* SOA to start and end */
+	mname, err := fqdn("ns1")
+	if nil != err {
+		return nil, err
+	}
+	rname, err := fqdn("hostmaster")
+	if nil != err {
+		return nil, err
+	}
+	serial, _ := strconv.ParseUint(
+		time.Now().Format("2006010215"),
+		10,
+		32,
+	)
+	ttl := uint32(currentSettings().ttl)
+	soa := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  origin,
+			Class: dnsmessage.ClassINET,
+			TTL:   ttl,
+		},
+		Body: &dnsmessage.SOAResource{
+			NS:      mname,
+			MBox:    rname,
+			Serial:  uint32(serial),
+			Refresh: 7200,
+			Retry:   3600,
+			Expire:  1209600,
+			MinTTL:  3600,
+		},
+	}
+	rs := []dnsmessage.Resource{soa}
+
+	/* The records themselves */
+	for _, zr := range zrs {
+		r, err := zr.resource(fqdn, ttl)
+		if nil != err {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+
+	return append(rs, soa), nil
+}
+
+/* resource turns zr into a resource with the given TTL.  Names are made
+fully-qualified with fqdn. */
+func (zr zoneRecord) resource(
+	fqdn func(n string) (dnsmessage.Name, error),
+	ttl uint32,
+) (dnsmessage.Resource, error) {
+	n, err := fqdn(zr.name)
+	if nil != err {
+		return dnsmessage.Resource{}, fmt.Errorf(
+			"name %q: %w",
+			zr.name,
+			err,
+		)
+	}
+	r := dnsmessage.Resource{Header: dnsmessage.ResourceHeader{
+		Name:  n,
+		Class: dnsmessage.ClassINET,
+		TTL:   ttl,
+	}}
+	switch zr.rtype {
+	case dnsmessage.TypeA:
+		ip := net.ParseIP(zr.data[0]).To4()
+		if nil == ip {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"invalid IPv4 address %q",
+				zr.data[0],
+			)
+		}
+		var a dnsmessage.AResource
+		copy(a.A[:], ip)
+		r.Body = &a
+	case dnsmessage.TypeAAAA:
+		ip := net.ParseIP(zr.data[0])
+		if nil == ip || nil != ip.To4() {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"invalid IPv6 address %q",
+				zr.data[0],
+			)
+		}
+		var a dnsmessage.AAAAResource
+		copy(a.AAAA[:], ip)
+		r.Body = &a
+	case dnsmessage.TypeNS:
+		t, err := fqdn(zr.data[0])
+		if nil != err {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"NS %q: %w",
+				zr.data[0],
+				err,
+			)
+		}
+		r.Body = &dnsmessage.NSResource{NS: t}
+	case dnsmessage.TypeCNAME:
+		t, err := fqdn(zr.data[0])
+		if nil != err {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"CNAME %q: %w",
+				zr.data[0],
+				err,
+			)
+		}
+		r.Body = &dnsmessage.CNAMEResource{CNAME: t}
+	case dnsmessage.TypeMX:
+		if 2 != len(zr.data) {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"MX %q needs a preference and name",
+				strings.Join(zr.data, " "),
+			)
+		}
+		p, err := strconv.ParseUint(zr.data[0], 10, 16)
+		if nil != err {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"MX preference %q: %w",
+				zr.data[0],
+				err,
+			)
+		}
+		t, err := fqdn(zr.data[1])
+		if nil != err {
+			return dnsmessage.Resource{}, fmt.Errorf(
+				"MX %q: %w",
+				zr.data[1],
+				err,
+			)
+		}
+		r.Body = &dnsmessage.MXResource{Pref: uint16(p), MX: t}
+	case dnsmessage.TypeTXT:
+		r.Body = &dnsmessage.TXTResource{TXT: zr.data}
+	}
+	return r, nil
+}
+
+/* isZoneTransfer returns true if t is AXFR or IXFR. */
+func isZoneTransfer(t dnsmessage.Type) bool {
+	return dnsmessage.TypeAXFR == t || typeIXFR == t
+}
+
+/* handleZoneTransfer either refuses the zone transfer request in msg or sends
+back the decoy zone, and raises the alarm. */
+func handleZoneTransfer(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	log.Printf("[%s] Zone transfer attempt %q", la, q)
+
+	/* Let someone know */
+	if "" != axfrWebhook {
+		go func() {
+			if err := sendAXFRAlert(la, q); nil != err {
+				log.Printf(
+					"[%s] Error sending zone transfer "+
+						"alert: %s",
+					la,
+					err,
+				)
+			}
+		}()
+	}
+
+	/* Either refuse or give them something to look at */
+	switch axfrMode {
+	case axfrDecoy:
+		rs, err := zoneResources(decoyZone, msg.Questions[0].Name)
+		if nil != err {
+			log.Printf(
+				"[%s] Error generating decoy zone for %q: %s",
+				la,
+				q,
+				err,
+			)
+			msg.RCode = dnsmessage.RCodeServerFailure
+			break
+		}
+		msg.Answers = rs
+	default:
+		msg.RCode = dnsmessage.RCodeRefused
+	}
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf(
+			"[%s] Error responding to zone transfer %q: %s",
+			la,
+			q,
+			err,
+		)
+	}
+}
+
+/* sendAXFRAlert POSTs a bit of JSON describing a zone transfer attempt to the
+axfrWebhook. */
+func sendAXFRAlert(client, q string) error {
+	b, err := json.Marshal(struct {
+		Time   time.Time `json:"time"`
+		Client string    `json:"client"`
+		Query  string    `json:"query"`
+		Action string    `json:"action"`
+	}{
+		Time:   time.Now(),
+		Client: client,
+		Query:  q,
+		Action: axfrMode,
+	})
+	if nil != err {
+		return fmt.Errorf("marshalling alert: %w", err)
+	}
+	res, err := http.Post(axfrWebhook, "application/json", bytes.NewReader(b))
+	if nil != err {
+		return err
+	}
+	defer res.Body.Close()
+	if 200 > res.StatusCode || 299 < res.StatusCode {
+		return fmt.Errorf("non-2xx response status %s", res.Status)
+	}
+	return nil
+}
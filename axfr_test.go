@@ -0,0 +1,56 @@
+package main
+
+/*
+ * axfr_test.go
+ * Tests for zone transfer handling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleZoneTransfer(t *testing.T) {
+	testServe(t)
+	defer setAXFR(axfrRefuse, "")
+
+	/* Refusal */
+	if err := setAXFR(axfrRefuse, ""); nil != err {
+		t.Fatalf("setAXFR: %s", err)
+	}
+	m := testQuery(t, "files.example.com.", dnsmessage.TypeAXFR)
+	if nil == m {
+		t.Fatalf("No response to refused zone transfer")
+	}
+	if dnsmessage.RCodeRefused != m.RCode {
+		t.Errorf("Refused zone transfer got RCode %s", m.RCode)
+	}
+
+	/* Decoy zone */
+	if err := setAXFR(axfrDecoy, ""); nil != err {
+		t.Fatalf("setAXFR: %s", err)
+	}
+	m = testQuery(t, "files.example.com.", dnsmessage.TypeAXFR)
+	if nil == m {
+		t.Fatalf("No response to decoy zone transfer")
+	}
+	if dnsmessage.RCodeSuccess != m.RCode {
+		t.Fatalf("Decoy zone transfer got RCode %s", m.RCode)
+	}
+	if 3 > len(m.Answers) {
+		t.Fatalf("Decoy zone only has %d records", len(m.Answers))
+	}
+	for _, i := range []int{0, len(m.Answers) - 1} {
+		if dnsmessage.TypeSOA != m.Answers[i].Header.Type {
+			t.Errorf(
+				"Decoy zone record %d is %s, not SOA",
+				i,
+				m.Answers[i].Header.Type,
+			)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+/*
+ * bigtxt.go
+ * Parse queries for large TXT chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* bigTXTLabel goes before the offset in queries for chunks of answer.BigTXTMax
+bytes, which are only served in TXT records.  Like metaLabel, it's not valid
+base36. */
+const bigTXTLabel = "_txt"
+
+/* parseOffsetQuery parses the part of a query after a label which goes before
+the offset, such as bigTXTLabel or multiLabel, which is of the form
+offset-filename, with the offset in base36. */
+func parseOffsetQuery(s string) (off uint64, fname string, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if 2 != len(parts) {
+		return 0, "", errors.New("badly-formatted query")
+	}
+	if off, err = strconv.ParseUint(parts[0], 36, 64); nil != err {
+		return 0, "", fmt.Errorf("parsing offset: %w", err)
+	}
+	return off, parts[1], nil
+}
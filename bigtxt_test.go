@@ -0,0 +1,76 @@
+package main
+
+/*
+ * bigtxt_test.go
+ * Tests for big TXT answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleBigTXT(t *testing.T) {
+	testServe(t)
+	contents := make([]byte, 2*answer.BigTXTMax)
+	for i := range contents {
+		contents[i] = byte(i * 7)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "big"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+
+	/* Large chunks come in several strings */
+	m := testQuery(t, "_txt-dc-big.files.example.com.", dnsmessage.TypeTXT)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("No answer")
+	}
+	txt, ok := m.Answers[0].Body.(*dnsmessage.TXTResource)
+	if !ok {
+		t.Fatalf("Got %T", m.Answers[0].Body)
+	}
+	if 3 != len(txt.TXT) {
+		t.Errorf("Got %d strings, want 3", len(txt.TXT))
+	}
+	g := dnsfservget.Getter{Type: dnsfservget.TypeBigTXT}
+	buf := make([]byte, dnsfservget.MaxBigTXTDecode)
+	n, err := g.DecodeResponse(buf, strings.Join(txt.TXT, ""))
+	if nil != err {
+		t.Fatalf("Decoding answer: %s", err)
+	}
+	if !bytes.Equal(contents[answer.BigTXTMax:], buf[:n]) {
+		t.Errorf("Got %d bytes which don't match", n)
+	}
+
+	/* Normal chunks are still normal */
+	m = testQuery(t, "dc-big.files.example.com.", dnsmessage.TypeTXT)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("No normal answer")
+	}
+	if txt := m.Answers[0].Body.(*dnsmessage.TXTResource); 1 != len(
+		txt.TXT,
+	) || base64.RawStdEncoding.EncodedLen(answer.TXTMax) != len(txt.TXT[0]) {
+		t.Errorf("Normal answer %q", txt.TXT)
+	}
+
+	/* Large chunks only come in TXT records */
+	m = testQuery(t, "_txt-0-big.files.example.com.", dnsmessage.TypeA)
+	if nil == m || 0 != len(m.Answers) {
+		t.Errorf("Got A answer for large TXT query: %v", m)
+	}
+}
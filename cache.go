@@ -0,0 +1,176 @@
+package main
+
+/*
+ * cache.go
+ * Cache of encoded file chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* chunks holds chunks which have already been encoded */
+var chunks chunkCache
+
+/* chunkKey identifies an encoded chunk of a file */
+type chunkKey struct {
+	fname string          /* File path */
+	off   uint64          /* Offset into the file */
+	qtype dnsmessage.Type /* Record type */
+	zone  string          /* Zone, for records which hold names */
+	size  uint64          /* Most bytes of the file in the chunk */
+	seq   bool            /* Chunk starts with a sequence byte */
+	pad   bool            /* Chunk is padded */
+}
+
+/* chunk is an encoded chunk of a file, as well as enough information about
+the file to tell if it's changed since the chunk was encoded */
+type chunk struct {
+	key     chunkKey
+	bodies  []dnsmessage.ResourceBody
+	bytes   uint64 /* Approximate memory used by bodies */
+	size    int64
+	modTime time.Time
+}
+
+/* chunkCache caches the encoded bodies of records, independent of the query
+which caused them to be encoded.  This saves reading and encoding the same
+chunk over and over for queries from different resolvers.  When it holds max
+chunks or maxBytes bytes, the least-recently used chunks are evicted.  The
+zero value caches nothing. */
+type chunkCache struct {
+	max      uint   /* Maximum number of chunks to cache */
+	maxBytes uint64 /* Maximum bytes of chunks to cache, if not 0 */
+
+	l     sync.Mutex
+	ll    *list.List /* Of *chunk, most-recently used first */
+	m     map[chunkKey]*list.Element
+	bytes uint64 /* Approximate bytes cached */
+
+	hits, misses, evictions uint64 /* Since the last summary */
+}
+
+/* get returns the cached bodies for k, or nil if there aren't any or if the
+file described by fi has changed since the bodies were cached.  The returned
+bodies must not be modified. */
+func (c *chunkCache) get(
+	k chunkKey,
+	fi os.FileInfo,
+) []dnsmessage.ResourceBody {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	e, ok := c.m[k]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	/* If the file's changed, the chunk's no good any more */
+	ch := e.Value.(*chunk)
+	if ch.size != fi.Size() || !ch.modTime.Equal(fi.ModTime()) {
+		c.remove(e)
+		c.misses++
+		return nil
+	}
+	c.ll.MoveToFront(e)
+	c.hits++
+	return ch.bodies
+}
+
+/* put caches bodies for k.  The file described by fi is the file from which
+the bodies were read.  If the cache is full, the least-recently used chunks
+are evicted. */
+func (c *chunkCache) put(
+	k chunkKey,
+	fi os.FileInfo,
+	bodies []dnsmessage.ResourceBody,
+) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	/* Don't bother if we're not caching */
+	if 0 == c.max {
+		return
+	}
+	ch := &chunk{
+		key:     k,
+		bodies:  bodies,
+		bytes:   bodiesSize(bodies),
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+	}
+	if 0 != c.maxBytes && ch.bytes > c.maxBytes {
+		return
+	}
+	if nil == c.m {
+		c.m = make(map[chunkKey]*list.Element)
+		c.ll = list.New()
+	}
+	if e, ok := c.m[k]; ok {
+		c.remove(e)
+	}
+
+	/* Make room if we need it */
+	for 0 != c.ll.Len() && (uint(c.ll.Len()) >= c.max ||
+		(0 != c.maxBytes && c.bytes+ch.bytes > c.maxBytes)) {
+		c.remove(c.ll.Back())
+		c.evictions++
+	}
+
+	c.m[k] = c.ll.PushFront(ch)
+	c.bytes += ch.bytes
+}
+
+/* remove removes e from the cache.  c.l must be held. */
+func (c *chunkCache) remove(e *list.Element) {
+	ch := c.ll.Remove(e).(*chunk)
+	delete(c.m, ch.key)
+	c.bytes -= ch.bytes
+}
+
+/* stats returns the number of chunks and bytes cached and the number of hits,
+misses, and evictions since the last call to stats. */
+func (c *chunkCache) stats() (n int, bytes, hits, misses, evictions uint64) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	n, bytes = len(c.m), c.bytes
+	hits, misses, evictions = c.hits, c.misses, c.evictions
+	c.hits, c.misses, c.evictions = 0, 0, 0
+	return n, bytes, hits, misses, evictions
+}
+
+/* chunkOverhead is roughly how much memory a cached chunk uses besides its
+records' data */
+const chunkOverhead = 128
+
+/* bodiesSize returns roughly how much memory bodies uses. */
+func bodiesSize(bodies []dnsmessage.ResourceBody) uint64 {
+	n := uint64(chunkOverhead)
+	for _, b := range bodies {
+		n += 16 /* Interface */
+		switch b := b.(type) {
+		case *dnsmessage.AResource:
+			n += 4
+		case *dnsmessage.AAAAResource:
+			n += 16
+		case *dnsmessage.TXTResource:
+			for _, s := range b.TXT {
+				n += 16 + uint64(len(s))
+			}
+		case *dnsmessage.UnknownResource:
+			n += uint64(len(b.Data))
+		default:
+			/* Names */
+			n += 256
+		}
+	}
+	return n
+}
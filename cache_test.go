@@ -0,0 +1,64 @@
+package main
+
+/*
+ * cache_test.go
+ * Tests for the chunk cache
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestChunkCache(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "f")
+	if err := ioutil.WriteFile(fn, []byte("kittens"), 0600); nil != err {
+		t.Fatalf("Writing file: %s", err)
+	}
+	fi, err := os.Stat(fn)
+	if nil != err {
+		t.Fatalf("Stat: %s", err)
+	}
+	bodies := []dnsmessage.ResourceBody{&dnsmessage.AResource{}}
+	key := func(off uint64) chunkKey {
+		return chunkKey{fname: fn, off: off, qtype: dnsmessage.TypeA}
+	}
+
+	/* The least-recently used chunk goes first */
+	c := chunkCache{max: 2}
+	c.put(key(0), fi, bodies)
+	c.put(key(1), fi, bodies)
+	c.get(key(0), fi)
+	c.put(key(2), fi, bodies)
+	for off, want := range []bool{true, false, true} {
+		if got := nil != c.get(key(uint64(off)), fi); want != got {
+			t.Errorf("Chunk %d cached: %t", off, got)
+		}
+	}
+
+	/* As does the oldest chunk when we're out of bytes */
+	sz := bodiesSize(bodies)
+	c = chunkCache{max: 10, maxBytes: 2 * sz}
+	for off := uint64(0); off < 3; off++ {
+		c.put(key(off), fi, bodies)
+	}
+	n, b, _, _, evictions := c.stats()
+	if 2 != n || 2*sz != b || 1 != evictions {
+		t.Errorf(
+			"Got %d chunks, %d bytes, %d evictions",
+			n,
+			b,
+			evictions,
+		)
+	}
+	if nil != c.get(key(0), fi) {
+		t.Errorf("Oldest chunk not evicted")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+/*
+ * campaign.go
+ * Tag files and zones with campaigns and keep per-campaign stats
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* campaignStats holds the stats for a single campaign */
+type campaignStats struct {
+	clients   map[string]struct{}
+	completed map[string]struct{} /* Clients which got to EOF */
+	queries   uint64
+	bytes     uint64
+}
+
+/* campaignSet maps files and zones to campaigns and keeps stats for each
+campaign */
+type campaignSet struct {
+	files map[string]string /* Served filename -> campaign */
+	zones map[string]string /* Zone, without trailing dot -> campaign */
+
+	l     sync.Mutex
+	stats map[string]*campaignStats
+}
+
+/* campaigns holds the campaigns read from the file given with -campaigns, or
+is nil if there are none */
+var campaigns *campaignSet
+
+/* loadCampaigns reads campaign tags from the named file.  Each non-blank,
+non-comment line is of the form
+  file|zone name campaign
+where name is the name of a served file or a DNS zone. */
+func loadCampaigns(fn string) (*campaignSet, error) {
+	f, err := os.Open(fn)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &campaignSet{
+		files: make(map[string]string),
+		zones: make(map[string]string),
+		stats: make(map[string]*campaignStats),
+	}
+	s := bufio.NewScanner(f)
+	var ln int
+	for s.Scan() {
+		ln++
+		l := strings.TrimSpace(s.Text())
+		if "" == l || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fs := strings.Fields(l)
+		if 3 != len(fs) {
+			return nil, fmt.Errorf(
+				"line %d: need exactly three fields",
+				ln,
+			)
+		}
+		switch fs[0] {
+		case "file":
+			c.files[strings.ToLower(filepath.Clean(fs[1]))] = fs[2]
+		case "zone":
+			c.zones[strings.ToLower(strings.Trim(fs[1], "."))] = fs[2]
+		default:
+			return nil, fmt.Errorf(
+				"line %d: unknown kind %q",
+				ln,
+				fs[0],
+			)
+		}
+	}
+	if err := s.Err(); nil != err {
+		return nil, err
+	}
+	return c, nil
+}
+
+/* tag returns the campaign for the served file fname queried for in zone.  A
+campaign for the file takes precedence over one for the zone, and the longest
+matching zone wins.  If there's no campaign, tag returns the empty string. */
+func (c *campaignSet) tag(fname, zone string) string {
+	if t, ok := c.files[fname]; ok {
+		return t
+	}
+	zone = strings.Trim(zone, ".")
+	for {
+		if t, ok := c.zones[zone]; ok {
+			return t
+		}
+		i := strings.IndexByte(zone, '.')
+		if -1 == i {
+			return ""
+		}
+		zone = zone[i+1:]
+	}
+}
+
+/* statsFor returns the stats for the campaign tag.  c.l must be held. */
+func (c *campaignSet) statsFor(tag string) *campaignStats {
+	st, ok := c.stats[tag]
+	if !ok {
+		st = &campaignStats{
+			clients:   make(map[string]struct{}),
+			completed: make(map[string]struct{}),
+		}
+		c.stats[tag] = st
+	}
+	return st
+}
+
+/* served notes that n bytes of a file in the campaign tag were served to
+addr. */
+func (c *campaignSet) served(tag string, addr net.Addr, n uint64) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	st := c.statsFor(tag)
+	st.clients[campaignClient(addr)] = struct{}{}
+	st.queries++
+	st.bytes += n
+}
+
+/* completed notes that addr got to the end of a file in the campaign tag. */
+func (c *campaignSet) completed(tag string, addr net.Addr) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	st := c.statsFor(tag)
+	client := campaignClient(addr)
+	st.clients[client] = struct{}{}
+	st.completed[client] = struct{}{}
+	st.queries++
+}
+
+/* summarize logs a summary of each campaign's stats every interval.  It
+never returns. */
+func (c *campaignSet) summarize(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.l.Lock()
+		tags := make([]string, 0, len(c.stats))
+		for t := range c.stats {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+		for _, t := range tags {
+			st := c.stats[t]
+			log.Printf(
+				"Campaign %s: clients=%d completed=%d (%d%%) "+
+					"queries=%d bytes=%d",
+				t,
+				len(st.clients),
+				len(st.completed),
+				100*len(st.completed)/len(st.clients),
+				st.queries,
+				st.bytes,
+			)
+		}
+		c.l.Unlock()
+	}
+}
+
+/* campaignClient returns how addr is counted as a client, which is the
+(possibly redacted) host part. */
+func campaignClient(addr net.Addr) string {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	return logAddr(&net.IPAddr{IP: net.ParseIP(host)})
+}
+
+/* campaignLog returns a string to add to log lines for files in the campaign
+tag, or the empty string if tag is empty. */
+func campaignLog(tag string) string {
+	if "" == tag {
+		return ""
+	}
+	return " [campaign " + tag + "]"
+}
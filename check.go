@@ -0,0 +1,103 @@
+package main
+
+/*
+ * check.go
+ * Answer queries checking what gets through to us
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* checkLabel replaces the offset in queries from dnsfservget.Probe */
+const checkLabel = dnsfservget.CheckLabel
+
+/* checkNX is the size in a check query which gets an NXDomain */
+const checkNX = "nx"
+
+/* sendCheck answers the check query in msg, which came from addr via pc,
+with the first few bytes of dnsfservget.CheckPattern.  The query's name, after
+checkLabel, is in arg and is of the form size-nonce.  Names holding data are
+in zone.  The buffer buf is used to send the response. */
+func sendCheck(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	arg string,
+	zone string,
+) {
+	la := logAddr(addr)
+
+	/* Work out how much to send */
+	parts := strings.SplitN(arg, "-", 2)
+	if checkNX == parts[0] {
+		sendEOF(pc, addr, buf, msg, q)
+		return
+	}
+	size, err := strconv.ParseUint(parts[0], 36, 0)
+	if nil == err && dnsfservget.MaxCheckSize < size {
+		err = strconv.ErrRange
+	}
+	if nil != err {
+		log.Printf(
+			"[%s] Error parsing check size %q in %q: %s",
+			la,
+			parts[0],
+			q,
+			err,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrBadOffset)
+		return
+	}
+	p := dnsfservget.CheckPattern(uint(size))
+
+	/* Encode it like a file chunk, but with as much in TXT records as was
+	asked for */
+	ab := answer.Builder{QType: msg.Questions[0].Type, Zone: zone}
+	max := answer.ChunkSize(ab.QType)
+	if 0 == max {
+		sendNoData(pc, addr, buf, msg, q)
+		return
+	}
+	if dnsmessage.TypeTXT != ab.QType && max < uint64(len(p)) {
+		p = p[:max]
+	}
+	body, err := ab.Record(p, 0)
+	if nil != err {
+		log.Printf(
+			"[%s] Error encoding check answer for %q: %s",
+			la,
+			q,
+			err,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrAnswer)
+		return
+	}
+
+	/* Send it back, uncached */
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+		},
+		Body: body,
+	})
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending check answer: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Sent %d-byte check answer for %q", la, size, q)
+}
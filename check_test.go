@@ -0,0 +1,73 @@
+package main
+
+/*
+ * check_test.go
+ * Tests for what-gets-through checks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleCheck(t *testing.T) {
+	/* TXT answers hold the pattern, split into strings */
+	m := testQuery(
+		t,
+		"_check-e8-abc.files.example.com.",
+		dnsmessage.TypeTXT,
+	)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("No TXT answer")
+	}
+	txt, ok := m.Answers[0].Body.(*dnsmessage.TXTResource)
+	if !ok {
+		t.Fatalf("Got %T", m.Answers[0].Body)
+	}
+	if 3 != len(txt.TXT) {
+		t.Errorf("Got %d strings, want 3", len(txt.TXT))
+	}
+	b, err := base64.RawStdEncoding.DecodeString(strings.Join(txt.TXT, ""))
+	if nil != err {
+		t.Fatalf("Decoding TXT answer: %s", err)
+	}
+	if want := dnsfservget.CheckPattern(512); !bytes.Equal(want, b) {
+		t.Errorf("TXT: got %02x", b)
+	}
+
+	/* A answers look like file chunks */
+	m = testQuery(
+		t,
+		"_check-3-abc.files.example.com.",
+		dnsmessage.TypeA,
+	)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("No A answer")
+	}
+	a := m.Answers[0].Body.(*dnsmessage.AResource).A
+	if want := append(
+		[]byte{answer.AFirstByte},
+		dnsfservget.CheckPattern(3)...,
+	); !bytes.Equal(want, a[:]) {
+		t.Errorf("A: got %02x, want %02x", a, want)
+	}
+
+	/* And NXDomains are NXDomains */
+	m = testQuery(
+		t,
+		"_check-nx-abc.files.example.com.",
+		dnsmessage.TypeA,
+	)
+	if nil == m || dnsmessage.RCodeNameError != m.RCode {
+		t.Errorf("No NXDomain: %v", m)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+/*
+ * cname.go
+ * Answer with a CNAME to the real answer, like a CDN
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* cnameLabel, if set, is the label added to names to make the targets of
+CNAMEs to payload answers */
+var cnameLabel string
+
+/* isCNAMETarget returns true if a query for a name in zone, the part of the
+name after the first label, is for the target of one of our CNAMEs.  Those get
+answered directly. */
+func isCNAMETarget(zone string) bool {
+	return "" != cnameLabel && strings.HasPrefix(zone, cnameLabel+".")
+}
+
+/* cutZoneLabel removes the first label of zone, or the one after the CNAME
+label for CNAME targets, if it starts with prefix.  It returns the rest of the
+label, the zone without the label, and whether the label was there. */
+func cutZoneLabel(zone, prefix string) (v, rest string, ok bool) {
+	var pre string
+	if isCNAMETarget(zone) {
+		pre = cnameLabel + "."
+	}
+	first, rest, found := strings.Cut(strings.TrimPrefix(zone, pre), ".")
+	if !found || !strings.HasPrefix(first, prefix) {
+		return "", zone, false
+	}
+	return strings.TrimPrefix(first, prefix), pre + rest, true
+}
+
+/* addAnswer adds rrs to msg as the answer to the query for the file chunk
+named by label in zone.  If we're using CNAMEs, a CNAME to the chunk's name in
+the CNAME subdomain is added as the answer and rrs, with the CNAME's target as
+their name, are added to the additional section.  CNAMEs holding file data are
+always added as the answer.  The rrs should all have the same header. */
+func addAnswer(
+	msg *dnsmessage.Message,
+	label string,
+	zone string,
+	rrs ...dnsmessage.Resource,
+) error {
+	if 0 == len(rrs) {
+		return nil
+	}
+	if "" == cnameLabel || isCNAMETarget(zone) ||
+		dnsmessage.TypeCNAME == rrs[0].Header.Type {
+		msg.Answers = append(msg.Answers, rrs...)
+		return nil
+	}
+
+	/* Point the query at the target */
+	target, err := dnsmessage.NewName(label + "." + cnameLabel + "." + zone)
+	if nil != err {
+		return err
+	}
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  rrs[0].Header.Name,
+			Type:  dnsmessage.TypeCNAME,
+			Class: rrs[0].Header.Class,
+			TTL:   rrs[0].Header.TTL,
+		},
+		Body: &dnsmessage.CNAMEResource{CNAME: target},
+	})
+
+	/* And have the target's answer handy */
+	for _, rr := range rrs {
+		rr.Header.Name = target
+		msg.Additionals = append(msg.Additionals, rr)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+/*
+ * cname_test.go
+ * Tests for CNAME answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleCNAME(t *testing.T) {
+	testServe(t)
+	cnameLabel = "edge"
+	defer func() { cnameLabel = "" }()
+
+	/* Query for the file should get a CNAME */
+	m := testQuery(t, "0-payload.files.example.com.", dnsmessage.TypeA)
+	if nil == m {
+		t.Fatalf("No response")
+	}
+	const target = "0-payload.edge.files.example.com."
+	if 1 != len(m.Answers) {
+		t.Fatalf("Got %d answers", len(m.Answers))
+	}
+	c, ok := m.Answers[0].Body.(*dnsmessage.CNAMEResource)
+	if !ok {
+		t.Fatalf("Got %T answer", m.Answers[0].Body)
+	}
+	if target != c.CNAME.String() {
+		t.Errorf("CNAME to %s", c.CNAME)
+	}
+	if 1 != len(m.Additionals) {
+		t.Fatalf("Got %d additionals", len(m.Additionals))
+	}
+	if target != m.Additionals[0].Header.Name.String() {
+		t.Errorf("Additional for %s", m.Additionals[0].Header.Name)
+	}
+	if a, ok := m.Additionals[0].Body.(*dnsmessage.AResource); !ok {
+		t.Errorf("Got %T additional", m.Additionals[0].Body)
+	} else if "kit" != string(a.A[1:]) {
+		t.Errorf("Got payload %q", a.A[1:])
+	}
+
+	/* Query for the target should get the record */
+	m = testQuery(t, target, dnsmessage.TypeA)
+	if nil == m {
+		t.Fatalf("No response for target")
+	}
+	if 1 != len(m.Answers) {
+		t.Fatalf("Got %d answers for target", len(m.Answers))
+	}
+	if a, ok := m.Answers[0].Body.(*dnsmessage.AResource); !ok {
+		t.Errorf("Got %T answer for target", m.Answers[0].Body)
+	} else if "kit" != string(a.A[1:]) {
+		t.Errorf("Got payload %q for target", a.A[1:])
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+/*
+ * compress.go
+ * Send responses without name compression
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* uncompressedInterval is how often the cost of not compressing is logged */
+const uncompressedInterval = time.Hour
+
+/* noCompression is set by -no-compression to send responses without name
+compression, for middleboxes which mangle compression pointers. */
+var noCompression bool
+
+/* uncompressed counts how many more bytes we've sent than we would have with
+compression. */
+var uncompressed struct {
+	l          sync.Mutex
+	n          uint64 /* Responses */
+	sent       uint64 /* Bytes sent, without compression */
+	compressed uint64 /* Bytes we'd have sent with compression */
+}
+
+/* summarizeUncompressed logs and resets the counts of uncompressed responses
+every interval, if there were any.  It never returns. */
+func summarizeUncompressed(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		uncompressed.l.Lock()
+		n := uncompressed.n
+		sent, comp := uncompressed.sent, uncompressed.compressed
+		uncompressed.n = 0
+		uncompressed.sent, uncompressed.compressed = 0, 0
+		uncompressed.l.Unlock()
+		if 0 == n || 0 == comp {
+			continue
+		}
+		log.Printf(
+			"Sent %d uncompressed responses in the last %s: %d "+
+				"bytes, %d (%.1f%%) more than with compression",
+			n,
+			interval,
+			sent,
+			sent-comp,
+			100*float64(sent-comp)/float64(comp),
+		)
+	}
+}
+
+/* countUncompressed notes that we sent an uncompressed response of n bytes
+which would have been c bytes with compression. */
+func countUncompressed(n, c int) {
+	uncompressed.l.Lock()
+	defer uncompressed.l.Unlock()
+	uncompressed.n++
+	uncompressed.sent += uint64(n)
+	uncompressed.compressed += uint64(c)
+}
+
+/* packUncompressed is like msg.AppendPack(buf[:0]), but doesn't compress
+names. */
+func packUncompressed(
+	msg *dnsmessage.Message,
+	buf []byte,
+) ([]byte, error) {
+	b := dnsmessage.NewBuilder(buf[:0], msg.Header)
+	if err := b.StartQuestions(); nil != err {
+		return nil, err
+	}
+	for _, q := range msg.Questions {
+		if err := b.Question(q); nil != err {
+			return nil, fmt.Errorf("adding question: %w", err)
+		}
+	}
+	for _, s := range []struct {
+		start func() error
+		rs    []dnsmessage.Resource
+	}{
+		{b.StartAnswers, msg.Answers},
+		{b.StartAuthorities, msg.Authorities},
+		{b.StartAdditionals, msg.Additionals},
+	} {
+		if err := s.start(); nil != err {
+			return nil, err
+		}
+		for _, r := range s.rs {
+			if err := addUncompressed(&b, r); nil != err {
+				return nil, fmt.Errorf(
+					"adding %s record: %w",
+					r.Header.Type,
+					err,
+				)
+			}
+		}
+	}
+	return b.Finish()
+}
+
+/* addUncompressed adds r to b.  Builder has no generic way to add a record,
+so we need one case per type we send. */
+func addUncompressed(b *dnsmessage.Builder, r dnsmessage.Resource) error {
+	switch body := r.Body.(type) {
+	case *dnsmessage.AResource:
+		return b.AResource(r.Header, *body)
+	case *dnsmessage.AAAAResource:
+		return b.AAAAResource(r.Header, *body)
+	case *dnsmessage.CNAMEResource:
+		return b.CNAMEResource(r.Header, *body)
+	case *dnsmessage.MXResource:
+		return b.MXResource(r.Header, *body)
+	case *dnsmessage.NSResource:
+		return b.NSResource(r.Header, *body)
+	case *dnsmessage.PTRResource:
+		return b.PTRResource(r.Header, *body)
+	case *dnsmessage.SOAResource:
+		return b.SOAResource(r.Header, *body)
+	case *dnsmessage.SRVResource:
+		return b.SRVResource(r.Header, *body)
+	case *dnsmessage.TXTResource:
+		return b.TXTResource(r.Header, *body)
+	case *dnsmessage.OPTResource:
+		return b.OPTResource(r.Header, *body)
+	case *dnsmessage.UnknownResource:
+		return b.UnknownResource(r.Header, *body)
+	default:
+		return fmt.Errorf("unsupported record body %T", r.Body)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+/*
+ * compress_test.go
+ * Tests for uncompressed responses
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleNoCompression(t *testing.T) {
+	testServe(t)
+	defer func() { zones, soaSerial, noCompression = nil, 0, false }()
+	if err := zones.Set("files.example.com"); nil != err {
+		t.Fatalf("Setting zone: %s", err)
+	}
+	setSOADefaults()
+
+	/* With compression, the name only appears once */
+	qn := "0-payload.files.example.com."
+	m := testQuery(t, qn, dnsmessage.TypeA)
+	if nil == m || 0 == len(m.Answers) {
+		t.Fatalf("Bad response: %v", m)
+	}
+	wn := []byte("\x090-payload\x05files\x07example\x03com\x00")
+	cp, err := packResponse(m, nil)
+	if nil != err {
+		t.Fatalf("Packing compressed response: %s", err)
+	}
+	if n := bytes.Count(cp, wn); 1 != n {
+		t.Errorf("Name appears %d times in compressed response", n)
+	}
+
+	/* Without, it's in every record */
+	noCompression = true
+	up, err := packResponse(m, nil)
+	if nil != err {
+		t.Fatalf("Packing uncompressed response: %s", err)
+	}
+	if n := bytes.Count(up, wn); 1+len(m.Answers) != n {
+		t.Errorf(
+			"Name appears %d times in uncompressed response "+
+				"with %d answers",
+			n,
+			len(m.Answers),
+		)
+	}
+	if len(up) <= len(cp) {
+		t.Errorf(
+			"Uncompressed response %d bytes, compressed %d",
+			len(up),
+			len(cp),
+		)
+	}
+
+	/* And the whole thing still works */
+	for _, qt := range []dnsmessage.Type{
+		dnsmessage.TypeA,
+		dnsmessage.TypeTXT,
+		dnsmessage.TypeCNAME,
+		dnsmessage.TypeMX,
+		dnsmessage.TypeSRV,
+		answer.TypeNULL,
+	} {
+		m := testExchange(t, testMessage(qn, qt))
+		if nil == m || 0 == len(m.Answers) {
+			t.Errorf("Bad uncompressed %s response: %v", qt, m)
+		}
+	}
+	m = testQuery(t, "z-payload.files.example.com.", dnsmessage.TypeA)
+	if nil == m || 1 != len(m.Authorities) {
+		t.Errorf("Bad uncompressed negative response: %v", m)
+	}
+}
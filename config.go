@@ -0,0 +1,290 @@
+package main
+
+/*
+ * config.go
+ * Read flags from a config file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+/* configFile is the TOML file from which settings are read, if set with
+-config */
+var configFile string
+
+/* reloadableFlags are the flags which may be changed by reloading the config
+file.  Listeners and the like can't be changed without a restart.  These are
+only read with configL held, usually via currentSettings. */
+var reloadableFlags = map[string]bool{
+	"allow":        true,
+	"decoy-dir":    true,
+	"deny":         true,
+	"dir":          true,
+	"ttl":          true,
+	"unauthorized": true,
+}
+
+var (
+	/* configL is held for reading while copying the reloadable settings
+	and for writing while reloading the config file */
+	configL sync.RWMutex
+
+	/* configCLI are the flags set on the command line, which the config
+	file can't change */
+	configCLI map[string]bool
+
+	/* lastConfig is the config from the last time the config file was
+	read, to tell what's changed */
+	lastConfig map[string][]string
+)
+
+/* settings holds the reloadable settings needed to answer a query.  Queries
+are answered with a copy made when they arrive, so settings don't change
+mid-query and reloads don't wait on queries being delayed or throttled. */
+type settings struct {
+	ttl      uint
+	fdir     string
+	decoyDir string
+	allow    prefixList
+	deny     prefixList
+	unauth   geoAction /* -unauthorized */
+}
+
+/* currentSettings returns a copy of the reloadable settings. */
+func currentSettings() settings {
+	configL.RLock()
+	defer configL.RUnlock()
+	return liveSettings()
+}
+
+/* liveSettings returns a copy of the reloadable settings.  configL must be
+held. */
+func liveSettings() settings {
+	return settings{
+		ttl:      ttl,
+		fdir:     fdir,
+		decoyDir: decoyDir,
+		allow:    allowNets,
+		deny:     denyNets,
+		unauth:   aclAction,
+	}
+}
+
+/* flagSet returns a FlagSet with the reloadable flags, which set s's fields
+instead of the live settings. */
+func (s *settings) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.UintVar(&s.ttl, "ttl", s.ttl, "")
+	fs.StringVar(&s.fdir, "dir", s.fdir, "")
+	fs.StringVar(&s.decoyDir, "decoy-dir", s.decoyDir, "")
+	fs.Var(&s.allow, "allow", "")
+	fs.Var(&s.deny, "deny", "")
+	fs.Func("unauthorized", "", func(v string) error {
+		act, err := parseACLAction(v)
+		if nil != err {
+			return err
+		}
+		s.unauth = act
+		return nil
+	})
+	return fs
+}
+
+/* reset sets the setting for the flag named name in s back to what it would
+be without a config file, which is the default from fs or the profile's TTL.
+Flags set on the command line aren't reloaded, so needn't be considered. */
+func (s *settings) reset(fs *flag.FlagSet, name string) {
+	switch name {
+	case "ttl":
+		if nil != prof {
+			s.ttl = prof.ttl
+			return
+		}
+		n, _ := strconv.ParseUint(
+			fs.Lookup(name).DefValue,
+			0,
+			strconv.IntSize,
+		)
+		s.ttl = uint(n)
+	case "dir":
+		s.fdir = fs.Lookup(name).DefValue
+	case "decoy-dir":
+		s.decoyDir = fs.Lookup(name).DefValue
+	case "allow":
+		s.allow = nil
+	case "deny":
+		s.deny = nil
+	case "unauthorized":
+		s.unauth = geoRefuse
+	}
+}
+
+/* loadConfig reads the TOML config file fn.  Each key is the name of a flag in
+fs and each value is a string, number, boolean, or, for flags which may be
+given more than once, an array of them. */
+func loadConfig(fs *flag.FlagSet, fn string) (map[string][]string, error) {
+	var m map[string]any
+	if _, err := toml.DecodeFile(fn, &m); nil != err {
+		return nil, err
+	}
+	cfg := make(map[string][]string, len(m))
+	for k, v := range m {
+		if nil == fs.Lookup(k) || "config" == k {
+			return nil, fmt.Errorf("unknown setting %q", k)
+		}
+		vs, ok := v.([]any)
+		if !ok {
+			vs = []any{v}
+		}
+		for _, v := range vs {
+			s, err := configString(v)
+			if nil != err {
+				return nil, fmt.Errorf("setting %q: %w", k, err)
+			}
+			cfg[k] = append(cfg[k], s)
+		}
+	}
+	return cfg, nil
+}
+
+/* configString returns v, a value from a config file, as it would be given on
+the command line. */
+func configString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+/* setConfigFlag sets the flag in fs named name to vs, the way it would be
+set with the flag given once for each of vs. */
+func setConfigFlag(fs *flag.FlagSet, name string, vs []string) error {
+	for _, v := range vs {
+		if err := fs.Set(name, v); nil != err {
+			return fmt.Errorf("setting %q to %q: %w", name, v, err)
+		}
+	}
+	return nil
+}
+
+/* startConfig sets the flags in fs which weren't set on the command line from
+configFile. */
+func startConfig(fs *flag.FlagSet) error {
+	configCLI = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { configCLI[f.Name] = true })
+	cfg, err := loadConfig(fs, configFile)
+	if nil != err {
+		return err
+	}
+	for _, k := range sortedKeys(cfg) {
+		if configCLI[k] {
+			continue
+		}
+		if err := setConfigFlag(fs, k, cfg[k]); nil != err {
+			return err
+		}
+	}
+	lastConfig = cfg
+	return nil
+}
+
+/* reloadConfig re-reads configFile and updates the reloadable flags in fs
+which weren't set on the command line.  Reloadable settings which are no
+longer in the config file go back to their defaults, or for -ttl, the
+profile's TTL.  Changes to other settings are logged and otherwise ignored.  If
+the config file can't be read or any of the changed settings are invalid,
+nothing changes. */
+func reloadConfig(fs *flag.FlagSet) error {
+	cfg, err := loadConfig(fs, configFile)
+	if nil != err {
+		return err
+	}
+
+	/* Work out what's changed */
+	var changed []string
+	for k := range reloadableFlags {
+		if configCLI[k] || slices.Equal(lastConfig[k], cfg[k]) {
+			continue
+		}
+		changed = append(changed, k)
+	}
+	sort.Strings(changed)
+	var restart []string
+	for k := range cfg {
+		if !reloadableFlags[k] && !slices.Equal(lastConfig[k], cfg[k]) {
+			restart = append(restart, k)
+		}
+	}
+	for k := range lastConfig {
+		if _, ok := cfg[k]; !ok && !reloadableFlags[k] {
+			restart = append(restart, k)
+		}
+	}
+	sort.Strings(restart)
+	for _, k := range restart {
+		log.Printf("Not changing -%s without a restart", k)
+	}
+
+	/* Work out the new settings, but only use them if they all work, so
+	a typo doesn't leave us serving files to everybody */
+	configL.Lock()
+	defer configL.Unlock()
+	ns := liveSettings()
+	nfs := ns.flagSet()
+	var errs []error
+	for _, k := range changed {
+		ns.reset(fs, k)
+		if err := setConfigFlag(nfs, k, cfg[k]); nil != err {
+			errs = append(errs, err)
+		}
+	}
+	if nil != errs {
+		return errors.Join(errs...)
+	}
+
+	/* Change it */
+	ttl, fdir, decoyDir = ns.ttl, ns.fdir, ns.decoyDir
+	allowNets, denyNets, aclAction = ns.allow, ns.deny, ns.unauth
+	lastConfig = cfg
+	for _, k := range changed {
+		if vs, ok := cfg[k]; ok {
+			log.Printf("Set -%s to %q", k, vs)
+		} else {
+			log.Printf("Reset -%s", k)
+		}
+	}
+	return nil
+}
+
+/* sortedKeys returns m's keys, sorted. */
+func sortedKeys(m map[string][]string) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
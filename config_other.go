@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+/*
+ * config_other.go
+ * No SIGHUP to reload the config file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "flag"
+
+/* watchConfigSignal is a no-op, as there's no SIGHUP. */
+func watchConfigSignal(fs *flag.FlagSet) {}
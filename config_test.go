@@ -0,0 +1,194 @@
+package main
+
+/*
+ * config_test.go
+ * Tests for config file handling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleConfigLock(t *testing.T) {
+	testServe(t)
+	delayMin, delayMax = 300*time.Millisecond, 300*time.Millisecond
+	defer func() { delayMin, delayMax = 0, 0 }()
+
+	/* Start a query which will be delayed */
+	m := testMessage("0-payload.files.example.com.", dnsmessage.TypeA)
+	buf := make([]byte, netbuflen)
+	b, err := m.AppendPack(buf[:0])
+	if nil != err {
+		t.Fatalf("Packing query: %s", err)
+	}
+	pc := testResponder{out: make(chan []byte, 1)}
+	go handle(pc, testAddr, buf, len(b))
+	time.Sleep(50 * time.Millisecond)
+
+	/* Reloading shouldn't have to wait for it */
+	start := time.Now()
+	configL.Lock()
+	configL.Unlock()
+	if d := time.Since(start); 100*time.Millisecond < d {
+		t.Errorf("Waited %s for a delayed query", d)
+	}
+	select {
+	case <-pc.out:
+	case <-time.After(time.Second):
+		t.Errorf("No response")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	/* Settings we'll change */
+	ottl, odir, oallow, oact := ttl, fdir, allowNets, aclAction
+	defer func() {
+		ttl, fdir, allowNets, aclAction = ottl, odir, oallow, oact
+		configFile, configCLI, lastConfig = "", nil, nil
+	}()
+	allowNets = nil
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.UintVar(&ttl, "ttl", 1800, "")
+	fs.StringVar(&fdir, "dir", "fserv", "")
+	fs.Var(&allowNets, "allow", "")
+	fs.Func("unauthorized", "", setACLAction)
+	listen := fs.String("listen", "127.0.0.1:5353", "")
+	if err := fs.Parse([]string{"-dir", "cli"}); nil != err {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	configFile = filepath.Join(t.TempDir(), "dnsfserv.toml")
+	write := func(s string) {
+		if err := ioutil.WriteFile(
+			configFile,
+			[]byte(s),
+			0600,
+		); nil != err {
+			t.Fatalf("Writing config file: %s", err)
+		}
+	}
+
+	/* The command line wins */
+	write(`ttl = 60
+dir = "files"
+allow = ["192.0.2.0/24", "198.51.100.1"]
+listen = "127.0.0.1:53"
+`)
+	if err := startConfig(fs); nil != err {
+		t.Fatalf("Reading config: %s", err)
+	}
+	if 60 != ttl {
+		t.Errorf("TTL %d after start", ttl)
+	}
+	if "cli" != fdir {
+		t.Errorf("Directory %q after start", fdir)
+	}
+	if want := "192.0.2.0/24,198.51.100.1/32"; want != allowNets.String() {
+		t.Errorf("Allowed %q after start", allowNets.String())
+	}
+	if "127.0.0.1:53" != *listen {
+		t.Errorf("Listen address %q after start", *listen)
+	}
+
+	/* Reloads change what they can, and removed settings go back to their
+	defaults */
+	write(`dir = "other"
+allow = "203.0.113.0/24"
+unauthorized = "decoy"
+listen = "127.0.0.1:54"
+`)
+	if err := reloadConfig(fs); nil != err {
+		t.Fatalf("Reloading config: %s", err)
+	}
+	if 1800 != ttl {
+		t.Errorf("TTL %d after reload", ttl)
+	}
+	if "cli" != fdir {
+		t.Errorf("Directory %q after reload", fdir)
+	}
+	if want := "203.0.113.0/24"; want != allowNets.String() {
+		t.Errorf("Allowed %q after reload", allowNets.String())
+	}
+	if geoDecoy != aclAction {
+		t.Errorf("Unauthorized action %s after reload", aclAction)
+	}
+	if "127.0.0.1:53" != *listen {
+		t.Errorf("Listen address %q after reload", *listen)
+	}
+
+	/* Bad config files change nothing */
+	for _, c := range []string{
+		"ttl = ",
+		"kittens = 3",
+		"ttl = [[1]]",
+		"[table]\nttl = 3",
+	} {
+		write("ttl = 5\n" + c)
+		if err := reloadConfig(fs); nil == err {
+			t.Errorf("No error reloading %q", c)
+		}
+		if 1800 != ttl {
+			t.Errorf("TTL %d after reloading %q", ttl, c)
+		}
+	}
+
+	/* As do bad settings, even with good ones, until they're fixed */
+	write(`ttl = 5
+allow = ["198.51.100.0/24", "10.0.0.0/88"]
+`)
+	for i := 0; i < 2; i++ {
+		if err := reloadConfig(fs); nil == err {
+			t.Errorf("No error with bad -allow (try %d)", i)
+		}
+		if want := "203.0.113.0/24"; want != allowNets.String() {
+			t.Errorf(
+				"Allowed %q after bad -allow",
+				allowNets.String(),
+			)
+		}
+		if 1800 != ttl || geoDecoy != aclAction {
+			t.Errorf(
+				"TTL %d, unauthorized action %s after "+
+					"bad -allow",
+				ttl,
+				aclAction,
+			)
+		}
+	}
+	write(`ttl = 5
+allow = ["198.51.100.0/24", "10.0.0.0/8"]
+`)
+	if err := reloadConfig(fs); nil != err {
+		t.Fatalf("Reloading fixed config: %s", err)
+	}
+	if want := "198.51.100.0/24,10.0.0.0/8"; want != allowNets.String() {
+		t.Errorf("Allowed %q after fix", allowNets.String())
+	}
+	if 5 != ttl || geoRefuse != aclAction {
+		t.Errorf(
+			"TTL %d, unauthorized action %s after fix",
+			ttl,
+			aclAction,
+		)
+	}
+
+	/* A removed TTL goes back to the profile's */
+	prof = &profile{ttl: 300}
+	defer func() { prof = nil }()
+	write("")
+	if err := reloadConfig(fs); nil != err {
+		t.Fatalf("Reloading without TTL: %s", err)
+	}
+	if 300 != ttl {
+		t.Errorf("TTL %d without TTL in config, want profile's", ttl)
+	}
+}
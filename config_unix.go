@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+/*
+ * config_unix.go
+ * Reload the config file with SIGHUP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/* watchConfigSignal reloads the config file into fs every time we get a
+SIGHUP. */
+func watchConfigSignal(fs *flag.FlagSet) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := reloadConfig(fs); nil != err {
+			log.Printf("Error reloading %s: %s", configFile, err)
+			continue
+		}
+		log.Printf("Reloaded %s", configFile)
+	}
+}
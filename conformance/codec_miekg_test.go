@@ -0,0 +1,17 @@
+//go:build miekg
+
+package conformance_test
+
+/*
+ * codec_miekg_test.go
+ * Also test with MiekgCodec
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "github.com/magisterquis/dnsfserv/dnsfservget"
+
+func init() {
+	codecs["miekg"] = dnsfservget.MiekgCodec{}
+}
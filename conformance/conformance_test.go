@@ -0,0 +1,366 @@
+package conformance_test
+
+/*
+ * conformance_test.go
+ * Get files from a real dnsfserv with a real Getter
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+const (
+	/* domain is the domain for which the server serves files */
+	domain = "example.com"
+
+	/* startWait is how long to wait for the server to start */
+	startWait = 10 * time.Second
+
+	/* authKey is the key for queries to a server started with
+	-auth-key */
+	authKey = "kittens"
+)
+
+/* codecs are the Codecs with which to test.  More may be added by files with
+build tags. */
+var codecs = map[string]dnsfservget.Codec{
+	"dnsmessage": dnsfservget.DNSMessageCodec{},
+}
+
+/* qtypes are the QTypes with which to test */
+var qtypes = []dnsfservget.QType{
+	dnsfservget.TypeA,
+	dnsfservget.TypeAAAA,
+	dnsfservget.TypeTXT,
+	dnsfservget.TypeNULL,
+	dnsfservget.TypeCNAME,
+	dnsfservget.TypeMX,
+	dnsfservget.TypeSRV,
+	dnsfservget.TypeBigTXT,
+	dnsfservget.TypeMultiA,
+	dnsfservget.TypeMultiAAAA,
+}
+
+/* noDatas are the NoDataPolicies with which to test */
+var noDatas = []dnsfservget.NoDataPolicy{
+	dnsfservget.FailOnNoData,
+	dnsfservget.RetryOnNoData,
+	dnsfservget.EOFOnNoData,
+}
+
+/* option is a Getter option which changes what goes over the wire, and any
+flags the server needs to go with it */
+type option struct {
+	name  string
+	flags []string /* Extra flags for the server */
+	meta  bool     /* Only test with UseMeta */
+	set   func(g *dnsfservget.Getter)
+}
+
+/* options are the Getter options with which to test, each on its own */
+var options = []option{{
+	name: "meta",
+	meta: true,
+}, {
+	/* Past the end of the file, A and AAAA chunks don't decrypt to
+	NULs, so we need the file's size. */
+	name: "handshake",
+	meta: true,
+	set:  func(g *dnsfservget.Getter) { g.Handshake = true },
+}, {
+	name:  "key",
+	flags: []string{"-auth-key", authKey},
+	set:   func(g *dnsfservget.Getter) { g.Key = []byte(authKey) },
+}, {
+	name: "sequence",
+	set:  func(g *dnsfservget.Getter) { g.Sequence = true },
+}, {
+	name: "pad",
+	set:  func(g *dnsfservget.Getter) { g.Pad = true },
+}, {
+	name: "verify",
+	set:  func(g *dnsfservget.Getter) { g.VerifyEvery = 4 },
+}, {
+	name:  "nonce",
+	flags: []string{"-nonce-cache", "65536"},
+	set:   func(g *dnsfservget.Getter) { g.Nonce = true },
+}}
+
+/* server is a running dnsfserv */
+type server struct {
+	dns string /* UDP and TCP address */
+	doh string /* DoH URL */
+}
+
+/* transport makes a Querier which talks to a server */
+type transport struct {
+	name string
+	new  func(t *testing.T, s server) dnsfservget.Querier
+}
+
+/* transports are the ways we talk to the server */
+var transports = []transport{{
+	name: "udp",
+	new: func(t *testing.T, s server) dnsfservget.Querier {
+		q, err := dnsfservget.UDPQuerier(dnsfservget.UDPConfig{
+			Server: s.dns,
+		})
+		if nil != err {
+			t.Fatalf("Making UDP querier: %s", err)
+		}
+		return q
+	},
+}, {
+	name: "tcp",
+	new: func(t *testing.T, s server) dnsfservget.Querier {
+		c, err := net.Dial("tcp", s.dns)
+		if nil != err {
+			t.Fatalf("Connecting to %s: %s", s.dns, err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return dnsfservget.NewStreamQuerier(c)
+	},
+}, {
+	name: "doh",
+	new: func(t *testing.T, s server) dnsfservget.Querier {
+		return dnsfservget.DOHQuerier(dnsfservget.DOHConfig{URL: s.doh})
+	},
+}}
+
+/* freePort returns a loopback address with a port which was free for both
+UDP and TCP a moment ago. */
+func freePort(t *testing.T) string {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatalf("Finding a free port: %s", err)
+		}
+		a := l.Addr().String()
+		l.Close()
+		pc, err := net.ListenPacket("udp", a)
+		if nil != err {
+			continue
+		}
+		pc.Close()
+		return a
+	}
+	t.Fatalf("Unable to find a free port")
+	return ""
+}
+
+/* buildServer builds dnsfserv and returns the path to the binary. */
+func buildServer(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "dnsfserv")
+	if out, err := exec.Command(
+		"go",
+		"build",
+		"-o", bin,
+		"..",
+	).CombinedOutput(); nil != err {
+		t.Fatalf("Building dnsfserv: %s\n%s", err, out)
+	}
+	return bin
+}
+
+/* startServer starts the dnsfserv at bin serving files from dir, with the
+flags o needs. */
+func startServer(t *testing.T, bin, dir string, o option) server {
+	t.Helper()
+
+	/* Start it going */
+	s := server{dns: freePort(t)}
+	dohAddr := freePort(t)
+	s.doh = "http://" + dohAddr + "/dns-query"
+	cmd := exec.Command(
+		bin,
+		"-listen", s.dns,
+		"-listen-tcp", s.dns,
+		"-listen-doh", dohAddr,
+		"-dir", dir,
+		"-domain", domain,
+		"-enable-types", "A,AAAA,TXT,NULL,CNAME,MX,SRV",
+	)
+	cmd.Args = append(cmd.Args, o.flags...)
+	if err := cmd.Start(); nil != err {
+		t.Fatalf("Starting dnsfserv: %s", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	/* Wait for it to be ready */
+	q := transports[0].new(t, s)
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeTXT,
+		Name:    "payload",
+		Domain:  domain,
+		Querier: q,
+	}
+	if nil != o.set {
+		o.set(&g)
+	}
+	start := time.Now()
+	for {
+		_, err := g.Meta()
+		if nil == err {
+			return s
+		}
+		if time.Since(start) > startWait {
+			t.Fatalf("Server not ready after %s: %s", startWait, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping conformance tests in short mode")
+	}
+
+	/* A file which needs a few chunks of every type */
+	dir := t.TempDir()
+	file := make([]byte, 2000)
+	for i := range file {
+		file[i] = byte(i*7 + i/256)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, "payload"),
+		file,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+	bin := buildServer(t)
+	s := startServer(t, bin, dir, option{})
+
+	/* Options which need flags need their own servers */
+	servers := map[string]server{"": s}
+	for _, o := range options {
+		k := strings.Join(o.flags, " ")
+		if _, ok := servers[k]; !ok {
+			servers[k] = startServer(t, bin, dir, o)
+		}
+	}
+
+	defer func(c dnsfservget.Codec) { dnsfservget.DefaultCodec = c }(
+		dnsfservget.DefaultCodec,
+	)
+	for cn, c := range codecs {
+		dnsfservget.DefaultCodec = c
+		for _, tr := range transports {
+			for _, qt := range qtypes {
+				for _, nd := range noDatas {
+					t.Run(fmt.Sprintf(
+						"%s/%s/%s/%s",
+						cn,
+						tr.name,
+						qt,
+						nd,
+					), func(t *testing.T) {
+						testGet(
+							t,
+							tr.new(t, s),
+							qt,
+							nd,
+							option{},
+							file,
+						)
+					})
+				}
+				for _, o := range options {
+					srv := servers[strings.Join(
+						o.flags,
+						" ",
+					)]
+					t.Run(fmt.Sprintf(
+						"%s/%s/%s/%s",
+						cn,
+						tr.name,
+						qt,
+						o.name,
+					), func(t *testing.T) {
+						testGet(
+							t,
+							tr.new(t, srv),
+							qt,
+							dnsfservget.FailOnNoData,
+							o,
+							file,
+						)
+					})
+				}
+			}
+		}
+	}
+}
+
+/* testGet gets the file with q in records of type qt, with o, and checks it's
+want. */
+func testGet(
+	t *testing.T,
+	q dnsfservget.Querier,
+	qt dnsfservget.QType,
+	nd dnsfservget.NoDataPolicy,
+	o option,
+	want []byte,
+) {
+	metas := []bool{false, true}
+	if o.meta {
+		metas = []bool{true}
+	}
+	for _, meta := range metas {
+		g := dnsfservget.Getter{
+			Type:    qt,
+			Name:    "payload",
+			Domain:  domain,
+			Querier: q,
+			UseMeta: meta,
+			NoData:  nd,
+		}
+		if nil != o.set {
+			o.set(&g)
+		}
+		got, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			t.Errorf("Get (meta:%t): %s", meta, err)
+			continue
+		}
+		/* Without metadata, the last chunk may be padded */
+		if !meta {
+			got = bytes.TrimRight(got, "\x00")
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf(
+				"Get (meta:%t): got %d bytes, want %d",
+				meta,
+				len(got),
+				len(want),
+			)
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("go"); nil != err {
+		fmt.Fprintf(os.Stderr, "Conformance tests need the go tool\n")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,24 @@
+// Package conformance holds tests which run dnsfserv against dnsfservget's
+// Getter, to catch the two drifting apart.
+//
+// The tests build dnsfserv from the parent directory with the go tool, start
+// it listening on the loopback interface, and get a file with every QType,
+// over every transport, with every NoDataPolicy and Codec.  Each QType is also
+// tried over every transport with each of the Getter's options which change
+// what's sent, such as Handshake, Key, Sequence, Pad, VerifyEvery, UseMeta,
+// and Nonce, against a server started with whatever flags the option needs.
+// They also get a file from the test vectors written by dnsfserv's vectors
+// command, with nothing but the vectors to answer queries.  Run them with
+//
+//	go test ./conformance/...
+//
+// and add -tags miekg to include MiekgCodec.
+package conformance
+
+/*
+ * doc.go
+ * Client/server conformance tests
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
@@ -0,0 +1,176 @@
+package conformance_test
+
+/*
+ * vectors_test.go
+ * Get files using dnsfserv's test vectors
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* vectorSize is the size of the file described by the vectors */
+const vectorSize = 1000
+
+/* vector is a line of output from dnsfserv vectors */
+type vector struct {
+	Type     dnsfservget.QType `json:"type"`
+	Offset   uint64            `json:"offset"`
+	Name     string            `json:"name"`
+	Query    string            `json:"query"`
+	Response string            `json:"response"`
+	Payload  string            `json:"payload"`
+}
+
+/* vectorKey identifies a vector by the name and type of its query */
+type vectorKey struct {
+	name  string
+	rtype dnsmessage.Type
+}
+
+/* vectorStream answers length-prefixed queries with the responses from
+vectors, as though it were a DNS over TCP connection to dnsfserv. */
+type vectorStream struct {
+	t    *testing.T
+	vs   map[vectorKey][]byte
+	resp bytes.Buffer
+}
+
+/* Write reads a query and queues the vector's response to it, with the query's
+ID.  Queries without a vector get a SERVFAIL. */
+func (s *vectorStream) Write(b []byte) (int, error) {
+	var m dnsmessage.Message
+	if 2 > len(b) {
+		return 0, fmt.Errorf("short query")
+	}
+	if err := m.Unpack(b[2:]); nil != err {
+		return 0, fmt.Errorf("unpacking query: %w", err)
+	}
+	q := m.Questions[0]
+	r, ok := s.vs[vectorKey{strings.ToLower(q.Name.String()), q.Type}]
+	if !ok {
+		s.t.Errorf("No vector for %s %s", q.Name, q.Type)
+		m.Header.Response = true
+		m.Header.RCode = dnsmessage.RCodeServerFailure
+		var err error
+		if r, err = m.Pack(); nil != err {
+			return 0, err
+		}
+	}
+	r = append([]byte(nil), r...)
+	binary.BigEndian.PutUint16(r, m.Header.ID)
+	binary.Write(&s.resp, binary.BigEndian, uint16(len(r)))
+	s.resp.Write(r)
+	return len(b), nil
+}
+
+/* Read reads queued responses. */
+func (s *vectorStream) Read(b []byte) (int, error) { return s.resp.Read(b) }
+
+func TestVectors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping conformance tests in short mode")
+	}
+
+	/* Get the vectors */
+	out, err := exec.Command(
+		buildServer(t),
+		"vectors",
+		"-domain", domain,
+		"-size", fmt.Sprint(vectorSize),
+		"-sequence",
+	).Output()
+	if nil != err {
+		t.Fatalf("Getting vectors: %s", err)
+	}
+	file := dnsfservget.CheckPattern(vectorSize)
+	vs := make(map[dnsfservget.QType]map[vectorKey][]byte)
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var v vector
+		if err := json.Unmarshal(s.Bytes(), &v); nil != err {
+			t.Fatalf("Parsing vector %q: %s", s.Text(), err)
+		}
+		/* Make sure the vector makes sense */
+		p, err := hex.DecodeString(v.Payload)
+		if nil != err {
+			t.Fatalf("Decoding payload for %s: %s", v.Name, err)
+		}
+		switch {
+		case 0 == len(p) && uint64(len(file)) > v.Offset:
+			t.Errorf("Empty payload for %s", v.Name)
+		case 0 != len(p) && !bytes.Equal(
+			file[v.Offset:v.Offset+uint64(len(p))],
+			p,
+		):
+			t.Errorf("Payload for %s isn't the file's", v.Name)
+		}
+		q, err := hex.DecodeString(v.Query)
+		if nil != err {
+			t.Fatalf("Decoding query for %s: %s", v.Name, err)
+		}
+		var m dnsmessage.Message
+		if err := m.Unpack(q); nil != err {
+			t.Fatalf("Unpacking query for %s: %s", v.Name, err)
+		}
+		if got := m.Questions[0].Name.String(); got != v.Name {
+			t.Errorf("Query for %s is for %s", v.Name, got)
+		}
+		r, err := hex.DecodeString(v.Response)
+		if nil != err {
+			t.Fatalf("Decoding response for %s: %s", v.Name, err)
+		}
+		if nil == vs[v.Type] {
+			vs[v.Type] = make(map[vectorKey][]byte)
+		}
+		vs[v.Type][vectorKey{v.Name, m.Questions[0].Type}] = r
+	}
+	if err := s.Err(); nil != err {
+		t.Fatalf("Reading vectors: %s", err)
+	}
+
+	/* A Getter should be able to get the file from the vectors alone */
+	for _, qt := range qtypes {
+		qt := qt
+		t.Run(string(qt), func(t *testing.T) {
+			if 0 == len(vs[qt]) {
+				t.Fatalf("No vectors")
+			}
+			g := dnsfservget.Getter{
+				Type:   qt,
+				Name:   "payload",
+				Domain: domain,
+				Querier: dnsfservget.NewStreamQuerier(
+					&vectorStream{t: t, vs: vs[qt]},
+				),
+				Sequence: true,
+			}
+			got, err := ioutil.ReadAll(g.Get())
+			if nil != err {
+				t.Fatalf("Get: %s", err)
+			}
+			if !bytes.Equal(file, bytes.TrimRight(got, "\x00")) {
+				t.Errorf(
+					"Got %d bytes, want %d",
+					len(got),
+					len(file),
+				)
+			}
+		})
+	}
+}
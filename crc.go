@@ -0,0 +1,139 @@
+package main
+
+/*
+ * crc.go
+ * Serve checksums of parts of files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	/* crcLabel replaces the offset in queries for the checksum of part of
+	a file.  Like metaLabel, it's not valid base36. */
+	crcLabel = "_crc"
+
+	/* crcMax is the most bytes we'll checksum for one query */
+	crcMax = 1 << 20
+)
+
+/* parseCRCQuery parses the part of a checksum query after the label, which
+is of the form offset-length-filename, with offset and length in base36. */
+func parseCRCQuery(s string) (off, l uint64, fname string, err error) {
+	parts := strings.SplitN(s, "-", 3)
+	if 3 != len(parts) {
+		return 0, 0, "", errors.New("badly-formatted checksum query")
+	}
+	if off, err = strconv.ParseUint(parts[0], 36, 64); nil != err {
+		return 0, 0, "", fmt.Errorf("parsing offset: %w", err)
+	}
+	if l, err = strconv.ParseUint(parts[1], 36, 64); nil != err {
+		return 0, 0, "", fmt.Errorf("parsing length: %w", err)
+	}
+	if crcMax < l {
+		return 0, 0, "", fmt.Errorf("length %d too large", l)
+	}
+	return off, l, parts[2], nil
+}
+
+/* sendCRC responds to the query in msg, which came from addr via pc, with the
+CRC32 of the l bytes starting at off in the file named fname.  Bytes past the
+end of the file are treated as NULs, as they are in A and AAAA records.  The
+buffer buf is used to send the response, whose answer has a TTL of rttl.  Only
+TXT queries get an answer. */
+func sendCRC(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	fname string,
+	off uint64,
+	l uint64,
+	rttl uint32,
+) {
+	la := logAddr(addr)
+	if dnsmessage.TypeTXT != msg.Questions[0].Type {
+		log.Printf(
+			"[%s] Unsupported %s checksum request for %q",
+			la,
+			msg.Questions[0].Type,
+			q,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrNeedsTXT)
+		return
+	}
+
+	/* Checksum the requested bytes */
+	c, err := fileCRC(fname, off, l)
+	if nil != err {
+		log.Printf(
+			"[%s] Error checksumming %d bytes at offset %d "+
+				"of %s for %q: %s",
+			la,
+			l,
+			off,
+			fname,
+			q,
+			err,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrCRC)
+		return
+	}
+
+	/* Send it back */
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+			TTL:   rttl,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{answer.CRCTXT(c)}},
+	})
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending checksum: %s", la, err)
+		return
+	}
+	log.Printf(
+		"[%s] Sent checksum for %d bytes at offset %d of %s for %s",
+		la,
+		l,
+		off,
+		fname,
+		q,
+	)
+}
+
+/* fileCRC returns the CRC32 of the l bytes starting at off in the file named
+fname, with NULs past the end of the file. */
+func fileCRC(fname string, off, l uint64) (uint32, error) {
+	f, err := openFile(fname)
+	if nil != err {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, io.NewSectionReader(f, int64(off), int64(l)))
+	if nil != err {
+		return 0, err
+	}
+	if _, err := h.Write(make([]byte, l-uint64(n))); nil != err {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+/*
+ * crosstype.go
+ * Answer and count queries for files in types we don't serve
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* crossTypeInterval is how often cross-type query counts are logged */
+const crossTypeInterval = time.Hour
+
+/* crossTypeKey identifies a client asking with a type we don't serve */
+type crossTypeKey struct {
+	client string
+	qtype  dnsmessage.Type
+}
+
+/* crossTypeCounter counts queries for files with types in which we don't
+serve files, such as A queries from dual-stack clients when only AAAA is
+enabled, so misconfigured clients are visible. */
+type crossTypeCounter struct {
+	l    sync.Mutex
+	n    map[dnsmessage.Type]uint64
+	seen map[crossTypeKey]bool /* Clients we've logged since the summary */
+}
+
+/* crossTypes counts cross-type queries */
+var crossTypes = crossTypeCounter{
+	n:    make(map[dnsmessage.Type]uint64),
+	seen: make(map[crossTypeKey]bool),
+}
+
+/* count counts a query from client of type qtype.  It returns true the first
+time client's used qtype since the last summary. */
+func (c *crossTypeCounter) count(client string, qtype dnsmessage.Type) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.n[qtype]++
+	k := crossTypeKey{client: client, qtype: qtype}
+	if c.seen[k] {
+		return false
+	}
+	c.seen[k] = true
+	return true
+}
+
+/* summarize logs and resets the counts of cross-type queries every interval,
+if there were any.  It never returns. */
+func (c *crossTypeCounter) summarize(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.l.Lock()
+		var ss []string
+		for t, n := range c.n {
+			ss = append(ss, fmt.Sprintf("%s=%d", t, n))
+		}
+		c.n = make(map[dnsmessage.Type]uint64)
+		c.seen = make(map[crossTypeKey]bool)
+		c.l.Unlock()
+		if 0 == len(ss) {
+			continue
+		}
+		sort.Strings(ss)
+		log.Printf(
+			"Cross-type queries in the last %s: %s",
+			interval,
+			strings.Join(ss, " "),
+		)
+	}
+}
+
+/* sendCrossType sends an empty response to a query for the file named fname
+in msg with a type in which we don't serve files, and counts it. */
+func sendCrossType(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	fname string,
+) {
+	qtype := msg.Questions[0].Type
+	if crossTypes.count(campaignClient(addr), qtype) {
+		log.Printf(
+			"[%s] Got %s query for %s, which isn't served with %s; "+
+				"misconfigured client?",
+			logAddr(addr),
+			qtype,
+			fname,
+			qtype,
+		)
+	}
+	sendNoData(pc, addr, buf, msg, q)
+}
@@ -0,0 +1,57 @@
+package main
+
+/*
+ * crosstype_test.go
+ * Tests for cross-type answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleCrossType(t *testing.T) {
+	testServe(t)
+	if err := setEnabledTypes("AAAA"); nil != err {
+		t.Fatalf("setEnabledTypes: %s", err)
+	}
+	defer func() { enabledTypes = nil }()
+
+	/* Types we won't serve get an empty response, even past the end of
+	the file, and are counted */
+	for _, c := range []struct {
+		name  string
+		qtype dnsmessage.Type
+	}{
+		{"0-payload.files.example.com.", dnsmessage.TypeA},
+		{"0-payload.files.example.com.", dnsmessage.TypeHINFO},
+		{"zz-payload.files.example.com.", dnsmessage.TypeHINFO},
+	} {
+		crossTypes.l.Lock()
+		before := crossTypes.n[c.qtype]
+		crossTypes.l.Unlock()
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Fatalf("%s %s: no response", c.name, c.qtype)
+		}
+		if dnsmessage.RCodeSuccess != m.RCode || 0 != len(m.Answers) {
+			t.Errorf(
+				"%s %s: got RCode %s and %d answers",
+				c.name,
+				c.qtype,
+				m.RCode,
+				len(m.Answers),
+			)
+		}
+		crossTypes.l.Lock()
+		after := crossTypes.n[c.qtype]
+		crossTypes.l.Unlock()
+		if before+1 != after {
+			t.Errorf("%s %s: not counted", c.name, c.qtype)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+/*
+ * debugerr.go
+ * Tell clients why their queries weren't answered
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* debugErrors is set by -debug-errors */
+var debugErrors bool
+
+/* Error codes sent with -debug-errors */
+const (
+	debugErrNoOffset  = "no-offset"
+	debugErrBadOffset = "bad-offset"
+	debugErrNoFile    = "no-file"
+	debugErrStat      = "stat-failed"
+	debugErrRead      = "read-failed"
+	debugErrAnswer    = "answer-failed"
+	debugErrNeedsTXT  = "needs-txt"
+	debugErrMeta      = "meta-failed"
+	debugErrCRC       = "crc-failed"
+	debugErrProbe     = "probe-failed"
+	debugErrSession   = "session-failed"
+	debugErrSRVOffset = "srv-offset"
+)
+
+/* sendDebugError sends a TXT record with code to addr via pc in response to
+the query in msg which would otherwise go unanswered, if we're sending debug
+errors, or decoy records if we're not and we have some.  For TXT queries, the record is the answer.  Otherwise, it's in the
+additional section.  The buffer buf is used to send the response. */
+func sendDebugError(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	code string,
+) {
+	if !debugErrors {
+		if nil != decoyAnswers {
+			sendDecoyAnswer(pc, addr, buf, msg, q)
+		}
+		return
+	}
+	la := logAddr(addr)
+
+	/* Roll the record, which shouldn't be cached */
+	rr := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  dnsmessage.TypeTXT,
+			Class: msg.Questions[0].Class,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{"error=" + code}},
+	}
+	msg.Answers = msg.Answers[:0]
+	if dnsmessage.TypeTXT == msg.Questions[0].Type {
+		msg.Answers = append(msg.Answers, rr)
+	} else {
+		msg.Additionals = append(msg.Additionals, rr)
+	}
+
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf(
+			"[%s] Error sending debug error for %q: %s",
+			la,
+			q,
+			err,
+		)
+		return
+	}
+	log.Printf("[%s] Sent debug error %s for %q", la, code, q)
+}
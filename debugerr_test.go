@@ -0,0 +1,70 @@
+package main
+
+/*
+ * debugerr_test.go
+ * Tests for debug error answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleDebugErrors(t *testing.T) {
+	testServe(t)
+	cases := []struct {
+		name  string
+		qtype dnsmessage.Type
+		code  string
+	}{
+		{"-payload.files.example.com.", dnsmessage.TypeTXT, "no-offset"},
+		{"0-nonesuch.files.example.com.", dnsmessage.TypeTXT, "no-file"},
+		{"zzzzzzzzzzzzzzzz-payload.files.example.com.",
+			dnsmessage.TypeA, "bad-offset"},
+		{metaLabel + "-payload.files.example.com.",
+			dnsmessage.TypeA, "needs-txt"},
+		{strconv.FormatUint(answer.MaxSRVOffset, 36) +
+			"-payload.files.example.com.",
+			dnsmessage.TypeSRV, "srv-offset"},
+	}
+
+	/* Off by default */
+	if m := testQuery(t, cases[0].name, cases[0].qtype); nil != m {
+		t.Errorf("Got a response with debug errors off")
+	}
+
+	/* On, the errors should be in TXT records */
+	debugErrors = true
+	defer func() { debugErrors = false }()
+	for _, c := range cases {
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Errorf("%s %s: no response", c.name, c.qtype)
+			continue
+		}
+		rrs := m.Additionals
+		if dnsmessage.TypeTXT == c.qtype {
+			rrs = m.Answers
+		}
+		if 1 != len(rrs) {
+			t.Errorf("%s %s: got %d records", c.name, c.qtype, len(rrs))
+			continue
+		}
+		txt, ok := rrs[0].Body.(*dnsmessage.TXTResource)
+		if !ok || 1 != len(txt.TXT) || "error="+c.code != txt.TXT[0] {
+			t.Errorf(
+				"%s %s: got %v, want %s",
+				c.name,
+				c.qtype,
+				rrs[0].Body,
+				c.code,
+			)
+		}
+	}
+}
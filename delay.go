@@ -0,0 +1,33 @@
+package main
+
+/*
+ * delay.go
+ * Take a little while to respond
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"math/rand"
+	"time"
+)
+
+/* delayMin and delayMax bound the random delay before each response is sent,
+so we don't answer in the sub-millisecond times which give away a server on
+the same box as the resolver, or no resolver at all.  They're set with
+-delay-min and -delay-max or by a profile.  If delayMax is 0, responses are
+sent right away. */
+var delayMin, delayMax time.Duration
+
+/* delayResponse sleeps for a random time between delayMin and delayMax. */
+func delayResponse() {
+	if 0 >= delayMax {
+		return
+	}
+	d := delayMin
+	if delayMax > delayMin {
+		d += time.Duration(rand.Int63n(int64(delayMax - delayMin)))
+	}
+	time.Sleep(d)
+}
@@ -0,0 +1,34 @@
+package main
+
+/*
+ * delay_test.go
+ * Tests for response delays
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleDelay(t *testing.T) {
+	testServe(t)
+	delayMin, delayMax = 50*time.Millisecond, 60*time.Millisecond
+	defer func() { delayMin, delayMax = 0, 0 }()
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		qn := "0-payload.files.example.com."
+		if m := testQuery(t, qn, dnsmessage.TypeA); nil == m ||
+			0 == len(m.Answers) {
+			t.Fatalf("%s: bad response: %v", qn, m)
+		}
+		if d := time.Since(start); delayMin > d {
+			t.Errorf("Response took only %s", d)
+		}
+	}
+}
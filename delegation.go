@@ -0,0 +1,362 @@
+package main
+
+/*
+ * delegation.go
+ * Make sure our zone's delegated to us
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* defaultDelegationResolvers are the public resolvers through which
+-check-delegation checks the zone, if no others are given */
+const defaultDelegationResolvers = "1.1.1.1:53,8.8.8.8:53,9.9.9.9:53"
+
+/* delegationTimeout is how long we wait for each delegation check query */
+const delegationTimeout = 10 * time.Second
+
+var (
+	/* delegationNonces holds the nonces in the names of outstanding
+	delegation check queries and whether they've reached us */
+	delegationNonces  = make(map[string]bool)
+	delegationNoncesL sync.Mutex
+)
+
+/* checkDelegation checks that the parent of zone delegates it to us and that
+queries for names in zone sent to each of the resolvers reach us.  What it
+finds is logged, along with what to fix if queries don't get through.  The
+address on which we're listening is laddr. */
+func checkDelegation(zone string, resolvers []string, laddr net.Addr) {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	if 0 == len(resolvers) {
+		log.Printf("Delegation check: no resolvers")
+		return
+	}
+
+	/* See what the parent zone says */
+	nss, err := delegationNS(resolverVia(resolvers[0]), zone)
+	if nil != err {
+		log.Printf(
+			"Delegation check: error getting %s's NS records from "+
+				"its parent zone: %s",
+			zone,
+			err,
+		)
+	} else {
+		logDelegationNS(resolverVia(resolvers[0]), zone, nss, laddr)
+	}
+
+	/* See if queries get to us */
+	var working int
+	for _, resolver := range resolvers {
+		if err := delegationReaches(
+			resolverVia(resolver),
+			zone,
+		); nil != err {
+			log.Printf(
+				"Delegation check: queries for %s via %s "+
+					"don't reach us: %s",
+				zone,
+				resolver,
+				err,
+			)
+			continue
+		}
+		log.Printf(
+			"Delegation check: queries for %s via %s reach us",
+			zone,
+			resolver,
+		)
+		working++
+	}
+	switch working {
+	case len(resolvers):
+		log.Printf("Delegation check: %s is delegated to us", zone)
+	case 0:
+		log.Printf(
+			"Delegation check: no queries for %s reached us.  "+
+				"Make sure the parent zone has NS records "+
+				"for %s naming a host whose A or AAAA "+
+				"records are this server's public address, "+
+				"and that UDP port 53 is reachable from the "+
+				"internet",
+			zone,
+			zone,
+		)
+	default:
+		log.Printf(
+			"Delegation check: only %d of %d resolvers reached "+
+				"us.  If the NS records for %s changed "+
+				"recently, the others may still have the old "+
+				"ones cached",
+			working,
+			len(resolvers),
+			zone,
+		)
+	}
+}
+
+/* logDelegationNS logs the nameservers nss for zone, and whether they resolve,
+via r, to one of our addresses.  The address on which we're listening is
+laddr. */
+func logDelegationNS(
+	r *net.Resolver,
+	zone string,
+	nss []string,
+	laddr net.Addr,
+) {
+	if 0 == len(nss) {
+		log.Printf(
+			"Delegation check: %s's parent zone has no NS records "+
+				"for it; add some naming this server",
+			zone,
+		)
+		return
+	}
+	ours := localIPs(laddr)
+	for _, ns := range nss {
+		ctx, cancel := context.WithTimeout(
+			context.Background(),
+			delegationTimeout,
+		)
+		addrs, err := r.LookupHost(ctx, ns)
+		cancel()
+		if nil != err {
+			log.Printf(
+				"Delegation check: error resolving %s's "+
+					"nameserver %s: %s",
+				zone,
+				ns,
+				err,
+			)
+			continue
+		}
+		var isUs bool
+		for _, a := range addrs {
+			if ours[a] {
+				isUs = true
+			}
+		}
+		if isUs {
+			log.Printf(
+				"Delegation check: %s's nameserver %s is us (%s)",
+				zone,
+				ns,
+				strings.Join(addrs, ", "),
+			)
+			continue
+		}
+		log.Printf(
+			"Delegation check: %s's nameserver %s (%s) isn't one "+
+				"of our addresses, which is fine if we're "+
+				"behind NAT",
+			zone,
+			ns,
+			strings.Join(addrs, ", "),
+		)
+	}
+}
+
+/* delegationNS gets the NS records for zone from one of the nameservers for
+its parent zone, which it finds with r. */
+func delegationNS(r *net.Resolver, zone string) ([]string, error) {
+	parts := strings.SplitN(zone, ".", 2)
+	if 2 != len(parts) {
+		return nil, errors.New("zone has no parent")
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		delegationTimeout,
+	)
+	defer cancel()
+	pnss, err := r.LookupNS(ctx, parts[1])
+	if nil != err {
+		return nil, fmt.Errorf("getting parent's nameservers: %w", err)
+	}
+
+	/* Ask the parent's nameservers until one answers */
+	for _, pns := range pnss {
+		var nss []string
+		if nss, err = askNS(
+			net.JoinHostPort(pns.Host, "53"),
+			zone,
+		); nil == err {
+			return nss, nil
+		}
+	}
+	if nil == err {
+		err = errors.New("parent zone has no nameservers")
+	}
+	return nil, err
+}
+
+/* askNS asks the nameserver at addr for zone's NS records, without
+recursion, and returns the NS records in the answer or in the referral to
+zone's nameservers. */
+func askNS(addr, zone string) ([]string, error) {
+	name, err := dnsmessage.NewName(zone + ".")
+	if nil != err {
+		return nil, fmt.Errorf("parsing zone: %w", err)
+	}
+	var id [2]byte
+	if _, err := rand.Read(id[:]); nil != err {
+		return nil, fmt.Errorf("generating query ID: %w", err)
+	}
+	qid := binary.BigEndian.Uint16(id[:])
+	q, err := (&dnsmessage.Message{
+		Header: dnsmessage.Header{ID: qid},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypeNS,
+			Class: dnsmessage.ClassINET,
+		}},
+	}).Pack()
+	if nil != err {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	/* Send it off and wait for the answer */
+	c, err := net.DialTimeout("udp", addr, delegationTimeout)
+	if nil != err {
+		return nil, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(delegationTimeout))
+	if _, err := c.Write(q); nil != err {
+		return nil, fmt.Errorf("sending query: %w", err)
+	}
+	buf := make([]byte, 4096)
+	var m dnsmessage.Message
+	for qid != m.Header.ID || !m.Header.Response {
+		n, err := c.Read(buf)
+		if nil != err {
+			return nil, fmt.Errorf("receiving answer: %w", err)
+		}
+		if err := m.Unpack(buf[:n]); nil != err {
+			return nil, fmt.Errorf("unpacking answer: %w", err)
+		}
+	}
+	if dnsmessage.RCodeSuccess != m.Header.RCode {
+		return nil, fmt.Errorf("got %s", m.Header.RCode)
+	}
+
+	/* Pick out the nameservers */
+	var nss []string
+	for _, rr := range append(m.Answers, m.Authorities...) {
+		ns, ok := rr.Body.(*dnsmessage.NSResource)
+		if !ok || !strings.EqualFold(rr.Header.Name.String(), zone+".") {
+			continue
+		}
+		nss = append(nss, ns.NS.String())
+	}
+	return nss, nil
+}
+
+/* delegationReaches returns nil if a query for a name in zone made with r
+reaches us. */
+func delegationReaches(r *net.Resolver, zone string) error {
+	/* Make a name no resolver will have cached */
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); nil != err {
+		return fmt.Errorf("generating nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(b)
+	delegationNoncesL.Lock()
+	delegationNonces[nonce] = false
+	delegationNoncesL.Unlock()
+	defer func() {
+		delegationNoncesL.Lock()
+		defer delegationNoncesL.Unlock()
+		delete(delegationNonces, nonce)
+	}()
+
+	/* We'll send an NXDomain, but so will anybody else */
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		delegationTimeout,
+	)
+	defer cancel()
+	_, err := r.LookupTXT(ctx, fmt.Sprintf(
+		"%s-%s-%s.%s",
+		checkLabel,
+		checkNX,
+		nonce,
+		zone,
+	))
+	delegationNoncesL.Lock()
+	defer delegationNoncesL.Unlock()
+	switch {
+	case delegationNonces[nonce]:
+		return nil
+	case nil == err:
+		return errors.New("answered by someone else")
+	default:
+		return err
+	}
+}
+
+/* noteDelegationCheck notes that a check query with the argument arg, which
+may be from delegationReaches, reached us. */
+func noteDelegationCheck(arg string) {
+	parts := strings.SplitN(arg, "-", 2)
+	if 2 != len(parts) {
+		return
+	}
+	delegationNoncesL.Lock()
+	defer delegationNoncesL.Unlock()
+	if _, ok := delegationNonces[parts[1]]; ok {
+		delegationNonces[parts[1]] = true
+	}
+}
+
+/* resolverVia returns a resolver which sends its queries to the resolver at
+addr. */
+func resolverVia(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(
+			ctx context.Context,
+			network string,
+			_ string,
+		) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+/* localIPs returns the set of this host's addresses, including the one in
+laddr, if it's not unspecified. */
+func localIPs(laddr net.Addr) map[string]bool {
+	ips := make(map[string]bool)
+	if ua, ok := laddr.(*net.UDPAddr); ok && !ua.IP.IsUnspecified() {
+		ips[ua.IP.String()] = true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if nil != err {
+		log.Printf("Error getting local addresses: %s", err)
+		return ips
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok {
+			ips[ipn.IP.String()] = true
+		}
+	}
+	return ips
+}
@@ -0,0 +1,48 @@
+package main
+
+/*
+ * delegation_test.go
+ * Tests for delegation checks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDelegationReaches(t *testing.T) {
+	testServe(t)
+	server, stop := testUDPServer(t)
+	defer stop()
+
+	/* Queries via a working path get to us */
+	r := resolverVia(server)
+	if err := delegationReaches(r, "files.example.com"); nil != err {
+		t.Errorf("Check didn't reach us: %s", err)
+	}
+	if 0 != len(delegationNonces) {
+		t.Errorf("Leftover nonces: %v", delegationNonces)
+	}
+
+	/* We don't serve NS records */
+	nss, err := askNS(server, "files.example.com")
+	if nil != err {
+		t.Errorf("Asking for NS records: %s", err)
+	} else if 0 != len(nss) {
+		t.Errorf("Got NS records %q", nss)
+	}
+
+	/* Queries which don't make it aren't seen */
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("ListenPacket: %s", err)
+	}
+	dead.Close()
+	r = resolverVia(dead.LocalAddr().String())
+	if err := delegationReaches(r, "files.example.com"); nil == err {
+		t.Errorf("No error without a server")
+	}
+}
@@ -6,11 +6,11 @@ package main
  * Serve files over DNS
  * By J. Stuart McMurray
  * Created 20200805
- * Last Modified 20200817
+ * Last Modified 20261015
  */
 
 import (
-	"encoding/base64"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -24,6 +24,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/magisterquis/dnsfserv/internal/answer"
 	"golang.org/x/net/dns/dnsmessage"
 )
 
@@ -36,19 +37,9 @@ const (
 	another packet after a temporary error */
 	rxPause = time.Second
 
-	/* ansAFirstByte is the first byte of an A record response */
-	ansAFirstByte = 3
-
-	/* ansTXTMax is the maximum amount of plaintext to put in a TXT
-	record */
-	ansTXTMax = 160
-)
-
-var (
-	/* ansAAAAFirstHalf is the first half on an AAAA record response */
-	ansAAAAFirstHalf = []byte{
-		0x26, 0x00, 0x90, 0x00, 0x53, 0x05, 0xce, 0x00,
-	}
+	/* udpMinMax is the largest message we'll send over UDP to a client
+	which didn't tell us it can take more with EDNS0 */
+	udpMinMax = 512
 )
 
 var (
@@ -64,17 +55,364 @@ var (
 
 /* Set by flags */
 var (
-	ttl  uint
-	fdir string
+	ttl      uint
+	fdir     string
+	decoyDir string
 )
 
 func main() {
+	/* Maybe we're building a stager */
+	if 1 < len(os.Args) && "stager" == os.Args[1] {
+		stagerMain(os.Args[2:])
+		return
+	}
+	/* Or encrypting a file */
+	if 1 < len(os.Args) && "encrypt" == os.Args[1] {
+		encryptMain(os.Args[2:])
+		return
+	}
+	/* Or striping one */
+	if 1 < len(os.Args) && "stripe" == os.Args[1] {
+		stripeMain(os.Args[2:])
+		return
+	}
+	/* Or working out what it'd take to serve one */
+	if 1 < len(os.Args) && "plan" == os.Args[1] {
+		planMain(os.Args[2:])
+		return
+	}
+	/* Or giving them aliases */
+	if 1 < len(os.Args) && "aliases" == os.Args[1] {
+		aliasesMain(os.Args[2:])
+		return
+	}
+	/* Or showing clients what to expect */
+	if 1 < len(os.Args) && "vectors" == os.Args[1] {
+		vectorsMain(os.Args[2:])
+		return
+	}
+
 	var (
 		laddr = flag.String(
 			"listen",
 			"127.0.0.1:5353",
 			"Listen `address`",
 		)
+		tcpAddr = flag.String(
+			"listen-tcp",
+			"",
+			"Optional `address` on which to listen for DNS queries "+
+				"over TCP",
+		)
+		dohAddr = flag.String(
+			"listen-doh",
+			"",
+			"Optional `address` on which to listen for DNS over "+
+				"HTTPS queries",
+		)
+		dohCert = flag.String(
+			"doh-cert",
+			"",
+			"TLS certificate `file` for -listen-doh, which serves "+
+				"plaintext HTTP if unset",
+		)
+		dohKey = flag.String(
+			"doh-key",
+			"",
+			"TLS key `file` for -listen-doh",
+		)
+		dohStreamOn = flag.Bool(
+			"doh-stream",
+			false,
+			"Also serve experimental long-lived DoH streams with "+
+				"-listen-doh",
+		)
+		doqAddr = flag.String(
+			"listen-doq",
+			"",
+			"Optional `address` on which to listen for DNS over "+
+				"QUIC queries",
+		)
+		doqCert = flag.String(
+			"doq-cert",
+			"",
+			"TLS certificate `file` for -listen-doq",
+		)
+		doqKey = flag.String(
+			"doq-key",
+			"",
+			"TLS key `file` for -listen-doq",
+		)
+		aliasesFile = flag.String(
+			"aliases",
+			"",
+			"Optional `file` mapping names in queries to served "+
+				"files, reloaded on SIGHUP",
+		)
+		cacheMax = flag.Uint(
+			"cache",
+			10240,
+			"Maximum number of encoded file `chunks` to cache",
+		)
+		cacheBytes = flag.Uint64(
+			"cache-bytes",
+			0,
+			"Optional maximum approximate `bytes` of encoded "+
+				"file chunks to cache",
+		)
+		maxOpen = flag.Uint(
+			"max-open",
+			0,
+			"Optional maximum `number` of files to have open at "+
+				"once",
+		)
+		redact = flag.Bool(
+			"redact",
+			false,
+			"Log hashed client addresses and truncated query names",
+		)
+		logFile = flag.String(
+			"log",
+			"",
+			"Optional log `file` to use instead of stdout",
+		)
+		logMaxSize = flag.Int64(
+			"log-max-size",
+			0,
+			"If nonzero, rotate the log file after this many `bytes`",
+		)
+		logMaxAge = flag.Duration(
+			"log-max-age",
+			0,
+			"If nonzero, rotate the log file after this `duration`",
+		)
+		logKeep = flag.Int(
+			"log-keep",
+			3,
+			"Keep this `number` of rotated log files",
+		)
+		syslogDest = flag.String(
+			"syslog",
+			"",
+			"Optionally also log to syslog at this `destination`, "+
+				"either local or a URL like udp://host:514, "+
+				"tcp://host:514, or tls://host:6514",
+		)
+		geoDBs = flag.String(
+			"geoip-db",
+			"",
+			"Optional comma-separated MaxMind country and ASN "+
+				"database `files`",
+		)
+		canary = flag.String(
+			"canary",
+			"",
+			"If set, periodically make sure the `file` can be "+
+				"retrieved",
+		)
+		canaryInterval = flag.Duration(
+			"canary-interval",
+			time.Minute,
+			"Canary check `interval`",
+		)
+		canaryVia = flag.String(
+			"canary-via",
+			"",
+			"DNS server `address` for canary queries "+
+				"(default the listen address)",
+		)
+		canaryDomain = flag.String(
+			"canary-domain",
+			defaultCanaryDomain,
+			"DNS `domain` for canary queries",
+		)
+		canaryWebhook = flag.String(
+			"canary-webhook",
+			"",
+			"Optional `URL` to which to POST canary alerts",
+		)
+		hooksFile = flag.String(
+			"hooks",
+			"",
+			"Optional `file` of commands and webhooks to run "+
+				"when files are downloaded",
+		)
+		profName = flag.String(
+			"profile",
+			"",
+			"Optional traffic `profile` (cdn, corporate, or "+
+				"residential) setting TTLs, prefixes, and jitter",
+		)
+		tsigKeyStr = flag.String(
+			"tsig-key",
+			"",
+			"Optional TSIG `key` with which queries must be signed, "+
+				"as [hmac-sha256:]name:base64secret",
+		)
+		axfr = flag.String(
+			"axfr",
+			axfrRefuse,
+			"Zone transfer `action` (refuse or decoy)",
+		)
+		axfrZone = flag.String(
+			"axfr-zone",
+			"",
+			"Optional decoy zone `file` for -axfr decoy",
+		)
+		unknown = flag.String(
+			"unknown",
+			unknownDrop,
+			"Unanswerable query `action` (drop or decoy)",
+		)
+		unknownAnswers = flag.String(
+			"unknown-answers",
+			"",
+			"Optional decoy records `file` for -unknown decoy",
+		)
+		doFingerprint = flag.Bool(
+			"fingerprint",
+			false,
+			"Log the characteristics of resolvers' queries for "+
+				"each transfer",
+		)
+		startMaintenance = flag.Bool(
+			"maintenance",
+			false,
+			"Start in maintenance mode, toggled with SIGUSR1",
+		)
+		debugErrs = flag.Bool(
+			"debug-errors",
+			false,
+			"Answer queries which would otherwise be ignored "+
+				"because of errors with a TXT record with an "+
+				"error code, for setting up clients",
+		)
+		replayThreshold = flag.Int(
+			"replay-threshold",
+			0,
+			"If nonzero, warn when a client asks for this `number` "+
+				"of chunks already served to another client",
+		)
+		replayWindow = flag.Duration(
+			"replay-window",
+			10*time.Minute,
+			"How long to remember served chunks for -replay-threshold",
+		)
+		campaignsFile = flag.String(
+			"campaigns",
+			"",
+			"Optional `file` of campaign tags for files and zones",
+		)
+		campaignInterval = flag.Duration(
+			"campaign-summary",
+			time.Hour,
+			"Campaign summary logging `interval`",
+		)
+		enableTypes = flag.String(
+			"enable-types",
+			"A,AAAA,TXT",
+			"Comma-separated record `types` in which to serve files",
+		)
+		geoRules = flag.String(
+			"geoip-policy",
+			"",
+			"Comma-separated GeoIP `rules`, e.g. "+
+				"US=serve,AS1234=refuse,*=decoy",
+		)
+		delegationZone = flag.String(
+			"check-delegation",
+			"",
+			"On startup, check via public resolvers that the `zone` "+
+				"is delegated to us",
+		)
+		delegationResolvers = flag.String(
+			"delegation-resolvers",
+			defaultDelegationResolvers,
+			"Comma-separated resolver `addresses` for "+
+				"-check-delegation",
+		)
+		maxSessions = flag.Int(
+			"max-sessions",
+			4096,
+			"Maximum `number` of handshake sessions to remember, "+
+				"or 0 to disable handshakes",
+		)
+		sessionTTL = flag.Duration(
+			"session-ttl",
+			30*time.Minute,
+			"How long to remember an unused handshake session",
+		)
+		authKeyStr = flag.String(
+			"auth-key",
+			"",
+			"Optional `secret` with which queries for files must "+
+				"carry a MAC in their names",
+		)
+		noComp = flag.Bool(
+			"no-compression",
+			false,
+			"Send responses without name compression, for "+
+				"middleboxes which mishandle it",
+		)
+		shuffleOn = flag.Bool(
+			"shuffle",
+			false,
+			"Send multi-chunk answers' records in a random order",
+		)
+		nonceMax = flag.Int(
+			"nonce-cache",
+			0,
+			"Optional `number` of nonces to remember, to serve "+
+				"decoys to chunk queries with stale nonces",
+		)
+		nonceGrace = flag.Duration(
+			"nonce-grace",
+			10*time.Second,
+			"How long after a nonce is first seen it may be seen "+
+				"again, for retries",
+		)
+		maxBytes = flag.Uint64(
+			"max-bps",
+			0,
+			"Optional maximum `bytes` of files to send per second, "+
+				"to all clients together",
+		)
+		padTo = flag.Uint(
+			"pad-bucket",
+			0,
+			"Pad TXT and NULL chunks, when asked, to a multiple of "+
+				"this many `bytes` (default a full chunk)",
+		)
+		minDelay = flag.Duration(
+			"delay-min",
+			0,
+			"Minimum `duration` to wait before sending each "+
+				"response",
+		)
+		maxDelay = flag.Duration(
+			"delay-max",
+			0,
+			"Maximum `duration` to wait before sending each "+
+				"response (default -delay-min)",
+		)
+		minTTLHint = flag.Uint(
+			"ttl-hint-min",
+			0,
+			"Minimum TTL in `seconds` clients may ask for with a "+
+				"TTL hint",
+		)
+		maxTTLHint = flag.Uint(
+			"ttl-hint-max",
+			0,
+			"Optional maximum TTL in `seconds` clients may ask for "+
+				"with a TTL hint, which enables TTL hints",
+		)
+	)
+	flag.Var(
+		&zones,
+		"domain",
+		"Only answer queries for names in this `zone`, which may be "+
+			"given more than once (default any zone)",
 	)
 	flag.StringVar(
 		&fdir,
@@ -82,30 +420,346 @@ func main() {
 		"fserv",
 		"Name of `directory` containing files to serve",
 	)
+	flag.Var(
+		&allowNets,
+		"allow",
+		"Only serve files to queries from this `network`, which may "+
+			"be given more than once (default any network)",
+	)
+	flag.Var(
+		&denyNets,
+		"deny",
+		"Don't serve files to queries from this `network`, which "+
+			"may be given more than once",
+	)
+	flag.Func(
+		"unauthorized",
+		"What to do with queries from networks which don't get "+
+			"files, refuse or decoy (default refuse)",
+		setACLAction,
+	)
+	flag.StringVar(
+		&configFile,
+		"config",
+		"",
+		"Optional TOML `file` of settings named like these "+
+			"options, some of which are reloaded on SIGHUP",
+	)
+	flag.StringVar(
+		&decoyDir,
+		"decoy-dir",
+		"",
+		"Optional name of `directory` containing decoy files",
+	)
+	flag.StringVar(
+		&axfrWebhook,
+		"axfr-webhook",
+		"",
+		"Optional `URL` to which to POST zone transfer alerts",
+	)
+	flag.StringVar(
+		&cnameLabel,
+		"cname",
+		"",
+		"If set, answer with a CNAME to a name with this `label` "+
+			"added, like a CDN",
+	)
 	flag.UintVar(
 		&ttl,
 		"ttl",
 		1800,
 		"Response TLL in `seconds`",
 	)
+	flag.StringVar(
+		&soaMName,
+		"soa-mname",
+		"",
+		"Primary nameserver `name` in SOA and NS records for "+
+			"-domain zones (default ns1.<zone>)",
+	)
+	flag.StringVar(
+		&soaRName,
+		"soa-rname",
+		"",
+		"Responsible person's `address` in SOA records for "+
+			"-domain zones (default hostmaster.<zone>)",
+	)
+	flag.UintVar(
+		&soaSerial,
+		"soa-serial",
+		0,
+		"`Serial` in SOA records for -domain zones (default the "+
+			"start time as YYYYMMDDHH)",
+	)
 	flag.Usage = func() {
 		fmt.Fprintf(
 			os.Stderr,
 			`Usage: %v [options]
+       %v stager [options]
+       %v encrypt [options]
+       %v stripe [options]
+       %v plan [options]
+       %v aliases [options] file [file...]
+       %v vectors [options]
 
-Serves chunks of files from a directory in response to DNS queries.
+Serves chunks of files from a directory in response to DNS queries.  With
+"stager", builds a stager configured to get one of the files.  With "encrypt",
+encrypts a file with a passphrase.  With "stripe", splits a file to be served
+under several names.  With "plan", reports what it would take to get a file
+with each query type.  With "aliases", generates aliases for files for use
+with -aliases.  With "vectors", writes test vectors for client
+implementations.
 
 Options:
 `,
 			os.Args[0],
+			os.Args[0],
+			os.Args[0],
+			os.Args[0],
+			os.Args[0],
+			os.Args[0],
+			os.Args[0],
 		)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	/* Settings can come from a file, too */
+	if "" != configFile {
+		if err := startConfig(flag.CommandLine); nil != err {
+			log.Fatalf("Error reading %s: %s", configFile, err)
+		}
+	}
+
 	/* Log nicer */
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	if "" != *logFile {
+		rl, err := newRotatingLog(
+			*logFile,
+			*logMaxSize,
+			*logMaxAge,
+			*logKeep,
+		)
+		if nil != err {
+			log.Fatalf("Error opening log file: %s", err)
+		}
+		log.SetOutput(rl)
+	}
+	if "" != *syslogDest {
+		sw, err := newSyslogWriter(*syslogDest)
+		if nil != err {
+			log.Fatalf("Error connecting to syslog: %s", err)
+		}
+		log.SetOutput(io.MultiWriter(log.Writer(), sw))
+	}
+	if *redact {
+		if err := startRedacting(); nil != err {
+			log.Fatalf("Error starting log redaction: %s", err)
+		}
+	}
+
+	/* Work out who gets what */
+	if 0 != len(allowNets) {
+		log.Printf("Serving files only to %s", allowNets.String())
+	}
+	if 0 != len(denyNets) {
+		log.Printf("Not serving files to %s", denyNets.String())
+	}
+	if aclEnabled() {
+		log.Printf("Unauthorized networks' queries get %s", aclAction)
+	}
+	if "" != *geoDBs {
+		var err error
+		if geo, err = newGeoPolicy(*geoDBs, *geoRules); nil != err {
+			log.Fatalf("Error setting up GeoIP policy: %s", err)
+		}
+	}
+
+	/* Get ready to tell someone about downloads */
+	if "" != *hooksFile {
+		var err error
+		if hooks, err = loadHooks(*hooksFile); nil != err {
+			log.Fatalf("Error loading hooks: %s", err)
+		}
+	}
+
+	/* Some settings can change while we're running */
+	if "" != configFile {
+		log.Printf("Read settings from %s", configFile)
+		go watchConfigSignal(flag.CommandLine)
+	}
+
+	/* Let files be asked for by other names */
+	if "" != *aliasesFile {
+		aliasFile = *aliasesFile
+		if err := reloadAliases(); nil != err {
+			log.Fatalf("Error loading aliases: %s", err)
+		}
+		go watchAliasSignal()
+	}
+
+	/* Keep track of who's getting what */
+	if "" != *campaignsFile {
+		var err error
+		if campaigns, err = loadCampaigns(*campaignsFile); nil != err {
+			log.Fatalf("Error loading campaigns: %s", err)
+		}
+		go campaigns.summarize(*campaignInterval)
+	}
+
+	/* Only talk to people who know the key */
+	if "" != *tsigKeyStr {
+		if err := setTSIGKey(*tsigKeyStr); nil != err {
+			log.Fatalf("Error setting TSIG key: %s", err)
+		}
+	}
+
+	/* Work out what to tell people looking for zone transfers */
+	if err := setAXFR(*axfr, *axfrZone); nil != err {
+		log.Fatalf("Error setting up zone transfer handling: %s", err)
+	}
+
+	/* And what to tell people asking for things which aren't there */
+	if err := setUnknown(*unknown, *unknownAnswers); nil != err {
+		log.Fatalf("Error setting up decoy answers: %s", err)
+	}
+
+	/* Watch how resolvers ask for things */
+	if *doFingerprint {
+		fps = &fingerprints{m: make(map[fpKey]*fingerprint)}
+	}
+
+	/* Let the files be changed without clients getting the wrong thing */
+	setMaintenance(*startMaintenance)
+	go watchMaintenanceSignal()
+
+	/* Help with setting up clients, if asked */
+	debugErrors = *debugErrs
+	if debugErrors {
+		log.Printf("Sending error codes in response to bad queries")
+	}
+
+	/* Watch for people replaying queries */
+	if 0 < *replayThreshold {
+		replays = newReplayDetector(*replayThreshold, *replayWindow)
+	}
+
+	/* Allow for per-transfer session keys */
+	if 0 < *maxSessions {
+		var err error
+		if sessions, err = newSessionTable(
+			*maxSessions,
+			*sessionTTL,
+		); nil != err {
+			log.Fatalf("Error setting up handshakes: %s", err)
+		}
+		go sessions.summarize(sessionInterval)
+	}
+
+	/* Only serve the types we're meant to */
+	if err := setEnabledTypes(*enableTypes); nil != err {
+		log.Fatalf("Error setting enabled types: %s", err)
+	}
+	go crossTypes.summarize(crossTypeInterval)
+
+	/* Keep track of files split between hosts */
+	go summarizeShards(shardInterval)
+
+	/* Make sure clients know the secret, if we have one */
+	if "" != *authKeyStr {
+		authKey = []byte(*authKeyStr)
+		go summarizeBadAuth(authInterval)
+	}
+
+	/* Spell out every name, if we must */
+	if *noComp {
+		noCompression = true
+		log.Printf("Sending responses without name compression")
+		go summarizeUncompressed(uncompressedInterval)
+	}
+
+	/* Look like round-robin */
+	if *shuffleOn {
+		shuffleAnswers = true
+		log.Printf("Shuffling answer records")
+	}
+
+	/* Don't serve the same query twice */
+	if 0 < *nonceMax {
+		nonces = newNonceCache(*nonceMax, *nonceGrace)
+		log.Printf(
+			"Requiring fresh nonces, remembering up to %d and "+
+				"allowing repeats for %s",
+			*nonceMax,
+			*nonceGrace,
+		)
+	}
+
+	/* Don't send too fast */
+	if 0 != *maxBytes {
+		maxBPS = *maxBytes
+		log.Printf("Sending at most %d bytes of files per second", maxBPS)
+		go summarizeThrottled(throttleInterval)
+	}
+
+	/* Hide chunk sizes a bit better */
+	if 0 != *padTo {
+		padBucket = int(*padTo)
+		log.Printf("Padding chunks to multiples of %d bytes", padBucket)
+	}
+
+	/* Let clients pick their TTLs, within reason */
+	if 0 != *maxTTLHint {
+		if *maxTTLHint < *minTTLHint {
+			log.Fatalf(
+				"-ttl-hint-max must be at least -ttl-hint-min",
+			)
+		}
+		ttlHintMin, ttlHintMax = *minTTLHint, *maxTTLHint
+		log.Printf(
+			"Allowing TTL hints from %d to %d seconds",
+			ttlHintMin,
+			ttlHintMax,
+		)
+	}
+
+	/* Stick to our own zones */
+	if 0 != len(zones) {
+		log.Printf("Answering only for %s", zones.String())
+		go summarizeOutOfZone(outOfZoneInterval)
+		setSOADefaults()
+	}
+
+	/* Try to blend in */
+	if 0 == *maxDelay {
+		*maxDelay = *minDelay
+	}
+	if *maxDelay < *minDelay {
+		log.Fatalf("-delay-max must be at least -delay-min")
+	}
+	delayMin, delayMax = *minDelay, *maxDelay
+	if "" != *profName {
+		if err := setProfile(*profName); nil != err {
+			log.Fatalf("Error setting profile: %s", err)
+		}
+	}
+	if 0 != delayMax {
+		log.Printf(
+			"Waiting %s-%s before sending responses",
+			delayMin,
+			delayMax,
+		)
+	}
+
+	/* Don't cache more than we're allowed */
+	chunks.max = *cacheMax
+	chunks.maxBytes = *cacheBytes
+	if 0 != *maxOpen {
+		setMaxOpen(*maxOpen)
+		log.Printf("Keeping at most %d files open at once", *maxOpen)
+	}
+	go summarizeResources(resourceInterval)
 
 	/* Listen for DNS queries */
 	pc, err := net.ListenPacket("udp", *laddr)
@@ -113,6 +767,101 @@ Options:
 		log.Fatalf("Error listening on %s: %s", *laddr, err)
 	}
 	log.Printf("Listening for DNS queries on %s", pc.LocalAddr())
+	if "" != *tcpAddr {
+		l, err := net.Listen("tcp", *tcpAddr)
+		if nil != err {
+			log.Fatalf("Error listening on %s: %s", *tcpAddr, err)
+		}
+		log.Printf("Listening for DNS queries over TCP on %s", l.Addr())
+		go serveTCP(l)
+	}
+	if "" != *dohAddr {
+		if ("" == *dohCert) != ("" == *dohKey) {
+			log.Fatalf("Need both or neither of -doh-cert and -doh-key")
+		}
+		proto := "https"
+		if "" == *dohCert {
+			proto = "http"
+		}
+		log.Printf(
+			"Listening for DoH queries on %s://%s%s",
+			proto,
+			*dohAddr,
+			dohPath,
+		)
+		if *dohStreamOn {
+			dohStream = true
+			log.Printf(
+				"Serving DoH streams on %s://%s%s",
+				proto,
+				*dohAddr,
+				dohStreamPath,
+			)
+		}
+		go serveDoH(*dohAddr, *dohCert, *dohKey)
+	}
+	if "" != *doqAddr {
+		if "" == *doqCert || "" == *doqKey {
+			log.Fatalf("Need -doq-cert and -doq-key with -listen-doq")
+		}
+		cert, err := tls.LoadX509KeyPair(*doqCert, *doqKey)
+		if nil != err {
+			log.Fatalf("Error loading DoQ certificate: %s", err)
+		}
+		l, err := listenDoQ(*doqAddr, cert)
+		if nil != err {
+			log.Fatalf("Error listening on %s: %s", *doqAddr, err)
+		}
+		log.Printf("Listening for DoQ queries on %s", l.Addr())
+		go serveDoQ(l)
+	}
+
+	/* Make sure we keep working */
+	if "" != *canary {
+		if "" == *canaryVia {
+			*canaryVia = canaryServer(pc.LocalAddr())
+		}
+		if !zones.contains(strings.ToLower(
+			strings.TrimSuffix(*canaryDomain, ".") + ".",
+		)) {
+			log.Printf(
+				"Canary domain %s isn't one of ours, canary "+
+					"queries will be refused",
+				*canaryDomain,
+			)
+		}
+		if act, why := canaryACL(*canaryVia); geoServe != act {
+			log.Printf(
+				"Canary queries via %s will get %s "+
+					"responses due to -allow or -deny (%s)",
+				*canaryVia,
+				act,
+				why,
+			)
+		}
+		go canaryCheck(
+			*canary,
+			*canaryVia,
+			*canaryDomain,
+			*canaryInterval,
+			*canaryWebhook,
+		)
+		log.Printf(
+			"Checking for canary %s via %s every %s",
+			*canary,
+			*canaryVia,
+			*canaryInterval,
+		)
+	}
+
+	/* Make sure we're reachable */
+	if "" != *delegationZone {
+		go checkDelegation(
+			*delegationZone,
+			strings.Split(*delegationResolvers, ","),
+			pc.LocalAddr(),
+		)
+	}
 
 	/* Serve queries */
 	var te interface{ Temporary() bool }
@@ -140,16 +889,28 @@ Options:
 	}
 }
 
-/* handle responds to the dnsquery of n bytes in buf, as sent from addr to
+/* responder sends responses to queries.  A net.PacketConn is a responder;
+other transports wrap their connections in one. */
+type responder interface {
+	WriteTo(b []byte, addr net.Addr) (int, error)
+}
+
+/* handle responds to the dnsquery of n bytes in buf, as sent from addr, via
 pc.  A file from fdir is served. */
-func handle(pc net.PacketConn, addr net.Addr, buf []byte, n int) {
+func handle(pc responder, addr net.Addr, buf []byte, n int) {
+	/* Work out how to log the client */
+	la := logAddr(addr)
+
+	/* Don't let settings change under us */
+	cfg := currentSettings()
+
 	/* Parse the DNS query */
 	msg := msgpool.Get().(*dnsmessage.Message)
 	defer msgpool.Put(msg)
 	if err := (*msg).Unpack(buf[:n]); nil != err {
 		log.Printf(
 			"[%s] Error unpacking %d byte message: %s",
-			addr,
+			la,
 			n,
 			err,
 		)
@@ -162,10 +923,18 @@ func handle(pc net.PacketConn, addr net.Addr, buf []byte, n int) {
 	msg.Header.RecursionAvailable = false
 	msg.Header.RCode = dnsmessage.RCodeSuccess
 
+	/* Make sure the client knows the key, if we have one */
+	if nil != tsigKey {
+		if !verifyTSIG(pc, addr, buf, n, msg) {
+			return
+		}
+		defer forgetTSIG(msg)
+	}
+
 	/* Make sure there's at least one question.  We'll only respond to one
 	per message, to keep things simple. */
 	if 0 == len(msg.Questions) {
-		log.Printf("[%s] Got query with 0 questions", addr)
+		log.Printf("[%s] Got query with 0 questions", la)
 		return
 	}
 
@@ -173,178 +942,655 @@ func handle(pc net.PacketConn, addr net.Addr, buf []byte, n int) {
 	q := strings.ToLower(msg.Questions[0].Name.String())
 	labels := strings.SplitN(q, ".", 2)
 	if 0 == len(labels) {
-		log.Printf("[%s] Empty query", addr)
+		log.Printf("[%s] Empty query", la)
+		return
+	}
+	inZone := zones.contains(q)
+	q = fmt.Sprintf("%s(%s)", logName(q), msg.Questions[0].Type)
+
+	/* Names not in our zones aren't ours to answer */
+	if !inZone {
+		sendOutOfZone(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Zone transfers are probably someone poking around */
+	if isZoneTransfer(msg.Questions[0].Type) {
+		handleZoneTransfer(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Resolvers doing QNAME minimization ask for NS records for parts of
+	names and may ask for other records for names which aren't files.
+	Telling them there's nothing there but the name exists lets them
+	carry on to the full name.  The apexes of our zones get real SOA and
+	NS records. */
+	if dnsmessage.TypeNS == msg.Questions[0].Type ||
+		dnsmessage.TypeSOA == msg.Questions[0].Type {
+		sendApex(pc, addr, buf, msg, q)
 		return
 	}
-	q = fmt.Sprintf("%s(%s)", q, msg.Questions[0].Type)
+
+	/* Authenticated queries have a MAC in the label after the first,
+	followed by a nonce, if there is one, and a label if the chunk should
+	start with a sequence byte, and chunks encrypted with a session key
+	have the client's key in the label before the zone, all of which
+	we'll need for CNAMEs.  A label asking for padding goes between the
+	sequence and session labels, one asking for a TTL between the nonce
+	and sequence labels, and one naming a shard after that. */
+	qzone := labels[1]
+	var (
+		mac, nonce, cpub, th, sh string
+		seq, pd                  bool
+	)
+	mac, labels[1] = authZone(labels[1])
+	nonce, labels[1] = nonceZone(labels[1])
+	th, labels[1] = ttlHintZone(labels[1])
+	sh, labels[1] = shardZone(labels[1])
+	seq, labels[1] = sequenceZone(labels[1])
+	pd, labels[1] = padZone(labels[1])
+	cpub, labels[1] = sessionZone(labels[1])
+
 	parts := strings.SplitN(labels[0], "-", 2)
-	if 2 != len(parts) {
-		log.Printf("[%s] Badly-formatted query %q", addr, q)
+	if 2 != len(parts) || sessionLabel == parts[0] {
+		sendNoData(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Delegation checks only need to get here */
+	if checkLabel == parts[0] {
+		noteDelegationCheck(parts[1])
+	}
+
+	/* Everything else is for a file, for which we may need a MAC */
+	if checkLabel != parts[0] && !authOK(labels[0], mac) {
+		sendBadAuth(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Handshakes start with our key */
+	if keyLabel == parts[0] {
+		sendKey(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Types we're not serving get nothing */
+	if typeDisabled(msg.Questions[0].Type) {
+		sendCrossType(pc, addr, buf, msg, q, parts[1])
 		return
 	}
 	if 0 == len(parts[0]) {
-		log.Printf("[%s] No offset in %q", addr, q)
+		log.Printf("[%s] No offset in %q", la, q)
+		sendDebugError(pc, addr, buf, msg, q, debugErrNoOffset)
 		return
 	}
-	foff, err := strconv.ParseUint(parts[0], 36, 64)
+
+	/* Path checks don't involve files at all */
+	if checkLabel == parts[0] {
+		sendCheck(pc, addr, buf, msg, q, parts[1], labels[1])
+		return
+	}
+	var (
+		isMeta   = metaLabel == parts[0]
+		isCRC    = crcLabel == parts[0]
+		isProbe  = probeLabel == parts[0]
+		isBigTXT = bigTXTLabel == parts[0]
+		isMulti  = multiLabel == parts[0]
+		foff     uint64
+		clen     uint64
+		err      error
+	)
+	switch {
+	case isMeta, isProbe:
+	case isCRC:
+		foff, clen, parts[1], err = parseCRCQuery(parts[1])
+	case isBigTXT, isMulti:
+		foff, parts[1], err = parseOffsetQuery(parts[1])
+	default:
+		foff, err = strconv.ParseUint(parts[0], 36, 64)
+	}
 	if nil != err {
 		log.Printf(
 			"[%s] Error parsing file offset %q in %q: %s",
-			addr,
+			la,
 			parts[0],
 			q,
 			err,
 		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrBadOffset)
 		return
 	}
-	fname := filepath.Clean(parts[1])
+	fname := filepath.Clean(resolveAlias(parts[1]))
 
-	/* Try to open the file */
-	fname = filepath.Join(fdir, fname)
-	f, err := os.OpenFile(fname, os.O_RDONLY, 000)
-	if nil != err {
+	/* Types in which we can't serve files at all get nothing, too */
+	if !isMeta && !isCRC && !isProbe &&
+		!typeServable(msg.Questions[0].Type) {
+		sendCrossType(pc, addr, buf, msg, q, fname)
+		return
+	}
+	if (isBigTXT && dnsmessage.TypeTXT != msg.Questions[0].Type) ||
+		(isMulti && !isMultiType(msg.Questions[0].Type)) {
+		sendCrossType(pc, addr, buf, msg, q, fname)
+		return
+	}
+
+	/* SRV records can't say where anything past 4GiB goes */
+	if dnsmessage.TypeSRV == msg.Questions[0].Type &&
+		answer.MaxSRVOffset <= foff {
+		log.Printf("[%s] Offset %d too large for SRV in %q", la, foff, q)
+		sendDebugError(pc, addr, buf, msg, q, debugErrSRVOffset)
+		return
+	}
+
+	/* Don't serve anything if the files might be changing */
+	if inMaintenance() {
+		sendMaintenance(pc, addr, buf, msg, q)
+		return
+	}
+
+	/* Make sure this client should get the file */
+	dir := cfg.fdir
+	act, where := aclCheck(cfg, addr)
+	if geoServe == act && nil != geo {
+		act, where = geo.action(cfg, addr)
+	}
+	if geoServe == act && nil != nonces && !isMeta && !isProbe && !isCRC {
+		if ok, why := nonces.fresh(
+			nonce,
+			isCNAMETarget(qzone),
+		); !ok {
+			act, where = geoDecoy, "query with "+why
+		}
+	}
+	switch act {
+	case geoRefuse:
 		log.Printf(
-			"[%s] Error opening file %q for %q: %s",
-			addr,
-			fname,
+			"[%s] Refusing query from %s for %q",
+			la,
+			where,
 			q,
-			err,
 		)
+		msg.RCode = dnsmessage.RCodeRefused
+		if err := sendResponse(pc, addr, buf, msg); nil != err {
+			log.Printf(
+				"[%s] Error sending refusal: %s",
+				la,
+				err,
+			)
+		}
 		return
+	case geoDecoy:
+		log.Printf(
+			"[%s] Serving decoy to %s for %q",
+			la,
+			where,
+			q,
+		)
+		/* No decoys means no file */
+		if "" == cfg.decoyDir {
+			sendEOF(pc, addr, buf, msg, q)
+			return
+		}
+		dir = cfg.decoyDir
 	}
-	defer f.Close()
 
-	/* Seek to the offset */
-	flen, err := f.Seek(0, os.SEEK_END)
-	if nil != err {
-		log.Printf(
-			"[%s] Error getting size of %s: %s",
+	/* Only real files get hooks */
+	hname := fname
+	if dir != cfg.fdir {
+		hname = ""
+	}
+
+	/* Work out to which campaign this file belongs */
+	var ctag string
+	if nil != campaigns && "" != hname {
+		ctag = campaigns.tag(hname, labels[1])
+	}
+
+	/* Probes are answered without so much as opening the file */
+	fname = filepath.Join(dir, fname)
+	if isProbe {
+		sendProbe(
+			pc,
 			addr,
-			f.Name(),
-			err,
+			buf,
+			msg,
+			q,
+			fname,
+			answerTTL(cfg.ttl, th),
 		)
+		return
 	}
-	if foff >= uint64(flen) { /* EOF */
+
+	/* Work out how big the file is */
+	fi, err := os.Stat(fname)
+	if nil != err {
 		log.Printf(
-			"[%s] EOF at offset %d of %s for %q",
-			addr,
-			foff,
-			f.Name(),
+			"[%s] Error getting info about file %q for %q: %s",
+			la,
+			fname,
 			q,
+			err,
 		)
-		sendEOF(pc, addr, buf, msg, q)
+		code := debugErrStat
+		if errors.Is(err, os.ErrNotExist) {
+			code = debugErrNoFile
+		}
+		sendDebugError(pc, addr, buf, msg, q, code)
 		return
 	}
-	if _, err := f.Seek(int64(foff), os.SEEK_SET); nil != err {
-		log.Printf(
-			"[%s] Error seeking to %d in %s for %q: %s",
+
+	/* Metadata queries get the file's size and hash */
+	if isMeta {
+		sendMeta(
+			pc,
 			addr,
-			foff,
-			f.Name(),
+			buf,
+			msg,
 			q,
-			err,
+			fname,
+			fi,
+			answerTTL(cfg.ttl, th),
 		)
 		return
 	}
 
-	/* Roll a response record */
-	var rr dnsmessage.Resource
-	rr.Header.Name = msg.Questions[0].Name
-	rr.Header.Type = msg.Questions[0].Type
-	rr.Header.Class = msg.Questions[0].Class
-	rr.Header.TTL = uint32(ttl)
-	switch rr.Header.Type {
-	case dnsmessage.TypeA:
-		var ans dnsmessage.AResource
-		ans.A[0] = ansAFirstByte
-		n, err = f.Read(ans.A[1:])
-		rr.Body = &ans
-	case dnsmessage.TypeAAAA:
-		var ans dnsmessage.AAAAResource
-		copy(ans.AAAA[:], ansAAAAFirstHalf)
-		_, err = f.Read(ans.AAAA[len(ansAAAAFirstHalf):])
-		rr.Body = &ans
-	case dnsmessage.TypeTXT:
-		var ans dnsmessage.TXTResource
-		if n, err = f.Read(buf[:ansTXTMax]); nil != err {
-			break
-		}
-		ans.TXT = []string{
-			base64.RawStdEncoding.EncodeToString(buf[:n]),
-		}
-		rr.Body = &ans
-	default:
-		log.Printf(
-			"[%s] Unsupported %s request for %q",
+	/* As do checksum queries */
+	if isCRC {
+		sendCRC(
+			pc,
 			addr,
-			msg.Questions[0].Type,
+			buf,
+			msg,
 			q,
+			fname,
+			foff,
+			clen,
+			answerTTL(cfg.ttl, th),
 		)
 		return
 	}
-	if errors.Is(err, io.EOF) {
+
+	/* Note how the resolver asked */
+	if nil != fps {
+		fps.observe(addr, fname, msg)
+	}
+
+	/* Make sure it's not someone else asking */
+	if nil != replays {
+		checkReplay(addr, fname, hname, foff, msg.Questions[0].Type)
+	}
+
+	if foff >= uint64(fi.Size()) { /* EOF */
 		log.Printf(
-			"[%s] Unexpected EOF at offset %d of %s for %q",
-			addr,
+			"[%s] EOF at offset %d of %s for %q%s",
+			la,
 			foff,
-			f.Name(),
+			fname,
 			q,
+			campaignLog(ctag),
 		)
 		sendEOF(pc, addr, buf, msg, q)
+		if "" != sh { /* Shards finish when they're served */
+			return
+		}
+		if "" != ctag {
+			campaigns.completed(ctag, addr)
+		}
+		if nil != fps {
+			fps.finish(addr, fname)
+		}
+		if nil != hooks && "" != hname {
+			hooks.fire(hname, hookComplete, addr, msg.Questions[0].Type)
+		}
 		return
-	} else if nil != err {
+	}
+
+	/* Chunks in a session are encrypted with its key */
+	var skey []byte
+	if "" != cpub {
+		if nil == sessions {
+			log.Printf("[%s] Handshakes disabled for %q", la, q)
+			sendDebugError(pc, addr, buf, msg, q, debugErrSession)
+			return
+		}
+		var isNew bool
+		if skey, isNew, err = sessions.key(cpub); nil != err {
+			log.Printf(
+				"[%s] Error getting session key for %q: %s",
+				la,
+				q,
+				err,
+			)
+			sendDebugError(pc, addr, buf, msg, q, debugErrSession)
+			return
+		} else if isNew {
+			log.Printf("[%s] Started session for %q", la, q)
+		}
+	}
+
+	/* Roll a response record */
+	var rr dnsmessage.Resource
+	rr.Header.Name = msg.Questions[0].Name
+	rr.Header.Type = msg.Questions[0].Type
+	rr.Header.Class = msg.Questions[0].Class
+	rr.Header.TTL = answerTTL(cfg.ttl, th)
+
+	/* Work out how much to send */
+	ab := answer.Builder{
+		QType:     rr.Header.Type,
+		Zone:      labels[1],
+		Off:       foff,
+		SKey:      skey,
+		SName:     parts[1],
+		Seq:       seq,
+		Pad:       pd && answer.Padded(rr.Header.Type),
+		PadBucket: padBucket,
+	}
+	csize := answer.ChunkSize(rr.Header.Type)
+	switch {
+	case isBigTXT:
+		csize = answer.BigTXTMax
+		ab.Max = answer.BigTXTMax
+	case isMulti:
+		csize *= multiAnswers
+		ab.Multi = true
+	}
+	if seq && 1 < csize {
+		csize--
+	}
+	if ab.Pad && 1 < csize {
+		csize--
+	}
+
+	/* If we've already encoded this chunk, no need to do it again,
+	unless it's encrypted for a session */
+	ck := chunkKey{
+		fname: fname,
+		off:   foff,
+		qtype: rr.Header.Type,
+		size:  csize,
+		seq:   seq,
+		pad:   ab.Pad,
+	}
+	if dnsmessage.TypeCNAME == rr.Header.Type ||
+		dnsmessage.TypeMX == rr.Header.Type ||
+		dnsmessage.TypeSRV == rr.Header.Type {
+		ck.zone = labels[1]
+	}
+	var bodies []dnsmessage.ResourceBody
+	if nil == skey {
+		bodies = chunks.get(ck, fi)
+	}
+	if nil == bodies {
+		if bodies, err = readChunk(
+			fname,
+			ab,
+			csize,
+			buf,
+		); errors.Is(err, io.EOF) {
+			log.Printf(
+				"[%s] Unexpected EOF at offset %d of %s for %q",
+				la,
+				foff,
+				fname,
+				q,
+			)
+			sendEOF(pc, addr, buf, msg, q)
+			return
+		} else if nil != err {
+			log.Printf(
+				"[%s] Error reading chunk at offset %d "+
+					"of %s for %q: %s",
+				la,
+				foff,
+				fname,
+				q,
+				err,
+			)
+			sendDebugError(pc, addr, buf, msg, q, debugErrRead)
+			return
+		}
+		/* NULL chunks are big and cheap to read */
+		if answer.TypeNULL != rr.Header.Type && nil == skey {
+			chunks.put(ck, fi, bodies)
+		}
+	}
+	rrs := make([]dnsmessage.Resource, len(bodies))
+	for i, body := range bodies {
+		/* Disguising would clobber sequence numbers */
+		if nil != prof && !isMulti {
+			body = prof.disguise(body)
+		}
+		rrs[i] = rr
+		rrs[i].Body = body
+	}
+	shuffle(rrs)
+	if err := addAnswer(msg, labels[0], qzone, rrs...); nil != err {
 		log.Printf(
-			"[%s] Error reading from %s for answer to %q: %s",
-			addr,
-			f.Name(),
+			"[%s] Error adding answer for %q: %s",
+			la,
 			q,
 			err,
 		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrAnswer)
 		return
 	}
-	msg.Answers = append(msg.Answers, rr)
 
-	/* Send the answer back */
+	/* Send the answer back, when we're allowed */
+	sent := csize
+	if left := uint64(fi.Size()) - foff; left < sent {
+		sent = left
+	}
+	throttle(sent)
 	if serr := sendResponse(pc, addr, buf, msg); nil != serr {
-		log.Printf("[%s] Error sending response: %s", addr, serr)
+		log.Printf("[%s] Error sending response: %s", la, serr)
 	}
 	log.Printf(
-		"[%s] Responded starting at offset %d of %s for %s",
-		addr,
+		"[%s] Responded starting at offset %d of %s for %s%s",
+		la,
 		foff,
-		f.Name(),
+		fname,
 		q,
+		campaignLog(ctag),
+	)
+	if "" != ctag {
+		campaigns.served(ctag, addr, sent)
+	}
+	if nil != hooks && "" != hname && 0 == foff {
+		hooks.fire(hname, hookFirstChunk, addr, rr.Header.Type)
+	}
+
+	/* A sharded delivery is complete when all its shards are */
+	if "" == sh {
+		return
+	}
+	shardDone, allDone := shardServed(
+		sh,
+		fname,
+		addr,
+		uint64(fi.Size()),
+		csize,
+		foff,
+		sent,
 	)
+	if shardDone && nil != fps {
+		fps.finish(addr, fname)
+	}
+	if !allDone {
+		return
+	}
+	if "" != ctag {
+		campaigns.completed(ctag, addr)
+	}
+	if nil != hooks && "" != hname {
+		hooks.fire(hname, hookComplete, addr, rr.Header.Type)
+	}
 }
 
 /* sendResponse sends the message to addr via pc.  It will be stored in buf. */
 func sendResponse(
-	pc net.PacketConn,
+	pc responder,
 	addr net.Addr,
 	buf []byte,
 	msg *dnsmessage.Message,
 ) error {
+	/* Don't answer suspiciously quickly */
+	delayResponse()
+
 	/* Marshal the message */
-	p, err := msg.AppendPack(buf[:0])
+	p, err := packResponse(msg, buf)
 	if nil != err {
 		return err
 	}
 
+	/* If it's too big for UDP, let the client know to try TCP */
+	if max := udpMax(pc, msg); 0 != max && max < len(p) {
+		msg.Truncated = true
+		msg.Answers = msg.Answers[:0]
+		as := msg.Additionals[:0]
+		for _, a := range msg.Additionals {
+			if dnsmessage.TypeOPT == a.Header.Type {
+				as = append(as, a)
+			}
+		}
+		msg.Additionals = as
+		if p, err = packResponse(msg, buf); nil != err {
+			return err
+		}
+	}
+
 	/* Send it back */
 	_, err = pc.WriteTo(p, addr)
 	return err
 }
 
+/* packResponse packs msg into buf, growing it if need be, and signs it if
+we're using TSIG.  If noCompression is set, names aren't compressed. */
+func packResponse(msg *dnsmessage.Message, buf []byte) ([]byte, error) {
+	var (
+		p   []byte
+		err error
+	)
+	if noCompression {
+		p, err = packUncompressed(msg, buf)
+	} else {
+		p, err = msg.AppendPack(buf[:0])
+	}
+	if nil != err {
+		return nil, err
+	}
+	if noCompression {
+		if c, err := msg.Pack(); nil == err {
+			countUncompressed(len(p), len(c))
+		}
+	}
+	if nil != tsigKey {
+		if p, err = signTSIG(msg, p); nil != err {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+/* udpMax returns the size of the largest response to the query in msg which
+may be sent via pc, or 0 if pc isn't UDP and there's no limit. */
+func udpMax(pc responder, msg *dnsmessage.Message) int {
+	if _, ok := pc.(net.PacketConn); !ok {
+		return 0
+	}
+	for _, a := range msg.Additionals {
+		if dnsmessage.TypeOPT == a.Header.Type &&
+			udpMinMax < int(a.Header.Class) {
+			return int(a.Header.Class)
+		}
+	}
+	return udpMinMax
+}
+
 /* sendEOF sets msg to be an NXDomain and sends it to addr via pc, using buf */
 func sendEOF(
-	pc net.PacketConn,
+	pc responder,
 	addr net.Addr,
 	buf []byte,
 	msg *dnsmessage.Message,
 	q string,
 ) {
 	msg.RCode = dnsmessage.RCodeNameError
+	addSOA(msg)
 	if err := sendResponse(pc, addr, buf, msg); nil != err {
-		log.Printf("[%s] Error sending EOF for %q: %s", addr, q, err)
+		log.Printf(
+			"[%s] Error sending EOF for %q: %s",
+			logAddr(addr),
+			q,
+			err,
+		)
+	}
+}
+
+/* sendNoData sends msg to addr via pc, using buf, as an answerless NOERROR
+response, for queries for names which exist but aren't files. */
+func sendNoData(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	addSOA(msg)
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf(
+			"[%s] Error sending empty response for %q: %s",
+			la,
+			q,
+			err,
+		)
+		return
+	}
+	log.Printf("[%s] Sent empty response for non-file query %q", la, q)
+}
+
+/* readChunk reads up to max bytes of the file named fname, starting at ab.Off,
+and encodes them with ab as the bodies of records.  The buffer buf may be used
+to hold file data.  An error wrapping io.EOF is returned if there is no data at
+ab.Off. */
+func readChunk(
+	fname string,
+	ab answer.Builder,
+	max uint64,
+	buf []byte,
+) ([]dnsmessage.ResourceBody, error) {
+	/* Try to open the file */
+	f, err := openFile(fname)
+	if nil != err {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	/* Seek to the offset */
+	if _, err := f.Seek(int64(ab.Off), os.SEEK_SET); nil != err {
+		return nil, fmt.Errorf("seeking to %d: %w", ab.Off, err)
+	}
+
+	/* Read the next bit of the file */
+	if 0 == max {
+		return nil, fmt.Errorf("unsupported record type %s", ab.QType)
+	}
+	if uint64(len(buf)) < max {
+		buf = make([]byte, max)
+	}
+	n, err := f.Read(buf[:max])
+	if nil != err {
+		return nil, err
+	}
+
+	/* Encode it */
+	bodies, used, err := ab.Build(buf[:n], answer.MaxBudget)
+	if nil != err {
+		return nil, err
+	}
+	if used != n {
+		return nil, errors.New("chunk too big for an answer")
 	}
+	return bodies, nil
 }
@@ -0,0 +1,312 @@
+package main
+
+/*
+ * dnsfserv_test.go
+ * Tests for query handling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* testResponder is a responder which sends written packets to a channel. */
+type testResponder struct {
+	out chan []byte
+}
+
+/* WriteTo implements responder.WriteTo */
+func (t testResponder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	t.out <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+/* testAddr is the address from which test queries come */
+var testAddr = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5353}
+
+/* testQuery sends a query for name of type qtype to handle and returns the
+response, or nil if there wasn't one. */
+func testQuery(
+	t *testing.T,
+	name string,
+	qtype dnsmessage.Type,
+) *dnsmessage.Message {
+	t.Helper()
+
+	return testExchange(t, testMessage(name, qtype))
+}
+
+/* testMessage returns a query for name of type qtype. */
+func testMessage(name string, qtype dnsmessage.Type) dnsmessage.Message {
+	return dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 1234},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+}
+
+/* testExchange sends q to handle and returns the response, or nil if there
+wasn't one. */
+func testExchange(t *testing.T, q dnsmessage.Message) *dnsmessage.Message {
+	t.Helper()
+	name := q.Questions[0].Name.String()
+
+	/* Roll the query */
+	buf := make([]byte, netbuflen)
+	b, err := q.AppendPack(buf[:0])
+	if nil != err {
+		t.Fatalf("Packing query for %s: %s", name, err)
+	}
+
+	/* Send it off and see what we get */
+	pc := testResponder{out: make(chan []byte, 1)}
+	handle(pc, testAddr, buf, len(b))
+	select {
+	case r := <-pc.out:
+		var m dnsmessage.Message
+		if err := m.Unpack(r); nil != err {
+			t.Fatalf("Unpacking response for %s: %s", name, err)
+		}
+		return &m
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+/* testServe sets up a directory with a file named payload to serve and
+returns the file's contents. */
+func testServe(t *testing.T) []byte {
+	t.Helper()
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stdout) })
+	fdir = t.TempDir()
+	contents := []byte("kittens")
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "payload"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+	return contents
+}
+
+/* testUDPServer handles queries sent to a UDP socket on the loopback address.
+It returns the socket's address and a function which stops handling queries
+and waits until none are being handled. */
+func testUDPServer(t *testing.T) (string, func()) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("ListenPacket: %s", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			buf := make([]byte, netbuflen)
+			n, addr, err := pc.ReadFrom(buf)
+			if nil != err {
+				return
+			}
+			handle(pc, addr, buf, n)
+		}
+	}()
+	return pc.LocalAddr().String(), func() {
+		pc.Close()
+		<-done
+	}
+}
+
+func TestHandleQNAMEMinimization(t *testing.T) {
+	testServe(t)
+	for _, c := range []struct {
+		name  string
+		qtype dnsmessage.Type
+	}{
+		{"files.example.com.", dnsmessage.TypeNS},
+		{"files.example.com.", dnsmessage.TypeA},
+		{"example.com.", dnsmessage.TypeNS},
+		{"0-payload.files.example.com.", dnsmessage.TypeNS},
+		{"_.files.example.com.", dnsmessage.TypeA},
+	} {
+		c := c
+		t.Run(c.name+c.qtype.String(), func(t *testing.T) {
+			m := testQuery(t, c.name, c.qtype)
+			if nil == m {
+				t.Fatalf("No response")
+			}
+			if dnsmessage.RCodeSuccess != m.RCode {
+				t.Errorf("RCode %s", m.RCode)
+			}
+			if 0 != len(m.Answers) {
+				t.Errorf("Got %d answers", len(m.Answers))
+			}
+		})
+	}
+
+	/* The file itself should still be served */
+	m := testQuery(t, "0-payload.files.example.com.", dnsmessage.TypeA)
+	if nil == m {
+		t.Fatalf("No response to file query")
+	}
+	if 1 != len(m.Answers) {
+		t.Fatalf("Got %d answers to file query", len(m.Answers))
+	}
+	a, ok := m.Answers[0].Body.(*dnsmessage.AResource)
+	if !ok {
+		t.Fatalf("Got %T answer to file query", m.Answers[0].Body)
+	}
+	if "kit" != string(a.A[1:]) {
+		t.Errorf("Got payload %q", a.A[1:])
+	}
+}
+
+func TestServeNULL(t *testing.T) {
+	testServe(t)
+	contents := make([]byte, answer.NULLMax*2+100)
+	for i := range contents {
+		contents[i] = byte(i * 7)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "big"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	/* Answers are too big for UDP, so we'll need TCP on the same port */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer l.Close()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if nil != err {
+		t.Fatalf("ListenPacket: %s", err)
+	}
+	defer pc.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go handleTCP(c)
+		}
+	}()
+	go func() {
+		for {
+			buf := make([]byte, netbuflen)
+			n, addr, err := pc.ReadFrom(buf)
+			if nil != err {
+				return
+			}
+			handle(pc, addr, buf, n)
+		}
+	}()
+
+	q, err := dnsfservget.UDPQuerier(dnsfservget.UDPConfig{
+		Server: l.Addr().String(),
+	})
+	if nil != err {
+		t.Fatalf("UDPQuerier: %s", err)
+	}
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeNULL,
+		Name:    "big",
+		Domain:  "files.example.com",
+		Querier: q,
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if string(contents) != string(b) {
+		t.Errorf("Got %d bytes, want %d", len(b), len(contents))
+	}
+}
+
+func TestHandleCNAMEPayload(t *testing.T) {
+	contents := testServe(t)
+
+	/* The file's in the target, even when we'd otherwise send CNAMEs to
+	the real answers */
+	defer func() { cnameLabel = "" }()
+	for _, label := range []string{"", "cdn"} {
+		cnameLabel = label
+		m := testQuery(
+			t,
+			"0-payload.files.example.com.",
+			dnsmessage.TypeCNAME,
+		)
+		if nil == m || 1 != len(m.Answers) {
+			t.Fatalf("Label %q: no answer", label)
+		}
+		c, ok := m.Answers[0].Body.(*dnsmessage.CNAMEResource)
+		if !ok {
+			t.Fatalf("Label %q: got %T", label, m.Answers[0].Body)
+		}
+		g := dnsfservget.Getter{
+			Type:   dnsfservget.TypeCNAME,
+			Domain: "files.example.com",
+		}
+		buf := make([]byte, dnsfservget.MaxNameDecode)
+		n, err := g.DecodeResponse(buf, c.CNAME.String())
+		if nil != err {
+			t.Fatalf("Label %q: decoding %s: %s", label, c.CNAME, err)
+		}
+		if string(contents) != string(buf[:n]) {
+			t.Errorf("Label %q: got %q", label, buf[:n])
+		}
+	}
+}
+
+func TestHandleMXPayload(t *testing.T) {
+	contents := testServe(t)
+	m := testQuery(t, "0-payload.files.example.com.", dnsmessage.TypeMX)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("No answer")
+	}
+	mx, ok := m.Answers[0].Body.(*dnsmessage.MXResource)
+	if !ok {
+		t.Fatalf("Got %T", m.Answers[0].Body)
+	}
+	if 0 != mx.Pref {
+		t.Errorf("Preference %d for first chunk", mx.Pref)
+	}
+	g := dnsfservget.Getter{
+		Type:   dnsfservget.TypeMX,
+		Domain: "files.example.com",
+	}
+	buf := make([]byte, dnsfservget.MaxNameDecode)
+	n, err := g.DecodeResponse(buf, fmt.Sprintf("%d %s", mx.Pref, mx.MX))
+	if nil != err {
+		t.Fatalf("Decoding %s: %s", mx.MX, err)
+	}
+	if string(contents) != string(buf[:n]) {
+		t.Errorf("Got %q", buf[:n])
+	}
+
+	/* Later chunks have later preferences */
+	if got := answer.MXSequence(3*answer.NameMax + 1); 3 != got {
+		t.Errorf("Sequence hint %d, want 3", got)
+	}
+}
@@ -0,0 +1,427 @@
+// Program dnsfservcat streams a file from dnsfserv to stdout
+package main
+
+/*
+ * dnsfservcat.go
+ * Stream a file from dnsfserv to stdout, or serve it over local HTTP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* passphraseEnv is the environment variable from which the passphrase for an
+encrypted file is read, the same as for dnsfserv's encrypt command */
+const passphraseEnv = "DNSFSERV_PASSPHRASE"
+
+/* authKeyEnv is the environment variable from which the secret given to
+dnsfserv's -auth-key is read */
+const authKeyEnv = "DNSFSERV_AUTH_KEY"
+
+func main() {
+	var (
+		domain = flag.String(
+			"domain",
+			"",
+			"DNS `domain` to query",
+		)
+		name = flag.String(
+			"file",
+			"",
+			"Name of the served `file` to get",
+		)
+		aliasesFile = flag.String(
+			"aliases",
+			"",
+			"Optional `file` of aliases, as used with dnsfserv's "+
+				"-aliases, from which to get -file's alias",
+		)
+		qtype = flag.String(
+			"type",
+			"A",
+			"Query `type` (A, AAAA, TXT, BIGTXT, MULTIA, MULTIAAAA, "+
+				"MX, SRV, or, with -server or -doh, NULL or CNAME)",
+		)
+		server = flag.String(
+			"server",
+			"",
+			"Optional DNS `server` to query directly over UDP, or "+
+				"through the SOCKS5 proxy with -socks",
+		)
+		socks = flag.String(
+			"socks",
+			"",
+			"Optional SOCKS5 proxy `address` through which to query "+
+				"-server over TCP",
+		)
+		dohURL = flag.String(
+			"doh",
+			"",
+			"Optional DoH server `URL`",
+		)
+		tsig = flag.String(
+			"tsig-key",
+			"",
+			"Optional TSIG `key` (name:base64secret)",
+		)
+		useMeta = flag.Bool(
+			"meta",
+			false,
+			"Get the file's size and hash first, to avoid trailing "+
+				"NULs and check the hash",
+		)
+		handshake = flag.Bool(
+			"handshake",
+			false,
+			"Encrypt the transfer with a key exchanged with the "+
+				"server",
+		)
+		noSequence = flag.Bool(
+			"no-sequence",
+			false,
+			"Don't have chunks start with a sequence byte, for "+
+				"a bit more throughput",
+		)
+		nonce = flag.Bool(
+			"nonce",
+			false,
+			"Put a fresh nonce in every query, for dnsfserv "+
+				"started with -nonce-cache",
+		)
+		retryCorrupt = flag.Bool(
+			"retry-corrupt",
+			false,
+			"Get chunks with bad sequence bytes again, with nonces "+
+				"to get past resolvers' caches",
+		)
+		pad = flag.Bool(
+			"pad",
+			false,
+			"Ask for padded TXT and NULL chunks, to hide the "+
+				"file's size",
+		)
+		ttlHint = flag.Uint(
+			"ttl-hint",
+			0,
+			"Optionally ask for answers to queries for chunks with "+
+				"this TTL, in `seconds`",
+		)
+		controlTTLHint = flag.Uint(
+			"control-ttl-hint",
+			0,
+			"Optionally ask for answers to queries for metadata "+
+				"with this TTL, in `seconds`",
+		)
+		manifest = flag.String(
+			"manifest",
+			"",
+			"Optional `file` to which to write a JSON manifest of "+
+				"the transfer",
+		)
+		start = flag.Uint(
+			"start",
+			0,
+			"Offset of the first `byte` to get",
+		)
+		length = flag.Uint(
+			"length",
+			0,
+			"If nonzero, the number of `bytes` to get",
+		)
+		shard = flag.String(
+			"shard",
+			"",
+			"Only get shard I of N (counting from 0), as `I/N`, "+
+				"for joining with the other shards later",
+		)
+		shardID = flag.String(
+			"shard-id",
+			"",
+			"Optional `ID`, the same for every shard, with which "+
+				"the server can tell when all shards are done",
+		)
+		httpAddr = flag.String(
+			"http",
+			"",
+			"If set, serve the file over HTTP on this `address` "+
+				"instead of writing it to stdout",
+		)
+		check = flag.Bool(
+			"check",
+			false,
+			"Instead of getting a file, check which query types and "+
+				"answer sizes make it back from dnsfserv",
+		)
+		healthFile = flag.String(
+			"health",
+			"",
+			"Optional `file` in which to remember which transports "+
+				"and types work on each network, to use the "+
+				"best when -type, -server, and -doh aren't "+
+				"given",
+		)
+		verbose = flag.Bool(
+			"v",
+			false,
+			"Log the transfer's progress to stderr",
+		)
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v [options]
+
+Gets a file from dnsfserv and writes it to stdout or, with -http, serves it
+over HTTP.  If the environment variable %s is set, the file is
+decrypted with it as the passphrase.  If the environment variable %s
+is set, queries are authenticated with it as the secret given to dnsfserv's
+-auth-key.  With -check, reports on what makes it back from dnsfserv instead.
+
+Options:
+`,
+			os.Args[0],
+			passphraseEnv,
+			authKeyEnv,
+		)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	/* Make sure we have what we need */
+	if "" == *domain || ("" == *name && !*check) {
+		log.Fatalf("Need a domain (-domain) and file (-file)")
+	}
+	if "" != *socks && "" == *server {
+		log.Fatalf("Need a DNS server (-server) with -socks")
+	}
+	if "" != *dohURL && "" != *server {
+		log.Fatalf("Only one of -doh and -server may be given")
+	}
+
+	/* Start with what worked last time on this network, if we know */
+	var (
+		health  *dnsfservget.HealthDB
+		network string
+	)
+	if "" != *healthFile {
+		var err error
+		if health, err = dnsfservget.OpenHealthDB(
+			*healthFile,
+		); nil != err {
+			log.Fatalf("Error opening health database: %s", err)
+		}
+		network = dnsfservget.NetworkFingerprint()
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		he, ok := health.Best(network, *domain)
+		if ok && !set["type"] && !set["server"] && !set["doh"] &&
+			parseTransport(he.Transport, server, socks, dohURL) {
+			*qtype = string(he.Type)
+			if *verbose {
+				log.Printf(
+					"Using %s via %s, which worked on "+
+						"network %s",
+					he.Type,
+					he.Transport,
+					network,
+				)
+			}
+		}
+	}
+
+	/* Ask for the file by its alias, if it has one */
+	if "" != *aliasesFile && "" != *name {
+		f, err := os.Open(*aliasesFile)
+		if nil != err {
+			log.Fatalf("Error opening aliases: %s", err)
+		}
+		as, err := dnsfservget.ParseAliases(f)
+		f.Close()
+		if nil != err {
+			log.Fatalf("Error reading aliases: %s", err)
+		}
+		var ok bool
+		if *name, ok = as.Alias(*name); !ok {
+			log.Fatalf("No alias for %s", *name)
+		}
+	}
+
+	/* Configure the Getter */
+	g := &dnsfservget.Getter{
+		Type:           dnsfservget.QType(strings.ToUpper(*qtype)),
+		Name:           *name,
+		Domain:         strings.TrimSuffix(*domain, "."),
+		UseMeta:        *useMeta,
+		Passphrase:     os.Getenv(passphraseEnv),
+		Handshake:      *handshake,
+		Sequence:       !*noSequence,
+		Nonce:          *nonce,
+		RetryCorrupt:   *retryCorrupt,
+		Pad:            *pad,
+		TTLHint:        uint32(*ttlHint),
+		ControlTTLHint: uint32(*controlTTLHint),
+		ShardID:        strings.ToLower(*shardID),
+	}
+	if k := os.Getenv(authKeyEnv); "" != k {
+		g.Key = []byte(k)
+	}
+	if _, err := g.Type.PayloadSize(); nil != err {
+		log.Fatalf("Invalid query type: %s", err)
+	}
+	if *verbose {
+		g.OnStateChange = func(sc dnsfservget.StateChange) {
+			log.Printf(
+				"%s -> %s (%d bytes) %s",
+				sc.From,
+				sc.To,
+				sc.Written,
+				sc.Query,
+			)
+		}
+	}
+	var (
+		key *dnsfservget.TSIGKey
+		err error
+	)
+	if "" != *tsig {
+		if key, err = dnsfservget.ParseTSIGKey(*tsig); nil != err {
+			log.Fatalf("Error parsing TSIG key: %s", err)
+		}
+	}
+	switch {
+	case "" != *dohURL:
+		g.Querier = dnsfservget.DOHQuerier(
+			dnsfservget.DOHConfig{URL: *dohURL},
+		)
+	case "" != *socks:
+		g.Querier, err = dnsfservget.SOCKS5Querier(
+			dnsfservget.SOCKS5Config{
+				Proxy:  *socks,
+				Server: *server,
+				TSIG:   key,
+			},
+		)
+	case "" != *server:
+		g.Querier, err = dnsfservget.UDPQuerier(dnsfservget.UDPConfig{
+			Server: *server,
+			TSIG:   key,
+		})
+	}
+	if nil != err {
+		log.Fatalf("Error setting up queries: %s", err)
+	}
+
+	/* Maybe just see what gets through */
+	if *check {
+		r, err := dnsfservget.Probe(g.Domain, g.Querier)
+		if nil != err {
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Print(r)
+		if nil != health {
+			if err := health.RecordReport(
+				network,
+				g.Domain,
+				transport(*server, *socks, *dohURL),
+				r,
+			); nil != err {
+				log.Fatalf(
+					"Error updating health database: %s",
+					err,
+				)
+			}
+		}
+		return
+	}
+
+	/* Maybe just be a local web server */
+	if "" != *httpAddr {
+		log.Printf("Serving %s on http://%s", *name, *httpAddr)
+		log.Fatalf("Error: %s", dnsfservget.ServeHTTP(*httpAddr, g))
+	}
+
+	/* Note what we got, if asked */
+	if "" != *manifest {
+		f, err := os.Create(*manifest)
+		if nil != err {
+			log.Fatalf("Error creating manifest: %s", err)
+		}
+		defer f.Close()
+		g.Manifest = f
+	}
+
+	/* Send the file to stdout */
+	var rc io.ReadCloser
+	switch {
+	case "" != *shard:
+		var i, n uint
+		if _, err := fmt.Sscanf(*shard, "%d/%d", &i, &n); nil != err {
+			log.Fatalf("Error parsing shard %q: %s", *shard, err)
+		}
+		rc = g.GetShard(i, n)
+	case 0 != *start || 0 != *length:
+		rc = g.GetRange(*start, *length)
+	default:
+		rc = g.Get()
+	}
+	defer rc.Close()
+	_, err = io.Copy(os.Stdout, rc)
+	if nil != health {
+		if herr := health.Record(
+			network,
+			g.Domain,
+			transport(*server, *socks, *dohURL),
+			g.Type,
+			err,
+		); nil != herr {
+			log.Printf("Error updating health database: %s", herr)
+		}
+	}
+	if nil != err {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+/* transport describes how queries are sent, for the health database, given
+the -server, -socks, and -doh flags' values.  TSIG keys aren't included. */
+func transport(server, socks, dohURL string) string {
+	switch {
+	case "" != dohURL:
+		return "doh " + dohURL
+	case "" != socks:
+		return "socks " + socks + " " + server
+	case "" != server:
+		return "server " + server
+	default:
+		return "system"
+	}
+}
+
+/* parseTransport sets server, socks, and dohURL from a transport returned by
+transport.  It returns false if t isn't a transport. */
+func parseTransport(t string, server, socks, dohURL *string) bool {
+	fs := strings.Fields(t)
+	switch {
+	case 1 == len(fs) && "system" == fs[0]:
+		*server, *socks, *dohURL = "", "", ""
+	case 2 == len(fs) && "doh" == fs[0]:
+		*server, *socks, *dohURL = "", "", fs[1]
+	case 2 == len(fs) && "server" == fs[0]:
+		*server, *socks, *dohURL = fs[1], "", ""
+	case 3 == len(fs) && "socks" == fs[0]:
+		*server, *socks, *dohURL = fs[2], fs[1], ""
+	default:
+		return false
+	}
+	return true
+}
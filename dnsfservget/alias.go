@@ -0,0 +1,189 @@
+package dnsfservget
+
+/*
+ * alias.go
+ * Innocuous names for served files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultAliasWords are the words from which GenerateAliases picks aliases by
+// default.
+var DefaultAliasWords = []string{
+	"almanac", "anchor", "apple", "atlas", "autumn", "badge", "banner",
+	"basket", "beacon", "berry", "bridge", "button", "cabin", "candle",
+	"canvas", "castle", "cedar", "chapter", "cloud", "clover", "comet",
+	"copper", "cotton", "crystal", "daisy", "delta", "desert", "dolphin",
+	"ember", "falcon", "feather", "forest", "fountain", "garden", "glacier",
+	"harbor", "harvest", "helmet", "island", "jasmine", "kettle", "lantern",
+	"lemon", "library", "linen", "maple", "marble", "meadow", "mirror",
+	"morning", "mountain", "news", "orchard", "paper", "pebble", "pepper",
+	"planet", "pocket", "rainbow", "ribbon", "river", "saddle", "shadow",
+	"silver", "sparrow", "spring", "summit", "sunset", "thunder", "timber",
+	"tulip", "valley", "velvet", "violet", "walnut", "weather", "willow",
+	"window", "winter", "zephyr",
+}
+
+// Aliases maps names used in queries to the names of the served files for
+// which they stand, so on-wire names need not look anything like the real
+// file names.  Aliases of striped files also stand for the file's stripes.
+type Aliases map[string]string
+
+// ParseAliases reads Aliases from r.  Each non-blank, non-comment line is of
+// the form
+//   alias file
+// where alias is the name used in queries and file is the name of the served
+// file.  Aliases are case-insensitive and may not contain dots.
+func ParseAliases(r io.Reader) (Aliases, error) {
+	as := make(Aliases)
+	s := bufio.NewScanner(r)
+	var ln int
+	for s.Scan() {
+		ln++
+		l := strings.TrimSpace(s.Text())
+		if "" == l || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fs := strings.Fields(l)
+		if 2 != len(fs) {
+			return nil, fmt.Errorf(
+				"line %d: need exactly two fields",
+				ln,
+			)
+		}
+		a := strings.ToLower(fs[0])
+		if strings.Contains(a, ".") {
+			return nil, fmt.Errorf(
+				"line %d: alias %q contains a dot",
+				ln,
+				fs[0],
+			)
+		}
+		if _, ok := as[a]; ok {
+			return nil, fmt.Errorf(
+				"line %d: duplicate alias %q",
+				ln,
+				fs[0],
+			)
+		}
+		as[a] = filepath.Clean(fs[1])
+	}
+	if err := s.Err(); nil != err {
+		return nil, err
+	}
+	return as, nil
+}
+
+// File returns the name of the file for which name, taken from a query,
+// stands.  If name is the StripeName of an alias, the StripeName of the
+// aliased file is returned.  If name isn't an alias, name is returned.
+func (as Aliases) File(name string) string {
+	if f, ok := as[name]; ok {
+		return f
+	}
+	i := strings.LastIndexByte(name, '-')
+	if -1 == i {
+		return name
+	}
+	f, ok := as[name[:i]]
+	if !ok {
+		return name
+	}
+	n, err := strconv.ParseUint(name[i+1:], 10, 0)
+	if nil != err || StripeName("", uint(n)) != name[i:] {
+		return name
+	}
+	return StripeName(f, uint(n))
+}
+
+// Alias returns the alias for the file with the given name, suitable for use
+// as a Getter's Name, and true.  If there is no alias for the file, Alias
+// returns file and false.  If the file has more than one alias, an arbitrary
+// one is returned.
+func (as Aliases) Alias(file string) (string, bool) {
+	file = filepath.Clean(file)
+	for a, f := range as {
+		if f == file {
+			return a, true
+		}
+	}
+	return file, false
+}
+
+// WriteTo writes as to w, sorted by alias, in the form read by ParseAliases.
+func (as Aliases) WriteTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(as))
+	for a := range as {
+		names = append(names, a)
+	}
+	sort.Strings(names)
+	var tot int64
+	for _, a := range names {
+		n, err := fmt.Fprintf(w, "%s %s\n", a, as[a])
+		tot += int64(n)
+		if nil != err {
+			return tot, err
+		}
+	}
+	return tot, nil
+}
+
+// GenerateAliases returns Aliases giving each of the files a different alias
+// chosen at random from words.  If words is nil, DefaultAliasWords is used.
+// Words which aren't usable as aliases are skipped.
+func GenerateAliases(files, words []string) (Aliases, error) {
+	if nil == words {
+		words = DefaultAliasWords
+	}
+
+	/* Work out which words we can use */
+	var (
+		seen   = make(map[string]bool)
+		usable []string
+	)
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if "" == w || strings.ContainsAny(w, ".-") || seen[w] {
+			continue
+		}
+		seen[w] = true
+		usable = append(usable, w)
+	}
+	if len(usable) < len(files) {
+		return nil, fmt.Errorf(
+			"need %d usable words, have %d",
+			len(files),
+			len(usable),
+		)
+	}
+
+	/* Pick one for each file */
+	as := make(Aliases)
+	for i, f := range files {
+		if "" == f {
+			return nil, errors.New("empty file name")
+		}
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(len(usable)-i)))
+		if nil != err {
+			return nil, fmt.Errorf("choosing word: %w", err)
+		}
+		k := i + int(j.Int64())
+		usable[i], usable[k] = usable[k], usable[i]
+		as[usable[i]] = filepath.Clean(f)
+	}
+	return as, nil
+}
@@ -0,0 +1,137 @@
+package dnsfservget_test
+
+/*
+ * alias_test.go
+ * Tests for aliases
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestParseAliases(t *testing.T) {
+	as, err := dnsfservget.ParseAliases(strings.NewReader(
+		"# alias file\n\nWeather payload\nnews  ./tools/../implant\n",
+	))
+	if nil != err {
+		t.Fatalf("ParseAliases: %s", err)
+	}
+	for _, c := range []struct {
+		name string
+		want string
+	}{
+		{"weather", "payload"},
+		{"news", "implant"},
+		{"weather-2", "payload-2"},
+		{"weather-02", "weather-02"},
+		{"weather-x", "weather-x"},
+		{"payload", "payload"},
+		{"nonesuch-1", "nonesuch-1"},
+	} {
+		if got := as.File(c.name); c.want != got {
+			t.Errorf("File(%q): got %q, want %q", c.name, got, c.want)
+		}
+	}
+	if a, ok := as.Alias("implant"); !ok || "news" != a {
+		t.Errorf("Alias(implant): got %q, %t", a, ok)
+	}
+	if a, ok := as.Alias("nonesuch"); ok || "nonesuch" != a {
+		t.Errorf("Alias(nonesuch): got %q, %t", a, ok)
+	}
+
+	/* Bad files */
+	for _, s := range []string{
+		"news\n",
+		"news payload extra\n",
+		"a.b payload\n",
+		"news payload\nNEWS implant\n",
+	} {
+		if _, err := dnsfservget.ParseAliases(
+			strings.NewReader(s),
+		); nil == err {
+			t.Errorf("No error parsing %q", s)
+		}
+	}
+}
+
+func TestGenerateAliases(t *testing.T) {
+	files := []string{"payload", "implant", "tools/stage2"}
+	as, err := dnsfservget.GenerateAliases(files, nil)
+	if nil != err {
+		t.Fatalf("GenerateAliases: %s", err)
+	}
+	if len(files) != len(as) {
+		t.Fatalf("Got %d aliases for %d files", len(as), len(files))
+	}
+	for _, f := range files {
+		a, ok := as.Alias(f)
+		if !ok {
+			t.Errorf("No alias for %s", f)
+		}
+		if strings.ContainsAny(a, ".-") {
+			t.Errorf("Unusable alias %q for %s", a, f)
+		}
+	}
+
+	/* Written aliases should read back the same */
+	var b bytes.Buffer
+	if _, err := as.WriteTo(&b); nil != err {
+		t.Fatalf("WriteTo: %s", err)
+	}
+	ras, err := dnsfservget.ParseAliases(&b)
+	if nil != err {
+		t.Fatalf("ParseAliases: %s", err)
+	}
+	for a, f := range as {
+		if ras[a] != f {
+			t.Errorf("Alias %s: read %q, want %q", a, ras[a], f)
+		}
+	}
+
+	/* Not enough usable words */
+	if _, err := dnsfservget.GenerateAliases(
+		files,
+		[]string{"one", "One", "two.three", "four-five", "six"},
+	); nil == err {
+		t.Errorf("No error with too few words")
+	}
+}
+
+func TestGetterAlias(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := bytes.Repeat([]byte("kittens"), 200)
+	for i, b := range [][]byte{file[:480], file[480:960], file[960:]} {
+		s.SetFile(dnsfservget.StripeName("payload", uint(i)), b)
+	}
+	s.SetFile("payload", file)
+	s.SetAliases(dnsfservget.Aliases{"weather": "payload"})
+
+	/* Both plain and striped files should be gettable by alias */
+	for _, stripes := range []uint{0, 3} {
+		g := dnsfservget.Getter{
+			Type:    dnsfservget.TypeTXT,
+			Name:    "weather",
+			Domain:  "example.com",
+			Querier: q,
+			Stripes: stripes,
+		}
+		got, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			t.Errorf("Get (%d stripes): %s", stripes, err)
+			continue
+		}
+		if !bytes.Equal(file, bytes.TrimRight(got, "\x00")) {
+			t.Errorf("Get (%d stripes): got %q", stripes, got)
+		}
+	}
+}
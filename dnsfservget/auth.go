@@ -0,0 +1,58 @@
+package dnsfservget
+
+/*
+ * auth.go
+ * Authenticate queries with a MAC in the query name
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+)
+
+const (
+	// AuthLabel starts the label, between the first label of a query and
+	// the domain (or session label), holding a MAC of the first label,
+	// for dnsfserv started with -auth-key.
+	AuthLabel = "_a"
+
+	// AuthMACLen is the number of bytes of the HMAC-SHA256 put in the
+	// AuthLabel label.
+	AuthMACLen = 8
+)
+
+/* authEncoding encodes MACs in labels */
+var authEncoding = base32.NewEncoding(
+	"abcdefghijklmnopqrstuvwxyz234567",
+).WithPadding(base32.NoPadding)
+
+// AuthMAC returns the truncated HMAC-SHA256, keyed with key, of the first
+// label of a query, lowercase, as it would be put after AuthLabel.  The
+// label is split at its first hyphen into the offset (or a label such as
+// MetaLabel) and the file's name, and the MAC is of the two joined with a
+// pipe, i.e. offset|filename.
+func AuthMAC(key []byte, label string) string {
+	off, fname, _ := strings.Cut(strings.ToLower(label), "-")
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(off + "|" + fname))
+	return authEncoding.EncodeToString(m.Sum(nil)[:AuthMACLen])
+}
+
+// AuthName returns name with a label holding the AuthMAC of its first label
+// inserted after its first label.  If key is empty, name is returned
+// unchanged.
+func AuthName(key []byte, name string) string {
+	if 0 == len(key) {
+		return name
+	}
+	first, rest, ok := strings.Cut(name, ".")
+	if !ok {
+		return name
+	}
+	return first + "." + AuthLabel + "-" + AuthMAC(key, first) + "." + rest
+}
@@ -0,0 +1,94 @@
+package dnsfservget_test
+
+/*
+ * auth_test.go
+ * Tests for MACs in query names
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestAuthName(t *testing.T) {
+	key := []byte("kittens")
+	n := dnsfservget.AuthName(key, "0-payload.example.com")
+	ls := strings.Split(n, ".")
+	if 4 != len(ls) || "0-payload" != ls[0] ||
+		dnsfservget.AuthLabel+"-"+
+			dnsfservget.AuthMAC(key, "0-payload") != ls[1] {
+		t.Fatalf("Unexpected name %q", n)
+	}
+	if m := dnsfservget.AuthMAC(key, "0-PayLoad"); ls[1][3:] != m {
+		t.Errorf("MAC depends on case: %s", m)
+	}
+	for _, l := range []string{"1-payload", "0-payload2", "_meta-payload"} {
+		if m := dnsfservget.AuthMAC(key, l); ls[1][3:] == m {
+			t.Errorf("Same MAC for %s and 0-payload", l)
+		}
+	}
+	m := dnsfservget.AuthMAC([]byte("moose"), "0-payload")
+	if ls[1][3:] == m {
+		t.Errorf("Same MAC with different keys")
+	}
+	n = dnsfservget.AuthName(nil, "0-payload.example.com")
+	if "0-payload.example.com" != n {
+		t.Errorf("Name changed without a key: %s", n)
+	}
+}
+
+func TestGetterKey(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := bytes.Repeat([]byte("kittens"), 100)
+	s.SetFile("payload", file)
+	s.SetAuthKey([]byte("moose"))
+
+	/* With the key, everything works */
+	for _, hs := range []bool{false, true} {
+		g := dnsfservget.Getter{
+			Type:      dnsfservget.TypeTXT,
+			Name:      "payload",
+			Domain:    "example.com",
+			Querier:   q,
+			UseMeta:   true,
+			Handshake: hs,
+			Key:       []byte("moose"),
+		}
+		b, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			t.Fatalf("Get (handshake:%t): %s", hs, err)
+		}
+		if !bytes.Equal(file, b) {
+			t.Fatalf("Get (handshake:%t): wrong file", hs)
+		}
+		if _, err := g.Stat(); nil != err {
+			t.Errorf("Stat (handshake:%t): %s", hs, err)
+		}
+		if _, err := g.CRC(0, 10); nil != err {
+			t.Errorf("CRC (handshake:%t): %s", hs, err)
+		}
+	}
+
+	/* Without it, nothing does */
+	for _, k := range [][]byte{nil, []byte("kittens")} {
+		g := dnsfservget.Getter{
+			Type:    dnsfservget.TypeTXT,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: q,
+			Key:     k,
+		}
+		if _, err := ioutil.ReadAll(g.Get()); nil == err {
+			t.Errorf("No error with key %q", k)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package dnsfservget
+
+/*
+ * cache.go
+ * Cache retrieved files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheKey identifies a retrieved file in a Cache.  The file's metadata
+// changes when the file does, so old versions of a file aren't returned.
+type CacheKey struct {
+	Domain string
+	Name   string
+	Meta   FileMeta
+}
+
+// Cache stores whole files retrieved by Getter.Get so that they needn't be
+// retrieved again while they're unchanged.  A Cache's methods may be called
+// concurrently.
+type Cache interface {
+	// Get returns the file stored with key k, if there is one.
+	Get(k CacheKey) ([]byte, bool)
+
+	// Put stores the file b with key k.
+	Put(k CacheKey, b []byte) error
+}
+
+/* memoryCache is a Cache which keeps files in memory */
+type memoryCache struct {
+	l sync.Mutex
+	m map[CacheKey][]byte
+}
+
+// NewMemoryCache returns a Cache which stores files in memory.  Files are
+// never removed from the cache, though older versions of a file are replaced
+// when a newer one is stored.
+func NewMemoryCache() Cache {
+	return &memoryCache{m: make(map[CacheKey][]byte)}
+}
+
+/* Get implements Cache.Get */
+func (c *memoryCache) Get(k CacheKey) ([]byte, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	b, ok := c.m[k]
+	return b, ok
+}
+
+/* Put implements Cache.Put */
+func (c *memoryCache) Put(k CacheKey, b []byte) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	for ok := range c.m {
+		if ok.Domain == k.Domain && ok.Name == k.Name {
+			delete(c.m, ok)
+		}
+	}
+	c.m[k] = append([]byte(nil), b...)
+	return nil
+}
+
+/* cacheKey returns the key for g's file, which has metadata m. */
+func (g *Getter) cacheKey(m FileMeta) CacheKey {
+	return CacheKey{Domain: g.Domain, Name: g.Name, Meta: m}
+}
+
+// DirCache is a Cache which stores files in a directory, which will be
+// created if it doesn't exist.
+type DirCache string
+
+/* path returns the path to the file for k */
+func (d DirCache) path(k CacheKey) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s\x00%s\x00%d\x00%d\x00%x",
+		k.Domain,
+		k.Name,
+		k.Meta.Size,
+		k.Meta.Generation,
+		k.Meta.SHA256,
+	)))
+	return filepath.Join(string(d), hex.EncodeToString(h[:]))
+}
+
+// Get implements Cache.Get.  Files which can't be read are treated as not
+// being in the cache.
+func (d DirCache) Get(k CacheKey) ([]byte, bool) {
+	b, err := ioutil.ReadFile(d.path(k))
+	if nil != err {
+		return nil, false
+	}
+	return b, true
+}
+
+// Put implements Cache.Put.
+func (d DirCache) Put(k CacheKey, b []byte) error {
+	if err := os.MkdirAll(string(d), 0700); nil != err {
+		return err
+	}
+	/* Write to a temporary file first so Get never sees half a file */
+	f, err := ioutil.TempFile(string(d), ".tmp-")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); nil != err {
+		return err
+	}
+	return os.Rename(f.Name(), d.path(k))
+}
@@ -0,0 +1,83 @@
+package dnsfservget_test
+
+/*
+ * cache_test.go
+ * Tests for caching retrieved files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* countingQuerier counts A queries */
+type countingQuerier struct {
+	dnsfservget.Querier
+	n int64
+}
+
+func (c *countingQuerier) A(name string) ([]string, error) {
+	atomic.AddInt64(&c.n, 1)
+	return c.Querier.A(name)
+}
+
+func TestGetterCache(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		cache dnsfservget.Cache
+	}{
+		{"memory", dnsfservget.NewMemoryCache()},
+		{"dir", dnsfservget.DirCache(t.TempDir())},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			s, q := dnsfservtest.Pair()
+			defer s.Close()
+			cq := &countingQuerier{Querier: q}
+
+			/* get gets the file and returns how many A queries it
+			took */
+			get := func(want string) int64 {
+				t.Helper()
+				g := dnsfservget.Getter{
+					Type:    dnsfservget.TypeA,
+					Name:    "payload",
+					Domain:  "example.com",
+					Querier: cq,
+					Cache:   c.cache,
+				}
+				start := atomic.LoadInt64(&cq.n)
+				b, err := ioutil.ReadAll(g.Get())
+				if nil != err {
+					t.Fatalf("Get: %s", err)
+				}
+				if want != string(b) {
+					t.Fatalf("Got %q, want %q", b, want)
+				}
+				return atomic.LoadInt64(&cq.n) - start
+			}
+
+			/* First time should query, second shouldn't */
+			s.SetFile("payload", []byte("kittens"))
+			if n := get("kittens"); 0 == n {
+				t.Errorf("No queries for first Get")
+			}
+			if n := get("kittens"); 0 != n {
+				t.Errorf("%d queries for cached Get", n)
+			}
+
+			/* A changed file should be gotten again */
+			s.SetFile("payload", []byte("moose"))
+			if n := get("moose"); 0 == n {
+				t.Errorf("No queries after file changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package dnsfservget
+
+/*
+ * cancel.go
+ * Stop transfers when the caller's done with them
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrCanceled is the error with which a transfer started with Get fails when
+// the returned io.ReadCloser is closed before the whole file has been read.
+var ErrCanceled = errors.New("transfer canceled")
+
+/* getReader is the io.ReadCloser returned by Get.  Closing it stops the
+query loop as well as the pipe. */
+type getReader struct {
+	*io.PipeReader
+	stop chan struct{}
+	once sync.Once
+}
+
+/* Close implements io.Closer.  It stops the transfer, which ends after any
+query in progress returns, without making any more queries. */
+func (r *getReader) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	return r.PipeReader.CloseWithError(ErrCanceled)
+}
+
+/* stoppableQuerier is implemented by Queriers which wait between attempts at a
+query, so they can stop waiting when a transfer's canceled. */
+type stoppableQuerier interface {
+	/* withStop returns a copy of the Querier which stops waiting and
+	fails queries with ErrCanceled when stop is closed. */
+	withStop(stop <-chan struct{}) Querier
+}
+
+/* querier returns g.Querier, set up to stop waiting when the transfer's
+canceled if it's a stoppableQuerier. */
+func (g *Getter) querier() Querier {
+	if sq, ok := g.Querier.(stoppableQuerier); ok && nil != g.stop {
+		return sq.withStop(g.stop)
+	}
+	return g.Querier
+}
+
+/* canceled returns true if the reader returned by Get has been closed.  It
+always returns false for transfers started with GetTo. */
+func (g *Getter) canceled() bool {
+	select {
+	case <-g.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+/* sleep sleeps for d, or until the transfer is canceled.  It returns
+ErrCanceled if the transfer was canceled. */
+func (g *Getter) sleep(d time.Duration) error {
+	if 0 >= d {
+		if g.canceled() {
+			return ErrCanceled
+		}
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-g.stop:
+		return ErrCanceled
+	}
+}
@@ -0,0 +1,76 @@
+package dnsfservget_test
+
+/*
+ * cancel_test.go
+ * Tests for canceling transfers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+	"go.uber.org/goleak"
+)
+
+func TestGetterCancel(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens and puppies"))
+
+	for _, c := range []struct {
+		name  string
+		pacer *dnsfservget.Pacer
+		read  int
+	}{
+		/* Waiting to make the next query */
+		{"pacer", &dnsfservget.Pacer{MinDelay: time.Hour}, 3},
+		/* Waiting for someone to read */
+		{"unread", nil, 0},
+	} {
+		failed := make(chan error, 1)
+		g := dnsfservget.Getter{
+			Type:    dnsfservget.TypeA,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: q,
+			Pacer:   c.pacer,
+			OnStateChange: func(sc dnsfservget.StateChange) {
+				if dnsfservget.StateFailed == sc.To {
+					failed <- sc.Err
+				}
+			},
+		}
+		r := g.Get()
+		if 0 != c.read {
+			if _, err := io.ReadFull(
+				r,
+				make([]byte, c.read),
+			); nil != err {
+				t.Fatalf("%s: reading: %s", c.name, err)
+			}
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := r.Close(); nil != err {
+			t.Errorf("%s: close: %s", c.name, err)
+		}
+
+		/* The transfer should stop right away */
+		select {
+		case err := <-failed:
+			if !errors.Is(err, dnsfservget.ErrCanceled) {
+				t.Errorf("%s: failed with %v", c.name, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: transfer not canceled", c.name)
+		}
+	}
+}
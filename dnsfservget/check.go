@@ -0,0 +1,243 @@
+package dnsfservget
+
+/*
+ * check.go
+ * Work out what gets through the path to dnsfserv
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckLabel replaces the offset in queries made by Probe.  Such queries are
+// of the form
+//   _check-<size>-<nonce>.domain
+// and are answered with the first size bytes of CheckPattern, encoded as for
+// a file chunk of the query's type, or with an NXDomain if size is nx.  The
+// size is in base36.
+const CheckLabel = "_check"
+
+// MaxCheckSize is the largest size dnsfserv will put in the answer to a
+// Probe's query.  Its base64 encoding just fits in a TXT record in a
+// maximum-sized message.
+const MaxCheckSize = 48000
+
+// ProbeRTTs is the number of queries Probe makes to measure latency.
+const ProbeRTTs = 3
+
+/* checkNX is the size in a query which should get an NXDomain */
+const checkNX = "nx"
+
+/* checkTypes are the QTypes Probe tries */
+var checkTypes = []QType{
+	TypeA, TypeAAAA, TypeTXT, TypeBigTXT, TypeNULL, TypeCNAME, TypeMX,
+	TypeSRV,
+}
+
+/* checkTXTSizes are the TXT payload sizes Probe tries, in order */
+var checkTXTSizes = []uint{
+	MaxDecode, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, MaxCheckSize,
+}
+
+// Report describes the path between a Querier and dnsfserv, as worked out by
+// Probe.
+type Report struct {
+	// MinRTT, MeanRTT, and MaxRTT describe how long answers to small TXT
+	// queries took to come back.
+	MinRTT  time.Duration
+	MeanRTT time.Duration
+	MaxRTT  time.Duration
+
+	// Types holds, for each built-in QType, the error which occurred
+	// getting a full-sized answer of that type, or nil if the answer came
+	// back intact.
+	Types map[QType]error
+
+	// NXDomain is true if NXDomains make it back as NXDomains and not,
+	// say, a resolver's search page.  Getters need this to find the end
+	// of files of unknown size.
+	NXDomain bool
+
+	// MaxTXT is the largest number of payload bytes which came back intact
+	// in a TXT answer, or 0 if none did.
+	MaxTXT uint
+}
+
+// String returns r as human-readable lines.
+func (r Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(
+		&sb,
+		"RTT: min %s, mean %s, max %s\n",
+		r.MinRTT,
+		r.MeanRTT,
+		r.MaxRTT,
+	)
+	for _, t := range checkTypes {
+		err, ok := r.Types[t]
+		switch {
+		case !ok:
+			continue
+		case nil == err:
+			fmt.Fprintf(&sb, "%s: ok\n", t)
+		default:
+			fmt.Fprintf(&sb, "%s: %s\n", t, err)
+		}
+	}
+	fmt.Fprintf(&sb, "NXDomain: %t\n", r.NXDomain)
+	fmt.Fprintf(&sb, "Max TXT payload: %d bytes\n", r.MaxTXT)
+	return sb.String()
+}
+
+// CheckPattern returns the first n bytes of the pattern with which dnsfserv
+// answers queries made by Probe.  Every byte value appears, to catch
+// middleboxes which mangle some of them.
+func CheckPattern(n uint) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+// Probe queries dnsfserv via q for the names in domain used by CheckLabel
+// and reports on what made it back.  If q is nil, DefaultQuerier() is used.
+// Types which can't be queried with q are reported as such in the returned
+// Report's Types.  An error is returned only if none of the queries to
+// measure latency are answered.
+func Probe(domain string, q Querier) (Report, error) {
+	if nil == q {
+		q = DefaultQuerier()
+	}
+	domain = strings.Trim(domain, ".")
+	r := Report{Types: make(map[QType]error)}
+
+	/* Time a few small queries */
+	var (
+		tot     time.Duration
+		nOK     int
+		lastErr error
+	)
+	for i := 0; i < ProbeRTTs; i++ {
+		start := time.Now()
+		if err := checkTXT(q, domain, MaxDecode); nil != err {
+			lastErr = err
+			continue
+		}
+		d := time.Since(start)
+		if 0 == nOK || d < r.MinRTT {
+			r.MinRTT = d
+		}
+		if d > r.MaxRTT {
+			r.MaxRTT = d
+		}
+		tot += d
+		nOK++
+	}
+	if 0 == nOK {
+		return Report{}, fmt.Errorf(
+			"no latency queries answered: %w",
+			lastErr,
+		)
+	}
+	r.MeanRTT = tot / time.Duration(nOK)
+
+	/* See which types work */
+	for _, t := range checkTypes {
+		r.Types[t] = checkType(q, domain, t)
+	}
+
+	/* Make sure we can tell where files end */
+	_, err := q.A(checkName(domain, checkNX))
+	var de *net.DNSError
+	r.NXDomain = errors.As(err, &de) && de.IsNotFound
+
+	/* Find the biggest TXT answer which gets through */
+	for _, n := range checkTXTSizes {
+		if nil != checkTXT(q, domain, n) {
+			break
+		}
+		r.MaxTXT = n
+	}
+
+	return r, nil
+}
+
+/* checkName returns a name in domain with which to ask for a check answer of
+the given size, which should be base36 or checkNX.  Each name has a random
+nonce to keep resolvers from answering from their caches. */
+func checkName(domain, size string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return fmt.Sprintf(
+		"%s-%s-%s.%s",
+		CheckLabel,
+		size,
+		strconv.FormatUint(binary.BigEndian.Uint64(b[:]), 36),
+		domain,
+	)
+}
+
+/* checkTXT asks for n bytes of the pattern in a TXT record and makes sure
+they come back intact. */
+func checkTXT(q Querier, domain string, n uint) error {
+	name := checkName(domain, strconv.FormatUint(uint64(n), 36))
+	as, err := q.TXT(name)
+	if nil != err {
+		return err
+	}
+	if 0 == len(as) {
+		return ErrNoData
+	}
+	b, err := base64.RawStdEncoding.DecodeString(as[0])
+	if nil != err {
+		return fmt.Errorf("decoding answer: %w", err)
+	}
+	if !bytes.Equal(CheckPattern(n), b) {
+		return errors.New("answer corrupted")
+	}
+	return nil
+}
+
+/* checkType asks for a full-sized answer of type t and makes sure it comes
+back intact. */
+func checkType(q Querier, domain string, t QType) error {
+	qi, err := lookupQType(t)
+	if nil != err {
+		return err
+	}
+	size := qi.payloadSize
+	if MaxCheckSize < size {
+		size = MaxCheckSize
+	}
+	name := checkName(domain, strconv.FormatUint(uint64(size), 36))
+	as, err := qi.doQuery(q, name)
+	if nil != err {
+		return err
+	}
+	if 0 == len(as) {
+		return ErrNoData
+	}
+	g := Getter{Type: t, Domain: domain}
+	buf := make([]byte, size)
+	n, err := g.DecodeResponse(buf, as[0])
+	if nil != err {
+		return fmt.Errorf("decoding answer: %w", err)
+	}
+	if !bytes.Equal(CheckPattern(size), buf[:n]) {
+		return errors.New("answer corrupted")
+	}
+	return nil
+}
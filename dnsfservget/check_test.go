@@ -0,0 +1,82 @@
+package dnsfservget_test
+
+/*
+ * check_test.go
+ * Tests for probing the path to dnsfserv
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* plainQuerier hides a Querier's other methods, such as Query */
+type plainQuerier struct{ dnsfservget.Querier }
+
+func TestProbe(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+
+	r, err := dnsfservget.Probe("example.com.", q)
+	if nil != err {
+		t.Fatalf("Probe: %s", err)
+	}
+	if 0 == r.MinRTT || r.MinRTT > r.MeanRTT || r.MeanRTT > r.MaxRTT {
+		t.Errorf(
+			"Odd RTTs: min %s, mean %s, max %s",
+			r.MinRTT,
+			r.MeanRTT,
+			r.MaxRTT,
+		)
+	}
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeAAAA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeBigTXT,
+		dnsfservget.TypeNULL,
+		dnsfservget.TypeCNAME,
+		dnsfservget.TypeMX,
+		dnsfservget.TypeSRV,
+	} {
+		err, ok := r.Types[qt]
+		if !ok {
+			t.Errorf("%s not checked", qt)
+		} else if nil != err {
+			t.Errorf("%s: %s", qt, err)
+		}
+	}
+	if !r.NXDomain {
+		t.Errorf("NXDomain not detected")
+	}
+	if dnsfservget.MaxCheckSize != r.MaxTXT {
+		t.Errorf(
+			"MaxTXT: got %d, want %d",
+			r.MaxTXT,
+			dnsfservget.MaxCheckSize,
+		)
+	}
+
+	/* Types needing a TypeQuerier shouldn't work without one */
+	r, err = dnsfservget.Probe("example.com", plainQuerier{q})
+	if nil != err {
+		t.Fatalf("Probe without TypeQuerier: %s", err)
+	}
+	if nil != r.Types[dnsfservget.TypeTXT] {
+		t.Errorf("TXT failed: %s", r.Types[dnsfservget.TypeTXT])
+	}
+	if nil == r.Types[dnsfservget.TypeNULL] {
+		t.Errorf("NULL worked without a TypeQuerier")
+	}
+
+	/* No answers is an error */
+	s.Close()
+	if _, err := dnsfservget.Probe("example.com", q); nil == err {
+		t.Errorf("No error without a server")
+	}
+}
@@ -0,0 +1,111 @@
+package dnsfservget
+
+/*
+ * chunk.go
+ * Get a file one chunk at a time
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Chunk is a chunk of a file, returned by Getter.Next.  It's everything needed
+// to query for the chunk and decode the response, for callers which want to
+// make the queries themselves.
+type Chunk struct {
+	// Offset is the chunk's offset into the file.  For striped files,
+	// this is the offset into the stripe.
+	Offset uint
+
+	// Name is the name to query for the chunk, in records of type Type.
+	Name string
+
+	// Type is the type of query to make.
+	Type QType
+
+	g     *Getter
+	fname string   /* File or stripe name */
+	s     *session /* Set after a handshake */
+}
+
+// Next returns the next chunk of the file and advances g to the chunk after
+// it.  Next doesn't make any queries.  Instead, the caller queries for the
+// returned Chunk's Name, scheduling queries and using whichever transport it
+// likes, and passes the response to the Chunk's Decode method.  An NXDOMAIN
+// response means the end of the file.  Next is what Get uses to get chunks,
+// and should not be called on a Getter which has been or will be used with
+// Get.  Unlike Get, Next doesn't handshake, query for metadata or checksums,
+// or decrypt files encrypted with a passphrase; callers who need those should
+// use Get.
+func (g *Getter) Next() (Chunk, error) {
+	q, name, off, err := g.nextName()
+	if nil != err {
+		return Chunk{}, err
+	}
+	return Chunk{
+		Offset: off,
+		Name:   q,
+		Type:   g.Type,
+		g:      g,
+		fname:  name,
+		s:      g.getSession(),
+	}, nil
+}
+
+// Decode decodes res, the response to a query for c.Name, and returns the
+// chunk's bytes of the file.  Padding is removed, sequence bytes are checked
+// and removed, and, with a session key from a handshake, the chunk is
+// decrypted.  As with Getter.DecodeResponse, for TypeMultiA and TypeMultiAAAA
+// res should hold all of the answers, separated by spaces.  The last chunk of
+// some types may end in NULs, as the file's size isn't known without
+// metadata.  Decode may be called concurrently.
+func (c Chunk) Decode(res string) ([]byte, error) {
+	qi, err := lookupQType(c.Type)
+	if nil != err {
+		return nil, err
+	}
+	buf := make([]byte, qi.payloadSize)
+	n, err := c.decode(buf, res)
+	if nil != err {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+/* decode is like Decode, but decodes into buf, which must be at least the
+payload size of c.Type, and returns the number of bytes decoded. */
+func (c Chunk) decode(buf []byte, res string) (int, error) {
+	n, err := c.g.DecodeResponse(buf, res)
+	if nil != err {
+		return 0, fmt.Errorf(
+			"decoding response %q to %q: %w",
+			res,
+			c.Name,
+			err,
+		)
+	}
+	if 0 > n {
+		return 0, errors.New("negative number of bytes decoded")
+	}
+	if n, err = c.g.unpad(buf, n); nil != err {
+		return 0, fmt.Errorf("unpadding %q: %w", c.Name, err)
+	}
+	if n, err = c.g.checkSequence(buf, n, c.Offset); nil != err {
+		return 0, fmt.Errorf("checking %q: %w", c.Name, err)
+	}
+	if nil != c.s {
+		if err := SessionXOR(
+			c.s.key,
+			c.fname,
+			uint64(c.Offset),
+			buf[:n],
+		); nil != err {
+			return 0, fmt.Errorf("decrypting: %w", err)
+		}
+	}
+	return n, nil
+}
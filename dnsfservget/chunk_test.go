@@ -0,0 +1,94 @@
+package dnsfservget_test
+
+/*
+ * chunk_test.go
+ * Tests for getting chunks one at a time
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterNext(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 101)
+	for i := range file {
+		file[i] = byte(i * 3)
+	}
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeMultiAAAA,
+	} {
+		for _, seq := range []bool{false, true} {
+			g := dnsfservget.Getter{
+				Type:     qt,
+				Name:     "payload",
+				Domain:   "example.com",
+				Sequence: seq,
+			}
+			var got []byte
+			for {
+				c, err := g.Next()
+				if nil != err {
+					t.Fatalf("%s: Next: %s", qt, err)
+				}
+				var as []string
+				switch qt {
+				case dnsfservget.TypeTXT:
+					as, err = q.TXT(c.Name)
+				case dnsfservget.TypeMultiAAAA:
+					as, err = q.AAAA(c.Name)
+				default:
+					as, err = q.A(c.Name)
+				}
+				var de *net.DNSError
+				if errors.As(err, &de) && de.IsNotFound {
+					break
+				} else if nil != err {
+					t.Fatalf("%s: query: %s", qt, err)
+				}
+				if uint(len(got)) != c.Offset {
+					t.Fatalf(
+						"%s: chunk offset %d after %d "+
+							"bytes",
+						qt,
+						c.Offset,
+						len(got),
+					)
+				}
+				b, err := c.Decode(strings.Join(as, " "))
+				if nil != err {
+					t.Fatalf("%s: Decode: %s", qt, err)
+				}
+				got = append(got, b...)
+			}
+			/* The last chunk may be padded with NULs */
+			if len(got) < len(file) || !bytes.Equal(
+				file,
+				got[:len(file)],
+			) || 0 != len(bytes.Trim(got[len(file):], "\x00")) {
+				t.Errorf(
+					"%s (sequence:%t): got %02x, want %02x",
+					qt,
+					seq,
+					got,
+					file,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package dnsfservget
+
+/*
+ * codec.go
+ * Pluggable DNS message packing and parsing
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Codec packs DNS queries and parses DNS responses for the Queriers in this
+// package which speak DNS themselves, as well as for AppendQuery and
+// ParseDoHAnswer.  DNSMessageCodec, the default, uses
+// golang.org/x/net/dns/dnsmessage.  Building with the miekg tag adds
+// MiekgCodec, which uses github.com/miekg/dns.
+type Codec interface {
+	/* AppendQuery appends a recursive query with the given ID for the
+	fully-qualified name with the given record type and class IN to b and
+	returns the resulting slice. */
+	AppendQuery(b []byte, id uint16, name string, rrType uint16) ([]byte, error)
+
+	/* ParseResponse parses the DNS message in m.  The records in the
+	authority section need not be parsed. */
+	ParseResponse(m []byte) (*Response, error)
+}
+
+// DefaultCodec is the Codec used to pack queries and parse responses.  It
+// should be set before any queries are made.
+var DefaultCodec Codec = DNSMessageCodec{}
+
+// Response is a DNS message parsed by a Codec.
+type Response struct {
+	ID          uint16
+	Response    bool
+	Truncated   bool
+	RCode       uint16
+	Questions   []Question
+	Answers     []Record
+	Additionals []Record
+}
+
+// Question is a question from a Response.
+type Question struct {
+	Name string /* Fully-qualified */
+	Type uint16
+}
+
+// Record is a resource record from a Response.  Data holds the record's
+// uncompressed RDATA, and Target holds the target of a CNAME.  The names in
+// MX and SRV records' RDATA are uncompressed as well.
+type Record struct {
+	Name   string /* Fully-qualified */
+	Type   uint16
+	TTL    uint32
+	Data   []byte
+	Target string
+}
+
+// DNSMessageCodec is a Codec which uses golang.org/x/net/dns/dnsmessage.
+type DNSMessageCodec struct{}
+
+// AppendQuery implements Codec.AppendQuery.
+func (DNSMessageCodec) AppendQuery(
+	b []byte,
+	id uint16,
+	name string,
+	rrType uint16,
+) ([]byte, error) {
+	qn, err := dnsmessage.NewName(name)
+	if nil != err {
+		return nil, err
+	}
+	return (&dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  qn,
+			Type:  dnsmessage.Type(rrType),
+			Class: dnsmessage.ClassINET,
+		}},
+	}).AppendPack(b)
+}
+
+// ParseResponse implements Codec.ParseResponse.
+func (DNSMessageCodec) ParseResponse(m []byte) (*Response, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(m)
+	if nil != err {
+		return nil, fmt.Errorf("unpacking header: %w", err)
+	}
+	res := &Response{
+		ID:        h.ID,
+		Response:  h.Response,
+		Truncated: h.Truncated,
+		RCode:     uint16(h.RCode),
+	}
+	qs, err := p.AllQuestions()
+	if nil != err {
+		return nil, fmt.Errorf("unpacking questions: %w", err)
+	}
+	for _, q := range qs {
+		res.Questions = append(res.Questions, Question{
+			Name: q.Name.String(),
+			Type: uint16(q.Type),
+		})
+	}
+	if res.Answers, err = dnsmessageRecords(&p, p.AnswerHeader); nil != err {
+		return nil, fmt.Errorf("unpacking answers: %w", err)
+	}
+	if err := p.SkipAllAuthorities(); nil != err {
+		return nil, fmt.Errorf("skipping authorities: %w", err)
+	}
+	if res.Additionals, err = dnsmessageRecords(
+		&p,
+		p.AdditionalHeader,
+	); nil != err {
+		return nil, fmt.Errorf("unpacking additionals: %w", err)
+	}
+	return res, nil
+}
+
+/* dnsmessageRecords parses the records in the section of the message being
+parsed by p which has its headers returned by next. */
+func dnsmessageRecords(
+	p *dnsmessage.Parser,
+	next func() (dnsmessage.ResourceHeader, error),
+) ([]Record, error) {
+	var rs []Record
+	for {
+		h, err := next()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return rs, nil
+		} else if nil != err {
+			return nil, err
+		}
+		r := Record{
+			Name: h.Name.String(),
+			Type: uint16(h.Type),
+			TTL:  h.TTL,
+		}
+		/* CNAMEs may be compressed, so need to be parsed */
+		if dnsmessage.TypeCNAME == h.Type {
+			c, err := p.CNAMEResource()
+			if nil != err {
+				return nil, fmt.Errorf("unpacking CNAME: %w", err)
+			}
+			r.Target = c.CNAME.String()
+		} else if dnsmessage.TypeMX == h.Type {
+			/* As may MX records */
+			m, err := p.MXResource()
+			if nil != err {
+				return nil, fmt.Errorf("unpacking MX: %w", err)
+			}
+			n, err := wireName(m.MX.String())
+			if nil != err {
+				return nil, fmt.Errorf("packing MX: %w", err)
+			}
+			r.Data = append([]byte{byte(m.Pref >> 8), byte(m.Pref)}, n...)
+		} else if dnsmessage.TypeSRV == h.Type {
+			/* And SRV records, from sloppy servers */
+			s, err := p.SRVResource()
+			if nil != err {
+				return nil, fmt.Errorf("unpacking SRV: %w", err)
+			}
+			n, err := wireName(s.Target.String())
+			if nil != err {
+				return nil, fmt.Errorf("packing SRV: %w", err)
+			}
+			r.Data = append([]byte{
+				byte(s.Priority >> 8), byte(s.Priority),
+				byte(s.Weight >> 8), byte(s.Weight),
+				byte(s.Port >> 8), byte(s.Port),
+			}, n...)
+		} else {
+			u, err := p.UnknownResource()
+			if nil != err {
+				return nil, fmt.Errorf(
+					"unpacking %s record: %w",
+					h.Type,
+					err,
+				)
+			}
+			r.Data = u.Data
+		}
+		rs = append(rs, r)
+	}
+}
@@ -0,0 +1,102 @@
+//go:build miekg
+
+package dnsfservget
+
+/*
+ * codec_miekg.go
+ * DNS message packing and parsing with github.com/miekg/dns
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// MiekgCodec is a Codec which uses github.com/miekg/dns, which understands
+// more record types than golang.org/x/net/dns/dnsmessage.  It is only
+// available when built with the miekg tag.
+type MiekgCodec struct{}
+
+// AppendQuery implements Codec.AppendQuery.
+func (MiekgCodec) AppendQuery(
+	b []byte,
+	id uint16,
+	name string,
+	rrType uint16,
+) ([]byte, error) {
+	m := new(dns.Msg)
+	m.Id = id
+	m.RecursionDesired = true
+	m.Question = []dns.Question{{
+		Name:   dns.Fqdn(name),
+		Qtype:  rrType,
+		Qclass: dns.ClassINET,
+	}}
+	p, err := m.Pack()
+	if nil != err {
+		return nil, err
+	}
+	return append(b, p...), nil
+}
+
+// ParseResponse implements Codec.ParseResponse.
+func (MiekgCodec) ParseResponse(m []byte) (*Response, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(m); nil != err {
+		return nil, err
+	}
+	res := &Response{
+		ID:        msg.Id,
+		Response:  msg.Response,
+		Truncated: msg.Truncated,
+		RCode:     uint16(msg.Rcode),
+	}
+	for _, q := range msg.Question {
+		res.Questions = append(res.Questions, Question{
+			Name: q.Name,
+			Type: q.Qtype,
+		})
+	}
+	var err error
+	if res.Answers, err = miekgRecords(msg.Answer); nil != err {
+		return nil, fmt.Errorf("answers: %w", err)
+	}
+	if res.Additionals, err = miekgRecords(msg.Extra); nil != err {
+		return nil, fmt.Errorf("additionals: %w", err)
+	}
+	return res, nil
+}
+
+/* miekgRecords converts rrs to Records. */
+func miekgRecords(rrs []dns.RR) ([]Record, error) {
+	rs := make([]Record, 0, len(rrs))
+	for _, rr := range rrs {
+		h := rr.Header()
+		r := Record{Name: h.Name, Type: h.Rrtype, TTL: h.Ttl}
+		if c, ok := rr.(*dns.CNAME); ok {
+			r.Target = c.Target
+			rs = append(rs, r)
+			continue
+		}
+		/* Pack it uncompressed to get at the RDATA, which starts
+		after the name and ten bytes of type, class, TTL, and
+		length */
+		buf := make([]byte, dns.Len(rr))
+		off, err := dns.PackRR(rr, buf, 0, nil, false)
+		if nil != err {
+			return nil, fmt.Errorf("packing %s: %w", h.Name, err)
+		}
+		nb := make([]byte, 256)
+		nl, err := dns.PackDomainName(h.Name, nb, 0, nil, false)
+		if nil != err {
+			return nil, fmt.Errorf("packing name %s: %w", h.Name, err)
+		}
+		r.Data = buf[nl+10 : off]
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
@@ -0,0 +1,15 @@
+//go:build miekg
+
+package dnsfservget
+
+/*
+ * codec_miekg_test.go
+ * Tests for DNS message packing and parsing with github.com/miekg/dns
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "testing"
+
+func TestMiekgCodec(t *testing.T) { testCodec(t, MiekgCodec{}) }
@@ -0,0 +1,97 @@
+package dnsfservget
+
+/*
+ * codec_test.go
+ * Tests for DNS message packing and parsing
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSMessageCodec(t *testing.T) { testCodec(t, DNSMessageCodec{}) }
+
+/* testCodec checks that c can roll a query and parse a response. */
+func testCodec(t *testing.T, c Codec) {
+	t.Helper()
+
+	/* Roll a query */
+	q, err := c.AppendQuery(nil, 1234, "0-payload.example.com.", 10)
+	if nil != err {
+		t.Fatalf("AppendQuery: %s", err)
+	}
+
+	/* Turn it into a response with a CNAME, a compressed MX, and
+	something x/net doesn't know about */
+	var m dnsmessage.Message
+	if err := m.Unpack(q); nil != err {
+		t.Fatalf("Unpacking query: %s", err)
+	}
+	if !m.RecursionDesired || 1 != len(m.Questions) {
+		t.Fatalf("Incorrect query %+v", m)
+	}
+	m.Response = true
+	m.Truncated = true
+	target := dnsmessage.MustNewName("0-payload.c.example.com.")
+	m.Answers = []dnsmessage.Resource{{
+		Header: dnsmessage.ResourceHeader{
+			Name:  m.Questions[0].Name,
+			Type:  dnsmessage.TypeCNAME,
+			Class: dnsmessage.ClassINET,
+		},
+		Body: &dnsmessage.CNAMEResource{CNAME: target},
+	}, {
+		Header: dnsmessage.ResourceHeader{
+			Name:  m.Questions[0].Name,
+			Type:  dnsmessage.TypeMX,
+			Class: dnsmessage.ClassINET,
+		},
+		Body: &dnsmessage.MXResource{Pref: 258, MX: target},
+	}}
+	m.Additionals = []dnsmessage.Resource{{
+		Header: dnsmessage.ResourceHeader{
+			Name:  target,
+			Type:  10,
+			Class: dnsmessage.ClassINET,
+		},
+		Body: &dnsmessage.UnknownResource{Type: 10, Data: []byte("kittens")},
+	}}
+	b, err := m.Pack()
+	if nil != err {
+		t.Fatalf("Packing response: %s", err)
+	}
+
+	/* Parse it back */
+	res, err := c.ParseResponse(b)
+	if nil != err {
+		t.Fatalf("ParseResponse: %s", err)
+	}
+	if !res.Response || !res.Truncated || 1234 != res.ID ||
+		0 != res.RCode {
+		t.Errorf("Incorrect header %+v", res)
+	}
+	if 1 != len(res.Questions) ||
+		"0-payload.example.com." != res.Questions[0].Name ||
+		10 != res.Questions[0].Type {
+		t.Errorf("Incorrect questions %+v", res.Questions)
+	}
+	if 2 != len(res.Answers) || target.String() != res.Answers[0].Target {
+		t.Errorf("Incorrect answers %+v", res.Answers)
+	} else if mx := append(
+		[]byte{1, 2},
+		"\x090-payload\x01c\x07example\x03com\x00"...,
+	); !bytes.Equal(mx, res.Answers[1].Data) {
+		t.Errorf("Incorrect MX RDATA %q", res.Answers[1].Data)
+	}
+	if 1 != len(res.Additionals) ||
+		target.String() != res.Additionals[0].Name ||
+		!bytes.Equal([]byte("kittens"), res.Additionals[0].Data) {
+		t.Errorf("Incorrect additionals %+v", res.Additionals)
+	}
+}
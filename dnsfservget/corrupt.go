@@ -0,0 +1,49 @@
+package dnsfservget
+
+/*
+ * corrupt.go
+ * Retry corrupt chunks past resolvers' caches
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "errors"
+
+/* fetchChunk is like fetchChunkOnce, but if g.RetryCorrupt is set and the
+chunk is corrupt, it's retrieved again, with nonces, up to CRCTries times. */
+func (g *Getter) fetchChunk(
+	qi qtypeInfo,
+	buf []byte,
+	written uint,
+) (n int, q string, eof bool, err error) {
+	start := g.nextOff()
+	for try := 1; ; try++ {
+		n, q, eof, err = g.fetchChunkOnce(qi, buf, written)
+		if !g.RetryCorrupt || CRCTries <= try || !isCorrupt(err) {
+			return n, q, eof, err
+		}
+		g.ms.retries++
+		g.setOff(start)
+		if 1 == try {
+			defer g.setBust(g.setBust(true))
+		}
+	}
+}
+
+/* isCorrupt returns true if err means a chunk was corrupt, as opposed to
+missing or undecodable. */
+func isCorrupt(err error) bool {
+	return errors.Is(err, ErrSequenceMismatch) ||
+		errors.Is(err, ErrBadPadding)
+}
+
+/* setBust sets whether queries for chunks get nonces, even if g.Nonce isn't
+set, to get past resolvers' caches.  It returns the previous setting. */
+func (g *Getter) setBust(on bool) bool {
+	g.l.Lock()
+	defer g.l.Unlock()
+	was := g.bust
+	g.bust = on
+	return was
+}
@@ -0,0 +1,115 @@
+package dnsfservget_test
+
+/*
+ * corrupt_test.go
+ * Tests for retrying corrupt chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* stickyQuerier answers queries for the chunk at offset off with the first
+chunk, like a resolver with a bad cache entry, unless the query has a nonce.
+It notes the queries with nonces. */
+type stickyQuerier struct {
+	dnsfservget.Querier
+	off    string /* Base36 */
+	l      sync.Mutex
+	nonced []string
+}
+
+func (q *stickyQuerier) TXT(name string) ([]string, error) {
+	if strings.Contains(name, "."+dnsfservget.NonceLabel+"-") {
+		q.l.Lock()
+		q.nonced = append(q.nonced, name)
+		q.l.Unlock()
+	} else if rest := strings.TrimPrefix(name, q.off+"-"); rest != name {
+		name = "0-" + rest
+	}
+	return q.Querier.TXT(name)
+}
+
+func TestGetterRetryCorrupt(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1001)
+	for i := range file {
+		file[i] = byte(i * 13)
+	}
+	s.SetFile("payload", file)
+	ps, err := dnsfservget.TypeTXT.PayloadSize()
+	if nil != err {
+		t.Fatalf("Getting TXT payload size: %s", err)
+	}
+
+	for _, c := range []struct {
+		name        string
+		sequence    bool
+		verifyEvery uint
+		size        uint /* Chunk size */
+	}{
+		{"sequence", true, 0, ps - 1},
+		{"checksum", false, 2, ps},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			/* The third chunk is stuck in the cache */
+			off := strconv.FormatUint(uint64(2*c.size), 36)
+			get := func(
+				retry bool,
+			) ([]byte, *stickyQuerier, error) {
+				sq := &stickyQuerier{Querier: q, off: off}
+				g := dnsfservget.Getter{
+					Type:         dnsfservget.TypeTXT,
+					Name:         "payload",
+					Domain:       "example.com",
+					Querier:      sq,
+					UseMeta:      true,
+					Sequence:     c.sequence,
+					VerifyEvery:  c.verifyEvery,
+					RetryCorrupt: retry,
+				}
+				b, err := ioutil.ReadAll(g.Get())
+				return b, sq, err
+			}
+
+			/* Without retrying with nonces, the bad chunk sticks */
+			if _, _, err := get(false); !errors.Is(
+				err,
+				dnsfservget.ErrSequenceMismatch,
+			) && !errors.Is(err, dnsfservget.ErrCRCMismatch) {
+				t.Errorf("Without retries: %v", err)
+			}
+
+			/* With them, we get past it */
+			b, sq, err := get(true)
+			if nil != err {
+				t.Fatalf("With retries: %s", err)
+			}
+			if !bytes.Equal(file, b) {
+				t.Errorf("With retries: wrong file")
+			}
+			if 0 == len(sq.nonced) {
+				t.Errorf("No queries with nonces")
+			}
+			for _, n := range sq.nonced {
+				if !strings.HasPrefix(n, off+"-") &&
+					0 == c.verifyEvery {
+					t.Errorf("Unexpected nonce in %s", n)
+				}
+			}
+		})
+	}
+}
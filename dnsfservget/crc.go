@@ -0,0 +1,195 @@
+package dnsfservget
+
+/*
+ * crc.go
+ * Verify windows of chunks with CRC32 checkpoints
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CRCLabel replaces the offset in queries for a checksum of part of a
+	// file.  Such queries are of the form
+	//  _crc-<base36 offset>-<base36 length>-<filename>
+	CRCLabel = "_crc"
+
+	// MaxCRCLen is the largest number of bytes dnsfserv will checksum.
+	MaxCRCLen = 1 << 20
+
+	// CRCTries is the number of times Get will try to retrieve a window of
+	// chunks whose checksum doesn't match.
+	CRCTries = 3
+)
+
+// ErrCRCMismatch is returned when a window of chunks retrieved with
+// Getter.VerifyEvery set still doesn't match its checksum after CRCTries
+// tries.
+var ErrCRCMismatch = errors.New("checksum mismatch")
+
+/* window holds verified chunks waiting to be returned */
+type window struct {
+	chunks [][]byte
+	eof    bool
+	q      string /* Last query made */
+}
+
+// CRCName returns the name to query for the CRC32 of the length bytes of g's
+// file starting at offset.  Bytes past the end of the file are treated as
+// NULs, as they are for A and AAAA records.
+func (g *Getter) CRCName(offset, length uint) string {
+	return AuthName(g.Key, fmt.Sprintf(
+		"%s-%s-%s-%s.%s",
+		CRCLabel,
+		strconv.FormatUint(uint64(offset), 36),
+		strconv.FormatUint(uint64(length), 36),
+		g.Name,
+		ttlHintDomain(g.ControlTTLHint, g.Domain),
+	))
+}
+
+// CRC gets the CRC32 (IEEE) of the length bytes of g's file starting at
+// offset with a TXT query.  If g.Querier is nil, DefaultQuerier() is used.
+func (g *Getter) CRC(offset, length uint) (uint32, error) {
+	q := g.Querier
+	if nil == q {
+		q = DefaultQuerier()
+	}
+	n := g.CRCName(offset, length)
+	as, err := q.TXT(n)
+	if nil != err {
+		return 0, fmt.Errorf("querying for %q: %w", n, err)
+	}
+	if 0 == len(as) {
+		return 0, fmt.Errorf("empty response to query for %q", n)
+	}
+	h := strings.TrimPrefix(as[0], "crc32=")
+	if h == as[0] {
+		return 0, fmt.Errorf("invalid checksum %q", as[0])
+	}
+	c, err := strconv.ParseUint(h, 16, 32)
+	if nil != err {
+		return 0, fmt.Errorf("parsing checksum %q: %w", h, err)
+	}
+	return uint32(c), nil
+}
+
+/* nextVerifiedChunk is like fetchChunk, but retrieves g.VerifyEvery chunks at
+a time and checks them against a CRC32 from the server, retrieving them again
+if they don't match. */
+func (g *Getter) nextVerifiedChunk(
+	qi qtypeInfo,
+	w *window,
+	buf []byte,
+	written uint,
+	meta *FileMeta,
+) (n int, q string, eof bool, err error) {
+	/* Get more chunks if we need them */
+	if 0 == len(w.chunks) && !w.eof {
+		if err := g.fillWindow(qi, w, buf, written, meta); nil != err {
+			return 0, w.q, false, err
+		}
+	}
+	if 0 == len(w.chunks) {
+		return 0, w.q, true, nil
+	}
+
+	/* Send back the next one */
+	n = copy(buf, w.chunks[0])
+	w.chunks = w.chunks[1:]
+	return n, w.q, false, nil
+}
+
+/* fillWindow fills w with up to g.VerifyEvery verified chunks. */
+func (g *Getter) fillWindow(
+	qi qtypeInfo,
+	w *window,
+	buf []byte,
+	written uint,
+	meta *FileMeta,
+) error {
+	start := g.nextOff()
+	for try := 1; ; try++ {
+		/* Get a window's worth of chunks */
+		var all []byte
+		w.chunks = w.chunks[:0]
+		w.eof = false
+		for i := uint(0); i < g.VerifyEvery; i++ {
+			/* No sense asking for more than the file */
+			if nil != meta &&
+				uint64(start+i*g.chunkSize(qi)) >= meta.Size {
+				break
+			}
+			n, q, eof, err := g.fetchChunk(qi, buf, written)
+			w.q = q
+			if nil != err {
+				return err
+			}
+			if eof {
+				w.eof = true
+				break
+			}
+			c := append([]byte(nil), buf[:n]...)
+			w.chunks = append(w.chunks, c)
+			all = append(all, c...)
+		}
+		if 0 == len(all) {
+			return nil
+		}
+
+		/* Make sure it's what we expect */
+		w.q = g.CRCName(start, uint(len(all)))
+		if err := g.countQuery(); nil != err {
+			return err
+		}
+		g.noteTransport(TypeTXT)
+		g.setState(StateQuerying, w.q, written, nil)
+		want, err := g.CRC(start, uint(len(all)))
+		if nil != err {
+			return fmt.Errorf("getting checksum: %w", err)
+		}
+		if want == crc32.ChecksumIEEE(all) {
+			return nil
+		}
+		if CRCTries <= try {
+			return fmt.Errorf(
+				"%w for %d bytes at offset %d",
+				ErrCRCMismatch,
+				len(all),
+				start,
+			)
+		}
+
+		/* Try again, maybe getting past bad cached answers */
+		g.ms.retries++
+		g.setOff(start)
+		if g.RetryCorrupt && 1 == try {
+			defer g.setBust(g.setBust(true))
+		}
+	}
+}
+
+/* nextOff returns the offset NextName will next request. */
+func (g *Getter) nextOff() uint {
+	g.l.Lock()
+	defer g.l.Unlock()
+	if 0 == g.off {
+		return g.StartOff
+	}
+	return g.off
+}
+
+/* setOff sets the offset NextName will next request. */
+func (g *Getter) setOff(off uint) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	g.off = off
+}
@@ -0,0 +1,467 @@
+package dnsfservget
+
+/*
+ * crypt.go
+ * Passphrase-based file encryption
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// SegmentSize is the number of bytes of plaintext encrypted at once by
+	// encrypters returned by NewEncrypter.  Every segment adds
+	// SegmentOverhead bytes.
+	SegmentSize     = 1024
+	SegmentOverhead = 16
+
+	// MaxSegmentSize is the largest segment size a decrypter will accept.
+	MaxSegmentSize = 1 << 20
+
+	// MaxKDFMemory is the largest amount of memory, in KiB, a decrypter
+	// will let a KDF use, to keep a malicious server from using it all.
+	// It's small enough for small machines, but still four times what
+	// the default parameters use.
+	MaxKDFMemory = 256 * 1024
+
+	// MaxKDFTime is the largest number of passes a decrypter will let
+	// Argon2id make, and MaxKDFParallelism is the most threads it'll let
+	// Argon2id use and the largest scrypt parallelism parameter it'll
+	// accept, to keep a malicious server from using all the CPU.
+	MaxKDFTime        = 16
+	MaxKDFParallelism = 16
+
+	/* cryptMagic starts every encrypted file */
+	cryptMagic = "DFE\x01"
+
+	/* saltLen is the length of the salt in the header */
+	saltLen = 16
+
+	/* headerLen is the length of the header of an encrypted file */
+	headerLen = len(cryptMagic) + 1 + 9 + saltLen + 4
+
+	/* keyLen is the length of the derived key */
+	keyLen = 32
+
+	/* maxPadding is the number of zero bytes which may follow an
+	encrypted file when it's retrieved with A or AAAA records */
+	maxPadding = 7
+)
+
+// ErrDecryption is returned by decrypters when the file can't be decrypted,
+// either because the passphrase is wrong or because the file's been corrupted.
+var ErrDecryption = errors.New("decryption failed")
+
+// KDF identifies a key derivation function used to turn a passphrase into a
+// key.
+type KDF uint8
+
+// Supported KDFs
+const (
+	KDFArgon2id KDF = 1
+	KDFScrypt   KDF = 2
+)
+
+// KDFParams holds a KDF and its parameters.  They are stored in the header of
+// an encrypted file.
+type KDFParams struct {
+	KDF KDF
+
+	/* Argon2id parameters.  Memory is in KiB. */
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	/* scrypt parameters.  N is 1<<LogN. */
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// Default KDF parameters, as recommended by RFC 9106 and the scrypt package.
+var (
+	DefaultArgon2idParams = KDFParams{
+		KDF:     KDFArgon2id,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+	DefaultScryptParams = KDFParams{
+		KDF:  KDFScrypt,
+		LogN: 15,
+		R:    8,
+		P:    1,
+	}
+)
+
+/* marshal appends the 9-byte wire form of the parameters to b. */
+func (k KDFParams) marshal(b []byte) ([]byte, error) {
+	b = append(b, byte(k.KDF))
+	switch k.KDF {
+	case KDFArgon2id:
+		b = binary.BigEndian.AppendUint32(b, k.Time)
+		b = binary.BigEndian.AppendUint32(b, k.Memory)
+		b = append(b, k.Threads)
+	case KDFScrypt:
+		b = append(b, k.LogN)
+		b = binary.BigEndian.AppendUint32(b, k.R)
+		b = binary.BigEndian.AppendUint32(b, k.P)
+	default:
+		return nil, fmt.Errorf("unknown KDF %d", k.KDF)
+	}
+	return b, nil
+}
+
+/* unmarshalKDFParams parses the 10 bytes of KDF ID and parameters in b. */
+func unmarshalKDFParams(b []byte) (KDFParams, error) {
+	k := KDFParams{KDF: KDF(b[0])}
+	switch k.KDF {
+	case KDFArgon2id:
+		k.Time = binary.BigEndian.Uint32(b[1:])
+		k.Memory = binary.BigEndian.Uint32(b[5:])
+		k.Threads = b[9]
+	case KDFScrypt:
+		k.LogN = b[1]
+		k.R = binary.BigEndian.Uint32(b[2:])
+		k.P = binary.BigEndian.Uint32(b[6:])
+	default:
+		return k, fmt.Errorf("unknown KDF %d", k.KDF)
+	}
+	return k, nil
+}
+
+/* deriveKey turns the passphrase and salt into a key.  Parameters which would
+use too much memory or time cause an error. */
+func (k KDFParams) deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	switch k.KDF {
+	case KDFArgon2id:
+		if 0 == k.Time || 0 == k.Threads {
+			return nil, errors.New("invalid Argon2id parameters")
+		}
+		if MaxKDFMemory < k.Memory {
+			return nil, fmt.Errorf(
+				"Argon2id memory %dKiB too large",
+				k.Memory,
+			)
+		}
+		if MaxKDFTime < k.Time {
+			return nil, fmt.Errorf(
+				"Argon2id time %d too large",
+				k.Time,
+			)
+		}
+		if MaxKDFParallelism < k.Threads {
+			return nil, fmt.Errorf(
+				"Argon2id threads %d too large",
+				k.Threads,
+			)
+		}
+		return argon2.IDKey(
+			[]byte(passphrase),
+			salt,
+			k.Time,
+			k.Memory,
+			k.Threads,
+			keyLen,
+		), nil
+	case KDFScrypt:
+		/* scrypt uses about 128*N*r bytes */
+		if 1 > k.LogN || 62 < k.LogN || 0 == k.R || 0 == k.P ||
+			MaxKDFMemory < (uint64(128)<<k.LogN)*uint64(k.R)/1024 {
+			return nil, errors.New("invalid scrypt parameters")
+		}
+		if MaxKDFParallelism < k.P {
+			return nil, fmt.Errorf(
+				"scrypt parallelism %d too large",
+				k.P,
+			)
+		}
+		return scrypt.Key(
+			[]byte(passphrase),
+			salt,
+			1<<k.LogN,
+			int(k.R),
+			int(k.P),
+			keyLen,
+		)
+	default:
+		return nil, fmt.Errorf("unknown KDF %d", k.KDF)
+	}
+}
+
+/* newAEAD makes an AES-GCM AEAD from the key. */
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+/* segmentNonce returns the nonce for the nth segment. */
+func segmentNonce(n uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return nonce
+}
+
+/* segmentAD returns the additional data for a segment, which notes whether
+it's the last segment to make truncation detectable. */
+func segmentAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+/* encrypter is an io.WriteCloser which encrypts data in segments */
+type encrypter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte /* Unencrypted data */
+	n    uint64 /* Segment number */
+	err  error
+}
+
+// NewEncrypter returns an io.WriteCloser which encrypts what's written to it
+// with a key derived from the passphrase using the KDF and parameters in
+// params, and writes it to w.  Decryption parameters are written to w in a
+// header, followed by the file itself encrypted with AES-256-GCM in segments
+// of SegmentSize bytes.  Close must be called to write the final segment, but
+// does not close w.
+func NewEncrypter(
+	w io.Writer,
+	passphrase string,
+	params KDFParams,
+) (io.WriteCloser, error) {
+	/* Roll the header */
+	hdr := append(make([]byte, 0, headerLen), cryptMagic...)
+	hdr, err := params.marshal(hdr)
+	if nil != err {
+		return nil, err
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); nil != err {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	hdr = append(hdr, salt...)
+	hdr = binary.BigEndian.AppendUint32(hdr, SegmentSize)
+
+	/* Work out the key */
+	key, err := params.deriveKey(passphrase, salt)
+	if nil != err {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if nil != err {
+		return nil, fmt.Errorf("setting up cipher: %w", err)
+	}
+
+	/* Send the header and get ready for the file */
+	if _, err := w.Write(hdr); nil != err {
+		return nil, fmt.Errorf("writing header: %w", err)
+	}
+	return &encrypter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, SegmentSize),
+	}, nil
+}
+
+/* Write implements io.Writer.  Data is written out a segment at a time. */
+func (e *encrypter) Write(p []byte) (int, error) {
+	var tot int
+	for 0 != len(p) {
+		if nil != e.err {
+			return tot, e.err
+		}
+		/* If we have a full segment and more data, it's not the last
+		segment. */
+		if SegmentSize == len(e.buf) {
+			e.seal(false)
+			continue
+		}
+		n := copy(e.buf[len(e.buf):SegmentSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		tot += n
+	}
+	return tot, e.err
+}
+
+/* Close writes the final segment. */
+func (e *encrypter) Close() error {
+	if nil == e.err {
+		e.seal(true)
+		if nil == e.err {
+			e.err = errors.New("encrypter closed")
+			return nil
+		}
+	}
+	return e.err
+}
+
+/* seal encrypts and writes e.buf. */
+func (e *encrypter) seal(final bool) {
+	ct := e.aead.Seal(nil, segmentNonce(e.n), e.buf, segmentAD(final))
+	e.n++
+	e.buf = e.buf[:0]
+	if _, err := e.w.Write(ct); nil != err {
+		e.err = err
+	}
+}
+
+/* decrypter is an io.Reader which decrypts what it reads from an underlying
+reader. */
+type decrypter struct {
+	r          io.Reader
+	passphrase string
+	aead       cipher.AEAD
+	segLen     int    /* Sealed segment size */
+	in         []byte /* Encrypted data */
+	out        []byte /* Decrypted data not yet read */
+	n          uint64 /* Segment number */
+	err        error
+}
+
+// NewDecrypter returns an io.Reader which decrypts a file encrypted with an
+// encrypter returned by NewEncrypter and read from r, using a key derived from
+// passphrase.  The header is read from r on the first call to Read.  Up to
+// seven zero bytes following the encrypted file, as may be returned when
+// retrieving a file with A or AAAA records, are ignored.  Errors caused by a
+// corrupt file or wrong passphrase wrap ErrDecryption.
+func NewDecrypter(r io.Reader, passphrase string) io.Reader {
+	return &decrypter{r: r, passphrase: passphrase}
+}
+
+/* Read implements io.Reader. */
+func (d *decrypter) Read(p []byte) (int, error) {
+	/* Get the key if we've not already */
+	if nil == d.aead && nil == d.err {
+		d.err = d.readHeader()
+	}
+
+	/* Make sure we have something to send back */
+	for 0 == len(d.out) && nil == d.err {
+		d.err = d.readSegment()
+	}
+
+	/* Send it back */
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	if 0 != n {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+/* readHeader reads the header and derives the key. */
+func (d *decrypter) readHeader() error {
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(d.r, hdr); nil != err {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	if !bytes.HasPrefix(hdr, []byte(cryptMagic)) {
+		return fmt.Errorf("%w: not an encrypted file", ErrDecryption)
+	}
+	b := hdr[len(cryptMagic):]
+	params, err := unmarshalKDFParams(b)
+	if nil != err {
+		return err
+	}
+	b = b[10:]
+	salt := b[:saltLen]
+	ss := binary.BigEndian.Uint32(b[saltLen:])
+	if 0 == ss || MaxSegmentSize < ss {
+		return fmt.Errorf("invalid segment size %d", ss)
+	}
+
+	/* Work out the key */
+	key, err := params.deriveKey(d.passphrase, salt)
+	if nil != err {
+		return fmt.Errorf("deriving key: %w", err)
+	}
+	if d.aead, err = newAEAD(key); nil != err {
+		return fmt.Errorf("setting up cipher: %w", err)
+	}
+	d.segLen = int(ss) + SegmentOverhead
+	d.in = make([]byte, 0, d.segLen+maxPadding+1)
+	return nil
+}
+
+/* readSegment reads and decrypts the next segment into d.out.  It returns
+io.EOF after the final segment. */
+func (d *decrypter) readSegment() error {
+	/* Get enough to know if this is the last segment */
+	n, err := io.ReadFull(d.r, d.in[len(d.in):cap(d.in)])
+	d.in = d.in[:len(d.in)+n]
+	if nil == err { /* Not the last segment */
+		if err := d.open(d.in[:d.segLen], false); nil != err {
+			return err
+		}
+		d.in = d.in[:copy(d.in, d.in[d.segLen:])]
+		return nil
+	} else if !errors.Is(err, io.EOF) &&
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	/* We have the end of the file, possibly with some padding.  Try
+	less and less of it until something decrypts. */
+	tail := d.in
+	for i := 0; i <= maxPadding && 0 != len(tail); i++ {
+		if err := d.openTail(tail); nil == err {
+			return io.EOF
+		}
+		if 0 != tail[len(tail)-1] {
+			break
+		}
+		tail = tail[:len(tail)-1]
+	}
+	return fmt.Errorf("%w: final segment", ErrDecryption)
+}
+
+/* openTail decrypts the final one or two segments in tail. */
+func (d *decrypter) openTail(tail []byte) error {
+	/* Might be a full segment before the final one */
+	if len(tail) > d.segLen {
+		n := d.n
+		if err := d.open(tail[:d.segLen], false); nil != err {
+			return err
+		}
+		last := d.out
+		if err := d.open(tail[d.segLen:], true); nil != err {
+			d.n = n
+			d.out = nil
+			return err
+		}
+		d.out = append(last, d.out...)
+		return nil
+	}
+	return d.open(tail, true)
+}
+
+/* open decrypts the segment in ct into d.out. */
+func (d *decrypter) open(ct []byte, final bool) error {
+	pt, err := d.aead.Open(nil, segmentNonce(d.n), ct, segmentAD(final))
+	if nil != err {
+		return fmt.Errorf("%w: segment %d", ErrDecryption, d.n)
+	}
+	d.n++
+	d.out = pt
+	return nil
+}
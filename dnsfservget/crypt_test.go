@@ -0,0 +1,144 @@
+package dnsfservget
+
+/*
+ * crypt_test.go
+ * Tests for passphrase-based file encryption
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+/* testKDFParams are cheap scrypt parameters to keep tests fast */
+var testKDFParams = KDFParams{KDF: KDFScrypt, LogN: 4, R: 8, P: 1}
+
+/* encrypt encrypts pt with the passphrase */
+func encrypt(t *testing.T, pt []byte, passphrase string) []byte {
+	var ct bytes.Buffer
+	e, err := NewEncrypter(&ct, passphrase, testKDFParams)
+	if nil != err {
+		t.Fatalf("NewEncrypter: %s", err)
+	}
+	if _, err := e.Write(pt); nil != err {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := e.Close(); nil != err {
+		t.Fatalf("Close: %s", err)
+	}
+	return ct.Bytes()
+}
+
+func TestDecrypter(t *testing.T) {
+	for _, size := range []int{
+		0, 1,
+		SegmentSize - 1, SegmentSize, SegmentSize + 1,
+		2 * SegmentSize, 5000,
+	} {
+		pt := make([]byte, size)
+		rand.Read(pt)
+		ct := encrypt(t, pt, "kittens")
+
+		/* Trailing padding from A and AAAA records should be ignored */
+		for pad := 0; pad <= maxPadding; pad++ {
+			in := append(append([]byte{}, ct...), make([]byte, pad)...)
+			got, err := ioutil.ReadAll(NewDecrypter(
+				bytes.NewReader(in),
+				"kittens",
+			))
+			if nil != err {
+				t.Errorf("Size %d, padding %d: %s", size, pad, err)
+				continue
+			}
+			if !bytes.Equal(got, pt) {
+				t.Errorf("Size %d, padding %d: mismatch", size, pad)
+			}
+		}
+
+		/* Wrong passphrase */
+		_, err := ioutil.ReadAll(NewDecrypter(
+			bytes.NewReader(ct),
+			"puppies",
+		))
+		if !errors.Is(err, ErrDecryption) {
+			t.Errorf("Size %d, wrong passphrase: got %v", size, err)
+		}
+
+		/* Truncation at a segment boundary */
+		if SegmentSize < size {
+			_, err := ioutil.ReadAll(NewDecrypter(
+				bytes.NewReader(ct[:headerLen+SegmentSize+
+					SegmentOverhead]),
+				"kittens",
+			))
+			if !errors.Is(err, ErrDecryption) {
+				t.Errorf("Size %d, truncated: got %v", size, err)
+			}
+		}
+	}
+}
+
+func TestDecrypterKDFLimits(t *testing.T) {
+	for _, c := range []struct {
+		params KDFParams
+		ok     bool
+	}{
+		{KDFParams{
+			KDF:     KDFArgon2id,
+			Time:    1,
+			Memory:  64,
+			Threads: 1,
+		}, true},
+		{KDFParams{
+			KDF:     KDFArgon2id,
+			Time:    MaxKDFTime + 1,
+			Memory:  64,
+			Threads: 1,
+		}, false},
+		{KDFParams{
+			KDF:     KDFArgon2id,
+			Time:    1,
+			Memory:  MaxKDFMemory + 1,
+			Threads: 1,
+		}, false},
+		{KDFParams{
+			KDF:     KDFArgon2id,
+			Time:    1,
+			Memory:  64 * (MaxKDFParallelism + 1),
+			Threads: MaxKDFParallelism + 1,
+		}, false},
+		{testKDFParams, true},
+		{KDFParams{
+			KDF:  KDFScrypt,
+			LogN: 4,
+			R:    8,
+			P:    MaxKDFParallelism + 1,
+		}, false},
+		{KDFParams{KDF: KDFScrypt, LogN: 20, R: 8, P: 1}, false},
+	} {
+		/* Roll a header with the parameters */
+		hdr, err := c.params.marshal([]byte(cryptMagic))
+		if nil != err {
+			t.Fatalf("Marshalling %+v: %s", c.params, err)
+		}
+		hdr = append(hdr, make([]byte, saltLen)...)
+		hdr = append(hdr, 0, 0, 4, 0)
+
+		_, err = ioutil.ReadAll(NewDecrypter(
+			bytes.NewReader(hdr),
+			"kittens",
+		))
+		rejected := nil != err && !errors.Is(err, ErrDecryption)
+		if c.ok && rejected {
+			t.Errorf("%+v: got %v", c.params, err)
+		} else if !c.ok && !rejected {
+			t.Errorf("%+v: not rejected: %v", c.params, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package dnsfservget
+
+/*
+ * decode_test.go
+ * Tests for decoding A and AAAA records
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"testing"
+)
+
+/* testAAAA is a valid AAAA answer */
+const testAAAA = "2600:9000:5305:ce00:6b69:7474:656e:7300"
+
+func TestDecodeA(t *testing.T) {
+	want := []byte{1, 2, 3}
+	for _, c := range []struct {
+		res string
+		ok  bool
+	}{
+		/* Plain IPv4 */
+		{"3.1.2.3", true},
+		{"0.1.2.3", true},
+
+		/* IPv4 in IPv6 form, which some resolvers return */
+		{"::ffff:3.1.2.3", true},
+		{"::FFFF:3.1.2.3", true},
+		{"0:0:0:0:0:ffff:3.1.2.3", true},
+		{"0000:0000:0000:0000:0000:ffff:0301:0203", true},
+		{"::ffff:301:203", true},
+		{"::ffff:0301:0203", true},
+
+		/* Not IPv4 */
+		{"::3.1.2.3", false},
+		{"::301:203", false},
+		{"64:ff9b::3.1.2.3", false},
+		{testAAAA, false},
+		{"fe80::ffff:3.1.2.3", false},
+		{"::ffff:3.1.2.3%eth0", false},
+
+		/* Not addresses at all */
+		{"", false},
+		{"3.1.2", false},
+		{"3.1.2.3.4", false},
+		{"3.1.2.256", false},
+		{"003.001.002.003", false},
+		{" 3.1.2.3", false},
+		{"3.1.2.3.", false},
+		{"kittens", false},
+	} {
+		buf := make([]byte, 3)
+		n, err := decodeA(buf, c.res)
+		if !c.ok {
+			if nil == err {
+				t.Errorf("%q: no error, got %02x", c.res, buf[:n])
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("%q: %s", c.res, err)
+			continue
+		}
+		if !bytes.Equal(want, buf[:n]) {
+			t.Errorf("%q: got %02x, want %02x", c.res, buf[:n], want)
+		}
+	}
+}
+
+func TestDecodeAAAA(t *testing.T) {
+	want := []byte("kittens\x00")
+	for _, c := range []struct {
+		res string
+		ok  bool
+	}{
+		{testAAAA, true},
+		{"2600:9000:5305:CE00:6B69:7474:656E:7300", true},
+		{"::6b69:7474:656e:7300", true},
+
+		/* IPv4, in either form, is an A record */
+		{"3.1.2.3", false},
+		{"::ffff:3.1.2.3", false},
+		{"::ffff:6b69:7474", false},
+
+		{"2600:9000:5305:ce00:6b69:7474:656e:7300%eth0", false},
+		{"2600:9000:5305:ce00:6b69:7474:656e", false},
+		{"", false},
+	} {
+		buf := make([]byte, 8)
+		n, err := decodeAAAA(buf, c.res)
+		if !c.ok {
+			if nil == err {
+				t.Errorf("%q: no error, got %02x", c.res, buf[:n])
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("%q: %s", c.res, err)
+			continue
+		}
+		if !bytes.Equal(want, buf[:n]) {
+			t.Errorf("%q: got %q, want %q", c.res, buf[:n], want)
+		}
+	}
+
+	/* Too-small buffers shouldn't be written past */
+	if _, err := decodeAAAA(make([]byte, 7), testAAAA); nil == err {
+		t.Errorf("No error with too-small buffer")
+	}
+}
+
+func TestDecodeIPAllocs(t *testing.T) {
+	buf := make([]byte, 8)
+	for _, c := range []struct {
+		res    string
+		decode func([]byte, string) (int, error)
+	}{
+		{"3.1.2.3", decodeA},
+		{"::ffff:3.1.2.3", decodeA},
+		{testAAAA, decodeAAAA},
+	} {
+		if n := testing.AllocsPerRun(100, func() {
+			c.decode(buf, c.res)
+		}); 0 != n {
+			t.Errorf("%q: %v allocations", c.res, n)
+		}
+	}
+}
+
+func TestDecodeNULL(t *testing.T) {
+	buf := make([]byte, 8)
+	n, err := decodeNULL(buf, "kit\x00tens")
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if "kit\x00tens" != string(buf[:n]) {
+		t.Errorf("Got %q", buf[:n])
+	}
+	if _, err := decodeNULL(buf, "kittens!!"); nil == err {
+		t.Errorf("No error with too-small buffer")
+	}
+}
+
+func TestDecodeName(t *testing.T) {
+	g := Getter{Type: TypeCNAME, Domain: "example.com"}
+	buf := make([]byte, MaxNameDecode)
+	for _, c := range []struct {
+		res  string
+		want string
+		ok   bool
+	}{
+		{"nnuxi5dfnzzq.example.com.", "kittens", true},
+		{"NNuXi5DfNZZQ.ExAmPlE.cOm.", "kittens", true},
+		{"nnuxi.5dfnzzq.example.com.", "kittens", true},
+		{"nnuxi5dfnzzq.example.org.", "", false},
+		{"nnuxi5dfnzzq.notexample.com.", "", false},
+		{"nnuxi5dfnzz1.example.com.", "", false},
+	} {
+		n, err := g.DecodeResponse(buf, c.res)
+		if !c.ok {
+			if nil == err {
+				t.Errorf("%q: no error, got %q", c.res, buf[:n])
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("%q: %s", c.res, err)
+			continue
+		}
+		if c.want != string(buf[:n]) {
+			t.Errorf("%q: got %q, want %q", c.res, buf[:n], c.want)
+		}
+	}
+}
+
+func TestDecodeMX(t *testing.T) {
+	/* RDATA should turn into what LookupMX would give us */
+	ans, err := encodeMX([]byte(
+		"\x00\x03\x0cnnuxi5dfnzzq\x07example\x03com\x00",
+	))
+	if nil != err {
+		t.Fatalf("encodeMX: %s", err)
+	}
+	if "3 nnuxi5dfnzzq.example.com." != ans {
+		t.Fatalf("encodeMX: got %q", ans)
+	}
+	for _, rdata := range []string{
+		"\x00\x03",
+		"\x00\x03\x0cnnuxi5dfnzzq",
+		"\x00\x03\x0cnnuxi5dfnzzq\xc0\x0c",
+	} {
+		if _, err := encodeMX([]byte(rdata)); nil == err {
+			t.Errorf("encodeMX(%q): no error", rdata)
+		}
+	}
+
+	g := Getter{Type: TypeMX, Domain: "example.com"}
+	buf := make([]byte, MaxNameDecode)
+	n, err := g.DecodeResponse(buf, ans)
+	if nil != err {
+		t.Fatalf("DecodeResponse: %s", err)
+	}
+	if "kittens" != string(buf[:n]) {
+		t.Errorf("DecodeResponse: got %q", buf[:n])
+	}
+	for _, res := range []string{
+		"nnuxi5dfnzzq.example.com.",
+		"x nnuxi5dfnzzq.example.com.",
+		"65536 nnuxi5dfnzzq.example.com.",
+	} {
+		if _, err := g.DecodeResponse(buf, res); nil == err {
+			t.Errorf("%q: no error", res)
+		}
+	}
+}
+
+func TestDecodeSRV(t *testing.T) {
+	ans, err := encodeSRV([]byte(
+		"\x00\x01\x00\x02\x00\x07\x0cnnuxi5dfnzzq\x07example\x03com\x00",
+	))
+	if nil != err {
+		t.Fatalf("encodeSRV: %s", err)
+	}
+	if "1 2 7 nnuxi5dfnzzq.example.com." != ans {
+		t.Fatalf("encodeSRV: got %q", ans)
+	}
+	if _, err := encodeSRV([]byte("\x00\x01\x00\x02\x00\x07")); nil == err {
+		t.Errorf("encodeSRV: no error without target")
+	}
+
+	g := Getter{Type: TypeSRV, Domain: "example.com"}
+	buf := make([]byte, MaxNameDecode)
+	n, err := g.DecodeResponse(buf, ans)
+	if nil != err {
+		t.Fatalf("DecodeResponse: %s", err)
+	}
+	if "kittens" != string(buf[:n]) {
+		t.Errorf("DecodeResponse: got %q", buf[:n])
+	}
+	for _, res := range []string{
+		"1 2 nnuxi5dfnzzq.example.com.",
+		"1 2 6 nnuxi5dfnzzq.example.com.",
+		"1 2 x nnuxi5dfnzzq.example.com.",
+		"1 65536 7 nnuxi5dfnzzq.example.com.",
+	} {
+		if _, err := g.DecodeResponse(buf, res); nil == err {
+			t.Errorf("%q: no error", res)
+		}
+	}
+
+	/* Offsets SRV records can't hold shouldn't be asked for at all; the
+	Getter has no Querier. */
+	qi, err := lookupQType(TypeSRV)
+	if nil != err {
+		t.Fatalf("lookupQType: %s", err)
+	}
+	off := uint64(MaxSRVOffset)
+	g = Getter{
+		Type:     TypeSRV,
+		Name:     "payload",
+		Domain:   "example.com",
+		StartOff: uint(off),
+	}
+	if 0xFFFFFFFF < ^uint(0) {
+		if _, _, _, err := g.fetchChunkOnce(qi, buf, 0); nil == err {
+			t.Errorf("No error at offset %d", off)
+		}
+	}
+}
+
+func TestDecodeMulti(t *testing.T) {
+	buf := make([]byte, 8*MultiAnswers)
+
+	/* Out of order is fine */
+	g := Getter{Type: TypeMultiA}
+	n, err := g.DecodeResponse(
+		buf,
+		"34.116.101.110 32.107.105.116 33.116.101.110",
+	)
+	if nil != err {
+		t.Fatalf("A: %s", err)
+	}
+	if "kittenten" != string(buf[:n]) {
+		t.Errorf("A: got %q", buf[:n])
+	}
+	g.Type = TypeMultiAAAA
+	n, err = g.DecodeResponse(
+		buf,
+		"2600:9000:5305:ce01:7465:6e73:2121:2121 "+
+			"2600:9000:5305:ce00:6b69:7474:656e:7320",
+	)
+	if nil != err {
+		t.Fatalf("AAAA: %s", err)
+	}
+	if "kittens tens!!!!" != string(buf[:n]) {
+		t.Errorf("AAAA: got %q", buf[:n])
+	}
+
+	/* Gaps, repeats, and odd sequence numbers aren't */
+	g.Type = TypeMultiA
+	for _, res := range []string{
+		"32.107.105.116 34.116.101.110",
+		"32.107.105.116 32.107.105.116",
+		"3.107.105.116",
+		"44.107.105.116",
+		"2600:9000:5305:ce00:6b69:7474:656e:7320",
+	} {
+		if _, err := g.DecodeResponse(buf, res); nil == err {
+			t.Errorf("%q: no error", res)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dnsfservget_test
+
+/*
+ * decodehook_test.go
+ * Tests for transforming decoded chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterDecodeHook(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := []byte("kittens and puppies and moose")
+
+	/* Serve an obfuscated file */
+	obfuscated := make([]byte, len(file))
+	for i, b := range file {
+		obfuscated[i] = b ^ byte(i)
+	}
+	s.SetFile("payload", obfuscated)
+
+	/* The hook should undo the obfuscation */
+	var offs []uint
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeAAAA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: q,
+		UseMeta: true,
+		DecodeHook: func(offset uint, raw []byte) ([]byte, error) {
+			offs = append(offs, offset)
+			b := make([]byte, len(raw))
+			for i := range raw {
+				b[i] = raw[i] ^ byte(offset+uint(i))
+			}
+			return b, nil
+		},
+	}
+	got, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if !bytes.Equal(file, got) {
+		t.Errorf("Got %q, want %q", got, file)
+	}
+	if 4 != len(offs) {
+		t.Errorf("Hook called %d times, want 4", len(offs))
+	}
+	for i, off := range offs {
+		if uint(8*i) != off {
+			t.Errorf("Chunk %d: got offset %d", i, off)
+		}
+	}
+
+	/* Errors should stop the transfer */
+	herr := errors.New("kittens")
+	g = dnsfservget.Getter{
+		Type:    dnsfservget.TypeAAAA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: q,
+		DecodeHook: func(offset uint, raw []byte) ([]byte, error) {
+			if 0 != offset {
+				return nil, herr
+			}
+			return raw, nil
+		},
+	}
+	got, err = ioutil.ReadAll(g.Get())
+	if !errors.Is(err, herr) {
+		t.Errorf("Got error %v", err)
+	}
+	if !bytes.Equal(obfuscated[:8], got) {
+		t.Errorf("Got %q before error, want %q", got, obfuscated[:8])
+	}
+}
@@ -0,0 +1,127 @@
+package dnsfservget
+
+/*
+ * decoy.go
+ * Make decoy queries alongside real ones
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultDecoyDomains are the popular domains queried by a DecoyGenerator
+// with no Domains set.
+var DefaultDecoyDomains = []string{
+	"www.google.com",
+	"www.microsoft.com",
+	"login.microsoftonline.com",
+	"outlook.office365.com",
+	"www.apple.com",
+	"www.amazon.com",
+	"www.youtube.com",
+	"www.facebook.com",
+	"www.wikipedia.org",
+	"www.bing.com",
+	"update.googleapis.com",
+	"ocsp.digicert.com",
+	"clients4.google.com",
+	"slack.com",
+	"zoom.us",
+}
+
+/* decoyLabelChars are used to make random subdomains */
+const decoyLabelChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// DecoyGenerator makes benign-looking queries alongside a Getter's real ones,
+// so that the mix of queries looks less like a file transfer.  Decoy queries
+// are for popular domains and random subdomains of the Getter's Domain, to
+// which dnsfserv returns empty responses.  Decoy queries are made in the
+// background and their results are ignored.
+type DecoyGenerator struct {
+	/* Ratio is the average number of decoy queries to make per real
+	query, e.g. 0.5 for one decoy query for every other real query. */
+	Ratio float64
+
+	/* Domains, if set, replaces DefaultDecoyDomains. */
+	Domains []string
+
+	/* ZoneFraction is the fraction of decoy queries which are for random
+	subdomains of the Getter's Domain rather than for Domains. */
+	ZoneFraction float64
+
+	/* Querier, if set, is used to make decoy queries instead of the
+	Getter's Querier. */
+	Querier Querier
+
+	l    sync.Mutex
+	rand *rand.Rand
+}
+
+/* decoys makes decoy queries to go with a real query for a file in domain,
+using q if d.Querier is nil. */
+func (d *DecoyGenerator) decoys(q Querier, domain string) {
+	if nil != d.Querier {
+		q = d.Querier
+	}
+
+	/* Work out what to query */
+	names, aaaa := d.pick(domain)
+	for i, n := range names {
+		go func(n string, aaaa bool) {
+			if aaaa {
+				q.AAAA(n)
+			} else {
+				q.A(n)
+			}
+		}(n, aaaa[i])
+	}
+}
+
+/* pick picks the names to query for one real query and whether to query
+for an AAAA record for each. */
+func (d *DecoyGenerator) pick(domain string) ([]string, []bool) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	if nil == d.rand {
+		d.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	/* How many to make */
+	if 0 >= d.Ratio {
+		return nil, nil
+	}
+	n := int(d.Ratio)
+	if d.rand.Float64() < d.Ratio-float64(n) {
+		n++
+	}
+
+	/* Roll the names */
+	ds := d.Domains
+	if 0 == len(ds) {
+		ds = DefaultDecoyDomains
+	}
+	var (
+		names = make([]string, n)
+		aaaa  = make([]bool, n)
+	)
+	for i := range names {
+		aaaa[i] = 0 == d.rand.Intn(2)
+		if d.rand.Float64() >= d.ZoneFraction {
+			names[i] = ds[d.rand.Intn(len(ds))]
+			continue
+		}
+		/* No hyphens, so dnsfserv won't look for a file */
+		l := make([]byte, 4+d.rand.Intn(9))
+		for j := range l {
+			l[j] = decoyLabelChars[d.rand.Intn(len(decoyLabelChars))]
+		}
+		names[i] = string(l) + "." + domain
+	}
+
+	return names, aaaa
+}
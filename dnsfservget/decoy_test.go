@@ -0,0 +1,49 @@
+package dnsfservget
+
+/*
+ * decoy_test.go
+ * Tests for decoy queries
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecoyGeneratorPick(t *testing.T) {
+	/* Zone decoys */
+	d := DecoyGenerator{Ratio: 2.5, ZoneFraction: 1}
+	for i := 0; i < 1000; i++ {
+		names, aaaa := d.pick("example.com")
+		if 2 != len(names) && 3 != len(names) {
+			t.Fatalf("Ratio 2.5 gave %d names", len(names))
+		}
+		if len(names) != len(aaaa) {
+			t.Fatalf("Got %d names but %d types", len(names), len(aaaa))
+		}
+		for _, n := range names {
+			if !strings.HasSuffix(n, ".example.com") {
+				t.Fatalf("Decoy %q not in zone", n)
+			}
+			if strings.Contains(n, "-") {
+				t.Fatalf("Decoy %q looks like a file query", n)
+			}
+		}
+	}
+
+	/* Other domains */
+	d = DecoyGenerator{Ratio: 1, Domains: []string{"kittens.com"}}
+	names, _ := d.pick("example.com")
+	if 1 != len(names) || "kittens.com" != names[0] {
+		t.Fatalf("Got decoys %q", names)
+	}
+
+	/* No decoys */
+	d = DecoyGenerator{}
+	if names, _ := d.pick("example.com"); 0 != len(names) {
+		t.Fatalf("Ratio 0 gave %d names", len(names))
+	}
+}
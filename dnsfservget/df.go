@@ -0,0 +1,173 @@
+package dnsfservget
+
+/*
+ * df.go
+ * Domain-fronting HTTP clients
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+/* dfRootCAs, if not nil, is used instead of the system's root CAs to verify
+fronts' certificates. */
+var dfRootCAs *x509.CertPool
+
+/* frontedClient spreads HTTP requests round-robin among several
+domain-fronting HTTP clients, one per SNI. */
+type frontedClient struct {
+	cs []*http.Client
+	n  uint32 /* Next client to use */
+}
+
+/* newFrontedClient returns a frontedClient which uses the given SNIs and, if
+not empty, the ECHConfigList ech. */
+func newFrontedClient(snis []string, ech []byte) *frontedClient {
+	fc := &frontedClient{cs: make([]*http.Client, len(snis))}
+	for i, sni := range snis {
+		fc.cs[i] = dfClient(sni, ech)
+	}
+	return fc
+}
+
+/* Do makes the request with the next client.  If the request fails or gets a
+non-2xx response, which likely means a front's been blocked, the other clients
+are tried in turn until one works.  If none work, the last client's response
+or error is returned. */
+func (f *frontedClient) Do(req *http.Request) (*http.Response, error) {
+	var (
+		res   *http.Response
+		err   error
+		start = atomic.AddUint32(&f.n, 1) - 1
+	)
+	for i := range f.cs {
+		/* Make sure we have a fresh body */
+		if 0 != i && nil != req.GetBody {
+			if req.Body, err = req.GetBody(); nil != err {
+				return nil, err
+			}
+		}
+		c := f.cs[(int(start)+i)%len(f.cs)]
+		if res, err = c.Do(req); nil != err {
+			continue
+		}
+		if (200 > res.StatusCode || 299 < res.StatusCode) &&
+			len(f.cs)-1 != i {
+			res.Body.Close()
+			continue
+		}
+		return res, nil
+	}
+	return res, err
+}
+
+/* Post is like http.Client.Post, but uses f.Do. */
+func (f *frontedClient) Post(
+	url string,
+	contentType string,
+	body io.Reader,
+) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if nil != err {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return f.Do(req)
+}
+
+/* dfClient returns an HTTP client which connects to and uses sni for SNI
+instead of the host in the request, for domain fronting.  If sni doesn't have
+a port, DefaultDOHPort is used.  If ech is not empty, it is used as the
+ECHConfigList for ECH, with the host in the request used as the inner SNI. */
+func dfClient(sni string, ech []byte) *http.Client {
+	/* Make sure we have a port */
+	_, p, err := net.SplitHostPort(sni)
+	if "" == p || nil != err {
+		sni = net.JoinHostPort(sni, DefaultDOHPort)
+	}
+
+	/* Roll a domain-fronting HTTP client */
+	d := &tls.Dialer{Config: &tls.Config{RootCAs: dfRootCAs}}
+	ed := &echDialer{sni: sni, ech: ech}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialTLSContext: func(
+				ctx context.Context,
+				network string,
+				addr string,
+			) (net.Conn, error) {
+				/* Try ECH first, if we can */
+				if c, err := ed.DialContext(
+					ctx,
+					addr,
+				); nil == err {
+					return c, nil
+				}
+				return d.DialContext(ctx, "tcp", sni)
+			},
+		},
+	}
+}
+
+/* echDialer makes TLS connections to sni using ECH. */
+type echDialer struct {
+	sni string
+	ech []byte /* ECHConfigList */
+	l   sync.Mutex
+}
+
+/* DialContext makes a TLS connection to e.sni with ECH, using the host in addr
+as the inner SNI.  If the server rejects ECH but sends back a new
+ECHConfigList, the connection is tried again with the new list.  If the server
+rejects ECH without a new list, ECH won't be tried again. */
+func (e *echDialer) DialContext(
+	ctx context.Context,
+	addr string,
+) (net.Conn, error) {
+	/* Inner SNI is the real host */
+	host, _, err := net.SplitHostPort(addr)
+	if nil != err {
+		host = addr
+	}
+
+	for i := 0; i < 2; i++ {
+		/* Make sure we're still doing ECH */
+		e.l.Lock()
+		ech := e.ech
+		e.l.Unlock()
+		if 0 == len(ech) {
+			return nil, errors.New("ECH not available")
+		}
+
+		/* Try to connect */
+		c, err := (&tls.Dialer{Config: &tls.Config{
+			ServerName:                     host,
+			RootCAs:                        dfRootCAs,
+			MinVersion:                     tls.VersionTLS13,
+			EncryptedClientHelloConfigList: ech,
+		}}).DialContext(ctx, "tcp", e.sni)
+		var re *tls.ECHRejectionError
+		if nil == err || !errors.As(err, &re) {
+			return c, err
+		}
+
+		/* Server didn't like our config, maybe use its */
+		e.l.Lock()
+		e.ech = re.RetryConfigList
+		e.l.Unlock()
+	}
+
+	return nil, errors.New("ECH rejected")
+}
+
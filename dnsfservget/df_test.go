@@ -0,0 +1,175 @@
+package dnsfservget
+
+/*
+ * df_test.go
+ * Tests for domain-fronting HTTP clients
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+/* testFront starts a server which responds with the given status and the body
+of the request and returns a client which sends every request to it, as
+though it were a front. */
+func testFront(t *testing.T, status int) *http.Client {
+	s := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write(b)
+	}))
+	t.Cleanup(s.Close)
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(
+			ctx context.Context,
+			network string,
+			addr string,
+		) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(
+				ctx,
+				"tcp",
+				s.Listener.Addr().String(),
+			)
+		},
+	}}
+}
+
+func TestFrontedClientStatus(t *testing.T) {
+	blocked := testFront(t, http.StatusForbidden)
+	ok := testFront(t, http.StatusOK)
+
+	/* A blocked front shouldn't stop us */
+	fc := &frontedClient{cs: []*http.Client{blocked, ok}}
+	for i := 0; i < 2; i++ {
+		res, err := fc.Post(
+			"http://example.com/dns-query",
+			"text/plain",
+			bytes.NewReader([]byte("kittens")),
+		)
+		if nil != err {
+			t.Fatalf("Request %d: %s", i, err)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if nil != err {
+			t.Fatalf("Request %d: reading body: %s", i, err)
+		}
+		if http.StatusOK != res.StatusCode || "kittens" != string(b) {
+			t.Errorf(
+				"Request %d: got %s, body %q",
+				i,
+				res.Status,
+				b,
+			)
+		}
+	}
+
+	/* If every front's blocked, we should see why */
+	fc = &frontedClient{cs: []*http.Client{blocked, blocked}}
+	res, err := fc.Post(
+		"http://example.com/dns-query",
+		"text/plain",
+		bytes.NewReader([]byte("kittens")),
+	)
+	if nil != err {
+		t.Fatalf("All blocked: %s", err)
+	}
+	defer res.Body.Close()
+	if http.StatusForbidden != res.StatusCode {
+		t.Errorf("All blocked: got %s", res.Status)
+	}
+}
+
+/* testECHConfig returns an ECHConfig and an ECHConfigList holding only that
+config for a new X25519 key, as well as the key's private half. */
+func testECHConfig(t *testing.T, id byte) (config, list, key []byte) {
+	k, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("Generating ECH key: %s", err)
+	}
+	pub := k.PublicKey().Bytes()
+	c := []byte{id}
+	c = binary.BigEndian.AppendUint16(c, 0x0020) /* DHKEM(X25519) */
+	c = binary.BigEndian.AppendUint16(c, uint16(len(pub)))
+	c = append(c, pub...)
+	c = binary.BigEndian.AppendUint16(c, 4)
+	c = binary.BigEndian.AppendUint16(c, 0x0001) /* HKDF-SHA256 */
+	c = binary.BigEndian.AppendUint16(c, 0x0001) /* AES-128-GCM */
+	c = append(c, 0)                             /* Max name length */
+	c = append(c, byte(len("example.com")))
+	c = append(c, "example.com"...)
+	c = binary.BigEndian.AppendUint16(c, 0) /* Extensions */
+	config = binary.BigEndian.AppendUint16(nil, 0xfe0d)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(c)))
+	config = append(config, c...)
+	list = binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	list = append(list, config...)
+	return config, list, k.Bytes()
+}
+
+func TestBuiltinDFECHPOST(t *testing.T) {
+	conf, list, key := testECHConfig(t, 1)
+	_, staleList, _ := testECHConfig(t, 2)
+	for _, c := range []struct {
+		name      string
+		serverECH bool
+		clientECH []byte
+		want      string /* ECH used */
+	}{
+		{"ECH", true, list, "true"},
+		{"retry config", true, staleList, "true"},
+		{"no server ECH", false, list, "false"},
+		{"no client ECH", true, nil, "false"},
+	} {
+		/* Server which tells us if ECH was used */
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(
+			w http.ResponseWriter,
+			r *http.Request,
+		) {
+			fmt.Fprintf(w, "%t", r.TLS.ECHAccepted)
+		}))
+		s.TLS = new(tls.Config)
+		if c.serverECH {
+			ks := []tls.EncryptedClientHelloKey{{
+				Config:      conf,
+				PrivateKey:  key,
+				SendAsRetry: true,
+			}}
+			s.TLS.EncryptedClientHelloKeys = ks
+		}
+		s.StartTLS()
+		dfRootCAs = x509.NewCertPool()
+		dfRootCAs.AddCert(s.Certificate())
+
+		/* Should work with or without ECH */
+		b, err := BuiltinDFECHPOST(
+			s.Listener.Addr().String(),
+			c.clientECH,
+		)("https://example.com/dns-query", []byte("kittens"))
+		s.Close()
+		dfRootCAs = nil
+		if nil != err {
+			t.Errorf("%s: %s", c.name, err)
+		} else if c.want != string(b) {
+			t.Errorf("%s: ECH used: %s, want %s", c.name, b, c.want)
+		}
+	}
+}
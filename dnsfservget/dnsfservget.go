@@ -5,23 +5,62 @@ package dnsfservget
  * Get files from dnsfserv
  * By J. Stuart McMurray
  * Created 20200805
- * Last Modified 20200817
+ * Last Modified 20261015
  */
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
+	"net/netip"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	// MaxDecode is the maximum amount of decoded data decoded by
-	// DecodeRespnose.
+	// DecodeRespnose from a TXT record.
 	MaxDecode = 160
+
+	// MaxBigTXTDecode is the maximum amount of decoded data decoded by
+	// DecodeResponse from a TXT record when using TypeBigTXT.
+	MaxBigTXTDecode = 480
+
+	// MaxNULLDecode is the maximum amount of data decoded by
+	// DecodeResponse from a NULL record.
+	MaxNULLDecode = 64000
+
+	// MaxNameDecode is the maximum amount of data decoded by
+	// DecodeResponse from a domain name, such as a CNAME's target, an MX's
+	// exchange, or an SRV's target.
+	MaxNameDecode = 100
+
+	// MaxSRVOffset is one more than the largest offset in a file which may
+	// be retrieved with TypeSRV, as an SRV record's priority and weight
+	// only have room for 32 bits of offset.
+	MaxSRVOffset = 1 << 32
+
+	// BigTXTLabel goes before the offset in queries made with TypeBigTXT.
+	BigTXTLabel = "_txt"
+
+	// MultiLabel goes before the offset in queries made with TypeMultiA
+	// and TypeMultiAAAA.
+	MultiLabel = "_m"
+
+	// MultiAnswers is the number of records in an answer to a query made
+	// with TypeMultiA or TypeMultiAAAA, less at the end of the file.
+	MultiAnswers = 12
+
+	/* multiAFirstByte plus the record's sequence number is the first
+	byte of each record in an answer to a TypeMultiA query */
+	multiAFirstByte = 32
 )
 
 // QType is a DNS query type.
@@ -30,16 +69,11 @@ type QType string
 // PayloadSize returns the maximum number of payload bytes returnable by a
 // query of type q.
 func (q QType) PayloadSize() (uint, error) {
-	switch q {
-	case TypeA:
-		return 3, nil
-	case TypeAAAA:
-		return 8, nil
-	case TypeTXT:
-		return 160, nil
-	default:
-		return 0, ErrorUnsupportedQType{q}
+	qi, err := lookupQType(q)
+	if nil != err {
+		return 0, err
 	}
+	return qi.payloadSize, nil
 }
 
 // ErrorUnsupportedQType is returned when an unsupported QType is encountered.
@@ -52,11 +86,19 @@ func (e ErrorUnsupportedQType) Error() string {
 	return fmt.Sprintf("unsupported query type %q", e.Type)
 }
 
-// Supported QTypes
+// Supported QTypes.  More may be added with RegisterQType.
 const (
-	TypeA    QType = "A"
-	TypeAAAA QType = "AAAA"
-	TypeTXT  QType = "TXT"
+	TypeA     QType = "A"
+	TypeAAAA  QType = "AAAA"
+	TypeTXT   QType = "TXT"
+	TypeNULL  QType = "NULL"  /* Needs a TypeQuerier */
+	TypeCNAME QType = "CNAME" /* Needs a TypeQuerier */
+	TypeMX    QType = "MX"    /* Needs a TypeQuerier or DefaultQuerier */
+	TypeSRV   QType = "SRV"   /* Needs a TypeQuerier or DefaultQuerier */
+
+	TypeBigTXT    QType = "BIGTXT"    /* TXT, but several strings */
+	TypeMultiA    QType = "MULTIA"    /* A, but several records */
+	TypeMultiAAAA QType = "MULTIAAAA" /* AAAA, but several records */
 )
 
 // Getter gets a file from dnsfserv.  Its Get method makes all of the necessary
@@ -73,7 +115,7 @@ const (
 //   Getter{Type: TypeA, Name: "payload", Domain: "example.com"}
 type Getter struct {
 	Type   QType  /* Type of queries to use */
-	Name   string /* Name of file to retrieve */
+	Name   string /* Name of file to retrieve, or its alias */
 	Domain string /* Domain from which to retrieve file */
 
 	/* The following two fields control how much of the file to retrieve.
@@ -87,117 +129,521 @@ type Getter struct {
 	DefaultQuerier() is used. */
 	Querier Querier
 
-	off uint /* Offset into file */
-	l   sync.Mutex
+	/* If set, OnStateChange is called every time the State of the
+	transfer started with Get changes.  It is not called concurrently.
+	StallAfter, if set, is how long a query may take before the transfer
+	is considered Stalled. */
+	OnStateChange func(StateChange)
+	StallAfter    time.Duration
+
+	/* If set, Passphrase is used to decrypt a file encrypted with
+	NewEncrypter as it's retrieved.  StartOff and Max refer to the
+	encrypted file; StartOff should be 0 so the header is retrieved. */
+	Passphrase string
+
+	/* If set, UseMeta causes the file's size and hash to be retrieved
+	with a single TXT query before retrieving the file itself with
+	queries of type Type.  The file's size is used to stop retrieving
+	the file without an extra query and without trailing NULs.  If the
+	whole file is retrieved, its hash is checked.  This requires a
+	version of dnsfserv which serves metadata. */
+	UseMeta bool
+
+	/* If set, DecodeHook is called by Get with each chunk of the file
+	after it's been decoded from a DNS answer, along with the chunk's
+	offset into the file.  The returned bytes will be returned by Get
+	in its place, e.g. after removing a layer of custom obfuscation.
+	The chunk passed to DecodeHook will be overwritten after DecodeHook
+	returns.  An error causes the transfer to fail. */
+	DecodeHook func(offset uint, raw []byte) ([]byte, error)
+
+	/* If nonzero, VerifyEvery causes Get to retrieve the file in windows
+	of VerifyEvery chunks, each of which is checked against a CRC32 from
+	the server with a TXT query before being returned.  A window which
+	doesn't match is retrieved again, up to CRCTries times.  This
+	requires a version of dnsfserv which serves checksums. */
+	VerifyEvery uint
+
+	/* If set, Cache is used to store the file after it's been retrieved,
+	keyed by its domain, name, and metadata, and Get will return the
+	file from Cache if it's there and hasn't changed.  Only whole files
+	are cached, as returned by DecodeHook but before decryption.  Setting
+	Cache implies UseMeta. */
+	Cache Cache
+
+	/* If Stripes is more than 1, the file is retrieved from Stripes
+	files, each holding every Stripes'th block of StripeBlock bytes, as
+	written by Stripe, so that no one name gets too many queries.  If
+	StripeBlock is 0, DefaultStripeBlock is used.  It must be a multiple
+	of Type's payload size.  Striped files may not be retrieved with
+	UseMeta, VerifyEvery, or Cache set. */
+	Stripes     uint
+	StripeBlock uint
+
+	/* If set, Decoys is used to make benign-looking queries alongside
+	the queries for the file. */
+	Decoys *DecoyGenerator
+
+	/* If set, Pacer adaptively paces queries and retries those which
+	fail. */
+	Pacer *Pacer
+
+	/* NoData is what to do when a query for a chunk of the file gets a
+	response with no records.  Note that the system resolver reports
+	such responses as NXDomains, which are always taken to be the end of
+	the file. */
+	NoData NoDataPolicy
+
+	/* The following three fields, if nonzero, are hard limits on a
+	transfer started with Get, which fails with an ErrorLimitExceeded if
+	more than MaxTotalBytes bytes would be returned, it takes longer than
+	MaxDuration, or it would need more than MaxQueries queries, including
+	queries for metadata and checksums.  Unlike Max, these protect
+	against a misbehaving server. */
+	MaxTotalBytes uint64
+	MaxDuration   time.Duration
+	MaxQueries    uint
+
+	/* If set, Handshake causes Get to start with an X25519 key exchange
+	with the server, after which chunks are encrypted with a key unique
+	to the transfer.  This keeps the file from passive observers without
+	a static key in the stager, but doesn't authenticate the server.
+	Chunks in A and AAAA answers past the end of the file won't decrypt
+	to NULs, so UseMeta should be set with those types.  This requires a
+	version of dnsfserv which does handshakes. */
+	Handshake bool
+
+	/* If set, Key is the secret shared with a dnsfserv started with
+	-auth-key.  Every query for the file gets a label holding a MAC of
+	its offset and the file's name, made with AuthName, so the server
+	can reject queries from anybody without the key even through
+	resolvers which would strip TSIG. */
+	Key []byte
+
+	/* If set, Sequence asks the server to start each chunk with its
+	SequenceByte, which is checked and removed before the chunk is used.
+	This catches resolvers which answer with the wrong chunk, e.g. from
+	a confused cache, at the cost of one byte per query.  A StripeBlock
+	must be a multiple of one less than the payload size.  This requires
+	a version of dnsfserv which understands SequenceLabel. */
+	Sequence bool
+
+	/* If set, Nonce puts a new random nonce in every query for a chunk,
+	after NonceLabel, for dnsfserv started with -nonce-cache, which serves
+	decoys to queries with nonces it's seen before.  This defeats caching
+	by resolvers, so every query goes all the way to the server.  Retries
+	of a query use the same nonce. */
+	Nonce bool
+
+	/* If set and Type is TypeTXT, TypeBigTXT, or TypeNULL, Pad asks the
+	server, with PadLabel, to pad each chunk, so the size of the last
+	chunk and so the file can't be worked out from the size of answers.
+	Padding costs a byte per query and, as with Sequence, a StripeBlock
+	must be a multiple of the smaller chunk size. */
+	Pad bool
+
+	/* If set, TTLHint and ControlTTLHint ask the server, with TTLHintLabel,
+	for answers with TTLs of that many seconds to queries for chunks and
+	to queries for metadata, probes, and checksums, respectively.  This
+	allows for long-cached chunks of a static file and short-cached
+	metadata for one which changes. */
+	TTLHint        uint32
+	ControlTTLHint uint32
+
+	/* If set, ShardID is put in queries made by GetShard, and should be
+	the same for every shard of the file.  It lets dnsfserv tell apart
+	different sharded deliveries of the same file.  It must be a valid
+	DNS label. */
+	ShardID string
+
+	/* If set, RetryCorrupt causes a chunk which fails its sequence byte or
+	padding check, or a window of chunks which fails its checksum with
+	VerifyEvery set, to be retrieved again with a fresh nonce in every
+	query, as with Nonce, before the transfer fails.  The nonces get
+	past resolvers whose caches hold bad answers.  Chunks are retrieved
+	up to CRCTries times in all. */
+	RetryCorrupt bool
+
+	/* If set, ControlCache caches answers to queries for the file's
+	metadata and probes for their TTLs, so repeated checks needn't each
+	make a query.  This requires a TTLQuerier. */
+	ControlCache *ControlCache
+
+	/* If set, a JSON Manifest describing the transfer is written to
+	Manifest when a transfer started with Get finishes without error.  An
+	error writing the manifest fails the transfer. */
+	Manifest io.Writer
+
+	started  time.Time     /* Start of transfer */
+	nQueries uint          /* Queries made so far */
+	session  *session      /* Set after a handshake */
+	ms       manifestState /* For Manifest */
+
+	shardLabel string /* Set by GetShard */
+
+	off  uint /* Offset into file */
+	bust bool /* Nonces in queries for chunks, for RetryCorrupt */
+	l    sync.Mutex
+
+	stop chan struct{} /* Closed to cancel Get's transfer */
+
+	state State  /* Transfer state */
+	query string /* Query being made */
+	sl    sync.Mutex
+	cbl   sync.Mutex /* Serializes calls to OnStateChange */
 }
 
 // Get gets the file described by g.  The returned io.ReadCloser will be closed
 // when the file has been retrieved or on error.  If g.Type is set to an
 // invalid QType, the first read from the returned io.ReadCloser return an
-// error.
+// error.  If g.Passphrase is set, the file is decrypted as it's read.
+//
+// Closing the returned io.ReadCloser before the file has been read cancels
+// the transfer.  No more queries are made and waits between queries, as well
+// as waits between retries by Queriers returned by DOHQuerier, are cut short,
+// and the goroutine making queries returns as soon as any query in progress
+// returns, failing the transfer with ErrCanceled.
 func (g *Getter) Get() io.ReadCloser {
 	pr, pw := io.Pipe()
+	gr := &getReader{PipeReader: pr, stop: make(chan struct{})}
+	g.stop = gr.stop
 	go g.get(pw)
-	return pr
+	if "" == g.Passphrase {
+		return gr
+	}
+	return decryptingReader{NewDecrypter(gr, g.Passphrase), gr}
+}
+
+/* decryptingReader reads from a decrypter, closing the underlying
+io.ReadCloser when closed */
+type decryptingReader struct {
+	io.Reader
+	io.Closer
 }
 
-/* get makes the queries to get the file */
-func (g *Getter) get(pw *io.PipeWriter) {
+/* chunkWriter is where get sends the file.  It's satisfied by
+*io.PipeWriter. */
+type chunkWriter interface {
+	Write(b []byte) (int, error)
+	CloseWithError(err error) error
+}
+
+/* get makes the queries to get the file and writes it to pw */
+func (g *Getter) get(pw chunkWriter) {
 	/* Make sure we have something with which to make queries */
 	if nil == g.Querier {
 		g.Querier = DefaultQuerier()
 	}
 
+	/* Work out how to query */
+	qi, err := lookupQType(g.Type)
+	if nil != err {
+		g.finish(pw, "", 0, err)
+		return
+	}
+
+	/* Don't let the server keep us forever */
+	defer g.startLimits(pw)()
+	g.resetManifest()
+
+	/* Striped files don't have metadata */
+	if 1 < g.Stripes && (g.UseMeta || 0 != g.VerifyEvery || nil != g.Cache) {
+		g.finish(pw, "", 0, errors.New(
+			"striped files may not be retrieved with metadata, "+
+				"checksums, or caching",
+		))
+		return
+	}
+
 	var (
-		q    string
-		as   []string
-		err  error
-		n    int
-		de   *net.DNSError
-		buf  = make([]byte, MaxDecode)
-		umax = 0 == g.Max
+		q       string
+		n       int
+		buf     = make([]byte, qi.payloadSize)
+		umax    = 0 == g.Max
+		written uint
+		meta    *FileMeta
+		h       hash.Hash
+		foff    = g.StartOff /* Offset of the next chunk */
+		win     window
+		cbuf    *bytes.Buffer /* File for the cache */
 	)
+
+	/* Maybe start with the size and hash */
+	if g.UseMeta || nil != g.Cache {
+		q = g.MetaName()
+		if err := g.countQuery(); nil != err {
+			g.finish(pw, q, written, err)
+			return
+		}
+		g.noteTransport(TypeTXT)
+		g.setState(StateQuerying, q, written, nil)
+		m, err := g.Meta()
+		if nil != err {
+			g.finish(pw, q, written, fmt.Errorf(
+				"getting metadata: %w",
+				err,
+			))
+			return
+		}
+		meta = &m
+		if 0 == g.StartOff && umax {
+			h = sha256.New()
+		}
+	}
+
+	/* Maybe get a session key */
+	if g.Handshake {
+		q = g.KeyName()
+		if err := g.countQuery(); nil != err {
+			g.finish(pw, q, written, err)
+			return
+		}
+		g.noteTransport(TypeTXT)
+		g.setState(StateQuerying, q, written, nil)
+		s, err := g.handshake()
+		if nil != err {
+			g.finish(pw, q, written, fmt.Errorf(
+				"handshaking: %w",
+				err,
+			))
+			return
+		}
+		g.l.Lock()
+		g.session = s
+		g.l.Unlock()
+	}
+
+	/* Maybe we already have it */
+	if nil != g.Cache && nil != h {
+		if b, ok := g.Cache.Get(g.cacheKey(*meta)); ok {
+			if err := g.checkBytes(0, len(b)); nil != err {
+				g.finish(pw, "", 0, err)
+				return
+			}
+			_, err := pw.Write(b)
+			g.ms.h.Write(b)
+			g.ms.cached = true
+			g.finish(pw, "", uint(len(b)), err)
+			return
+		}
+		cbuf = new(bytes.Buffer)
+	}
+
 	for {
 		/* If we've got no more to write, we're done */
 		if 0 == g.Max && !umax {
-			pw.Close()
+			g.finish(pw, "", written, nil)
+			return
+		}
+		if nil != meta && uint64(foff) >= meta.Size {
+			if nil != h && !bytes.Equal(h.Sum(nil), meta.SHA256[:]) {
+				g.finish(pw, "", written, ErrHashMismatch)
+				return
+			}
+			/* A failure to cache isn't a failure to get */
+			if nil != cbuf {
+				g.Cache.Put(g.cacheKey(*meta), cbuf.Bytes())
+			}
+			g.finish(pw, "", written, nil)
 			return
 		}
 
-		/* Roll a query */
-		q, err = g.NextName()
-		if nil != err {
-			pw.CloseWithError(
-				fmt.Errorf("generating query name: %w", err),
+		/* Get the next chunk, maybe verified */
+		var eof bool
+		if 0 != g.VerifyEvery {
+			n, q, eof, err = g.nextVerifiedChunk(
+				qi,
+				&win,
+				buf,
+				written,
+				meta,
 			)
-			return
+		} else {
+			n, q, eof, err = g.fetchChunk(qi, buf, written)
 		}
-		switch g.Type {
-		case TypeA:
-			as, err = g.Querier.A(q)
-		case TypeAAAA:
-			as, err = g.Querier.AAAA(q)
-		case TypeTXT:
-			as, err = g.Querier.TXT(q)
-		default:
-			pw.CloseWithError(ErrorUnsupportedQType{g.Type})
+		if nil != err || eof {
+			g.finish(pw, q, written, err)
 			return
 		}
-		if nil != err {
-			/* NXDomain == EOF */
-			if errors.As(err, &de) && de.IsNotFound {
-				pw.Close()
-			} else {
-				pw.CloseWithError(fmt.Errorf(
-					"querying for %q: %w",
-					q,
+		/* Don't go past the end of the file */
+		if nil != meta && meta.Size-uint64(foff) < uint64(n) {
+			n = int(meta.Size - uint64(foff))
+		}
+		if nil != h {
+			h.Write(buf[:n])
+		}
+		/* Let the user have a go at it */
+		b := buf[:n]
+		if nil != g.DecodeHook {
+			if b, err = g.DecodeHook(foff, b); nil != err {
+				g.finish(pw, q, written, fmt.Errorf(
+					"decode hook at offset %d: %w",
+					foff,
 					err,
 				))
+				return
 			}
+		}
+		foff += g.chunkSize(qi)
+		/* Don't write too many bytes */
+		if g.Max < uint(len(b)) && !umax {
+			b = b[:g.Max]
+		}
+		if err := g.checkBytes(written, len(b)); nil != err {
+			g.finish(pw, q, written, err)
 			return
 		}
-		/* No answer probably means someone's blocking something */
-		if 0 == len(as) {
-			pw.CloseWithError(fmt.Errorf(
-				"empty response to query for %q",
-				q,
-			))
+		if _, err = pw.Write(b); nil != err {
+			g.finish(pw, q, written, err)
 			return
 		}
-		/* Decode the response and send it back */
-		n, err = g.DecodeResponse(buf, as[0])
+		g.ms.h.Write(b)
+		if nil != cbuf {
+			cbuf.Write(b)
+		}
+		/* Note how many we've written */
+		written += uint(len(b))
+		if !umax {
+			g.Max -= uint(len(b))
+		}
+	}
+}
+
+/* fetchChunkOnce queries for and decodes the next chunk of the file into buf.
+It returns the number of bytes decoded, the query made, and whether the end
+of the file was reached.  Use fetchChunk instead, which retries corrupt
+chunks. */
+func (g *Getter) fetchChunkOnce(
+	qi qtypeInfo,
+	buf []byte,
+	written uint,
+) (n int, q string, eof bool, err error) {
+	/* SRV records can't say where anything past 4GiB goes */
+	if TypeSRV == qi.name && MaxSRVOffset <= uint64(g.nextOff()) {
+		return 0, "", false, fmt.Errorf(
+			"offset %d too large for %s",
+			g.nextOff(),
+			TypeSRV,
+		)
+	}
+
+	/* Roll a query */
+	c, err := g.Next()
+	if nil != err {
+		return 0, "", false, fmt.Errorf(
+			"generating query name: %w",
+			err,
+		)
+	}
+	q = c.Name
+	var (
+		as    []string
+		fails uint
+	)
+	for try := 1; ; try++ {
+		if g.canceled() {
+			return 0, q, false, ErrCanceled
+		}
+		if err := g.countQuery(); nil != err {
+			return 0, q, false, err
+		}
+		g.noteTransport(qi.name)
+		if 1 < try {
+			g.ms.retries++
+		}
+		if nil != g.Pacer {
+			if err := g.Pacer.wait(g.sleep); nil != err {
+				return 0, q, false, err
+			}
+		}
+		g.setState(StateQuerying, q, written, nil)
+		if nil != g.Decoys {
+			g.Decoys.decoys(g.Querier, g.Domain)
+		}
+		st := g.stallTimer(q, written)
+		qstart := time.Now()
+		as, err = qi.doQuery(g.querier(), q)
+		if nil != st {
+			st.Stop()
+		}
 		if nil != err {
-			pw.CloseWithError(fmt.Errorf(
-				"decoding response %q to %q: %w",
-				as[0],
+			/* NXDomain == EOF */
+			var de *net.DNSError
+			if errors.As(err, &de) && de.IsNotFound {
+				return 0, q, true, nil
+			}
+			/* Maybe slow down and try again */
+			if fails++; nil != g.Pacer && g.Pacer.failed(fails) {
+				continue
+			}
+			return 0, q, false, fmt.Errorf(
+				"querying for %q: %w",
 				q,
 				err,
-			))
-			return
+			)
 		}
-		if 0 > n {
-			pw.CloseWithError(errors.New(
-				"negative number of bytes decoded",
-			))
+		if nil != g.Pacer {
+			g.Pacer.succeeded(time.Since(qstart))
 		}
-		/* Don't write too many bytes */
-		if g.Max < uint(n) && !umax {
-			n = int(g.Max)
+		if 0 != len(as) {
+			break
 		}
-		if _, err = pw.Write(buf[:n]); nil != err {
-			pw.CloseWithError(err)
-			return
-		}
-		/* Note how many we've written */
-		if !umax {
-			g.Max -= uint(n)
+		/* No answer probably means someone's blocking something,
+		or the server's not serving this type */
+		switch g.NoData {
+		case EOFOnNoData:
+			return 0, q, true, nil
+		case RetryOnNoData:
+			if NoDataTries > try {
+				if err := g.sleep(NoDataWait); nil != err {
+					return 0, q, false, err
+				}
+				continue
+			}
 		}
+		return 0, q, false, fmt.Errorf(
+			"%w to query for %q",
+			ErrNoData,
+			q,
+		)
+	}
+	/* Decode the response */
+	g.setState(StateDecoding, q, written, nil)
+	res := as[0]
+	if qi.multi {
+		res = strings.Join(as, " ")
+	}
+	if n, err = c.decode(buf, res); nil != err {
+		return 0, q, false, err
+	}
+	g.ms.chunks++
+	return n, q, false, nil
+}
+
+/* finish closes pw with err, which may be nil, and notes that the transfer is
+either Done or Failed.  If err is nil, the manifest is written first. */
+func (g *Getter) finish(pw chunkWriter, q string, written uint, err error) {
+	if nil == err {
+		err = g.writeManifest(written)
+	}
+	if nil == err {
+		g.setState(StateDone, q, written, nil)
+	} else {
+		g.setState(StateFailed, q, written, err)
 	}
+	pw.CloseWithError(err)
 }
 
 // NextName returns a DNS name which can be queried to get the next chunk of
 // the file.  NextName should not be called after Get has been called.
 func (g *Getter) NextName() (string, error) {
+	q, _, _, err := g.nextName()
+	return q, err
+}
+
+/* nextName returns NextName's name as well as the name of the file and the
+offset in the query, which differ from g.Name and g.off for striped files. */
+func (g *Getter) nextName() (q, name string, off uint, err error) {
 	g.l.Lock()
 	defer g.l.Unlock()
 
@@ -207,76 +653,230 @@ func (g *Getter) NextName() (string, error) {
 	}
 
 	/* Roll the query */
-	q := fmt.Sprintf(
+	qi, err := lookupQType(g.Type)
+	if nil != err {
+		return "", "", 0, fmt.Errorf(
+			"determining payload size: %w",
+			err,
+		)
+	}
+	a := g.chunkSize(qi)
+	if name, off, err = g.stripeName(g.off, a); nil != err {
+		return "", "", 0, err
+	}
+	domain := g.Domain
+	if nil != g.session {
+		domain = g.session.label + "." + domain
+	}
+	if g.padded() {
+		domain = PadLabel + "." + domain
+	}
+	if g.Sequence {
+		domain = SequenceLabel + "." + domain
+	}
+	if "" != g.shardLabel {
+		domain = g.shardLabel + "." + domain
+	}
+	domain = ttlHintDomain(g.TTLHint, domain)
+	if g.Nonce || g.bust {
+		n, err := newNonce()
+		if nil != err {
+			return "", "", 0, err
+		}
+		domain = NonceLabel + "-" + n + "." + domain
+	}
+	q = fmt.Sprintf(
 		"%s-%s.%s",
-		strconv.FormatUint(uint64(g.off), 36),
-		g.Name,
-		g.Domain,
+		strconv.FormatUint(uint64(off), 36),
+		name,
+		domain,
 	)
+	if "" != qi.label {
+		q = qi.label + "-" + q
+	}
+	q = AuthName(g.Key, q)
 
 	/* Advance the offset for the next call */
-	a, err := g.Type.PayloadSize()
-	if nil != err {
-		return "", fmt.Errorf("determining payload size: %w", err)
-	}
 	g.off += a
 
-	return q, nil
+	return q, name, off, nil
+}
+
+/* getSession returns g's session, or nil if there's been no handshake. */
+func (g *Getter) getSession() *session {
+	g.l.Lock()
+	defer g.l.Unlock()
+	return g.session
 }
 
 // DecodeResponse extracts the bytes of the file from the DNS response and
 // places the decoded bytes in buf.  If buf is too small DecodeResponse returns
 // an error.  The appropriate size for the buffer can be found using
-// Getter.Type.PayloadSize.
+// Getter.Type.PayloadSize.  For TypeMultiA and TypeMultiAAAA, res should hold
+// all of the answers, separated by spaces.
 func (g *Getter) DecodeResponse(buf []byte, res string) (int, error) {
-	switch g.Type {
-	case TypeA, TypeAAAA:
-		return g.decodeA(buf, res)
-	case TypeTXT:
-		return g.decodeTXT(buf, res)
-	default:
-		return 0, ErrorUnsupportedQType{g.Type}
+	qi, err := lookupQType(g.Type)
+	if nil != err {
+		return 0, err
 	}
+	/* Names holding data are in our domain */
+	if qi.nameData {
+		d := "." + strings.Trim(g.Domain, ".") + "."
+		if !strings.HasSuffix(strings.ToLower(res), strings.ToLower(d)) {
+			return 0, fmt.Errorf("name %q not in %s", res, g.Domain)
+		}
+		res = res[:len(res)-len(d)]
+	}
+	return qi.decode(buf, res)
+}
+
+/* decodeA decodes an IPv4 address and places the payload in buf.  The number
+of decoded bytes is returned. */
+func decodeA(buf []byte, res string) (int, error) {
+	return decodeIP(buf, res, TypeA)
 }
 
-/* decodeA decodes an IPv4 or IPv6 address and places the payload in buf.  The
+/* decodeAAAA decodes an IPv6 address and places the payload in buf.  The
 number of decoded bytes is returned. */
-func (g *Getter) decodeA(buf []byte, res string) (int, error) {
+func decodeAAAA(buf []byte, res string) (int, error) {
+	return decodeIP(buf, res, TypeAAAA)
+}
+
+/* decodeIP decodes an IPv4 or IPv6 address, depending on qtype, and places
+the payload in buf.  The number of decoded bytes is returned.  IPv4 addresses
+in IPv6 form (e.g. ::ffff:3.1.2.3) are accepted for A records, as some
+resolvers return them. */
+func decodeIP(buf []byte, res string, qtype QType) (int, error) {
 	/* Parse as an IP address */
-	ip := net.ParseIP(res)
-	if nil == ip {
-		return 0, fmt.Errorf("invalid IP address %q", res)
+	ip, err := netip.ParseAddr(res)
+	if nil != err {
+		return 0, fmt.Errorf("invalid IP address %q: %w", res, err)
 	}
-	/* Parse with the appropriate length */
-	var plen, start int
-	switch g.Type {
+	if "" != ip.Zone() {
+		return 0, fmt.Errorf("zoned IP address %s", res)
+	}
+
+	/* Extract the payload, making sure we have enough buffer */
+	switch qtype {
 	case TypeA:
-		ip = ip.To4()
-		plen = 4
-		start = 1
+		ip = ip.Unmap()
+		if !ip.Is4() {
+			return 0, fmt.Errorf("IPv6 address %s in A record", res)
+		}
+		a := ip.As4()
+		if len(a)-1 > len(buf) {
+			return 0, fmt.Errorf(
+				"buffer too small for record of type %s",
+				qtype,
+			)
+		}
+		return copy(buf, a[1:]), nil
 	case TypeAAAA:
-		ip = ip.To16()
-		plen = 16
-		start = 8
-	}
-	/* If we didn't get an address of the right size, someone goofed */
-	if nil == ip {
-		return 0, fmt.Errorf("unable to parse IP address %s", res)
-	}
-	/* Make sure we have enough buffer */
-	if plen > len(buf) {
-		return 0, fmt.Errorf(
-			"buffer too small for record of type %s",
-			g.Type,
+		/* An IPv4 address is probably an A record in disguise */
+		if ip.Is4() || ip.Is4In6() {
+			return 0, fmt.Errorf(
+				"IPv4 address %s in AAAA record",
+				res,
+			)
+		}
+		a := ip.As16()
+		if len(a)-8 > len(buf) {
+			return 0, fmt.Errorf(
+				"buffer too small for record of type %s",
+				qtype,
+			)
+		}
+		return copy(buf, a[8:]), nil
+	default:
+		return 0, ErrorUnsupportedQType{qtype}
+	}
+}
+
+/* decodeMultiA decodes the space-separated IPv4 addresses in res, each holding
+a sequence number and three bytes of payload, and places the payload in buf in
+order.  The number of decoded bytes is returned. */
+func decodeMultiA(buf []byte, res string) (int, error) {
+	return decodeMulti(buf, res, TypeA)
+}
+
+/* decodeMultiAAAA is like decodeMultiA, but for IPv6 addresses holding eight
+bytes of payload each. */
+func decodeMultiAAAA(buf []byte, res string) (int, error) {
+	return decodeMulti(buf, res, TypeAAAA)
+}
+
+/* decodeMulti decodes the space-separated IPv4 or IPv6 addresses in res,
+depending on qtype, and places their payload in buf in order. */
+func decodeMulti(buf []byte, res string, qtype QType) (int, error) {
+	var (
+		seen  [MultiAnswers]bool
+		count int
+		csize int
+	)
+	for _, a := range strings.Fields(res) {
+		/* Pull out the payload and where it goes */
+		ip, err := netip.ParseAddr(a)
+		if nil != err {
+			return 0, fmt.Errorf("invalid IP address %q: %w", a, err)
+		}
+		if "" != ip.Zone() {
+			return 0, fmt.Errorf("zoned IP address %s", a)
+		}
+		var (
+			seq   int
+			chunk []byte
 		)
+		if TypeA == qtype {
+			ip = ip.Unmap()
+			if !ip.Is4() {
+				return 0, fmt.Errorf("IPv6 address %s in A record", a)
+			}
+			b := ip.As4()
+			seq = int(b[0]) - multiAFirstByte
+			chunk = b[1:]
+		} else {
+			if ip.Is4() || ip.Is4In6() {
+				return 0, fmt.Errorf(
+					"IPv4 address %s in AAAA record",
+					a,
+				)
+			}
+			b := ip.As16()
+			seq = int(b[7])
+			chunk = b[8:]
+		}
+
+		/* Put it in place */
+		if 0 > seq || MultiAnswers <= seq {
+			return 0, fmt.Errorf("invalid sequence number in %s", a)
+		}
+		if seen[seq] {
+			return 0, fmt.Errorf("duplicate sequence number in %s", a)
+		}
+		csize = len(chunk)
+		if len(buf) < (seq+1)*csize {
+			return 0, fmt.Errorf(
+				"buffer too small for record of type %s",
+				qtype,
+			)
+		}
+		copy(buf[seq*csize:], chunk)
+		seen[seq] = true
+		count++
 	}
-	/* Extract the payload */
-	return copy(buf, ip[start:]), nil
+
+	/* Make sure we got all of them */
+	for i := 0; i < count; i++ {
+		if !seen[i] {
+			return 0, fmt.Errorf("missing record %d of %d", i, count)
+		}
+	}
+	return count * csize, nil
 }
 
 /* decodeTXT decodes a TXT record and places the payload in buf.  The number of
 decoded bytes is returned. */
-func (g *Getter) decodeTXT(buf []byte, txt string) (int, error) {
+func decodeTXT(buf []byte, txt string) (int, error) {
 	if base64.RawStdEncoding.DecodedLen(len(txt)) > len(buf) {
 		return 0, errors.New("buffer too small for decoded payload")
 	}
@@ -286,3 +886,72 @@ func (g *Getter) decodeTXT(buf []byte, txt string) (int, error) {
 	}
 	return n, nil
 }
+
+/* decodeNULL places the raw payload from a NULL record in buf.  The number of
+bytes placed in buf is returned. */
+func decodeNULL(buf []byte, res string) (int, error) {
+	if len(res) > len(buf) {
+		return 0, errors.New("buffer too small for payload")
+	}
+	return copy(buf, res), nil
+}
+
+/* decodeName decodes the base32-encoded payload in the labels of the name,
+less the Getter's domain, in res and places it in buf.  The number of decoded
+bytes is returned. */
+func decodeName(buf []byte, res string) (int, error) {
+	e := strings.ToUpper(strings.ReplaceAll(res, ".", ""))
+	if nameEncoding.DecodedLen(len(e)) > len(buf) {
+		return 0, errors.New("buffer too small for decoded payload")
+	}
+	n, err := nameEncoding.Decode(buf, []byte(e))
+	if nil != err {
+		return n, fmt.Errorf("decoding name: %w", err)
+	}
+	return n, nil
+}
+
+/* decodeMX decodes an MX record of the form "preference exchange", with the
+data in the exchange as for decodeName.  The preference is the chunk's
+sequence number, which isn't needed as chunks are requested one at a time. */
+func decodeMX(buf []byte, res string) (int, error) {
+	parts := strings.SplitN(res, " ", 2)
+	if 2 != len(parts) {
+		return 0, fmt.Errorf("invalid MX record %q", res)
+	}
+	if _, err := strconv.ParseUint(parts[0], 10, 16); nil != err {
+		return 0, fmt.Errorf("invalid MX preference %q", parts[0])
+	}
+	return decodeName(buf, parts[1])
+}
+
+/* decodeSRV decodes an SRV record of the form "priority weight port target",
+with the data in the target as for decodeName.  The priority and weight are
+the offset of the data, which isn't needed as chunks are requested one at a
+time, and the port is the number of bytes of data, which is checked. */
+func decodeSRV(buf []byte, res string) (int, error) {
+	parts := strings.SplitN(res, " ", 4)
+	if 4 != len(parts) {
+		return 0, fmt.Errorf("invalid SRV record %q", res)
+	}
+	var ns [3]uint64
+	for i, p := range parts[:3] {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if nil != err {
+			return 0, fmt.Errorf("invalid SRV field %q", p)
+		}
+		ns[i] = n
+	}
+	n, err := decodeName(buf, parts[3])
+	if nil != err {
+		return n, err
+	}
+	if uint64(n) != ns[2] {
+		return n, fmt.Errorf(
+			"decoded %d bytes, SRV record has %d",
+			n,
+			ns[2],
+		)
+	}
+	return n, nil
+}
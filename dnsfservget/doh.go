@@ -5,20 +5,21 @@ package dnsfservget
  * fserve using DNS over HTTPS
  * By J. Stuart McMurray
  * Created 20200809
- * Last Modified 20200817
+ * Last Modified 20261015
  */
 
 import (
 	"bytes"
-	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/dns/dnsmessage"
 )
@@ -28,12 +29,36 @@ const (
 	// connections
 	DefaultDOHPort = "443"
 
-	// MaxPOSTBody is the maximum number of bytes from a POST response body
-	// which will be used by the POSTClients returned from the functions
-	// in this package.
+	// MaxPOSTBody is the maximum number of bytes in a POST response body
+	// which will be accepted by the POSTClients returned from the
+	// functions in this package.  Queriers returned by DOHQuerier may be
+	// configured to accept larger responses.
 	MaxPOSTBody = 65535
+
+	// DOHMediaType is the media type for DoH requests and responses.
+	DOHMediaType = "application/dns-message"
+
+	// BrowserUserAgent is the User-Agent set by DOHConfig.MimicBrowser.
+	BrowserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; " +
+		"rv:131.0) Gecko/20100101 Firefox/131.0"
+
+	// DefaultDOHAttempts is the default maximum number of times a DoH
+	// query will be sent if the server is busy or broken.
+	DefaultDOHAttempts = 4
+
+	// DefaultDOHRetryWait is the default base time to wait before
+	// retrying a DoH query.  It is doubled for every attempt.
+	DefaultDOHRetryWait = time.Second
+
+	// DefaultDOHMaxRetryWait is the default maximum time to wait before
+	// retrying a DoH query, even if the server asks for longer.
+	DefaultDOHMaxRetryWait = time.Minute
 )
 
+// ErrResponseTooLarge is returned by the POSTClients in this package when a
+// response body is larger than allowed.
+var ErrResponseTooLarge = errors.New("response too large")
+
 /* bufPool holds a pool of buffers for rolling and unrolling DNS messages */
 var bufPool = sync.Pool{
 	New: func() interface{} { return make([]byte, MaxPOSTBody) },
@@ -71,8 +96,109 @@ type DOHConfig struct {
 	URL string
 
 	// POSTClient will be used to perform HTTP queries.  If this is not
-	// set, BuiltinPOST() will be used.
+	// set, a POSTClient similar to BuiltinPOST() but which sends the
+	// below headers will be used.
 	POST POSTClient
+
+	// SNI, if set, causes queries to be domain-fronted as with
+	// BuiltinDFPOST.  If MoreSNIs is also set, queries will be spread
+	// among all of the SNIs.  Both are ignored if POST is set.
+	SNI      string
+	MoreSNIs []string
+
+	// ECHConfigList, if set along with SNI, causes Encrypted Client Hello
+	// to be attempted as with BuiltinDFECHPOST.  It is ignored if POST
+	// is set.
+	ECHConfigList []byte
+
+	// UserAgent, Accept, and ContentType, if set, are sent as the
+	// User-Agent, Accept, and Content-Type headers.  Header holds any
+	// other headers to send.  These are all ignored if POST is set; use
+	// WrapDo to send headers with a custom client.  If UserAgent is not
+	// set, Go's default User-Agent will be sent.
+	UserAgent   string
+	Accept      string
+	ContentType string
+	Header      http.Header
+
+	// MaxAttempts is the maximum number of times to send a query which
+	// gets an HTTP 429 or 5xx response.  Before each retry, the querier
+	// waits RetryWait, doubled for every attempt, with a bit of jitter,
+	// or as long as the server asks in a Retry-After header, whichever
+	// is longer, but never more than MaxRetryWait.  Retries only happen
+	// if POST returns an *HTTPStatusError.  Zero values are replaced by
+	// DefaultDOHAttempts, DefaultDOHRetryWait, and
+	// DefaultDOHMaxRetryWait.  Set MaxAttempts to 1 to disable retries.
+	MaxAttempts  int
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+
+	// MaxResponseSize is the size of the largest response body which
+	// will be accepted.  Larger responses cause an error wrapping
+	// ErrResponseTooLarge.  If unset, MaxPOSTBody is used.  It is
+	// ignored if POST is set.
+	MaxResponseSize int
+}
+
+// HTTPStatusError is returned by the POSTClients in this package when a DoH
+// server sends back a non-2xx response.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+
+	/* RetryAfter is how long the server asked us to wait before trying
+	again, or 0 if it didn't. */
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf(
+		"non-2xx response status %d %s",
+		e.StatusCode,
+		e.Status,
+	)
+}
+
+// Retryable returns true if the response was a 429 or a 5xx other than a 501,
+// which indicates the query may be retried.
+func (e *HTTPStatusError) Retryable() bool {
+	return http.StatusTooManyRequests == e.StatusCode ||
+		(500 <= e.StatusCode && 599 >= e.StatusCode &&
+			http.StatusNotImplemented != e.StatusCode)
+}
+
+// MimicBrowser sets c's UserAgent, Accept, and ContentType to what a browser
+// would send with a DoH request, to look a bit less like a Go program in
+// proxy logs.  Fields which are already set are not changed.
+func (c *DOHConfig) MimicBrowser() {
+	if "" == c.UserAgent {
+		c.UserAgent = BrowserUserAgent
+	}
+	if "" == c.Accept {
+		c.Accept = DOHMediaType
+	}
+	if "" == c.ContentType {
+		c.ContentType = DOHMediaType
+	}
+}
+
+/* header returns the headers to send with every request made with c */
+func (c DOHConfig) header() http.Header {
+	h := c.Header.Clone()
+	if nil == h {
+		h = make(http.Header)
+	}
+	for k, v := range map[string]string{
+		"User-Agent":   c.UserAgent,
+		"Accept":       c.Accept,
+		"Content-Type": c.ContentType,
+	} {
+		if "" != v {
+			h.Set(k, v)
+		}
+	}
+	return h
 }
 
 // dohQuerier implements Querier but performs the lookups using DNS over HTTPS
@@ -80,6 +206,12 @@ type DOHConfig struct {
 type dohQuerier struct {
 	u    string /* URL */
 	post POSTClient
+
+	attempts     int
+	retryWait    time.Duration
+	maxRetryWait time.Duration
+
+	stop <-chan struct{} /* Closed to stop waiting to retry */
 }
 
 // dohQuerier implements Querier but performs the lookups using DNS over HTTPS
@@ -87,18 +219,45 @@ type dohQuerier struct {
 // resolve CNAME records into A records.  This is a known limitation.
 func DOHQuerier(conf DOHConfig) Querier {
 	q := dohQuerier{
-		u:    conf.URL,
-		post: conf.POST,
+		u:            conf.URL,
+		post:         conf.POST,
+		attempts:     conf.MaxAttempts,
+		retryWait:    conf.RetryWait,
+		maxRetryWait: conf.MaxRetryWait,
+	}
+	if 0 >= q.attempts {
+		q.attempts = DefaultDOHAttempts
+	}
+	if 0 >= q.retryWait {
+		q.retryWait = DefaultDOHRetryWait
+	}
+	if 0 >= q.maxRetryWait {
+		q.maxRetryWait = DefaultDOHMaxRetryWait
 	}
 	if nil == q.post {
-		q.post = BuiltinPOST()
+		do := http.DefaultClient.Do
+		if "" != conf.SNI {
+			do = newFrontedClient(
+				append([]string{conf.SNI}, conf.MoreSNIs...),
+				conf.ECHConfigList,
+			).Do
+		}
+		max := conf.MaxResponseSize
+		if 0 >= max {
+			max = MaxPOSTBody
+		}
+		q.post = wrapDo(do, conf.header(), max)
 	}
 
 	return q
 }
 
-/* dohQuery does a DoH query for the given name and record type */
-func (d dohQuerier) dohQuery(name string, qtype QType) ([]string, error) {
+/* dohQuery does a DoH query for the given name and record type.  It also
+returns the answer's TTL. */
+func (d dohQuerier) dohQuery(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
 	/* Buffer for the query */
 	qb := getBuf()
 	defer putBuf(qb)
@@ -107,37 +266,105 @@ func (d dohQuerier) dohQuery(name string, qtype QType) ([]string, error) {
 	var err error
 	qb, err = AppendQuery(name, qtype, qb[:0])
 	if nil != err {
-		return nil, fmt.Errorf("generating query: %w", err)
+		return nil, 0, fmt.Errorf("generating query: %w", err)
 	}
 
-	/* Send query off */
-	res, err := d.post(d.u, qb)
+	/* Send query off, retrying if the server's busy */
+	var (
+		res []byte
+		se  *HTTPStatusError
+	)
+	for i := 0; ; i++ {
+		res, err = d.post(d.u, qb)
+		if nil == err ||
+			!errors.As(err, &se) ||
+			!se.Retryable() ||
+			d.attempts <= i+1 {
+			break
+		}
+		if err := d.sleep(d.backoff(i, se.RetryAfter)); nil != err {
+			return nil, 0, fmt.Errorf("sending query: %w", err)
+		}
+	}
 	if nil != err {
-		return nil, fmt.Errorf("sending query: %w", err)
+		return nil, 0, fmt.Errorf("sending query: %w", err)
 	}
 	defer putBuf(res)
 
 	/* Send back answer */
-	as, err := ParseDoHAnswer(res, qtype)
+	as, ttl, err := parseAnswer(res, name, qtype)
 	if nil != err {
-		return nil, fmt.Errorf("parsing response: %w", err)
+		return nil, 0, fmt.Errorf("parsing response: %w", err)
+	}
+	return as, ttl, nil
+}
+
+/* backoff returns how long to wait after the attempt'th failed attempt,
+starting from 0.  The server asked us to wait for retryAfter. */
+func (d dohQuerier) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	/* Exponential backoff, with a bit of jitter */
+	w := d.maxRetryWait
+	if 30 > attempt && d.retryWait<<attempt < w {
+		w = d.retryWait << attempt
+	}
+	w = w/2 + time.Duration(rand.Int63n(int64(w/2)+1))
+
+	/* Wait longer if the server asked, but not too long */
+	if retryAfter > w {
+		w = retryAfter
+	}
+	if w > d.maxRetryWait {
+		w = d.maxRetryWait
+	}
+	return w
+}
+
+/* sleep waits for w, or until d.stop is closed, in which case it returns
+ErrCanceled. */
+func (d dohQuerier) sleep(w time.Duration) error {
+	t := time.NewTimer(w)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-d.stop:
+		return ErrCanceled
 	}
-	return as, nil
+}
+
+/* withStop implements stoppableQuerier. */
+func (d dohQuerier) withStop(stop <-chan struct{}) Querier {
+	d.stop = stop
+	return d
 }
 
 /* A implements Querier.A */
 func (d dohQuerier) A(name string) ([]string, error) {
-	return d.dohQuery(name, TypeA)
+	return d.Query(name, TypeA)
 }
 
 /* AAAA implements Querier.AAAA */
 func (d dohQuerier) AAAA(name string) ([]string, error) {
-	return d.dohQuery(name, TypeAAAA)
+	return d.Query(name, TypeAAAA)
 }
 
 /* TXT implements Querier.TXT */
 func (d dohQuerier) TXT(name string) ([]string, error) {
-	return d.dohQuery(name, TypeTXT)
+	return d.Query(name, TypeTXT)
+}
+
+/* Query implements TypeQuerier.Query */
+func (d dohQuerier) Query(name string, qtype QType) ([]string, error) {
+	as, _, err := d.dohQuery(name, qtype)
+	return as, err
+}
+
+/* QueryTTL implements TTLQuerier.QueryTTL */
+func (d dohQuerier) QueryTTL(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
+	return d.dohQuery(name, qtype)
 }
 
 // BuiltinPOST returns a POSTClient which is a thin wrapper around
@@ -151,26 +378,32 @@ func BuiltinPOST() POSTClient {
 // the server as well as in the SNI of the TLS connection.  An optional port
 // may be supplied with the SNI in host:port form.  If not, DefaultDOHPort will
 // be used.
-func BuiltinDFPOST(sni string) POSTClient {
-	/* Make sure we have a port */
-	_, p, err := net.SplitHostPort(sni)
-	if "" == p || nil != err {
-		sni = net.JoinHostPort(sni, DefaultDOHPort)
-	}
-
-	/* Roll a domain-fronting HTTP client */
-	d := new(tls.Dialer)
-	return WrapPOST((&http.Client{
-		Transport: &http.Transport{
-			DialTLSContext: func(
-				ctx context.Context,
-				network string,
-				addr string,
-			) (net.Conn, error) {
-				return d.DialContext(ctx, "tcp", sni)
-			},
-		},
-	}).Post)
+//
+// If moreSNIs are given, requests will be spread round-robin among sni and
+// moreSNIs.  If a request can't be made using one SNI, the next will be tried.
+func BuiltinDFPOST(sni string, moreSNIs ...string) POSTClient {
+	return WrapPOST(newFrontedClient(
+		append([]string{sni}, moreSNIs...),
+		nil,
+	).Post)
+}
+
+// BuiltinDFECHPOST is like BuiltinDFPOST, but uses Encrypted Client Hello
+// (ECH) with the serialized ECHConfigList echConfigList, usually taken from
+// the fronting provider's HTTPS DNS record.  The request's host is put in the
+// encrypted inner SNI, hiding it even from SNI inspection.  If the server
+// sends back a different ECHConfigList, it will be used instead.  If ECH
+// doesn't work, plain domain fronting will be used, as with BuiltinDFPOST.
+// As with BuiltinDFPOST, requests will be spread among sni and moreSNIs.
+func BuiltinDFECHPOST(
+	sni string,
+	echConfigList []byte,
+	moreSNIs ...string,
+) POSTClient {
+	return WrapPOST(newFrontedClient(
+		append([]string{sni}, moreSNIs...),
+		echConfigList,
+	).Post)
 }
 
 // WrapPOST wraps a function like http.Post into a POSTClient
@@ -188,52 +421,125 @@ func WrapPOST(post func(URL string, contentType string, body io.Reader) (resp *h
 		if nil != err {
 			return nil, fmt.Errorf("making request: %w", err)
 		}
-		defer res.Body.Close()
-		/* Non-200's are bad */
-		if 200 < res.StatusCode || 200 > res.StatusCode {
-			return nil, fmt.Errorf(
-				"non-2xx response status %d %s",
-				res.StatusCode,
-				res.Status,
-			)
+		return readPOSTResponse(res, MaxPOSTBody)
+	}
+}
+
+// WrapDo wraps a function like http.Client.Do into a POSTClient.  The headers
+// in header will be sent with every request.
+func WrapDo(do func(req *http.Request) (*http.Response, error), header http.Header) POSTClient {
+	return wrapDo(do, header, MaxPOSTBody)
+}
+
+/* wrapDo is like WrapDo, but allows response bodies up to max bytes. */
+func wrapDo(
+	do func(req *http.Request) (*http.Response, error),
+	header http.Header,
+	max int,
+) POSTClient {
+	return func(URL string, reqBody []byte) (resBody []byte, err error) {
+		/* Roll the request */
+		req, err := http.NewRequest(
+			http.MethodPost,
+			URL,
+			bytes.NewReader(reqBody),
+		)
+		if nil != err {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		for k, vs := range header {
+			req.Header[k] = append([]string(nil), vs...)
 		}
-		/* Slurp the body */
-		b := getBuf()
-		n, err := io.ReadFull(res.Body, b)
-		if nil != err && !errors.Is(err, io.ErrUnexpectedEOF) {
-			putBuf(b)
-			return nil, fmt.Errorf(
-				"reading response body: %w",
-				err,
-			)
+
+		/* Make the query */
+		res, err := do(req)
+		if nil != err {
+			return nil, fmt.Errorf("making request: %w", err)
+		}
+		return readPOSTResponse(res, max)
+	}
+}
+
+/* readPOSTResponse reads the body of a response to a DoH query and closes it.
+An error is returned if res has a non-2xx status or if the body is larger than
+max bytes. */
+func readPOSTResponse(res *http.Response, max int) ([]byte, error) {
+	defer res.Body.Close()
+	/* Non-200's are bad */
+	if 200 < res.StatusCode || 200 > res.StatusCode {
+		return nil, &HTTPStatusError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			RetryAfter: parseRetryAfter(
+				res.Header.Get("Retry-After"),
+			),
 		}
-		/* Send it back */
-		return b[:n], nil
 	}
+	/* Don't bother if we know it's too big */
+	tooBig := fmt.Errorf("%w (limit %d bytes)", ErrResponseTooLarge, max)
+	if int64(max) < res.ContentLength {
+		return nil, tooBig
+	}
+	/* Slurp the body, but not too much of it */
+	b := bytes.NewBuffer(getBuf()[:0])
+	if _, err := b.ReadFrom(
+		io.LimitReader(res.Body, int64(max)+1),
+	); nil != err {
+		putBuf(b.Bytes())
+		return nil, fmt.Errorf(
+			"reading response body: %w",
+			err,
+		)
+	}
+	if max < b.Len() {
+		putBuf(b.Bytes())
+		return nil, tooBig
+	}
+	/* Send it back */
+	return b.Bytes(), nil
+}
+
+/* parseRetryAfter parses the value of a Retry-After header, which may be
+either a number of seconds or an HTTP date.  If v is empty, unparsable, or in
+the past, parseRetryAfter returns 0. */
+func parseRetryAfter(v string) time.Duration {
+	if "" == v {
+		return 0
+	}
+	if n, err := strconv.ParseUint(v, 10, 32); nil == err {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); nil == err && time.Now().Before(t) {
+		return time.Until(t)
+	}
+	return 0
 }
 
 // AppendQuery appends a DNS query for the given domain and type suitable for a
 // DoH POST request body to b and returns the resulting slice.  The class will
 // always be inet.
 func AppendQuery(qname string, qtype QType, b []byte) ([]byte, error) {
-	/* Translate the type to dnsmessage */
-	var qt dnsmessage.Type
-	switch qtype {
-	case TypeA:
-		qt = dnsmessage.TypeA
-	case TypeAAAA:
-		qt = dnsmessage.TypeA
-	case TypeTXT:
-		qt = dnsmessage.TypeTXT
-	default:
-		return nil, ErrorUnsupportedQType{qtype}
+	return appendQuery(qname, qtype, 0, b)
+}
+
+/* appendQuery is like AppendQuery, but sets the query's ID to id. */
+func appendQuery(
+	qname string,
+	qtype QType,
+	id uint16,
+	b []byte,
+) ([]byte, error) {
+	/* Work out the type's number */
+	qi, err := lookupQType(qtype)
+	if nil != err {
+		return nil, err
 	}
 
 	/* Make sure the name ends with a . */
 	if !strings.HasSuffix(qname, ".") {
 		qname += "."
 	}
-	qn, err := dnsmessage.NewName(qname)
+	qb, err := DefaultCodec.AppendQuery(b, id, qname, qi.rrType)
 	if nil != err {
 		return nil, fmt.Errorf(
 			"error processing %q for query: %q",
@@ -241,16 +547,7 @@ func AppendQuery(qname string, qtype QType, b []byte) ([]byte, error) {
 			err,
 		)
 	}
-
-	/* Roll a DNS message */
-	return (&dnsmessage.Message{
-		Header: dnsmessage.Header{RecursionDesired: true},
-		Questions: []dnsmessage.Question{{
-			Name:  qn,
-			Type:  qt,
-			Class: dnsmessage.ClassINET,
-		}},
-	}).AppendPack(b)
+	return qb, nil
 }
 
 // ParseDoHAnswer parses an answer from a DoH server.  It returns a slice of
@@ -261,65 +558,145 @@ func AppendQuery(qname string, qtype QType, b []byte) ([]byte, error) {
 // If the answer indicates an NXDomain, a *net.DNSError is returned with its
 // IsNotFound field true.  Other errors may be represented by other types.
 func ParseDoHAnswer(ans []byte, filt QType) ([]string, error) {
+	ss, _, err := parseAnswer(ans, "", filt)
+	return ss, err
+}
+
+/* parseAnswer is like ParseDoHAnswer, but also returns the smallest TTL of
+the records returned and of any CNAMEs leading to them.  If name isn't empty,
+the answer must be for name and only records for name or the CNAMEs leading
+from it are returned, so an answer for a name with a search domain appended
+isn't mistaken for ours. */
+func parseAnswer(
+	ans []byte,
+	name string,
+	filt QType,
+) ([]string, time.Duration, error) {
 	/* Work out what type we need */
-	var mt dnsmessage.Type
-	switch filt {
-	case TypeA:
-		mt = dnsmessage.TypeA
-	case TypeAAAA:
-		mt = dnsmessage.TypeAAAA
-	case TypeTXT:
-		mt = dnsmessage.TypeTXT
+	qi, err := lookupQType(filt)
+	if nil != err {
+		return nil, 0, err
+	}
+
+	/* Parse the message */
+	res, err := DefaultCodec.ParseResponse(ans)
+	if nil != err {
+		return nil, 0, fmt.Errorf("unpacking response: %w", err)
 	}
+	return answerRecords(res, name, qi)
+}
+
+/* answerRecords is like parseAnswer, but takes an already-parsed response and
+the qtypeInfo for the type we need. */
+func answerRecords(
+	res *Response,
+	name string,
+	qi qtypeInfo,
+) ([]string, time.Duration, error) {
+	var err error
 
-	/* Unpack the message */
-	var m dnsmessage.Message
-	if err := m.Unpack(ans); nil != err {
-		return nil, fmt.Errorf("unpacking response: %w", err)
+	/* Make sure the answer's for the right name */
+	if "" != name && (0 == len(res.Questions) ||
+		!sameName(name, res.Questions[0].Name)) {
+		var got string
+		if 0 != len(res.Questions) {
+			got = res.Questions[0].Name
+		}
+		return nil, 0, fmt.Errorf("got answer for %q, not %q", got, name)
 	}
 
 	/* Make sure we got a good answer */
-	switch m.Header.RCode {
+	switch dnsmessage.RCode(res.RCode) {
 	case dnsmessage.RCodeSuccess: /* Good. */
 		break
 	case dnsmessage.RCodeNameError: /* NXDomain */
 		/* Maybe we get a name */
 		var n string
-		if 0 != len(m.Questions) {
-			n = m.Questions[0].Name.String()
+		if 0 != len(res.Questions) {
+			n = res.Questions[0].Name
 		}
-		return nil, &net.DNSError{
+		return nil, 0, &net.DNSError{
 			Err:        "name not found",
 			Name:       n,
 			IsNotFound: true,
 		}
 	default: /* Other error */
-		return nil, fmt.Errorf(
+		return nil, 0, fmt.Errorf(
 			"unsuccessful DNS response code %s (%d)",
-			m.Header.RCode,
-			m.Header.RCode,
+			dnsmessage.RCode(res.RCode),
+			res.RCode,
 		)
 	}
 
-	/* Extract the records */
-	var ss []string
-	for _, ans := range m.Answers {
+	/* Extract the records, noting where CNAMEs point */
+	var (
+		ss      []string
+		targets = make(map[string]bool)
+		owners  = map[string]bool{absName(strings.ToLower(name)): true}
+		ttl     = ^uint32(0)
+	)
+	noteTTL := func(t uint32) {
+		if t < ttl {
+			ttl = t
+		}
+	}
+	for _, r := range res.Answers {
+		/* Ignore records for names we didn't ask about */
+		if "" != name && !owners[absName(strings.ToLower(r.Name))] {
+			continue
+		}
+		/* Note CNAMEs, in case the answer's elsewhere */
+		if uint16(dnsmessage.TypeCNAME) == r.Type &&
+			uint16(dnsmessage.TypeCNAME) != qi.rrType {
+			t := strings.ToLower(r.Target)
+			targets[t] = true
+			owners[absName(t)] = true
+			noteTTL(r.TTL)
+			continue
+		}
 		/* Skip records we don't care about */
-		if ans.Header.Type != mt {
+		if r.Type != qi.rrType {
 			continue
 		}
-		/* Extract the answer itself */
-		switch ar := ans.Body.(type) {
-		case *dnsmessage.AResource:
-			ss = append(ss, net.IP(ar.A[:]).String())
-		case *dnsmessage.AAAAResource:
-			ss = append(ss, net.IP(ar.AAAA[:]).String())
-		case *dnsmessage.TXTResource:
-			ss = append(ss, ar.TXT...)
-		default:
+		/* Extract the answer itself.  CNAMEs' targets are parsed
+		already, as they may be compressed. */
+		a := r.Target
+		if uint16(dnsmessage.TypeCNAME) != r.Type {
+			if a, err = qi.encode(r.Data); nil != err {
+				return nil, 0, fmt.Errorf(
+					"encoding answer: %w",
+					err,
+				)
+			}
+		}
+		ss = append(ss, a)
+		noteTTL(r.TTL)
+	}
+
+	/* If we only got CNAMEs, the targets' records may be in the
+	additional section */
+	if 0 != len(ss) || 0 == len(targets) {
+		return ss, ttlDuration(ttl, len(ss)), nil
+	}
+	for _, r := range res.Additionals {
+		if r.Type != qi.rrType || !targets[strings.ToLower(r.Name)] {
 			continue
 		}
+		a, err := qi.encode(r.Data)
+		if nil != err {
+			return nil, 0, fmt.Errorf("encoding additional: %w", err)
+		}
+		ss = append(ss, a)
+		noteTTL(r.TTL)
 	}
 
-	return ss, nil
+	return ss, ttlDuration(ttl, len(ss)), nil
+}
+
+/* ttlDuration returns ttl as a Duration, or 0 if there were no records. */
+func ttlDuration(ttl uint32, nRecords int) time.Duration {
+	if 0 == nRecords {
+		return 0
+	}
+	return time.Duration(ttl) * time.Second
 }
@@ -0,0 +1,311 @@
+package dnsfservget
+
+/*
+ * doh_test.go
+ * Tests for DoH retries, headers, and response sizes
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* testDOHServer returns a DoH server which fails the first fails queries it
+gets with a 503 and a Retry-After of retryAfter, if not empty, and answers the
+rest with 192.0.2.1, as well as a counter of the queries it's had. */
+func testDOHServer(
+	t *testing.T,
+	fails int64,
+	retryAfter string,
+) (*httptest.Server, *int64) {
+	var n int64
+	s := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		if atomic.AddInt64(&n, 1) <= fails {
+			if "" != retryAfter {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if nil != err {
+			t.Errorf("Reading query: %s", err)
+			return
+		}
+		var m dnsmessage.Message
+		if err := m.Unpack(b); nil != err {
+			t.Errorf("Unpacking query: %s", err)
+			return
+		}
+		m.Response = true
+		m.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{
+				Name:  m.Questions[0].Name,
+				Type:  dnsmessage.TypeA,
+				Class: dnsmessage.ClassINET,
+			},
+			Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}}
+		if b, err = m.Pack(); nil != err {
+			t.Errorf("Packing response: %s", err)
+			return
+		}
+		w.Header().Set("Content-Type", DOHMediaType)
+		w.Write(b)
+	}))
+	t.Cleanup(s.Close)
+	return s, &n
+}
+
+func TestDOHQuerierRetries(t *testing.T) {
+	for _, c := range []struct {
+		fails int64
+		want  int64
+		ok    bool
+	}{
+		{0, 1, true},
+		{2, 3, true},
+		{3, 3, false},
+		{10, 3, false},
+	} {
+		s, n := testDOHServer(t, c.fails, "")
+		q := DOHQuerier(DOHConfig{
+			URL:         s.URL,
+			MaxAttempts: 3,
+			RetryWait:   time.Millisecond,
+		})
+		as, err := q.A("kittens.example.com")
+		if got := atomic.LoadInt64(n); c.want != got {
+			t.Errorf(
+				"%d failures: made %d queries, want %d",
+				c.fails,
+				got,
+				c.want,
+			)
+		}
+		var se *HTTPStatusError
+		switch {
+		case c.ok && nil != err:
+			t.Errorf("%d failures: %s", c.fails, err)
+		case c.ok && (1 != len(as) || "192.0.2.1" != as[0]):
+			t.Errorf("%d failures: got %q", c.fails, as)
+		case !c.ok && !errors.As(err, &se):
+			t.Errorf("%d failures: got error %v", c.fails, err)
+		}
+	}
+}
+
+func TestDOHQuerierBackoff(t *testing.T) {
+	d := dohQuerier{retryWait: time.Second, maxRetryWait: 10 * time.Second}
+
+	/* Exponential, jittered, and capped */
+	for attempt := 0; attempt < 70; attempt++ {
+		base := d.maxRetryWait
+		if 4 > attempt {
+			base = d.retryWait << attempt
+		}
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 100; i++ {
+			w := d.backoff(attempt, 0)
+			if base/2 > w || base < w {
+				t.Fatalf(
+					"Attempt %d: waited %s, want %s-%s",
+					attempt,
+					w,
+					base/2,
+					base,
+				)
+			}
+			seen[w] = true
+		}
+		if 2 > len(seen) {
+			t.Errorf("Attempt %d: no jitter", attempt)
+		}
+	}
+
+	/* Retry-After is honored, up to a point */
+	if w := d.backoff(0, 5*time.Second); 5*time.Second != w {
+		t.Errorf("Retry-After 5s: waited %s", w)
+	}
+	if w := d.backoff(0, time.Hour); d.maxRetryWait != w {
+		t.Errorf("Retry-After 1h: waited %s", w)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, c := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"kittens", 0},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	} {
+		if got := parseRetryAfter(c.v); c.want != got {
+			t.Errorf("%q: got %s, want %s", c.v, got, c.want)
+		}
+	}
+
+	/* HTTP dates only have seconds */
+	v := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(v); 88*time.Second > got ||
+		90*time.Second < got {
+		t.Errorf("%q: got %s, want about 90s", v, got)
+	}
+}
+
+func TestDOHQuerierStop(t *testing.T) {
+	s, n := testDOHServer(t, 1000, strconv.Itoa(3600))
+	q := DOHQuerier(DOHConfig{
+		URL:          s.URL,
+		MaxRetryWait: time.Hour,
+	}).(stoppableQuerier)
+
+	/* Waiting for the server should stop when we're told */
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+	start := time.Now()
+	_, err := q.withStop(stop).A("kittens.example.com")
+	if !errors.Is(err, ErrCanceled) {
+		t.Errorf("Got error %v", err)
+	}
+	if d := time.Since(start); time.Second < d {
+		t.Errorf("Took %s to stop", d)
+	}
+	if got := atomic.LoadInt64(n); 1 != got {
+		t.Errorf("Made %d queries", got)
+	}
+}
+
+func TestDOHConfigHeaders(t *testing.T) {
+	/* Note the headers we get */
+	ds, _ := testDOHServer(t, 0, "")
+	hs := make(chan http.Header, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		hs <- r.Header.Clone()
+		ds.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	get := func(c DOHConfig) http.Header {
+		c.URL = s.URL
+		if _, err := DOHQuerier(c).A("kittens.example.com"); nil != err {
+			t.Fatalf("Query error: %s", err)
+		}
+		return <-hs
+	}
+
+	/* Without anything set, we look like Go and don't say what we're
+	sending */
+	h := get(DOHConfig{})
+	if ua := h.Get("User-Agent"); !strings.HasPrefix(ua, "Go-http-client/") {
+		t.Errorf("Default User-Agent %q", ua)
+	}
+	if ct, ok := h["Content-Type"]; ok {
+		t.Errorf("Default Content-Type %q", ct)
+	}
+
+	/* MimicBrowser only fills in what's not set */
+	c := DOHConfig{
+		Accept: "*/*",
+		Header: http.Header{
+			"X-Kittens":  {"moose"},
+			"User-Agent": {"overridden"},
+		},
+	}
+	c.MimicBrowser()
+	if BrowserUserAgent != c.UserAgent ||
+		"*/*" != c.Accept ||
+		DOHMediaType != c.ContentType {
+		t.Errorf(
+			"MimicBrowser set UserAgent:%q Accept:%q ContentType:%q",
+			c.UserAgent,
+			c.Accept,
+			c.ContentType,
+		)
+	}
+	h = get(c)
+	for k, v := range map[string]string{
+		"User-Agent":   BrowserUserAgent,
+		"Accept":       "*/*",
+		"Content-Type": DOHMediaType,
+		"X-Kittens":    "moose",
+	} {
+		if got := h.Values(k); 1 != len(got) || v != got[0] {
+			t.Errorf("Got %s %q, want %q", k, got, v)
+		}
+	}
+	if ua := c.Header.Get("User-Agent"); "overridden" != ua {
+		t.Errorf("Config's Header changed, User-Agent now %q", ua)
+	}
+}
+
+func TestDOHQuerierResponseTooLarge(t *testing.T) {
+	/* A response to a query for an A record is a bit under 100 bytes */
+	s, _ := testDOHServer(t, 0, "")
+	for _, c := range []struct {
+		max int
+		ok  bool
+	}{
+		{0, true},
+		{1000, true},
+		{20, false},
+	} {
+		_, err := DOHQuerier(DOHConfig{
+			URL:             s.URL,
+			MaxResponseSize: c.max,
+		}).A("kittens.example.com")
+		if c.ok && nil != err {
+			t.Errorf("Limit %d: %s", c.max, err)
+		} else if !c.ok && !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("Limit %d: got error %v", c.max, err)
+		}
+	}
+
+	/* Responses without a Content-Length are caught, too */
+	for _, c := range []struct {
+		n  int
+		ok bool
+	}{
+		{10, true},
+		{11, false},
+	} {
+		b, err := readPOSTResponse(&http.Response{
+			StatusCode:    http.StatusOK,
+			ContentLength: -1,
+			Body: ioutil.NopCloser(
+				strings.NewReader(strings.Repeat("x", c.n)),
+			),
+		}, 10)
+		if c.ok && (nil != err || c.n != len(b)) {
+			t.Errorf(
+				"%d bytes: got %d bytes, error %v",
+				c.n,
+				len(b),
+				err,
+			)
+		} else if !c.ok && !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("%d bytes: got error %v", c.n, err)
+		}
+	}
+}
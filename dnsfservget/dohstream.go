@@ -0,0 +1,93 @@
+package dnsfservget
+
+/*
+ * dohstream.go
+ * Send many queries over one long-lived DoH request
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DOHStreamPath is the path at which dnsfserv serves DoH streams when started
+// with -doh-stream.
+const DOHStreamPath = "/dns-stream"
+
+// DialDOHStream starts an experimental DoH stream with a POST to URL, which
+// should be a dnsfserv DoH listener started with -doh-stream and end in
+// DOHStreamPath.  The request body and response body are kept open and carry
+// length-prefixed queries and responses, as with DNS over TCP, so the
+// returned stream can be passed to NewStreamQuerier to make every query over
+// a single request, without the per-query overhead of separate HTTP requests.
+// This needs HTTP/2, which Go's HTTP clients use with HTTPS by default, or a
+// client which reads the response while still sending the request.
+//
+// The request is made with do, which should be something like
+// http.Client.Do, or http.DefaultClient.Do if do is nil.  The headers in
+// header are sent with the request.  Closing the returned stream ends the
+// request.
+func DialDOHStream(
+	do func(req *http.Request) (*http.Response, error),
+	URL string,
+	header http.Header,
+) (io.ReadWriteCloser, error) {
+	if nil == do {
+		do = http.DefaultClient.Do
+	}
+
+	/* Roll the request, with a body we can keep writing */
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, URL, pr)
+	if nil != err {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, vs := range header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if "" == req.Header.Get("Content-Type") {
+		req.Header.Set("Content-Type", DOHMediaType)
+	}
+
+	/* Start the stream, which is ready as soon as we have headers */
+	res, err := do(req)
+	if nil != err {
+		pw.Close()
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	if http.StatusOK != res.StatusCode {
+		pw.Close()
+		res.Body.Close()
+		return nil, &HTTPStatusError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	return &dohStream{w: pw, r: res.Body}, nil
+}
+
+/* dohStream is an io.ReadWriteCloser which writes to a request's body and
+reads from the response's body */
+type dohStream struct {
+	w *io.PipeWriter
+	r io.ReadCloser
+}
+
+/* Read implements io.Reader. */
+func (d *dohStream) Read(b []byte) (int, error) { return d.r.Read(b) }
+
+/* Write implements io.Writer. */
+func (d *dohStream) Write(b []byte) (int, error) { return d.w.Write(b) }
+
+/* Close implements io.Closer.  It ends the request and closes the response
+body. */
+func (d *dohStream) Close() error {
+	return errors.Join(d.w.Close(), d.r.Close())
+}
@@ -0,0 +1,77 @@
+package dnsfservget
+
+/*
+ * envkey.go
+ * Passphrases keyed to the host on which a file's retrieved
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Host attributes which may be used to key a passphrase.  HostEnv can get
+// them for the current host.
+const (
+	EnvHostname    = "hostname"
+	EnvDomain      = "domain"
+	EnvMachineGUID = "machineguid"
+)
+
+// EnvPassphrase combines a passphrase, which may be empty, with the host
+// attributes in attrs, keyed by name, to make a passphrase which can be used
+// with NewEncrypter and Getter.Passphrase so that a file can only be decrypted
+// on a host with the same attributes.  Values are compared case-insensitively.
+func EnvPassphrase(passphrase string, attrs map[string]string) string {
+	names := make([]string, 0, len(attrs))
+	for n := range attrs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString(passphrase)
+	for _, n := range names {
+		fmt.Fprintf(
+			&sb,
+			"\x00%s=%s",
+			strings.ToLower(n),
+			strings.ToLower(strings.TrimSpace(attrs[n])),
+		)
+	}
+	return sb.String()
+}
+
+// HostEnv gets the named attributes of the current host, for use with
+// EnvPassphrase.
+func HostEnv(names ...string) (map[string]string, error) {
+	attrs := make(map[string]string, len(names))
+	for _, n := range names {
+		var (
+			v   string
+			err error
+		)
+		switch strings.ToLower(n) {
+		case EnvHostname:
+			v, err = os.Hostname()
+		case EnvDomain:
+			v, err = hostDomain()
+		case EnvMachineGUID:
+			v, err = machineGUID()
+		default:
+			return nil, fmt.Errorf("unknown host attribute %q", n)
+		}
+		if nil != err {
+			return nil, fmt.Errorf("getting %s: %w", n, err)
+		}
+		if "" == v {
+			return nil, fmt.Errorf("empty %s", n)
+		}
+		attrs[strings.ToLower(n)] = v
+	}
+	return attrs, nil
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package dnsfservget
+
+/*
+ * envkey_other.go
+ * Get host attributes on non-Windows hosts
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+/* machineIDFiles are the files which might hold the host's machine ID */
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+/* hostDomain returns the host's DNS domain, from the hostname if it's fully
+qualified or from /etc/resolv.conf if not. */
+func hostDomain() (string, error) {
+	if h, err := os.Hostname(); nil == err {
+		if i := strings.IndexByte(h, '.'); -1 != i && "" != h[i+1:] {
+			return h[i+1:], nil
+		}
+	}
+	f, err := os.Open("/etc/resolv.conf")
+	if nil != err {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+		if 2 <= len(fs) && ("domain" == fs[0] || "search" == fs[0]) {
+			return fs[1], nil
+		}
+	}
+	if err := s.Err(); nil != err {
+		return "", err
+	}
+	return "", errors.New("no domain found")
+}
+
+/* machineGUID returns the host's machine ID. */
+func machineGUID() (string, error) {
+	var err error
+	for _, fn := range machineIDFiles {
+		var b []byte
+		if b, err = ioutil.ReadFile(fn); nil == err {
+			return strings.TrimSpace(string(b)), nil
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,108 @@
+package dnsfservget_test
+
+/*
+ * envkey_test.go
+ * Tests for host-keyed passphrases
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestEnvPassphrase(t *testing.T) {
+	want := dnsfservget.EnvPassphrase("kittens", map[string]string{
+		dnsfservget.EnvHostname: "target",
+		dnsfservget.EnvDomain:   "corp.example.com",
+	})
+	if got := dnsfservget.EnvPassphrase("kittens", map[string]string{
+		dnsfservget.EnvDomain:   "CORP.example.com ",
+		dnsfservget.EnvHostname: "Target",
+	}); want != got {
+		t.Errorf("Case or order changed passphrase: %q != %q", got, want)
+	}
+	for _, attrs := range []map[string]string{{
+		dnsfservget.EnvHostname: "target",
+	}, {
+		dnsfservget.EnvHostname: "other",
+		dnsfservget.EnvDomain:   "corp.example.com",
+	}, {
+		dnsfservget.EnvHostname: "target",
+		dnsfservget.EnvDomain:   "example.com",
+	}} {
+		if got := dnsfservget.EnvPassphrase("kittens", attrs); want == got {
+			t.Errorf("Same passphrase for %v", attrs)
+		}
+	}
+}
+
+func TestHostEnvDecrypt(t *testing.T) {
+	attrs, err := dnsfservget.HostEnv(dnsfservget.EnvHostname)
+	if nil != err {
+		t.Fatalf("HostEnv: %s", err)
+	}
+	if h, _ := os.Hostname(); h != attrs[dnsfservget.EnvHostname] {
+		t.Fatalf(
+			"Got hostname %q, want %q",
+			attrs[dnsfservget.EnvHostname],
+			h,
+		)
+	}
+	if _, err := dnsfservget.HostEnv("kittens"); nil == err {
+		t.Errorf("No error for unknown attribute")
+	}
+
+	/* Encrypt for this host and another */
+	encrypt := func(attrs map[string]string) []byte {
+		var buf bytes.Buffer
+		enc, err := dnsfservget.NewEncrypter(
+			&buf,
+			dnsfservget.EnvPassphrase("", attrs),
+			dnsfservget.DefaultScryptParams,
+		)
+		if nil != err {
+			t.Fatalf("NewEncrypter: %s", err)
+		}
+		enc.Write([]byte("kittens"))
+		if err := enc.Close(); nil != err {
+			t.Fatalf("Close: %s", err)
+		}
+		return buf.Bytes()
+	}
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("here", encrypt(attrs))
+	s.SetFile("there", encrypt(map[string]string{
+		dnsfservget.EnvHostname: "not-" + attrs[dnsfservget.EnvHostname],
+	}))
+
+	/* Only the file for this host should decrypt */
+	get := func(name string) ([]byte, error) {
+		g := dnsfservget.Getter{
+			Type:       dnsfservget.TypeTXT,
+			Name:       name,
+			Domain:     "example.com",
+			Querier:    q,
+			Passphrase: dnsfservget.EnvPassphrase("", attrs),
+		}
+		return ioutil.ReadAll(g.Get())
+	}
+	if b, err := get("here"); nil != err {
+		t.Errorf("Getting file for this host: %s", err)
+	} else if "kittens" != string(b) {
+		t.Errorf("Got %q, want %q", b, "kittens")
+	}
+	if _, err := get("there"); !errors.Is(err, dnsfservget.ErrDecryption) {
+		t.Errorf("Getting file for another host: got %v, want %v",
+			err, dnsfservget.ErrDecryption)
+	}
+}
@@ -0,0 +1,40 @@
+package dnsfservget
+
+/*
+ * envkey_windows.go
+ * Get host attributes on Windows
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+/* hostDomain returns the host's DNS domain, as set in the environment for
+domain-joined hosts. */
+func hostDomain() (string, error) {
+	if d := os.Getenv("USERDNSDOMAIN"); "" != d {
+		return d, nil
+	}
+	return "", errors.New("not domain-joined")
+}
+
+/* machineGUID returns the MachineGuid set when Windows was installed. */
+func machineGUID() (string, error) {
+	k, err := registry.OpenKey(
+		registry.LOCAL_MACHINE,
+		`SOFTWARE\Microsoft\Cryptography`,
+		registry.QUERY_VALUE|registry.WOW64_64KEY,
+	)
+	if nil != err {
+		return "", err
+	}
+	defer k.Close()
+	v, _, err := k.GetStringValue("MachineGuid")
+	return v, err
+}
@@ -0,0 +1,130 @@
+package dnsfservget
+
+/*
+ * faulty.go
+ * Querier which misbehaves, for testing
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// FaultyQuerier wraps a Querier and randomly misbehaves in the sorts of ways
+// real resolvers do, for testing how well things hold up.  Each of the
+// probabilities is a number between 0 and 1, checked independently for every
+// query.  A FaultyQuerier is also a TypeQuerier, but if the wrapped Querier
+// isn't, queries for types other than A, AAAA, and TXT will fail.
+type FaultyQuerier struct {
+	Querier Querier /* Querier to wrap */
+
+	/* Delay is the probability a query will be delayed by a random amount
+	of time up to MaxDelay. */
+	Delay    float64
+	MaxDelay time.Duration
+
+	Duplicate float64 /* Probability every answer is returned twice */
+	WrongType float64 /* Probability answers are of the wrong type */
+	Truncate  float64 /* Probability answers are truncated */
+	NXDomain  float64 /* Probability of an NXDomain instead of answers */
+
+	/* Rand, if set, is used as the source of randomness, which is handy
+	for repeatable tests.  If unset, math/rand's functions are used. */
+	Rand *rand.Rand
+
+	l sync.Mutex
+}
+
+/* A implements Querier.A */
+func (f *FaultyQuerier) A(name string) ([]string, error) {
+	return f.Query(name, TypeA)
+}
+
+/* AAAA implements Querier.AAAA */
+func (f *FaultyQuerier) AAAA(name string) ([]string, error) {
+	return f.Query(name, TypeAAAA)
+}
+
+/* TXT implements Querier.TXT */
+func (f *FaultyQuerier) TXT(name string) ([]string, error) {
+	return f.Query(name, TypeTXT)
+}
+
+/* Query implements TypeQuerier.Query */
+func (f *FaultyQuerier) Query(name string, qtype QType) ([]string, error) {
+	/* Maybe be slow */
+	if f.chance(f.Delay) && 0 < f.MaxDelay {
+		time.Sleep(time.Duration(f.int63n(int64(f.MaxDelay))))
+	}
+
+	/* Maybe don't bother asking */
+	if f.chance(f.NXDomain) {
+		return nil, &net.DNSError{
+			Err:        "name not found",
+			Name:       name,
+			IsNotFound: true,
+		}
+	}
+
+	/* Ask the real querier */
+	qi, err := lookupQType(qtype)
+	if nil != err {
+		return nil, err
+	}
+	as, err := qi.doQuery(f.Querier, name)
+	if nil != err {
+		return as, err
+	}
+
+	/* Mess with the answers */
+	if f.chance(f.WrongType) {
+		for i := range as {
+			switch qtype {
+			case TypeA:
+				as[i] = "2600:9000:5305:ce00::1"
+			default:
+				as[i] = "3.1.2.3"
+			}
+		}
+	}
+	if f.chance(f.Truncate) {
+		for i, a := range as {
+			if 0 != len(a) {
+				as[i] = a[:f.int63n(int64(len(a)))]
+			}
+		}
+	}
+	if f.chance(f.Duplicate) {
+		as = append(as, as...)
+	}
+
+	return as, nil
+}
+
+/* chance returns true with probability p */
+func (f *FaultyQuerier) chance(p float64) bool {
+	if 0 >= p {
+		return false
+	}
+	f.l.Lock()
+	defer f.l.Unlock()
+	if nil != f.Rand {
+		return f.Rand.Float64() < p
+	}
+	return rand.Float64() < p
+}
+
+/* int63n returns a random number in [0,n) */
+func (f *FaultyQuerier) int63n(n int64) int64 {
+	f.l.Lock()
+	defer f.l.Unlock()
+	if nil != f.Rand {
+		return f.Rand.Int63n(n)
+	}
+	return rand.Int63n(n)
+}
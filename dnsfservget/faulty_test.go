@@ -0,0 +1,134 @@
+package dnsfservget
+
+/*
+ * faulty_test.go
+ * Tests for FaultyQuerier, and Getter's handling of faults
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* memQuerier serves a file from memory the same way dnsfserv would */
+type memQuerier []byte
+
+/* chunk returns n bytes starting at the offset in name, or an NXDomain. */
+func (m memQuerier) chunk(name string, n int) ([]byte, error) {
+	nxd := &net.DNSError{Err: "name not found", IsNotFound: true}
+	parts := strings.SplitN(strings.SplitN(name, ".", 2)[0], "-", 2)
+	off, err := strconv.ParseUint(parts[0], 36, 64)
+	if nil != err {
+		return nil, err
+	}
+	if off >= uint64(len(m)) {
+		return nil, nxd
+	}
+	b := make([]byte, n)
+	copy(b, m[off:])
+	return b, nil
+}
+
+func (m memQuerier) A(name string) ([]string, error) {
+	b, err := m.chunk(name, 3)
+	if nil != err {
+		return nil, err
+	}
+	return []string{net.IP(append([]byte{3}, b...)).String()}, nil
+}
+
+func (m memQuerier) AAAA(name string) ([]string, error) {
+	b, err := m.chunk(name, 8)
+	if nil != err {
+		return nil, err
+	}
+	return []string{net.IP(append([]byte{
+		0x26, 0x00, 0x90, 0x00, 0x53, 0x05, 0xce, 0x00,
+	}, b...)).String()}, nil
+}
+
+func (m memQuerier) TXT(name string) ([]string, error) {
+	b, err := m.chunk(name, MaxDecode)
+	if nil != err {
+		return nil, err
+	}
+	return []string{base64.RawStdEncoding.EncodeToString(b)}, nil
+}
+
+func TestFaultyQuerier(t *testing.T) {
+	/* A file which is a multiple of every type's payload size */
+	file := make([]byte, 960)
+	rand.New(rand.NewSource(1)).Read(file)
+
+	for _, c := range []struct {
+		name    string
+		fq      *FaultyQuerier
+		want    []byte
+		wantErr bool
+	}{{
+		name: "clean",
+		fq:   &FaultyQuerier{},
+		want: file,
+	}, {
+		name: "delay",
+		fq:   &FaultyQuerier{Delay: 0.5, MaxDelay: time.Millisecond},
+		want: file,
+	}, {
+		name: "duplicate",
+		fq:   &FaultyQuerier{Duplicate: 0.5},
+		want: file,
+	}, {
+		name: "nxdomain",
+		fq:   &FaultyQuerier{NXDomain: 1},
+		want: []byte{},
+	}, {
+		name:    "wrong_type",
+		fq:      &FaultyQuerier{WrongType: 1},
+		wantErr: true,
+	}, {
+		name:    "truncate",
+		fq:      &FaultyQuerier{Truncate: 1},
+		wantErr: true,
+	}} {
+		for _, qt := range []QType{TypeA, TypeAAAA, TypeTXT} {
+			c, qt := c, qt
+			t.Run(c.name+"/"+string(qt), func(t *testing.T) {
+				fq := c.fq
+				fq.Querier = memQuerier(file)
+				fq.Rand = rand.New(rand.NewSource(1))
+				got, err := ioutil.ReadAll((&Getter{
+					Type:    qt,
+					Name:    "payload",
+					Domain:  "example.com",
+					Querier: fq,
+				}).Get())
+				if c.wantErr {
+					if nil == err {
+						t.Fatalf("Expected error")
+					}
+					return
+				}
+				if nil != err {
+					t.Fatalf("Error: %s", err)
+				}
+				if !bytes.Equal(got, c.want) {
+					t.Fatalf(
+						"Got %d bytes, want %d",
+						len(got),
+						len(c.want),
+					)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package dnsfservget
+
+/*
+ * health.go
+ * Remember what worked on which network
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* healthRoute is the address to which we pretend to send packets to find the
+interface with the default route.  Nothing is actually sent. */
+const healthRoute = "192.0.2.1:53"
+
+/* resolvConf lists the system's DNS servers on most Unixy systems */
+const resolvConf = "/etc/resolv.conf"
+
+// HealthEntry records how well a transport and QType have worked for getting
+// files from a domain on a network.
+type HealthEntry struct {
+	// Transport describes how queries were sent, in whatever form the
+	// caller likes, e.g. a DoH URL.
+	Transport string `json:"transport"`
+	Type      QType  `json:"type"`
+
+	Successes uint      `json:"successes"`
+	Failures  uint      `json:"failures"`
+	LastOK    bool      `json:"last_ok"` /* The last use worked */
+	Last      time.Time `json:"last"`
+}
+
+// HealthDB is a small on-disk database of which transports and QTypes have
+// worked for getting files from a domain, per network, so a roaming client
+// can start with what worked the last time it was on the same network
+// instead of working it out again, e.g. with Probe.  Networks are identified
+// by NetworkFingerprint.  A HealthDB's methods may be called concurrently,
+// though not from more than one process at once.
+type HealthDB struct {
+	path string
+	l    sync.Mutex
+	nets map[string]map[string][]HealthEntry /* Network->domain->entry */
+}
+
+// OpenHealthDB reads the HealthDB in the named file.  If the file doesn't
+// exist, an empty HealthDB is returned, and the file is created when
+// something's recorded.
+func OpenHealthDB(path string) (*HealthDB, error) {
+	h := &HealthDB{
+		path: path,
+		nets: make(map[string]map[string][]HealthEntry),
+	}
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if nil != err {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &h.nets); nil != err {
+		return nil, err
+	}
+	if nil == h.nets {
+		h.nets = make(map[string]map[string][]HealthEntry)
+	}
+	return h, nil
+}
+
+// Record notes that using transport and qtype to get a file from domain on
+// the given network failed with err, or worked if err is nil, and writes the
+// database back to its file.
+func (h *HealthDB) Record(
+	network string,
+	domain string,
+	transport string,
+	qtype QType,
+	err error,
+) error {
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.record(network, domain, transport, qtype, err)
+	return h.save()
+}
+
+// RecordReport is like Record, but records each QType in a Report from Probe.
+func (h *HealthDB) RecordReport(
+	network string,
+	domain string,
+	transport string,
+	r Report,
+) error {
+	h.l.Lock()
+	defer h.l.Unlock()
+	for t, err := range r.Types {
+		h.record(network, domain, transport, t, err)
+	}
+	return h.save()
+}
+
+/* record updates the entry for transport and qtype.  h.l must be held. */
+func (h *HealthDB) record(
+	network string,
+	domain string,
+	transport string,
+	qtype QType,
+	err error,
+) {
+	domain = strings.ToLower(strings.Trim(domain, "."))
+	ds, ok := h.nets[network]
+	if !ok {
+		ds = make(map[string][]HealthEntry)
+		h.nets[network] = ds
+	}
+	es := ds[domain]
+	i := 0
+	for ; i < len(es); i++ {
+		if es[i].Transport == transport && es[i].Type == qtype {
+			break
+		}
+	}
+	if len(es) == i {
+		es = append(es, HealthEntry{Transport: transport, Type: qtype})
+	}
+	if nil == err {
+		es[i].Successes++
+	} else {
+		es[i].Failures++
+	}
+	es[i].LastOK = nil == err
+	es[i].Last = time.Now()
+	ds[domain] = es
+}
+
+/* save writes h to its file.  h.l must be held. */
+func (h *HealthDB) save() error {
+	b, err := json.MarshalIndent(h.nets, "", "\t")
+	if nil != err {
+		return err
+	}
+	/* Write to a temporary file first so we never leave half a file */
+	f, err := ioutil.TempFile(filepath.Dir(h.path), ".tmp-")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); nil != err {
+		return err
+	}
+	return os.Rename(f.Name(), h.path)
+}
+
+// Entries returns what's known about getting files from domain on network,
+// best first.  Entries which worked the last time they were used come first,
+// then those whose QType carries more of a file per query, then those used
+// most recently.
+func (h *HealthDB) Entries(network, domain string) []HealthEntry {
+	h.l.Lock()
+	es := append([]HealthEntry(nil), h.nets[network][strings.ToLower(
+		strings.Trim(domain, "."),
+	)]...)
+	h.l.Unlock()
+
+	size := func(t QType) uint {
+		n, _ := t.PayloadSize()
+		return n
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		a, b := es[i], es[j]
+		if a.LastOK != b.LastOK {
+			return a.LastOK
+		}
+		if sa, sb := size(a.Type), size(b.Type); sa != sb {
+			return sa > sb
+		}
+		return a.Last.After(b.Last)
+	})
+	return es
+}
+
+// Best returns the best entry from Entries, if there is one and it worked
+// the last time it was used.
+func (h *HealthDB) Best(network, domain string) (HealthEntry, bool) {
+	es := h.Entries(network, domain)
+	if 0 == len(es) || !es[0].LastOK {
+		return HealthEntry{}, false
+	}
+	return es[0], true
+}
+
+// NetworkFingerprint returns a short string identifying the network to which
+// this machine is connected, made from the address and network of the
+// interface with the default route and, on Unixy systems, the DNS servers in
+// /etc/resolv.conf.  It's meant to change when a laptop moves between
+// networks, but not otherwise.
+func NetworkFingerprint() string {
+	var parts []string
+
+	/* Work out which interface gets packets to the outside world */
+	if c, err := net.Dial("udp", healthRoute); nil == err {
+		ip := c.LocalAddr().(*net.UDPAddr).IP
+		c.Close()
+		parts = append(parts, "route "+interfaceNetwork(ip))
+	}
+
+	/* Note the system's resolvers */
+	if f, err := os.Open(resolvConf); nil == err {
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if fs := strings.Fields(s.Text()); 2 <= len(fs) &&
+				"nameserver" == fs[0] {
+				parts = append(parts, "dns "+fs[1])
+			}
+		}
+		f.Close()
+	}
+
+	sort.Strings(parts)
+	h := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(h[:8])
+}
+
+/* interfaceNetwork returns the name and network of the interface with the
+address ip, or just ip if there isn't one. */
+func interfaceNetwork(ip net.IP) string {
+	ifs, err := net.Interfaces()
+	if nil != err {
+		return ip.String()
+	}
+	for _, ifc := range ifs {
+		as, err := ifc.Addrs()
+		if nil != err {
+			continue
+		}
+		for _, a := range as {
+			if in, ok := a.(*net.IPNet); ok && in.IP.Equal(ip) {
+				return ifc.Name + " " + (&net.IPNet{
+					IP:   ip.Mask(in.Mask),
+					Mask: in.Mask,
+				}).String()
+			}
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,117 @@
+package dnsfservget_test
+
+/*
+ * health_test.go
+ * Tests for the resolver health database
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+func TestHealthDB(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "health")
+	h, err := dnsfservget.OpenHealthDB(fn)
+	if nil != err {
+		t.Fatalf("Opening new database: %s", err)
+	}
+	if _, ok := h.Best("net1", "example.com"); ok {
+		t.Errorf("Empty database has a best entry")
+	}
+
+	/* Bigger types which work should win */
+	for _, c := range []struct {
+		transport string
+		qtype     dnsfservget.QType
+		err       error
+	}{
+		{"system", dnsfservget.TypeA, nil},
+		{"system", dnsfservget.TypeTXT, nil},
+		{"doh https://x", dnsfservget.TypeNULL, errors.New("nope")},
+		{"system", dnsfservget.TypeTXT, errors.New("once")},
+		{"system", dnsfservget.TypeTXT, nil},
+	} {
+		if err := h.Record(
+			"net1",
+			"example.com.",
+			c.transport,
+			c.qtype,
+			c.err,
+		); nil != err {
+			t.Fatalf("Recording %+v: %s", c, err)
+		}
+	}
+	if err := h.Record(
+		"net2",
+		"example.com",
+		"server 127.0.0.1:53",
+		dnsfservget.TypeA,
+		nil,
+	); nil != err {
+		t.Fatalf("Recording on second network: %s", err)
+	}
+
+	/* It should all survive a trip to disk */
+	if h, err = dnsfservget.OpenHealthDB(fn); nil != err {
+		t.Fatalf("Reopening database: %s", err)
+	}
+	es := h.Entries("net1", "EXAMPLE.com")
+	if 3 != len(es) {
+		t.Fatalf("Got %d entries, want 3: %+v", len(es), es)
+	}
+	for i, want := range []dnsfservget.QType{
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeA,
+		dnsfservget.TypeNULL,
+	} {
+		if want != es[i].Type {
+			t.Errorf(
+				"Entry %d: got %s, want %s",
+				i,
+				es[i].Type,
+				want,
+			)
+		}
+	}
+	if 2 != es[0].Successes || 1 != es[0].Failures {
+		t.Errorf(
+			"TXT: got %d successes and %d failures, want 2 and 1",
+			es[0].Successes,
+			es[0].Failures,
+		)
+	}
+	if he, ok := h.Best("net2", "example.com"); !ok ||
+		"server 127.0.0.1:53" != he.Transport {
+		t.Errorf("Second network: got %+v (%t)", he, ok)
+	}
+
+	/* Probe's reports are recorded too */
+	if err := h.RecordReport(
+		"net3",
+		"example.com",
+		"system",
+		dnsfservget.Report{Types: map[dnsfservget.QType]error{
+			dnsfservget.TypeAAAA:   nil,
+			dnsfservget.TypeBigTXT: errors.New("too big"),
+		}},
+	); nil != err {
+		t.Fatalf("Recording report: %s", err)
+	}
+	if he, ok := h.Best("net3", "example.com"); !ok ||
+		dnsfservget.TypeAAAA != he.Type {
+		t.Errorf("Report: got %+v (%t)", he, ok)
+	}
+
+	/* The same network should look the same */
+	if a, b := dnsfservget.NetworkFingerprint(),
+		dnsfservget.NetworkFingerprint(); a != b || "" == a {
+		t.Errorf("Network fingerprints %q and %q", a, b)
+	}
+}
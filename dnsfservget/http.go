@@ -0,0 +1,165 @@
+package dnsfservget
+
+/*
+ * http.go
+ * Serve files retrieved via DNS over local HTTP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// HTTPHandler returns an http.Handler which serves the file described by g
+// over HTTP, for tools which expect to download files over HTTP.  Every
+// request is served by a new Getter configured like g, which itself is never
+// used to get the file.  HEAD requests and requests for a single range are
+// answered using a probe (see Getter.Stat) and Getter.GetRange, so only the
+// chunks needed are retrieved.  Encrypted files are always served whole.
+// Striped files aren't supported.
+func HTTPHandler(g *Getter) http.Handler {
+	return httpHandler{g: g}
+}
+
+// ServeHTTP serves the file described by g over HTTP on addr, as with
+// HTTPHandler.  It only returns on error.
+func ServeHTTP(addr string, g *Getter) error {
+	return http.ListenAndServe(addr, HTTPHandler(g))
+}
+
+/* httpHandler serves a file over HTTP */
+type httpHandler struct {
+	g *Getter
+}
+
+/* ServeHTTP implements http.Handler. */
+func (h httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if http.MethodGet != r.Method && http.MethodHead != r.Method {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	g := h.g.config()
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	/* Encrypted files are decrypted on the fly, so we can't know how big
+	they are until we're done */
+	if "" != g.Passphrase {
+		if http.MethodHead == r.Method {
+			return
+		}
+		rc := g.Get()
+		defer rc.Close()
+		io.Copy(w, rc)
+		return
+	}
+
+	/* Work out what we'll be serving */
+	st, err := g.Stat()
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !st.Exists {
+		http.NotFound(w, r)
+		return
+	}
+	start, length, ok := parseHTTPRange(r.Header.Get("Range"), st.Size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", st.Size))
+		http.Error(
+			w,
+			"requested range not satisfiable",
+			http.StatusRequestedRangeNotSatisfiable,
+		)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", st.ModTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.FormatUint(length, 10))
+	status := http.StatusOK
+	if length != st.Size {
+		w.Header().Set("Content-Range", fmt.Sprintf(
+			"bytes %d-%d/%d",
+			start,
+			start+length-1,
+			st.Size,
+		))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if http.MethodHead == r.Method || 0 == length {
+		return
+	}
+
+	/* Send it off */
+	rc := g.GetRange(uint(start), uint(length))
+	defer rc.Close()
+	io.Copy(w, rc)
+}
+
+/* parseHTTPRange parses the value of a Range header for a file of the given
+size and returns the start and length of the requested range.  If there's no
+header or more than one range, the whole file is returned.  If the range
+can't be satisfied, parseHTTPRange returns false. */
+func parseHTTPRange(v string, size uint64) (start, length uint64, ok bool) {
+	/* Whole file */
+	spec := strings.TrimPrefix(v, "bytes=")
+	if "" == v || spec == v || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	parts := strings.SplitN(strings.TrimSpace(spec), "-", 2)
+	if 2 != len(parts) {
+		return 0, 0, false
+	}
+
+	/* Suffix, e.g. bytes=-500 */
+	if "" == parts[0] {
+		n, err := strconv.ParseUint(parts[1], 10, 64)
+		if nil != err || 0 == n || 0 == size {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	/* Start and maybe end */
+	start, err := strconv.ParseUint(parts[0], 10, 64)
+	if nil != err || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if "" != parts[1] {
+		e, err := strconv.ParseUint(parts[1], 10, 64)
+		if nil != err || e < start {
+			return 0, 0, false
+		}
+		if e < end {
+			end = e
+		}
+	}
+	return start, end - start + 1, true
+}
+
+/* config returns a new Getter with g's configuration, for getting the file
+again.  Every exported field is copied, by reflection so as not to copy g's
+locks. */
+func (g *Getter) config() *Getter {
+	c := new(Getter)
+	cv, gv := reflect.ValueOf(c).Elem(), reflect.ValueOf(g).Elem()
+	for i := 0; i < gv.NumField(); i++ {
+		if gv.Type().Field(i).IsExported() {
+			cv.Field(i).Set(gv.Field(i))
+		}
+	}
+	return c
+}
@@ -0,0 +1,160 @@
+package dnsfservget_test
+
+/*
+ * http_test.go
+ * Tests for serving files over local HTTP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := strings.Repeat("kittens and ", 30) + "puppies"
+	s.SetFile("payload", []byte(file))
+	hs := httptest.NewServer(dnsfservget.HTTPHandler(&dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: q,
+	}))
+	defer hs.Close()
+
+	for _, c := range []struct {
+		method string
+		rng    string
+		status int
+		want   string
+	}{
+		{http.MethodGet, "", http.StatusOK, file},
+		{http.MethodHead, "", http.StatusOK, ""},
+		{http.MethodGet, "bytes=0-6", http.StatusPartialContent, "kittens"},
+		{http.MethodGet, "bytes=12-18", http.StatusPartialContent, "kittens"},
+		{http.MethodGet, "bytes=-7", http.StatusPartialContent, "puppies"},
+		{
+			http.MethodGet,
+			"bytes=360-",
+			http.StatusPartialContent,
+			file[360:],
+		},
+		{http.MethodGet, "bytes=0-0,5-6", http.StatusOK, file},
+		{
+			http.MethodGet,
+			"bytes=1000-",
+			http.StatusRequestedRangeNotSatisfiable,
+			"",
+		},
+		{http.MethodPost, "", http.StatusMethodNotAllowed, ""},
+	} {
+		req, err := http.NewRequest(c.method, hs.URL, nil)
+		if nil != err {
+			t.Fatalf("NewRequest: %s", err)
+		}
+		if "" != c.rng {
+			req.Header.Set("Range", c.rng)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Errorf("%s %q: %s", c.method, c.rng, err)
+			continue
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if nil != err {
+			t.Errorf("%s %q: reading body: %s", c.method, c.rng, err)
+			continue
+		}
+		if c.status != res.StatusCode {
+			t.Errorf(
+				"%s %q: got status %d, want %d",
+				c.method,
+				c.rng,
+				res.StatusCode,
+				c.status,
+			)
+			continue
+		}
+		if http.StatusOK/100 == res.StatusCode/100 && c.want != string(b) {
+			t.Errorf("%s %q: got %q, want %q", c.method, c.rng, b, c.want)
+		}
+	}
+
+	/* Nonexistent files are 404s */
+	ns := httptest.NewServer(dnsfservget.HTTPHandler(&dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "nonesuch",
+		Domain:  "example.com",
+		Querier: q,
+	}))
+	defer ns.Close()
+	res, err := http.Get(ns.URL)
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	res.Body.Close()
+	if http.StatusNotFound != res.StatusCode {
+		t.Errorf("Nonexistent file got status %d", res.StatusCode)
+	}
+}
+
+/* keyQuerier counts queries for session keys */
+type keyQuerier struct {
+	dnsfservget.Querier
+	n atomic.Int64
+}
+
+func (q *keyQuerier) TXT(name string) ([]string, error) {
+	if strings.HasPrefix(name, dnsfservget.KeyLabel+"-") {
+		q.n.Add(1)
+	}
+	return q.Querier.TXT(name)
+}
+
+func TestHTTPHandlerHandshake(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := strings.Repeat("kittens and ", 30) + "puppies"
+	s.SetFile("payload", []byte(file))
+	kq := &keyQuerier{Querier: q}
+	hs := httptest.NewServer(dnsfservget.HTTPHandler(&dnsfservget.Getter{
+		Type:      dnsfservget.TypeTXT,
+		Name:      "payload",
+		Domain:    "example.com",
+		Querier:   kq,
+		UseMeta:   true,
+		Handshake: true,
+	}))
+	defer hs.Close()
+
+	/* Every request should get the file with its own session */
+	for i := 1; i <= 2; i++ {
+		res, err := http.Get(hs.URL)
+		if nil != err {
+			t.Fatalf("Request %d: %s", i, err)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if nil != err {
+			t.Fatalf("Request %d: reading body: %s", i, err)
+		}
+		if file != string(b) {
+			t.Errorf("Request %d: got %q", i, b)
+		}
+		if n := kq.n.Load(); int64(i) != n {
+			t.Errorf("Request %d: %d handshakes", i, n)
+		}
+	}
+}
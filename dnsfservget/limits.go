@@ -0,0 +1,69 @@
+package dnsfservget
+
+/*
+ * limits.go
+ * Hard limits on transfers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrorLimitExceeded is returned when a transfer started with Getter.Get
+// exceeds one of the Getter's MaxTotalBytes, MaxDuration, or MaxQueries.
+type ErrorLimitExceeded struct {
+	Limit string      /* Name of the exceeded Getter field */
+	Max   interface{} /* The field's value */
+}
+
+// Error implements the error interface.
+func (e ErrorLimitExceeded) Error() string {
+	return fmt.Sprintf("transfer exceeded %s (%v)", e.Limit, e.Max)
+}
+
+/* startLimits notes the start of a transfer and, if g.MaxDuration is set,
+starts a timer which fails the transfer when the time is up even if a query
+is hung.  The returned function should be called when the transfer is
+finished. */
+func (g *Getter) startLimits(pw chunkWriter) func() {
+	g.started = time.Now()
+	g.nQueries = 0
+	if 0 >= g.MaxDuration {
+		return func() {}
+	}
+	t := time.AfterFunc(g.MaxDuration, func() {
+		err := ErrorLimitExceeded{"MaxDuration", g.MaxDuration}
+		g.changeState(func(cur State, _ string) bool {
+			return StateDone != cur && StateFailed != cur
+		}, StateChange{To: StateFailed, Err: err})
+		pw.CloseWithError(err)
+	})
+	return func() { t.Stop() }
+}
+
+/* countQuery checks whether another query may be made without exceeding
+g.MaxQueries or g.MaxDuration and, if so, counts it. */
+func (g *Getter) countQuery() error {
+	if 0 < g.MaxDuration && time.Since(g.started) > g.MaxDuration {
+		return ErrorLimitExceeded{"MaxDuration", g.MaxDuration}
+	}
+	if 0 != g.MaxQueries && g.nQueries >= g.MaxQueries {
+		return ErrorLimitExceeded{"MaxQueries", g.MaxQueries}
+	}
+	g.nQueries++
+	return nil
+}
+
+/* checkBytes checks whether n more bytes may be returned after written bytes
+have been returned without exceeding g.MaxTotalBytes. */
+func (g *Getter) checkBytes(written uint, n int) error {
+	if 0 != g.MaxTotalBytes &&
+		uint64(written)+uint64(n) > g.MaxTotalBytes {
+		return ErrorLimitExceeded{"MaxTotalBytes", g.MaxTotalBytes}
+	}
+	return nil
+}
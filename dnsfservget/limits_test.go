@@ -0,0 +1,88 @@
+package dnsfservget_test
+
+/*
+ * limits_test.go
+ * Tests for hard limits on transfers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* hungQuerier never answers */
+type hungQuerier chan struct{}
+
+func (h hungQuerier) A(string) ([]string, error)    { <-h; return nil, nil }
+func (h hungQuerier) AAAA(string) ([]string, error) { <-h; return nil, nil }
+func (h hungQuerier) TXT(string) ([]string, error)  { <-h; return nil, nil }
+
+func TestGetterLimits(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", make([]byte, 100))
+	hq := make(hungQuerier)
+	defer close(hq)
+
+	for _, c := range []struct {
+		limit string
+		g     *dnsfservget.Getter
+	}{{
+		limit: "MaxQueries",
+		g:     &dnsfservget.Getter{Querier: q, MaxQueries: 2},
+	}, {
+		limit: "MaxQueries",
+		g: &dnsfservget.Getter{
+			Querier:    q,
+			MaxQueries: 1,
+			UseMeta:    true,
+		},
+	}, {
+		limit: "MaxTotalBytes",
+		g:     &dnsfservget.Getter{Querier: q, MaxTotalBytes: 10},
+	}, {
+		limit: "MaxDuration",
+		g: &dnsfservget.Getter{
+			Querier:     hq,
+			MaxDuration: 10 * time.Millisecond,
+		},
+	}} {
+		c.g.Type = dnsfservget.TypeA
+		c.g.Name = "payload"
+		c.g.Domain = "example.com"
+		_, err := ioutil.ReadAll(c.g.Get())
+		var le dnsfservget.ErrorLimitExceeded
+		if !errors.As(err, &le) {
+			t.Errorf("%s: got error %v", c.limit, err)
+			continue
+		}
+		if c.limit != le.Limit {
+			t.Errorf("%s: exceeded %s instead", c.limit, le.Limit)
+		}
+	}
+
+	/* Limits which aren't exceeded shouldn't matter */
+	g := dnsfservget.Getter{
+		Type:          dnsfservget.TypeAAAA,
+		Name:          "payload",
+		Domain:        "example.com",
+		Querier:       q,
+		UseMeta:       true,
+		MaxTotalBytes: 100,
+		MaxQueries:    14,
+		MaxDuration:   time.Minute,
+	}
+	if b, err := ioutil.ReadAll(g.Get()); nil != err {
+		t.Errorf("Within limits: %s", err)
+	} else if 100 != len(b) {
+		t.Errorf("Within limits: got %d bytes", len(b))
+	}
+}
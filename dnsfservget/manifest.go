@@ -0,0 +1,112 @@
+package dnsfservget
+
+/*
+ * manifest.go
+ * Describe what a transfer actually got
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"time"
+)
+
+// Manifest describes a transfer started with Get which finished without
+// error.  It's written as JSON to the Getter's Manifest.  Size and SHA256
+// describe the bytes returned by Get, after DecodeHook but before decryption
+// with Passphrase.
+type Manifest struct {
+	Name     string        `json:"name"`
+	Domain   string        `json:"domain"`
+	Size     uint64        `json:"size"`
+	SHA256   string        `json:"sha256"` /* Hex-encoded */
+	Chunks   uint          `json:"chunks"` /* Chunks decoded */
+	Queries  uint          `json:"queries"`
+	Retries  uint          `json:"retries"`
+	Cached   bool          `json:"cached"` /* From the Getter's Cache */
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"` /* Nanoseconds */
+
+	/* Transports holds the ways queries were made, each of the form
+	querier/type, e.g. udp/TXT, sorted */
+	Transports []string `json:"transports"`
+}
+
+/* manifestState is what's tracked during a transfer for the manifest */
+type manifestState struct {
+	h          hash.Hash
+	chunks     uint
+	retries    uint
+	cached     bool
+	transports map[string]bool
+}
+
+/* resetManifest starts tracking a new transfer for the manifest. */
+func (g *Getter) resetManifest() {
+	g.ms = manifestState{
+		h:          sha256.New(),
+		transports: make(map[string]bool),
+	}
+}
+
+/* noteTransport notes that a query of type qt was made. */
+func (g *Getter) noteTransport(qt QType) {
+	if nil == g.ms.transports {
+		return
+	}
+	g.ms.transports[querierName(g.Querier)+"/"+string(qt)] = true
+}
+
+/* writeManifest writes the manifest for a transfer which returned written
+bytes to g.Manifest, if it's set. */
+func (g *Getter) writeManifest(written uint) error {
+	if nil == g.Manifest {
+		return nil
+	}
+	m := Manifest{
+		Name:       g.Name,
+		Domain:     g.Domain,
+		Size:       uint64(written),
+		Chunks:     g.ms.chunks,
+		Queries:    g.nQueries,
+		Retries:    g.ms.retries,
+		Cached:     g.ms.cached,
+		Started:    g.started,
+		Duration:   time.Since(g.started),
+		Transports: make([]string, 0, len(g.ms.transports)),
+	}
+	if nil != g.ms.h {
+		m.SHA256 = hex.EncodeToString(g.ms.h.Sum(nil))
+	}
+	for t := range g.ms.transports {
+		m.Transports = append(m.Transports, t)
+	}
+	sort.Strings(m.Transports)
+	if err := json.NewEncoder(g.Manifest).Encode(m); nil != err {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+/* querierName returns a short name for the kind of Querier q is. */
+func querierName(q Querier) string {
+	switch q.(type) {
+	case defaultQuerier:
+		return "system"
+	case udpQuerier:
+		return "udp"
+	case dohQuerier:
+		return "doh"
+	case *socksQuerier:
+		return "socks5"
+	default:
+		return fmt.Sprintf("%T", q)
+	}
+}
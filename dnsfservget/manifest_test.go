@@ -0,0 +1,93 @@
+package dnsfservget_test
+
+/*
+ * manifest_test.go
+ * Tests for transfer manifests
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterManifest(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := bytes.Repeat([]byte("kittens"), 100)
+	s.SetFile("payload", file)
+
+	var mb bytes.Buffer
+	g := dnsfservget.Getter{
+		Type:     dnsfservget.TypeTXT,
+		Name:     "payload",
+		Domain:   "example.com",
+		Querier:  q,
+		UseMeta:  true,
+		Manifest: &mb,
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if !bytes.Equal(file, b) {
+		t.Fatalf("Got %d bytes which don't match", len(b))
+	}
+
+	var m dnsfservget.Manifest
+	if err := json.Unmarshal(mb.Bytes(), &m); nil != err {
+		t.Fatalf("Unmarshalling manifest %q: %s", mb.String(), err)
+	}
+	h := sha256.Sum256(file)
+	if "payload" != m.Name || "example.com" != m.Domain {
+		t.Errorf("Wrong file %s in %s", m.Name, m.Domain)
+	}
+	if uint64(len(file)) != m.Size {
+		t.Errorf("Size: got %d, want %d", m.Size, len(file))
+	}
+	if want := hex.EncodeToString(h[:]); want != m.SHA256 {
+		t.Errorf("SHA256: got %s, want %s", m.SHA256, want)
+	}
+	if 0 == m.Chunks || m.Chunks+1 != m.Queries || 0 != m.Retries {
+		t.Errorf(
+			"Odd counts: %d chunks, %d queries, %d retries",
+			m.Chunks,
+			m.Queries,
+			m.Retries,
+		)
+	}
+	if m.Cached || 0 >= m.Duration || m.Started.IsZero() {
+		t.Errorf("Odd manifest: %+v", m)
+	}
+	if 1 != len(m.Transports) ||
+		!strings.HasSuffix(m.Transports[0], "/TXT") {
+		t.Errorf("Transports: %q", m.Transports)
+	}
+
+	/* Failed transfers don't get a manifest */
+	mb.Reset()
+	g = dnsfservget.Getter{
+		Type:     dnsfservget.TypeTXT,
+		Name:     "payload",
+		Domain:   "example.com",
+		Querier:  q,
+		Manifest: &mb,
+	}
+	s.Close()
+	if _, err := ioutil.ReadAll(g.Get()); nil == err {
+		t.Errorf("No error without a server")
+	}
+	if 0 != mb.Len() {
+		t.Errorf("Got manifest for failed transfer: %s", mb.String())
+	}
+}
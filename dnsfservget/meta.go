@@ -0,0 +1,103 @@
+package dnsfservget
+
+/*
+ * meta.go
+ * Get a file's metadata
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MetaLabel replaces the offset in queries for a file's metadata.
+const MetaLabel = "_meta"
+
+// ErrHashMismatch is returned when a file retrieved with Getter.UseMeta set
+// doesn't have the hash in its metadata.
+var ErrHashMismatch = errors.New("file hash mismatch")
+
+// FileMeta is a file's metadata, as served in a TXT record by dnsfserv.
+type FileMeta struct {
+	Size       uint64            /* File size in bytes */
+	SHA256     [sha256.Size]byte /* SHA256 hash of the whole file */
+	Generation int64             /* Changes when the file changes */
+}
+
+// MetaName returns the name to query for the metadata of g's file.
+func (g *Getter) MetaName() string {
+	return AuthName(
+		g.Key,
+		fmt.Sprintf(
+			"%s-%s.%s",
+			MetaLabel,
+			g.Name,
+			ttlHintDomain(g.ControlTTLHint, g.Domain),
+		),
+	)
+}
+
+// Meta gets the metadata for g's file with a TXT query.  If g.Querier is nil,
+// DefaultQuerier() is used.  If g.ControlCache is set, a cached answer may be
+// used instead.
+func (g *Getter) Meta() (FileMeta, error) {
+	q := g.Querier
+	if nil == q {
+		q = DefaultQuerier()
+	}
+	n := g.MetaName()
+	as, err := g.controlTXT(q, n)
+	if nil != err {
+		return FileMeta{}, fmt.Errorf("querying for %q: %w", n, err)
+	}
+	if 0 == len(as) {
+		return FileMeta{}, fmt.Errorf("empty response to query for %q", n)
+	}
+	return ParseMeta(as[0])
+}
+
+// ParseMeta parses a file's metadata from a TXT record returned by dnsfserv.
+func ParseMeta(txt string) (FileMeta, error) {
+	var (
+		m                FileMeta
+		gotSize, gotHash bool
+		err              error
+	)
+	for _, f := range strings.Fields(txt) {
+		parts := strings.SplitN(f, "=", 2)
+		if 2 != len(parts) {
+			return FileMeta{}, fmt.Errorf("invalid field %q", f)
+		}
+		switch parts[0] {
+		case "size":
+			m.Size, err = strconv.ParseUint(parts[1], 10, 64)
+			gotSize = true
+		case "sha256":
+			var b []byte
+			b, err = hex.DecodeString(parts[1])
+			if nil == err && len(m.SHA256) != len(b) {
+				err = fmt.Errorf("hash length %d", len(b))
+			}
+			copy(m.SHA256[:], b)
+			gotHash = true
+		case "gen":
+			m.Generation, err = strconv.ParseInt(parts[1], 10, 64)
+		default: /* Ignore things we don't know about */
+			continue
+		}
+		if nil != err {
+			return FileMeta{}, fmt.Errorf("parsing %s: %w", parts[0], err)
+		}
+	}
+	if !gotSize || !gotHash {
+		return FileMeta{}, errors.New("missing size or hash")
+	}
+	return m, nil
+}
@@ -0,0 +1,53 @@
+package dnsfservget
+
+/*
+ * nodata.go
+ * What to do about empty responses
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoData is wrapped by the error returned when a query for a chunk of a
+// file gets a response with no records and the Getter's NoData policy doesn't
+// allow for it.
+var ErrNoData = errors.New("empty response")
+
+// NoDataPolicy is what a Getter does when a query for a chunk of a file gets
+// a response with no records (NODATA), as dnsfserv sends for record types
+// it's not serving.
+type NoDataPolicy int
+
+// NoData policies.  FailOnNoData is the default.
+const (
+	FailOnNoData  NoDataPolicy = iota /* Fail the transfer */
+	RetryOnNoData                     /* Retry the query */
+	EOFOnNoData                       /* Treat NODATA as the end of the file */
+)
+
+// String implements fmt.Stringer.
+func (p NoDataPolicy) String() string {
+	switch p {
+	case FailOnNoData:
+		return "FailOnNoData"
+	case RetryOnNoData:
+		return "RetryOnNoData"
+	case EOFOnNoData:
+		return "EOFOnNoData"
+	default:
+		return fmt.Sprintf("NoDataPolicy(%d)", int(p))
+	}
+}
+
+// NoDataTries is the number of times a query which gets a NODATA response is
+// made by a Getter with RetryOnNoData before the transfer fails.
+const NoDataTries = 5
+
+// NoDataWait is how long a Getter with RetryOnNoData waits between tries.
+var NoDataWait = time.Second
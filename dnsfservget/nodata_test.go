@@ -0,0 +1,79 @@
+package dnsfservget_test
+
+/*
+ * nodata_test.go
+ * Tests for handling empty responses
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* noDataQuerier returns empty answers to the first n A queries */
+type noDataQuerier struct {
+	dnsfservget.Querier
+	n int64
+}
+
+func (q *noDataQuerier) A(name string) ([]string, error) {
+	if 0 <= atomic.AddInt64(&q.n, -1) {
+		return nil, nil
+	}
+	return q.Querier.A(name)
+}
+
+func TestGetterNoData(t *testing.T) {
+	defer func(d time.Duration) { dnsfservget.NoDataWait = d }(
+		dnsfservget.NoDataWait,
+	)
+	dnsfservget.NoDataWait = time.Millisecond
+
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens"))
+
+	for _, c := range []struct {
+		policy dnsfservget.NoDataPolicy
+		empty  int64
+		want   string
+		err    error
+	}{
+		{dnsfservget.FailOnNoData, 1, "", dnsfservget.ErrNoData},
+		{dnsfservget.EOFOnNoData, 1, "", nil},
+		{dnsfservget.RetryOnNoData, 2, "kittens\x00\x00", nil},
+		{
+			dnsfservget.RetryOnNoData,
+			dnsfservget.NoDataTries,
+			"",
+			dnsfservget.ErrNoData,
+		},
+	} {
+		g := dnsfservget.Getter{
+			Type:    dnsfservget.TypeA,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: &noDataQuerier{Querier: q, n: c.empty},
+			NoData:  c.policy,
+		}
+		b, err := ioutil.ReadAll(g.Get())
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s/%d: got error %v, want %v",
+				c.policy, c.empty, err, c.err)
+			continue
+		}
+		if nil == c.err && c.want != string(b) {
+			t.Errorf("%s/%d: got %q, want %q",
+				c.policy, c.empty, b, c.want)
+		}
+	}
+}
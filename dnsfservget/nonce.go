@@ -0,0 +1,33 @@
+package dnsfservget
+
+/*
+ * nonce.go
+ * Make every query for a chunk different
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const (
+	// NonceLabel starts the label, between the first label of a query and
+	// the domain (or sequence or session label), holding a random nonce,
+	// for dnsfserv started with -nonce-cache.
+	NonceLabel = "_n"
+
+	// NonceLen is the number of random bytes in a nonce.
+	NonceLen = 8
+)
+
+/* newNonce returns a new random nonce, encoded for use in a label. */
+func newNonce() (string, error) {
+	b := make([]byte, NonceLen)
+	if _, err := rand.Read(b); nil != err {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	return authEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package dnsfservget_test
+
+/*
+ * nonce_test.go
+ * Tests for query nonces
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* namingQuerier remembers the names for which it's asked for A records. */
+type namingQuerier struct {
+	dnsfservget.Querier
+	l     sync.Mutex
+	names []string
+}
+
+func (q *namingQuerier) A(name string) ([]string, error) {
+	q.l.Lock()
+	q.names = append(q.names, name)
+	q.l.Unlock()
+	return q.Querier.A(name)
+}
+
+func TestGetterNonce(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens and puppies"))
+
+	nq := &namingQuerier{Querier: q}
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: nq,
+		UseMeta: true,
+		Nonce:   true,
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if "kittens and puppies" != string(b) {
+		t.Errorf("Got %q", b)
+	}
+
+	/* Every name should have its own nonce */
+	seen := make(map[string]bool)
+	for _, n := range nq.names {
+		ls := strings.Split(n, ".")
+		if 2 > len(ls) ||
+			!strings.HasPrefix(ls[1], dnsfservget.NonceLabel+"-") {
+			t.Errorf("No nonce in %q", n)
+			continue
+		}
+		if seen[ls[1]] {
+			t.Errorf("Repeated nonce in %q", n)
+		}
+		seen[ls[1]] = true
+	}
+}
@@ -0,0 +1,147 @@
+package dnsfservget
+
+/*
+ * pace.go
+ * Adaptively pace queries
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"sync"
+	"time"
+)
+
+// Default Pacer parameters.
+const (
+	DefaultPacerStep     = 10 * time.Millisecond
+	DefaultPacerMaxDelay = 10 * time.Second
+	DefaultPacerRetries  = 5
+)
+
+/* pacerSlowFactor is how many times slower than the fastest query so far a
+query must be to be taken as a sign of congestion or rate-limiting */
+const pacerSlowFactor = 4
+
+// Pacer adaptively paces a Getter's queries for networks of which little is
+// known, in place of fixed delays.  It measures each query's round-trip time
+// and whether it failed and adjusts the delay between queries AIMD-style: the
+// delay shrinks by Step after every query which succeeds reasonably quickly
+// and doubles after a query which fails or takes much longer than the fastest
+// so far, as happens when a resolver starts rate-limiting.  Failed queries are
+// retried, after backing off, up to Retries times before the transfer fails.
+// Zero-valued fields are replaced by defaults.  A Pacer may be shared by
+// several Getters to pace them together.
+type Pacer struct {
+	MinDelay time.Duration /* Smallest delay between queries */
+	MaxDelay time.Duration /* Largest delay, DefaultPacerMaxDelay if 0 */
+	Step     time.Duration /* Additive decrease, DefaultPacerStep if 0 */
+	Retries  uint          /* Retries per query, DefaultPacerRetries if 0 */
+
+	l      sync.Mutex
+	delay  time.Duration /* Current delay */
+	minRTT time.Duration /* Fastest query so far */
+	srtt   time.Duration /* Smoothed round-trip time */
+	last   time.Time     /* When the last query was started */
+	losses uint
+}
+
+// PacerStats describes what a Pacer has seen so far.
+type PacerStats struct {
+	Delay  time.Duration /* Current delay between queries */
+	MinRTT time.Duration /* Fastest round-trip time */
+	SRTT   time.Duration /* Smoothed round-trip time */
+	Losses uint          /* Failed queries */
+}
+
+// Stats returns the Pacer's current delay and what it's seen so far.
+func (p *Pacer) Stats() PacerStats {
+	p.l.Lock()
+	defer p.l.Unlock()
+	return PacerStats{
+		Delay:  p.delay,
+		MinRTT: p.minRTT,
+		SRTT:   p.srtt,
+		Losses: p.losses,
+	}
+}
+
+/* wait waits until it's been the current delay since the last query
+started, using sleep to wait, and returns sleep's error. */
+func (p *Pacer) wait(sleep func(time.Duration) error) error {
+	p.l.Lock()
+	if p.delay < p.MinDelay {
+		p.delay = p.MinDelay
+	}
+	d := time.Until(p.last.Add(p.delay))
+	if 0 > d {
+		d = 0
+	}
+	p.last = time.Now().Add(d)
+	p.l.Unlock()
+	return sleep(d)
+}
+
+/* succeeded notes a query which succeeded after rtt. */
+func (p *Pacer) succeeded(rtt time.Duration) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	/* Update the round-trip times */
+	if 0 == p.minRTT || rtt < p.minRTT {
+		p.minRTT = rtt
+	}
+	if 0 == p.srtt {
+		p.srtt = rtt
+	} else {
+		p.srtt = (7*p.srtt + rtt) / 8
+	}
+
+	/* Much slower than normal means something's getting upset */
+	if rtt > pacerSlowFactor*p.minRTT && rtt > p.step() {
+		p.backOff()
+		return
+	}
+
+	/* Otherwise, we can go a bit faster */
+	if p.delay -= p.step(); p.delay < p.MinDelay {
+		p.delay = p.MinDelay
+	}
+}
+
+/* failed notes that the try'th try of a query failed and returns whether it
+should be tried again. */
+func (p *Pacer) failed(try uint) bool {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.losses++
+	p.backOff()
+	retries := p.Retries
+	if 0 == retries {
+		retries = DefaultPacerRetries
+	}
+	return try <= retries
+}
+
+/* backOff doubles the delay, within limits.  p.l must be held. */
+func (p *Pacer) backOff() {
+	max := p.MaxDelay
+	if 0 == max {
+		max = DefaultPacerMaxDelay
+	}
+	if p.delay *= 2; p.delay < p.step() {
+		p.delay = p.step()
+	}
+	if p.delay > max {
+		p.delay = max
+	}
+}
+
+/* step returns p.Step or, if it's not set, DefaultPacerStep. */
+func (p *Pacer) step() time.Duration {
+	if 0 == p.Step {
+		return DefaultPacerStep
+	}
+	return p.Step
+}
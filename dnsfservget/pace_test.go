@@ -0,0 +1,87 @@
+package dnsfservget_test
+
+/*
+ * pace_test.go
+ * Tests for adaptive pacing
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* flakyQuerier fails every nth A query */
+type flakyQuerier struct {
+	dnsfservget.Querier
+	nth   int64
+	count int64
+}
+
+func (f *flakyQuerier) A(name string) ([]string, error) {
+	if 0 == atomic.AddInt64(&f.count, 1)%f.nth {
+		return nil, errors.New("timeout")
+	}
+	return f.Querier.A(name)
+}
+
+func TestGetterPacer(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens and puppies"))
+
+	get := func(p *dnsfservget.Pacer) ([]byte, error) {
+		g := dnsfservget.Getter{
+			Type:    dnsfservget.TypeA,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: &flakyQuerier{Querier: q, nth: 3},
+			UseMeta: true,
+			Pacer:   p,
+		}
+		return ioutil.ReadAll(g.Get())
+	}
+
+	/* Without a pacer, a lost query fails the transfer */
+	if _, err := get(nil); nil == err {
+		t.Errorf("Lost query didn't fail transfer")
+	}
+
+	/* With one, it's retried */
+	p := &dnsfservget.Pacer{Step: time.Millisecond}
+	b, err := get(p)
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if "kittens and puppies" != string(b) {
+		t.Errorf("Got %q", b)
+	}
+	st := p.Stats()
+	if 0 == st.Losses || 0 == st.MinRTT || 0 == st.SRTT {
+		t.Errorf("Incorrect stats %+v", st)
+	}
+
+	/* Too many losses should still fail */
+	p = &dnsfservget.Pacer{Step: time.Millisecond, Retries: 1}
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: &flakyQuerier{Querier: q, nth: 1},
+		Pacer:   p,
+	}
+	if _, err := ioutil.ReadAll(g.Get()); nil == err {
+		t.Errorf("Transfer succeeded with every query lost")
+	}
+	if 2 != p.Stats().Losses {
+		t.Errorf("Got %d losses, want 2", p.Stats().Losses)
+	}
+}
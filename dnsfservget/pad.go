@@ -0,0 +1,52 @@
+package dnsfservget
+
+/*
+ * pad.go
+ * Remove padding from TXT and NULL chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "errors"
+
+// PadLabel is put between the first label of a query for a chunk and the
+// domain (or session label), after SequenceLabel, to ask dnsfserv to pad TXT
+// and NULL chunks.
+const PadLabel = "_p"
+
+// PadMarker ends the data in a padded chunk.  It's followed by NULs, up to
+// the padded size.
+const PadMarker = 0x80
+
+// ErrBadPadding is returned when a padded chunk doesn't end in PadMarker and
+// NULs.
+var ErrBadPadding = errors.New("bad chunk padding")
+
+/* padded returns true if g.Pad is set and chunks of g.Type are padded. */
+func (g *Getter) padded() bool {
+	if !g.Pad {
+		return false
+	}
+	switch g.Type {
+	case TypeTXT, TypeBigTXT, TypeNULL:
+		return true
+	default:
+		return false
+	}
+}
+
+/* unpad removes the padding from the n bytes of a chunk in buf, if g asks
+for padding, and returns the number of bytes left. */
+func (g *Getter) unpad(buf []byte, n int) (int, error) {
+	if !g.padded() {
+		return n, nil
+	}
+	for 0 < n && 0 == buf[n-1] {
+		n--
+	}
+	if 0 == n || PadMarker != buf[n-1] {
+		return 0, ErrBadPadding
+	}
+	return n - 1, nil
+}
@@ -0,0 +1,57 @@
+package dnsfservget_test
+
+/*
+ * pad_test.go
+ * Tests for padded chunks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterPad(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1001)
+	for i := range file {
+		file[i] = byte(i * 5)
+	}
+	/* A trailing NUL shouldn't be mistaken for padding */
+	file[len(file)-1] = 0
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeBigTXT,
+		dnsfservget.TypeNULL,
+	} {
+		for _, seq := range []bool{false, true} {
+			g := dnsfservget.Getter{
+				Type:     qt,
+				Name:     "payload",
+				Domain:   "example.com",
+				Querier:  q,
+				UseMeta:  true,
+				Sequence: seq,
+				Pad:      true,
+			}
+			b, err := ioutil.ReadAll(g.Get())
+			if nil != err {
+				t.Errorf("%s (sequence:%t): %s", qt, seq, err)
+				continue
+			}
+			if !bytes.Equal(file, b) {
+				t.Errorf("%s (sequence:%t): wrong file", qt, seq)
+			}
+		}
+	}
+}
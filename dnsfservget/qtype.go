@@ -0,0 +1,348 @@
+package dnsfservget
+
+/*
+ * qtype.go
+ * Registry of query types
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// An AnswerEncoder converts the RDATA of a DNS answer into the string form
+// of the answer as returned by a Querier.  Domain names in the RDATA are
+// passed as they appeared in the response and may be compressed.
+type AnswerEncoder func(rdata []byte) (string, error)
+
+// A PayloadDecoder extracts the payload from a single answer as returned by a
+// Querier and places it in buf.  It returns the number of bytes placed in buf.
+type PayloadDecoder func(buf []byte, ans string) (int, error)
+
+// TypeQuerier is a Querier which can also query for arbitrary record types.
+// A TypeQuerier is required to use QTypes registered with RegisterQType.  The
+// Querier returned by DOHQuerier is a TypeQuerier.
+type TypeQuerier interface {
+	Querier
+	Query(name string, qtype QType) ([]string, error)
+}
+
+/* qtypeInfo describes how to query for and decode a QType */
+type qtypeInfo struct {
+	name        QType
+	rrType      uint16
+	payloadSize uint
+	encode      AnswerEncoder
+	decode      PayloadDecoder
+
+	/* query, if set, is used to query instead of TypeQuerier.Query */
+	query func(q Querier, name string) ([]string, error)
+
+	/* nameData is true if answers are names in the Getter's domain, with
+	the data in the labels before the domain */
+	nameData bool
+
+	/* label, if set, goes before the offset in queries, for types which
+	get different answers for the same record type */
+	label string
+
+	/* multi is true if answers have several records, which are decoded
+	together */
+	multi bool
+}
+
+var (
+	/* qtypes holds the known QTypes */
+	qtypes = map[QType]qtypeInfo{
+		TypeA: {
+			name:        TypeA,
+			rrType:      1,
+			payloadSize: 3,
+			encode:      encodeIP,
+			decode:      decodeA,
+			query:       Querier.A,
+		},
+		TypeAAAA: {
+			name:        TypeAAAA,
+			rrType:      28,
+			payloadSize: 8,
+			encode:      encodeIP,
+			decode:      decodeAAAA,
+			query:       Querier.AAAA,
+		},
+		TypeTXT: {
+			name:        TypeTXT,
+			rrType:      16,
+			payloadSize: MaxDecode,
+			encode:      encodeTXT,
+			decode:      decodeTXT,
+			query:       Querier.TXT,
+		},
+		TypeBigTXT: {
+			name:        TypeBigTXT,
+			rrType:      16,
+			payloadSize: MaxBigTXTDecode,
+			encode:      encodeTXT,
+			decode:      decodeTXT,
+			query:       Querier.TXT,
+			label:       BigTXTLabel,
+		},
+		TypeMultiA: {
+			name:        TypeMultiA,
+			rrType:      1,
+			payloadSize: 3 * MultiAnswers,
+			encode:      encodeIP,
+			decode:      decodeMultiA,
+			query:       Querier.A,
+			label:       MultiLabel,
+			multi:       true,
+		},
+		TypeMultiAAAA: {
+			name:        TypeMultiAAAA,
+			rrType:      28,
+			payloadSize: 8 * MultiAnswers,
+			encode:      encodeIP,
+			decode:      decodeMultiAAAA,
+			query:       Querier.AAAA,
+			label:       MultiLabel,
+			multi:       true,
+		},
+		TypeNULL: {
+			name:        TypeNULL,
+			rrType:      10,
+			payloadSize: MaxNULLDecode,
+			encode:      encodeNULL,
+			decode:      decodeNULL,
+		},
+		TypeCNAME: { /* Targets are parsed by the Codec */
+			name:        TypeCNAME,
+			rrType:      5,
+			payloadSize: MaxNameDecode,
+			decode:      decodeName,
+			nameData:    true,
+		},
+		TypeMX: {
+			name:        TypeMX,
+			rrType:      15,
+			payloadSize: MaxNameDecode,
+			encode:      encodeMX,
+			decode:      decodeMX,
+			query:       queryMX,
+			nameData:    true,
+		},
+		TypeSRV: {
+			name:        TypeSRV,
+			rrType:      33,
+			payloadSize: MaxNameDecode,
+			encode:      encodeSRV,
+			decode:      decodeSRV,
+			query:       querySRV,
+			nameData:    true,
+		},
+	}
+	qtypesL sync.RWMutex
+)
+
+// RegisterQType registers a new QType, which may then be used as a Getter's
+// Type as well as with AppendQuery and ParseDoHAnswer.  The name is used for
+// the new QType, rrType is the numeric DNS record type which will be queried,
+// and payloadSize is the maximum number of payload bytes returnable by a
+// single query.  Answers in DNS responses are converted to strings with
+// encode, which are in turn decoded into payload with decode.
+//
+// Getters using registered QTypes must have a Querier which is a TypeQuerier.
+// It is an error to register the same name twice.
+func RegisterQType(
+	name QType,
+	rrType uint16,
+	payloadSize uint,
+	encode AnswerEncoder,
+	decode PayloadDecoder,
+) error {
+	/* Make sure we have everything we need */
+	switch {
+	case "" == name:
+		return errors.New("empty name")
+	case 0 == rrType:
+		return errors.New("zero record type")
+	case 0 == payloadSize:
+		return errors.New("zero payload size")
+	case nil == encode:
+		return errors.New("nil encoder")
+	case nil == decode:
+		return errors.New("nil decoder")
+	}
+
+	qtypesL.Lock()
+	defer qtypesL.Unlock()
+
+	/* Don't clobber existing types */
+	if _, ok := qtypes[name]; ok {
+		return fmt.Errorf("query type %q already registered", name)
+	}
+
+	qtypes[name] = qtypeInfo{
+		name:        name,
+		rrType:      rrType,
+		payloadSize: payloadSize,
+		encode:      encode,
+		decode:      decode,
+	}
+	return nil
+}
+
+/* lookupQType gets the info for q.  If q isn't registered, an
+ErrorUnsupportedQType is returned. */
+func lookupQType(q QType) (qtypeInfo, error) {
+	qtypesL.RLock()
+	defer qtypesL.RUnlock()
+	qi, ok := qtypes[q]
+	if !ok {
+		return qtypeInfo{}, ErrorUnsupportedQType{q}
+	}
+	return qi, nil
+}
+
+/* doQuery queries for name with q, using qi.query if it's set or q's Query
+method if q is a TypeQuerier. */
+func (qi qtypeInfo) doQuery(q Querier, name string) ([]string, error) {
+	if nil != qi.query {
+		return qi.query(q, name)
+	}
+	return typeQuery(q, name, qi.name)
+}
+
+/* typeQuery queries for name with q's Query method, if q is a
+TypeQuerier. */
+func typeQuery(q Querier, name string, qtype QType) ([]string, error) {
+	tq, ok := q.(TypeQuerier)
+	if !ok {
+		return nil, fmt.Errorf(
+			"querier cannot make queries of type %s",
+			qtype,
+		)
+	}
+	return tq.Query(name, qtype)
+}
+
+/* encodeIP encodes an A or AAAA record's RDATA as an IP address */
+func encodeIP(rdata []byte) (string, error) {
+	if net.IPv4len != len(rdata) && net.IPv6len != len(rdata) {
+		return "", fmt.Errorf("invalid address length %d", len(rdata))
+	}
+	return net.IP(rdata).String(), nil
+}
+
+/* encodeTXT joins the character-strings in a TXT record's RDATA */
+func encodeTXT(rdata []byte) (string, error) {
+	var sb strings.Builder
+	for 0 != len(rdata) {
+		l := int(rdata[0])
+		if len(rdata) < 1+l {
+			return "", errors.New("truncated character-string")
+		}
+		sb.Write(rdata[1 : 1+l])
+		rdata = rdata[1+l:]
+	}
+	return sb.String(), nil
+}
+
+/* encodeNULL returns a NULL record's RDATA as-is */
+func encodeNULL(rdata []byte) (string, error) {
+	return string(rdata), nil
+}
+
+/* encodeMX encodes an MX record's uncompressed RDATA as the preference and
+exchange, separated by a space */
+func encodeMX(rdata []byte) (string, error) {
+	if 3 > len(rdata) {
+		return "", errors.New("MX record too short")
+	}
+	n, err := parseWireName(rdata[2:])
+	if nil != err {
+		return "", fmt.Errorf("exchange: %w", err)
+	}
+	return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(rdata), n), nil
+}
+
+/* encodeSRV encodes an SRV record's uncompressed RDATA as the priority,
+weight, port, and target, separated by spaces */
+func encodeSRV(rdata []byte) (string, error) {
+	if 7 > len(rdata) {
+		return "", errors.New("SRV record too short")
+	}
+	n, err := parseWireName(rdata[6:])
+	if nil != err {
+		return "", fmt.Errorf("target: %w", err)
+	}
+	return fmt.Sprintf(
+		"%d %d %d %s",
+		binary.BigEndian.Uint16(rdata),
+		binary.BigEndian.Uint16(rdata[2:]),
+		binary.BigEndian.Uint16(rdata[4:]),
+		n,
+	), nil
+}
+
+/* parseWireName returns the uncompressed name at the start of b as a
+fully-qualified name.  It's the opposite of wireName. */
+func parseWireName(b []byte) (string, error) {
+	var sb strings.Builder
+	for 0 != len(b) && 0 != b[0] {
+		l := int(b[0])
+		if 0xC0 == l&0xC0 {
+			return "", errors.New("compressed name")
+		}
+		if len(b) < 1+l {
+			return "", errors.New("truncated name")
+		}
+		sb.Write(b[1 : 1+l])
+		sb.WriteByte('.')
+		b = b[1+l:]
+	}
+	if 0 == len(b) {
+		return "", errors.New("unterminated name")
+	}
+	return sb.String(), nil
+}
+
+/* mxQuerier is a Querier which can also look up MX records, like
+DefaultQuerier's */
+type mxQuerier interface {
+	MX(name string) ([]string, error)
+}
+
+/* srvQuerier is a Querier which can also look up SRV records, like
+DefaultQuerier's */
+type srvQuerier interface {
+	SRV(name string) ([]string, error)
+}
+
+/* queryMX queries for MX records with q's MX method, if it has one, or else
+its Query method. */
+func queryMX(q Querier, name string) ([]string, error) {
+	if mq, ok := q.(mxQuerier); ok {
+		return mq.MX(name)
+	}
+	return typeQuery(q, name, TypeMX)
+}
+
+/* querySRV queries for SRV records with q's SRV method, if it has one, or
+else its Query method. */
+func querySRV(q Querier, name string) ([]string, error) {
+	if sq, ok := q.(srvQuerier); ok {
+		return sq.SRV(name)
+	}
+	return typeQuery(q, name, TypeSRV)
+}
+
+/* nameEncoding is how data is encoded in names */
+var nameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
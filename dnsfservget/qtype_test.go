@@ -0,0 +1,127 @@
+package dnsfservget_test
+
+/*
+ * qtype_test.go
+ * Tests for the built-in and registered query types
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetTypes(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1000)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeAAAA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeBigTXT,
+		dnsfservget.TypeMultiA,
+		dnsfservget.TypeMultiAAAA,
+		dnsfservget.TypeNULL,
+		dnsfservget.TypeCNAME,
+		dnsfservget.TypeMX,
+		dnsfservget.TypeSRV,
+	} {
+		g := dnsfservget.Getter{
+			Type:    qt,
+			Name:    "payload",
+			Domain:  "files.example.com",
+			Querier: q,
+			UseMeta: true,
+		}
+		got, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			t.Errorf("%s: %s", qt, err)
+			continue
+		}
+		if !bytes.Equal(file, got) {
+			t.Errorf("%s: got %d bytes which don't match", qt, len(got))
+		}
+	}
+}
+
+func TestRegisterQType(t *testing.T) {
+	enc := func(rdata []byte) (string, error) { return string(rdata), nil }
+	dec := func(buf []byte, ans string) (int, error) {
+		return copy(buf, ans), nil
+	}
+	/* Unique, in case of -count */
+	name := dnsfservget.QType(fmt.Sprintf("TEST%d", time.Now().UnixNano()))
+
+	/* Built-in types can't be clobbered */
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeSRV,
+	} {
+		if err := dnsfservget.RegisterQType(
+			qt,
+			99,
+			10,
+			enc,
+			dec,
+		); nil == err {
+			t.Errorf("Registered built-in type %s", qt)
+		}
+		if n, err := qt.PayloadSize(); nil != err || 10 == n {
+			t.Errorf("%s payload size now %d (err %v)", qt, n, err)
+		}
+	}
+
+	/* New types can be registered, but only once */
+	if err := dnsfservget.RegisterQType(name, 99, 10, enc, dec); nil != err {
+		t.Fatalf("Registering %s: %s", name, err)
+	}
+	if n, err := name.PayloadSize(); nil != err || 10 != n {
+		t.Errorf("%s payload size %d (err %v), want 10", name, n, err)
+	}
+	if err := dnsfservget.RegisterQType(name, 98, 20, enc, dec); nil == err {
+		t.Errorf("Registered %s twice", name)
+	}
+	if n, _ := name.PayloadSize(); 10 != n {
+		t.Errorf("%s payload size changed to %d", name, n)
+	}
+
+	/* Registrations need everything */
+	for _, c := range []struct {
+		name   dnsfservget.QType
+		rrType uint16
+		size   uint
+		enc    dnsfservget.AnswerEncoder
+		dec    dnsfservget.PayloadDecoder
+	}{
+		{"", 99, 10, enc, dec},
+		{name + "x", 0, 10, enc, dec},
+		{name + "x", 99, 0, enc, dec},
+		{name + "x", 99, 10, nil, dec},
+		{name + "x", 99, 10, enc, nil},
+	} {
+		if err := dnsfservget.RegisterQType(
+			c.name,
+			c.rrType,
+			c.size,
+			c.enc,
+			c.dec,
+		); nil == err {
+			t.Errorf("No error registering %+v", c)
+		}
+	}
+}
@@ -5,12 +5,14 @@ package dnsfservget
  * Canned query-makers
  * By J. Stuart McMurray
  * Created 20200809
- * Last Modified 20200817
+ * Last Modified 20261015
  */
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
 )
 
 // Querier performs DNS queries.  It can be used to plug different protocols
@@ -25,7 +27,9 @@ type Querier interface {
 // DefaultQuerier returns a querier which wraps the appropriate net.Lookup*
 // functions.  Due to limitations of net.LookupHost, the returned querier's A
 // and AAAA methods may make requests for A and AAAA records even though only
-// one type of address is returned.
+// one type of address is returned.  Names are always looked up as absolute
+// names, with a trailing dot, so the system's resolver doesn't append search
+// domains to them and leak queries to internal DNS servers.
 func DefaultQuerier() Querier {
 	return defaultQuerier{}
 }
@@ -38,7 +42,7 @@ func (defaultQuerier) A(name string) ([]string, error) {
 	as, err := net.DefaultResolver.LookupIP(
 		context.Background(),
 		"ip4",
-		name,
+		absName(name),
 	)
 	return ips2Strings(as), err
 }
@@ -48,14 +52,73 @@ func (defaultQuerier) AAAA(name string) ([]string, error) {
 	as, err := net.DefaultResolver.LookupIP(
 		context.Background(),
 		"ip6",
-		name,
+		absName(name),
 	)
 	return ips2Strings(as), err
 }
 
 /* TXT wraps net.LookupTXT */
 func (defaultQuerier) TXT(name string) ([]string, error) {
-	return net.DefaultResolver.LookupTXT(context.Background(), name)
+	return net.DefaultResolver.LookupTXT(
+		context.Background(),
+		absName(name),
+	)
+}
+
+/* MX wraps net.LookupMX, returning each record as its preference and host,
+separated by a space */
+func (defaultQuerier) MX(name string) ([]string, error) {
+	mxs, err := net.DefaultResolver.LookupMX(
+		context.Background(),
+		absName(name),
+	)
+	if nil == mxs {
+		return nil, err
+	}
+	ss := make([]string, len(mxs))
+	for i, mx := range mxs {
+		ss[i] = fmt.Sprintf("%d %s", mx.Pref, mx.Host)
+	}
+	return ss, err
+}
+
+/* SRV wraps net.LookupSRV, returning each record as its priority, weight,
+port, and target, separated by spaces */
+func (defaultQuerier) SRV(name string) ([]string, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(
+		context.Background(),
+		"",
+		"",
+		absName(name),
+	)
+	if nil == srvs {
+		return nil, err
+	}
+	ss := make([]string, len(srvs))
+	for i, srv := range srvs {
+		ss[i] = fmt.Sprintf(
+			"%d %d %d %s",
+			srv.Priority,
+			srv.Weight,
+			srv.Port,
+			srv.Target,
+		)
+	}
+	return ss, err
+}
+
+/* absName returns name with a trailing dot, if it hasn't already got one. */
+func absName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+/* sameName returns true if a and b are the same name, ignoring case and
+trailing dots. */
+func sameName(a, b string) bool {
+	return strings.EqualFold(absName(a), absName(b))
 }
 
 /* ips2Strings returns a slice of strings formed from calling the String method
@@ -0,0 +1,137 @@
+package dnsfservget
+
+/*
+ * querier_test.go
+ * Tests for keeping queries away from search domains
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestAbsName(t *testing.T) {
+	for _, c := range []struct {
+		have string
+		want string
+	}{
+		{"0-payload.example.com", "0-payload.example.com."},
+		{"0-payload.example.com.", "0-payload.example.com."},
+		{"payload", "payload."},
+	} {
+		if got := absName(c.have); c.want != got {
+			t.Errorf("absName(%q): got %q, want %q", c.have, got, c.want)
+		}
+	}
+	if !sameName("0-PayLoad.example.com", "0-payload.EXAMPLE.com.") {
+		t.Errorf("sameName doesn't ignore case and trailing dots")
+	}
+}
+
+/* testAnswer returns a packed response for the question q with the A and
+CNAME records in rrs, each of which is an owner name, a space, and either an
+IPv4 address or a CNAME target. */
+func testAnswer(t *testing.T, q string, rrs ...string) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(q),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	for _, rr := range rrs {
+		owner, data, _ := strings.Cut(rr, " ")
+		r := dnsmessage.Resource{Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(owner),
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		}}
+		if ip := net.ParseIP(data).To4(); nil != ip {
+			r.Header.Type = dnsmessage.TypeA
+			r.Body = &dnsmessage.AResource{A: [4]byte(ip)}
+		} else {
+			r.Header.Type = dnsmessage.TypeCNAME
+			r.Body = &dnsmessage.CNAMEResource{
+				CNAME: dnsmessage.MustNewName(data),
+			}
+		}
+		msg.Answers = append(msg.Answers, r)
+	}
+	b, err := msg.Pack()
+	if nil != err {
+		t.Fatalf("Packing answer: %s", err)
+	}
+	return b
+}
+
+func TestParseAnswerName(t *testing.T) {
+	name := "0-payload.example.com"
+
+	/* An answer for a name with a search domain appended is an error */
+	if as, _, err := parseAnswer(
+		testAnswer(
+			t,
+			"0-payload.example.com.corp.internal.",
+			"0-payload.example.com.corp.internal. 10.0.0.1",
+		),
+		name,
+		TypeA,
+	); nil == err {
+		t.Errorf("No error for answer for wrong name, got %q", as)
+	}
+
+	/* Only records for our name and its CNAMEs count */
+	for _, c := range []struct {
+		rrs  []string
+		want []string
+	}{{
+		rrs: []string{
+			"0-payload.example.com. 192.0.2.1",
+			"other.example.com. 192.0.2.2",
+		},
+		want: []string{"192.0.2.1"},
+	}, {
+		rrs: []string{
+			"0-payload.example.com. cdn.example.net.",
+			"cdn.example.net. 192.0.2.3",
+			"other.example.com. 192.0.2.4",
+		},
+		want: []string{"192.0.2.3"},
+	}, {
+		rrs: []string{
+			"0-PAYLOAD.example.com. 192.0.2.5",
+		},
+		want: []string{"192.0.2.5"},
+	}} {
+		as, _, err := parseAnswer(
+			testAnswer(t, "0-payload.example.com.", c.rrs...),
+			name,
+			TypeA,
+		)
+		if nil != err {
+			t.Errorf("Answer %q: %s", c.rrs, err)
+			continue
+		}
+		if !slices.Equal(c.want, as) {
+			t.Errorf("Answer %q: got %q, want %q", c.rrs, as, c.want)
+		}
+	}
+
+	/* Without a name, we take what we get */
+	as, err := ParseDoHAnswer(
+		testAnswer(t, "x.example.com.", "y.example.com. 192.0.2.6"),
+		TypeA,
+	)
+	if nil != err || 1 != len(as) {
+		t.Errorf("ParseDoHAnswer without a name: %q, %v", as, err)
+	}
+}
@@ -0,0 +1,61 @@
+package dnsfservget
+
+/*
+ * range.go
+ * Get part of a file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// GetRange is like Get, but only gets length bytes of the file starting at
+// offset start, or the rest of the file if length is 0.  Only the chunks
+// holding the range are queried for, and the partial chunks at either end are
+// trimmed.  GetRange sets g.StartOff and g.Max, and is used instead of Get.
+// Encrypted files may not be retrieved with GetRange.
+func (g *Getter) GetRange(start, length uint) io.ReadCloser {
+	if "" != g.Passphrase {
+		pr, pw := io.Pipe()
+		pw.CloseWithError(errors.New(
+			"encrypted files may not be retrieved by range",
+		))
+		return pr
+	}
+
+	/* Start at the start of the first chunk */
+	var skip uint
+	if qi, err := lookupQType(g.Type); nil == err {
+		skip = start % g.chunkSize(qi)
+	}
+	g.StartOff = start - skip
+	g.Max = 0
+	if 0 != length {
+		g.Max = skip + length
+	}
+
+	return &rangeReader{ReadCloser: g.Get(), skip: int64(skip)}
+}
+
+/* rangeReader discards skip bytes before the first read */
+type rangeReader struct {
+	io.ReadCloser
+	skip int64
+}
+
+/* Read implements io.Reader. */
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if 0 != r.skip {
+		_, err := io.CopyN(ioutil.Discard, r.ReadCloser, r.skip)
+		r.skip = 0
+		if nil != err {
+			return 0, err
+		}
+	}
+	return r.ReadCloser.Read(p)
+}
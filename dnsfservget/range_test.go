@@ -0,0 +1,85 @@
+package dnsfservget_test
+
+/*
+ * range_test.go
+ * Tests for getting part of a file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterGetRange(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := strings.Repeat("kittens and ", 30) + "puppies"
+	s.SetFile("payload", []byte(file))
+
+	for _, qtype := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeAAAA,
+		dnsfservget.TypeTXT,
+	} {
+		for _, c := range []struct {
+			start  uint
+			length uint
+		}{
+			{0, 7},
+			{5, 6},
+			{13, 1},
+			{200, 150},
+			{uint(len(file)) - 7, 7},
+			{uint(len(file)) - 7, 0},
+		} {
+			g := dnsfservget.Getter{
+				Type:    qtype,
+				Name:    "payload",
+				Domain:  "example.com",
+				Querier: q,
+				UseMeta: true,
+			}
+			b, err := ioutil.ReadAll(g.GetRange(c.start, c.length))
+			if nil != err {
+				t.Errorf("%s %d+%d: %s", qtype, c.start, c.length, err)
+				continue
+			}
+			end := c.start + c.length
+			if 0 == c.length {
+				end = uint(len(file))
+			}
+			if want := file[c.start:end]; want != string(b) {
+				t.Errorf(
+					"%s %d+%d: got %q, want %q",
+					qtype,
+					c.start,
+					c.length,
+					b,
+					want,
+				)
+			}
+		}
+	}
+
+	/* Only the needed chunks should be queried for */
+	cq := &countingQuerier{Querier: q}
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: cq,
+	}
+	if _, err := ioutil.ReadAll(g.GetRange(100, 4)); nil != err {
+		t.Fatalf("GetRange: %s", err)
+	}
+	if 2 != cq.n {
+		t.Errorf("Made %d A queries for 4 bytes at offset 100", cq.n)
+	}
+}
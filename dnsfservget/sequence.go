@@ -0,0 +1,75 @@
+package dnsfservget
+
+/*
+ * sequence.go
+ * Check chunks start with the right sequence byte
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// SequenceLabel is put between the first label of a query for a chunk and the
+// domain (or session label) to ask dnsfserv to start the chunk with its
+// SequenceByte.
+const SequenceLabel = "_q"
+
+// ErrSequenceMismatch is returned when a chunk doesn't start with the
+// SequenceByte for its offset, which probably means a resolver answered with
+// the wrong chunk.
+var ErrSequenceMismatch = errors.New("chunk sequence byte mismatch")
+
+// SequenceByte returns the byte which starts a chunk at offset off in a file,
+// when asked for with SequenceLabel.  It's the low byte of the CRC32 (IEEE)
+// of the offset as 8 big-endian bytes.
+func SequenceByte(off uint64) byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], off)
+	return byte(crc32.ChecksumIEEE(b[:]))
+}
+
+/* chunkSize returns the number of bytes of the file in a chunk of the type
+described by qi, which is one less than its payload size if g.Sequence is
+set, and one less again if chunks are padded. */
+func (g *Getter) chunkSize(qi qtypeInfo) uint {
+	n := qi.payloadSize
+	if g.Sequence && 1 < n {
+		n--
+	}
+	if g.padded() && 1 < n {
+		n--
+	}
+	return n
+}
+
+/* checkSequence checks that the n bytes of a chunk at offset off in buf start
+with the chunk's SequenceByte, if g.Sequence is set, and removes it.  It
+returns the number of bytes left. */
+func (g *Getter) checkSequence(buf []byte, n int, off uint) (int, error) {
+	if !g.Sequence {
+		return n, nil
+	}
+	if 0 == n {
+		return 0, fmt.Errorf(
+			"%w: empty chunk at offset %d",
+			ErrSequenceMismatch,
+			off,
+		)
+	}
+	if want := SequenceByte(uint64(off)); want != buf[0] {
+		return 0, fmt.Errorf(
+			"%w: got %02x at offset %d, expected %02x",
+			ErrSequenceMismatch,
+			buf[0],
+			off,
+			want,
+		)
+	}
+	return copy(buf, buf[1:n]), nil
+}
@@ -0,0 +1,120 @@
+package dnsfservget_test
+
+/*
+ * sequence_test.go
+ * Tests for chunk sequence bytes
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* staleQuerier answers every query for a chunk with the first chunk, like a
+badly-confused cache. */
+type staleQuerier struct {
+	dnsfservget.Querier
+}
+
+func (q staleQuerier) TXT(name string) ([]string, error) {
+	if _, rest, ok := strings.Cut(name, "-"); ok &&
+		strings.Contains(name, "."+dnsfservget.SequenceLabel+".") {
+		name = "0-" + rest
+	}
+	return q.Querier.TXT(name)
+}
+
+func TestGetterSequence(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1001)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeAAAA,
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeBigTXT,
+		dnsfservget.TypeMultiA,
+		dnsfservget.TypeMultiAAAA,
+		dnsfservget.TypeNULL,
+		dnsfservget.TypeCNAME,
+		dnsfservget.TypeMX,
+		dnsfservget.TypeSRV,
+	} {
+		for _, hs := range []bool{false, true} {
+			g := dnsfservget.Getter{
+				Type:      qt,
+				Name:      "payload",
+				Domain:    "example.com",
+				Querier:   q,
+				UseMeta:   true,
+				Handshake: hs,
+				Sequence:  true,
+			}
+			b, err := ioutil.ReadAll(g.Get())
+			if nil != err {
+				t.Errorf("%s (handshake:%t): %s", qt, hs, err)
+				continue
+			}
+			if !bytes.Equal(file, b) {
+				t.Errorf(
+					"%s (handshake:%t): wrong file",
+					qt,
+					hs,
+				)
+			}
+		}
+	}
+
+	/* Ranges start on the right chunk */
+	g := dnsfservget.Getter{
+		Type:     dnsfservget.TypeA,
+		Name:     "payload",
+		Domain:   "example.com",
+		Querier:  q,
+		Sequence: true,
+	}
+	b, err := ioutil.ReadAll(g.GetRange(101, 10))
+	if nil != err {
+		t.Fatalf("GetRange: %s", err)
+	}
+	if !bytes.Equal(file[101:111], b) {
+		t.Errorf("GetRange: got %02x, want %02x", b, file[101:111])
+	}
+
+	/* The wrong chunk should be noticed */
+	ps, err := dnsfservget.TypeTXT.PayloadSize()
+	if nil != err {
+		t.Fatalf("Getting TXT payload size: %s", err)
+	}
+	if dnsfservget.SequenceByte(0) ==
+		dnsfservget.SequenceByte(uint64(ps-1)) {
+		t.Fatalf("Chunks 0 and 1 have the same sequence byte")
+	}
+	g = dnsfservget.Getter{
+		Type:     dnsfservget.TypeTXT,
+		Name:     "payload",
+		Domain:   "example.com",
+		Querier:  staleQuerier{Querier: q},
+		Sequence: true,
+	}
+	if _, err := ioutil.ReadAll(g.Get()); !errors.Is(
+		err,
+		dnsfservget.ErrSequenceMismatch,
+	) {
+		t.Errorf("Stale chunk error: %v", err)
+	}
+}
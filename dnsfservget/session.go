@@ -0,0 +1,129 @@
+package dnsfservget
+
+/*
+ * session.go
+ * Per-transfer session keys
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	// KeyLabel replaces the offset in queries for the server's ephemeral
+	// X25519 public key, which is returned in a TXT record of the form
+	// x25519=<base64-encoded key>.
+	KeyLabel = "_kx"
+
+	// SessionLabel, a hyphen, and the Getter's base32-encoded ephemeral
+	// X25519 public key make up a label put between the first label of
+	// queries for chunks encrypted with a session key and the domain.  This
+	// keeps the file's name out of queries made by resolvers doing QNAME
+	// minimization.
+	SessionLabel = "_s"
+
+	/* keyPrefix starts the TXT record holding the server's key */
+	keyPrefix = "x25519="
+)
+
+// KeyName returns the name to query for the server's ephemeral public key.
+func (g *Getter) KeyName() string {
+	return AuthName(
+		g.Key,
+		fmt.Sprintf("%s-%s.%s", KeyLabel, g.Name, g.Domain),
+	)
+}
+
+// SessionKey derives a session key from the X25519 shared secret between the
+// server's and Getter's ephemeral keys, and the public keys themselves.
+func SessionKey(shared, serverPub, clientPub []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("dnsfserv session key"))
+	h.Write(shared)
+	h.Write(serverPub)
+	h.Write(clientPub)
+	return h.Sum(nil)
+}
+
+// SessionXOR encrypts or decrypts b, which is at offset off in the file
+// named name, with AES-256-CTR and a session key from SessionKey.  The name
+// is the one in the query, before aliases are resolved.  Each name gets its
+// own keystream, which starts at the start of the file, so chunks may be
+// encrypted and decrypted in any order.
+func SessionXOR(key []byte, name string, off uint64, b []byte) error {
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return err
+	}
+	var iv [aes.BlockSize]byte
+	nh := sha256.Sum256([]byte(strings.ToLower(name)))
+	copy(iv[:8], nh[:])
+	binary.BigEndian.PutUint64(iv[8:], off/aes.BlockSize)
+	s := cipher.NewCTR(block, iv[:])
+
+	/* Skip to the offset within the block */
+	var skip [aes.BlockSize]byte
+	s.XORKeyStream(skip[:off%aes.BlockSize], skip[:off%aes.BlockSize])
+	s.XORKeyStream(b, b)
+	return nil
+}
+
+/* session is the client side of a session */
+type session struct {
+	key   []byte
+	label string /* SessionLabel and our public key */
+}
+
+/* handshake gets the server's ephemeral public key and works out a session
+key. */
+func (g *Getter) handshake() (*session, error) {
+	/* Get the server's key */
+	n := g.KeyName()
+	as, err := g.Querier.TXT(n)
+	if nil != err {
+		return nil, fmt.Errorf("querying for %q: %w", n, err)
+	}
+	if 0 == len(as) {
+		return nil, fmt.Errorf("empty response to query for %q", n)
+	}
+	k := strings.TrimPrefix(as[0], keyPrefix)
+	if k == as[0] {
+		return nil, fmt.Errorf("invalid key record %q", as[0])
+	}
+	b, err := base64.RawStdEncoding.DecodeString(k)
+	if nil != err {
+		return nil, fmt.Errorf("decoding key %q: %w", k, err)
+	}
+	spub, err := ecdh.X25519().NewPublicKey(b)
+	if nil != err {
+		return nil, fmt.Errorf("parsing key: %w", err)
+	}
+
+	/* Work out a key of our own */
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if nil != err {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	shared, err := priv.ECDH(spub)
+	if nil != err {
+		return nil, fmt.Errorf("computing shared secret: %w", err)
+	}
+	cpub := priv.PublicKey().Bytes()
+	return &session{
+		key: SessionKey(shared, spub.Bytes(), cpub),
+		label: SessionLabel + "-" + strings.ToLower(
+			nameEncoding.EncodeToString(cpub),
+		),
+	}, nil
+}
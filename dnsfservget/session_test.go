@@ -0,0 +1,114 @@
+package dnsfservget_test
+
+/*
+ * session_test.go
+ * Tests for per-transfer session keys
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* namesQuerier notes the names queried with TXT */
+type namesQuerier struct {
+	dnsfservget.Querier
+	names []string
+}
+
+func (q *namesQuerier) TXT(name string) ([]string, error) {
+	q.names = append(q.names, name)
+	return q.Querier.TXT(name)
+}
+
+func TestSessionXOR(t *testing.T) {
+	key := bytes.Repeat([]byte{0x41}, 32)
+	file := bytes.Repeat([]byte("kittens"), 20)
+	enc := append([]byte(nil), file...)
+	if err := dnsfservget.SessionXOR(key, "payload", 0, enc); nil != err {
+		t.Fatalf("Encrypting: %s", err)
+	}
+	if bytes.Equal(file, enc) {
+		t.Fatalf("Encryption did nothing")
+	}
+
+	/* Chunks should decrypt on their own */
+	for _, c := range [][2]int{{0, 7}, {17, 40}, {100, 140}} {
+		b := append([]byte(nil), enc[c[0]:c[1]]...)
+		if err := dnsfservget.SessionXOR(
+			key,
+			"PAYLOAD",
+			uint64(c[0]),
+			b,
+		); nil != err {
+			t.Fatalf("Decrypting: %s", err)
+		}
+		if !bytes.Equal(file[c[0]:c[1]], b) {
+			t.Errorf("Chunk %d-%d decrypted to %q", c[0], c[1], b)
+		}
+	}
+
+	/* Other names get other keystreams */
+	other := append([]byte(nil), file...)
+	if err := dnsfservget.SessionXOR(key, "other", 0, other); nil != err {
+		t.Fatalf("Encrypting other: %s", err)
+	}
+	if bytes.Equal(enc, other) {
+		t.Errorf("Same keystream for different names")
+	}
+}
+
+func TestGetterHandshake(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1000)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeTXT,
+		dnsfservget.TypeA,
+		dnsfservget.TypeCNAME,
+	} {
+		nq := &namesQuerier{Querier: q}
+		g := dnsfservget.Getter{
+			Type:      qt,
+			Name:      "payload",
+			Domain:    "files.example.com",
+			Querier:   q,
+			UseMeta:   true,
+			Handshake: true,
+		}
+		if dnsfservget.TypeTXT == qt {
+			g.Querier = nq
+		}
+		got, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			t.Errorf("%s: %s", qt, err)
+			continue
+		}
+		if !bytes.Equal(file, got) {
+			t.Errorf("%s: got %d bytes which don't match", qt, len(got))
+		}
+		if dnsfservget.TypeTXT != qt {
+			continue
+		}
+		if 3 > len(nq.names) || nq.names[1] != g.KeyName() {
+			t.Fatalf("Unexpected queries %q", nq.names)
+		}
+		if ls := strings.Split(nq.names[2], "."); 2 > len(ls) ||
+			!strings.HasPrefix(ls[1], dnsfservget.SessionLabel+"-") {
+			t.Errorf("No session label in %q", nq.names[2])
+		}
+	}
+}
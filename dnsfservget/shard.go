@@ -0,0 +1,111 @@
+package dnsfservget
+
+/*
+ * shard.go
+ * Split a file's retrieval between hosts
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ShardLabel starts a label, followed by a dash, the shard's index and the
+// number of shards in base 36, separated by a dash, and optionally another
+// dash and Getter.ShardID, which GetShard puts after the TTL hint label, if
+// there is one, in queries for chunks.  This lets dnsfserv count several
+// hosts' shards as one delivery of the file.
+const ShardLabel = "_h"
+
+// ShardRange returns the offset and length of shard index (counting from 0)
+// of count shards of a file of size bytes, for use with GetRange.  Shards are
+// contiguous, start on a multiple of block bytes (e.g. a Getter's chunk
+// size), and are as close to the same size as possible.  Concatenated in
+// order, they make up the whole file.  If there are more shards than blocks,
+// the last shards are empty.
+func ShardRange(
+	size, block, index, count uint,
+) (start, length uint, err error) {
+	switch {
+	case 0 == count:
+		return 0, 0, errors.New("no shards")
+	case index >= count:
+		return 0, 0, fmt.Errorf(
+			"shard %d out of range for %d shards",
+			index,
+			count,
+		)
+	case 0 == block:
+		return 0, 0, errors.New("zero block size")
+	}
+
+	/* Spread the blocks evenly, with the leftovers going to the first
+	few shards */
+	blocks := (size + block - 1) / block
+	per, extra := blocks/count, blocks%count
+	first, n := index*per+extra, per
+	if index < extra {
+		first, n = index*(per+1), per+1
+	}
+
+	/* The last block may be short, and the last shards empty */
+	start, end := first*block, (first+n)*block
+	if size < end {
+		end = size
+	}
+	if end <= start {
+		return size, 0, nil
+	}
+	return start, end - start, nil
+}
+
+// GetShard is like GetRange, but gets shard index (counting from 0) of count
+// shards of the file, as returned by ShardRange with the Getter's chunk size,
+// so that several hosts can each get part of the file, with fewer queries
+// from each.  Concatenating the shards in order gives the whole file, as long
+// as every shard was got with the same Type, Sequence, and Pad, which set the
+// chunk size.  The file's size is found with Meta.  Queries for chunks have
+// a ShardLabel label, so dnsfserv can tell when all of the shards with the same
+// g.ShardID have been got.  GetShard sets g.StartOff and g.Max, and is
+// used instead of Get.
+func (g *Getter) GetShard(index, count uint) io.ReadCloser {
+	pr, pw := io.Pipe()
+	qi, err := lookupQType(g.Type)
+	if nil != err {
+		pw.CloseWithError(fmt.Errorf("getting chunk size: %w", err))
+		return pr
+	}
+	fm, err := g.Meta()
+	if nil != err {
+		pw.CloseWithError(fmt.Errorf("getting file size: %w", err))
+		return pr
+	}
+	start, length, err := ShardRange(
+		uint(fm.Size),
+		g.chunkSize(qi),
+		index,
+		count,
+	)
+	if nil != err {
+		pw.CloseWithError(err)
+		return pr
+	}
+
+	/* An empty shard is easy, and can't be asked for by range */
+	if 0 == length {
+		pw.Close()
+		return pr
+	}
+	g.shardLabel = ShardLabel + "-" +
+		strconv.FormatUint(uint64(index), 36) + "-" +
+		strconv.FormatUint(uint64(count), 36)
+	if "" != g.ShardID {
+		g.shardLabel += "-" + g.ShardID
+	}
+	return g.GetRange(start, length)
+}
@@ -0,0 +1,145 @@
+package dnsfservget_test
+
+/*
+ * shard_test.go
+ * Tests for splitting a file's retrieval between hosts
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestShardRange(t *testing.T) {
+	for _, c := range []struct {
+		size, block, count uint
+	}{
+		{1000, 3, 1},
+		{1000, 3, 4},
+		{1000, 160, 3},
+		{1001, 7, 10},
+		{20, 8, 5},
+		{0, 3, 2},
+	} {
+		var (
+			next       uint
+			maxN, minN uint = 0, c.size
+		)
+		for i := uint(0); i < c.count; i++ {
+			start, length, err := dnsfservget.ShardRange(
+				c.size,
+				c.block,
+				i,
+				c.count,
+			)
+			if nil != err {
+				t.Fatalf("%+v shard %d: %s", c, i, err)
+			}
+			if next != start {
+				t.Errorf(
+					"%+v shard %d: start %d, want %d",
+					c,
+					i,
+					start,
+					next,
+				)
+			}
+			if 0 != length && 0 != start%c.block {
+				t.Errorf(
+					"%+v shard %d: start %d not on a block",
+					c,
+					i,
+					start,
+				)
+			}
+			next = start + length
+			if length > maxN {
+				maxN = length
+			}
+			if length < minN {
+				minN = length
+			}
+		}
+		if c.size != next {
+			t.Errorf("%+v: shards end at %d", c, next)
+		}
+		/* Shards should be within a block of each other, give or take
+		the short last block */
+		if maxN-minN > 2*c.block {
+			t.Errorf("%+v: shards from %d to %d bytes", c, minN, maxN)
+		}
+	}
+
+	/* Bad shards are bad */
+	if _, _, err := dnsfservget.ShardRange(10, 3, 2, 2); nil == err {
+		t.Errorf("No error for out-of-range shard")
+	}
+	if _, _, err := dnsfservget.ShardRange(10, 3, 0, 0); nil == err {
+		t.Errorf("No error for no shards")
+	}
+}
+
+func TestGetterGetShard(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := make([]byte, 1001)
+	for i := range file {
+		file[i] = byte(i * 11)
+	}
+	s.SetFile("payload", file)
+
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeTXT,
+	} {
+		var got []byte
+		for i := uint(0); i < 3; i++ {
+			g := dnsfservget.Getter{
+				Type:     qt,
+				Name:     "payload",
+				Domain:   "example.com",
+				Querier:  q,
+				Sequence: true,
+			}
+			b, err := ioutil.ReadAll(g.GetShard(i, 3))
+			if nil != err {
+				t.Fatalf("%s shard %d: %s", qt, i, err)
+			}
+			got = append(got, b...)
+		}
+		if !bytes.Equal(file, got) {
+			t.Errorf("%s: joined shards don't make the file", qt)
+		}
+	}
+
+	/* Queries should say which shard they're for */
+	nq := &namingQuerier{Querier: q}
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeA,
+		Name:    "payload",
+		Domain:  "example.com",
+		Querier: nq,
+		TTLHint: 30,
+		ShardID: "x1",
+	}
+	if _, err := ioutil.ReadAll(g.GetShard(11, 12)); nil != err {
+		t.Fatalf("Shard with ID: %s", err)
+	}
+	if 0 == len(nq.names) {
+		t.Fatalf("No queries for shard")
+	}
+	const suffix = "-payload._t-30._h-b-c-x1.example.com"
+	for _, n := range nq.names {
+		if !strings.HasSuffix(n, suffix) {
+			t.Errorf("Query without shard label: %s", n)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package dnsfservget
+
+/*
+ * sink.go
+ * Send chunks straight to the caller
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ChunkSink receives a file from GetTo chunk by chunk, without the copy
+// through a pipe made by Get.  It's meant for callers which need to put the
+// file somewhere particular, such as memory they've already allocated, as
+// it arrives.  Where the bytes end up and whether that's safe is entirely up
+// to the ChunkSink.
+//
+// WriteChunk is called with the chunks in order.  The offset passed to
+// WriteChunk is the number of bytes passed in previous calls, so each chunk
+// starts where the previous chunk ended.  Chunks are usually a single
+// answer's worth of the file, but may be larger, e.g. when the file comes
+// from a Cache.  The slice passed to WriteChunk is reused after WriteChunk
+// returns.  An error returned from WriteChunk fails the transfer.
+//
+// Done is called exactly once, after the last call to WriteChunk has
+// returned, with the error which ended the transfer or nil if the whole file
+// was retrieved.  No calls are made concurrently.
+type ChunkSink interface {
+	WriteChunk(offset uint, b []byte) error
+	Done(err error)
+}
+
+// GetTo gets the file described by g, as Get does, but sends it to s instead
+// of returning an io.ReadCloser.  Calls to s are made from the goroutine
+// calling GetTo, which returns after s.Done has returned, with the same error
+// passed to s.Done.  Unlike Get, GetTo waits for a hung query to return even
+// if g.MaxDuration has passed.  Encrypted files can't be retrieved with
+// GetTo; setting g.Passphrase is an error.
+func (g *Getter) GetTo(s ChunkSink) error {
+	sw := &sinkWriter{s: s}
+	if "" != g.Passphrase {
+		sw.CloseWithError(errors.New("GetTo can't decrypt files"))
+	} else {
+		g.stop = nil
+		g.get(sw)
+	}
+	err := sw.err()
+	s.Done(err)
+	return err
+}
+
+/* sinkWriter is a chunkWriter which writes to a ChunkSink */
+type sinkWriter struct {
+	s   ChunkSink
+	off uint
+
+	l      sync.Mutex
+	closed bool
+	cerr   error /* Error with which we were closed */
+}
+
+/* Write passes b to sw.s's WriteChunk method, unless sw is closed. */
+func (sw *sinkWriter) Write(b []byte) (int, error) {
+	sw.l.Lock()
+	if sw.closed {
+		sw.l.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	sw.l.Unlock()
+	if err := sw.s.WriteChunk(sw.off, b); nil != err {
+		return 0, err
+	}
+	sw.off += uint(len(b))
+	return len(b), nil
+}
+
+/* CloseWithError closes sw with err.  Only the first error is kept.  It may
+be called concurrently with Write. */
+func (sw *sinkWriter) CloseWithError(err error) error {
+	sw.l.Lock()
+	defer sw.l.Unlock()
+	if !sw.closed {
+		sw.closed = true
+		sw.cerr = err
+	}
+	return nil
+}
+
+/* err returns the error with which sw was closed */
+func (sw *sinkWriter) err() error {
+	sw.l.Lock()
+	defer sw.l.Unlock()
+	return sw.cerr
+}
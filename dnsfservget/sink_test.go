@@ -0,0 +1,101 @@
+package dnsfservget_test
+
+/*
+ * sink_test.go
+ * Tests for sending chunks straight to the caller
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* testSink is a ChunkSink which keeps what it's given */
+type testSink struct {
+	t       *testing.T
+	b       []byte
+	calls   int
+	failAt  int /* WriteChunk call to fail, if nonzero */
+	dones   int
+	doneErr error
+}
+
+func (s *testSink) WriteChunk(off uint, b []byte) error {
+	s.calls++
+	if 0 != s.dones {
+		s.t.Errorf("WriteChunk after Done")
+	}
+	if uint(len(s.b)) != off {
+		s.t.Errorf("Chunk at offset %d after %d bytes", off, len(s.b))
+	}
+	if s.calls == s.failAt {
+		return errors.New("sink full")
+	}
+	s.b = append(s.b, b...)
+	return nil
+}
+
+func (s *testSink) Done(err error) {
+	s.dones++
+	s.doneErr = err
+}
+
+func TestGetterGetTo(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	file := bytes.Repeat([]byte("kittens"), 100)
+	s.SetFile("payload", file)
+	newGetter := func() *dnsfservget.Getter {
+		return &dnsfservget.Getter{
+			Type:    dnsfservget.TypeTXT,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: q,
+			UseMeta: true,
+		}
+	}
+
+	/* Whole file, in order */
+	g := newGetter()
+	sink := &testSink{t: t}
+	if err := g.GetTo(sink); nil != err {
+		t.Fatalf("GetTo: %s", err)
+	}
+	if !bytes.Equal(file, sink.b) {
+		t.Errorf("Got %q", sink.b)
+	}
+	if 1 != sink.dones || nil != sink.doneErr {
+		t.Errorf("Done called %d times with %v", sink.dones, sink.doneErr)
+	}
+	if 5 != sink.calls {
+		t.Errorf("WriteChunk called %d times, want 5", sink.calls)
+	}
+
+	/* The sink's errors stop the transfer */
+	sink = &testSink{t: t, failAt: 2}
+	if err := newGetter().GetTo(sink); nil == err || err != sink.doneErr {
+		t.Errorf("GetTo returned %v, Done got %v", err, sink.doneErr)
+	}
+	if 2 != sink.calls || 1 != sink.dones {
+		t.Errorf(
+			"Failed sink got %d chunks and %d Dones",
+			sink.calls,
+			sink.dones,
+		)
+	}
+
+	/* Encrypted files aren't supported */
+	g = newGetter()
+	g.Passphrase = "kittens"
+	sink = &testSink{t: t}
+	if err := g.GetTo(sink); nil == err || 0 != sink.calls {
+		t.Errorf("Encrypted GetTo: %v after %d chunks", err, sink.calls)
+	}
+}
@@ -0,0 +1,161 @@
+package dnsfservget
+
+/*
+ * socks.go
+ * Querier which sends queries over TCP through a SOCKS5 proxy
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// DefaultTCPTimeout is the default amount of time to wait for a response to
+// a query sent over TCP.
+const DefaultTCPTimeout = 10 * time.Second
+
+// SOCKS5Config is used to configure a querier which sends queries over TCP
+// through a SOCKS5 proxy, such as an SSH dynamic forward.
+type SOCKS5Config struct {
+	// Proxy is the address of the SOCKS5 proxy, e.g. 127.0.0.1:1080.
+	Proxy string
+
+	// User and Password, if set, are used to authenticate to the proxy.
+	User     string
+	Password string
+
+	// Server is the address of the DNS server to which the proxy should
+	// connect, e.g. 8.8.8.8:53.  If no port is given, 53 is used.  A
+	// hostname will be resolved by the proxy.
+	Server string
+
+	// Timeout is how long to wait for a response.  If unset,
+	// DefaultTCPTimeout is used.
+	Timeout time.Duration
+
+	// TSIG, if set, is used to sign queries and verify responses.
+	TSIG *TSIGKey
+}
+
+/* socksQuerier implements Querier by sending queries over a TCP connection
+made through a SOCKS5 proxy.  The connection is reused for as long as it
+works. */
+type socksQuerier struct {
+	d       proxy.Dialer
+	server  string
+	timeout time.Duration
+	tsig    *TSIGKey
+
+	l sync.Mutex
+	c net.Conn
+}
+
+// SOCKS5Querier returns a Querier which sends queries over TCP to a DNS
+// server via a SOCKS5 proxy.  This allows files to be retrieved through an
+// existing pivot rather than the local host's DNS.  One query is made at a
+// time over a single connection, which is remade as needed.  The returned
+// Querier is also a TypeQuerier.
+func SOCKS5Querier(conf SOCKS5Config) (Querier, error) {
+	var auth *proxy.Auth
+	if "" != conf.User || "" != conf.Password {
+		auth = &proxy.Auth{User: conf.User, Password: conf.Password}
+	}
+	d, err := proxy.SOCKS5("tcp", conf.Proxy, auth, proxy.Direct)
+	if nil != err {
+		return nil, fmt.Errorf("setting up proxy: %w", err)
+	}
+
+	q := &socksQuerier{
+		d:       d,
+		server:  conf.Server,
+		timeout: conf.Timeout,
+		tsig:    conf.TSIG,
+	}
+	if _, _, err := net.SplitHostPort(q.server); nil != err {
+		q.server = net.JoinHostPort(q.server, "53")
+	}
+	if 0 >= q.timeout {
+		q.timeout = DefaultTCPTimeout
+	}
+	return q, nil
+}
+
+/* A implements Querier.A */
+func (s *socksQuerier) A(name string) ([]string, error) {
+	return s.Query(name, TypeA)
+}
+
+/* AAAA implements Querier.AAAA */
+func (s *socksQuerier) AAAA(name string) ([]string, error) {
+	return s.Query(name, TypeAAAA)
+}
+
+/* TXT implements Querier.TXT */
+func (s *socksQuerier) TXT(name string) ([]string, error) {
+	return s.Query(name, TypeTXT)
+}
+
+/* Query implements TypeQuerier.Query */
+func (s *socksQuerier) Query(name string, qtype QType) ([]string, error) {
+	as, _, err := s.QueryTTL(name, qtype)
+	return as, err
+}
+
+/* QueryTTL implements TTLQuerier.QueryTTL */
+func (s *socksQuerier) QueryTTL(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for {
+		/* Make sure we're connected */
+		reused := nil != s.c
+		if !reused {
+			c, err := s.d.Dial("tcp", s.server)
+			if nil != err {
+				return nil, 0, fmt.Errorf(
+					"connecting to %s: %w",
+					s.server,
+					err,
+				)
+			}
+			s.c = c
+		}
+
+		/* Ask the question */
+		err := s.c.SetDeadline(time.Now().Add(s.timeout))
+		if nil != err {
+			err = fmt.Errorf("setting timeout: %w", err)
+		}
+		var (
+			as  []string
+			ttl time.Duration
+		)
+		if nil == err {
+			as, ttl, err = streamQuery(s.c, name, qtype, s.tsig)
+		}
+
+		/* A DNS error is still a working connection */
+		var de *net.DNSError
+		if nil == err || errors.As(err, &de) {
+			return as, ttl, err
+		}
+
+		/* The server may have closed an old connection */
+		s.c.Close()
+		s.c = nil
+		if !reused {
+			return nil, 0, err
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package dnsfservget_test
+
+/*
+ * socks_test.go
+ * Tests for querying through a SOCKS5 proxy
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* testSOCKS5 is a SOCKS5 proxy which answers DNS queries sent over proxied
+connections itself, with a dnsfservtest.Server. */
+type testSOCKS5 struct {
+	t    *testing.T
+	l    net.Listener
+	s    *dnsfservtest.Server
+	user string
+	pass string
+
+	m       sync.Mutex
+	cs      []net.Conn
+	targets []string /* Requested by clients */
+}
+
+/* newTestSOCKS5 starts a testSOCKS5 which requires the given username and
+password, if user isn't empty. */
+func newTestSOCKS5(
+	t *testing.T,
+	s *dnsfservtest.Server,
+	user string,
+	pass string,
+) *testSOCKS5 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Listen: %s", err)
+	}
+	p := &testSOCKS5{t: t, l: l, s: s, user: user, pass: pass}
+	t.Cleanup(func() { l.Close(); p.drop() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			p.m.Lock()
+			p.cs = append(p.cs, c)
+			p.m.Unlock()
+			go p.handle(c)
+		}
+	}()
+	return p
+}
+
+/* drop closes all of the proxied connections */
+func (p *testSOCKS5) drop() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for _, c := range p.cs {
+		c.Close()
+	}
+	p.cs = nil
+}
+
+/* connects returns the targets requested so far */
+func (p *testSOCKS5) connects() []string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return append([]string(nil), p.targets...)
+}
+
+/* handle handles a proxied connection */
+func (p *testSOCKS5) handle(c net.Conn) {
+	defer c.Close()
+	read := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c, b); nil != err {
+			return nil
+		}
+		return b
+	}
+
+	/* Greeting and maybe authentication */
+	b := read(2)
+	if nil == b || 5 != b[0] {
+		return
+	}
+	if nil == read(int(b[1])) {
+		return
+	}
+	if "" == p.user {
+		c.Write([]byte{5, 0})
+	} else {
+		c.Write([]byte{5, 2})
+		if b = read(2); nil == b {
+			return
+		}
+		user := read(int(b[1]))
+		pl := read(1)
+		if nil == pl {
+			return
+		}
+		pass := read(int(pl[0]))
+		if p.user != string(user) || p.pass != string(pass) {
+			c.Write([]byte{1, 1})
+			return
+		}
+		c.Write([]byte{1, 0})
+	}
+
+	/* Connect request */
+	if b = read(4); nil == b || 1 != b[1] {
+		return
+	}
+	var host string
+	switch b[3] {
+	case 1:
+		host = net.IP(read(4)).String()
+	case 3:
+		l := read(1)
+		if nil == l {
+			return
+		}
+		host = string(read(int(l[0])))
+	case 4:
+		host = net.IP(read(16)).String()
+	}
+	port := read(2)
+	if nil == port {
+		return
+	}
+	p.m.Lock()
+	p.targets = append(p.targets, net.JoinHostPort(
+		host,
+		strconv.Itoa(int(binary.BigEndian.Uint16(port))),
+	))
+	p.m.Unlock()
+	c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	/* Answer DNS queries */
+	for {
+		if b = read(2); nil == b {
+			return
+		}
+		q := read(int(binary.BigEndian.Uint16(b)))
+		if nil == q {
+			return
+		}
+		res, err := p.s.Answer(q)
+		if nil != err {
+			p.t.Errorf("Answering query: %s", err)
+			return
+		}
+		c.Write(binary.BigEndian.AppendUint16(nil, uint16(len(res))))
+		c.Write(res)
+	}
+}
+
+func TestSOCKS5Querier(t *testing.T) {
+	s := dnsfservtest.NewServer()
+	defer s.Close()
+	file := bytes.Repeat([]byte("kittens"), 100)
+	s.SetFile("payload", file)
+	p := newTestSOCKS5(t, s, "user", "pass")
+
+	get := func(q dnsfservget.Querier) ([]byte, error) {
+		return ioutil.ReadAll((&dnsfservget.Getter{
+			Type:    dnsfservget.TypeTXT,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: q,
+			UseMeta: true,
+		}).Get())
+	}
+
+	/* Queries should go through the proxy, on one connection */
+	q, err := dnsfservget.SOCKS5Querier(dnsfservget.SOCKS5Config{
+		Proxy:    p.l.Addr().String(),
+		User:     "user",
+		Password: "pass",
+		Server:   "dns.example.com",
+	})
+	if nil != err {
+		t.Fatalf("SOCKS5Querier: %s", err)
+	}
+	got, err := get(q)
+	if nil != err {
+		t.Fatalf("Error getting file: %s", err)
+	}
+	if !bytes.Equal(file, got) {
+		t.Errorf("Got %q, want %q", got, file)
+	}
+	if cs := p.connects(); 1 != len(cs) || "dns.example.com:53" != cs[0] {
+		t.Errorf("Proxy got connection requests for %q", cs)
+	}
+
+	/* A dropped connection should be remade */
+	p.drop()
+	if _, err := q.TXT((&dnsfservget.Getter{
+		Name:   "payload",
+		Domain: "example.com",
+	}).MetaName()); nil != err {
+		t.Errorf("Query after dropped connection: %s", err)
+	}
+	if cs := p.connects(); 2 != len(cs) {
+		t.Errorf("Got %d connections, want 2", len(cs))
+	}
+
+	/* Bad credentials shouldn't work */
+	q, err = dnsfservget.SOCKS5Querier(dnsfservget.SOCKS5Config{
+		Proxy:    p.l.Addr().String(),
+		User:     "user",
+		Password: "kittens",
+		Server:   "dns.example.com",
+	})
+	if nil != err {
+		t.Fatalf("SOCKS5Querier: %s", err)
+	}
+	if _, err := get(q); nil == err {
+		t.Errorf("No error with bad password")
+	}
+}
@@ -0,0 +1,99 @@
+package dnsfservget
+
+/*
+ * stat.go
+ * Cheaply check a file's existence, size, and modification time
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProbeLabel replaces the offset in queries probing a file.
+const ProbeLabel = "_probe"
+
+// FileStat is whether a file exists and, if so, its size and modification
+// time, as served in a TXT record by dnsfserv in answer to a probe.  Unlike
+// FileMeta, it's cheap for the server to work out.
+type FileStat struct {
+	Exists     bool
+	Size       uint64
+	ModTime    time.Time
+	Generation int64 /* Same as FileMeta's Generation */
+}
+
+// ProbeName returns the name to query to probe g's file.
+func (g *Getter) ProbeName() string {
+	return AuthName(
+		g.Key,
+		fmt.Sprintf(
+			"%s-%s.%s",
+			ProbeLabel,
+			g.Name,
+			ttlHintDomain(g.ControlTTLHint, g.Domain),
+		),
+	)
+}
+
+// Stat probes g's file with a TXT query.  If g.Querier is nil,
+// DefaultQuerier() is used.  A file which doesn't exist isn't an error.  If
+// g.ControlCache is set, a cached answer may be used instead.
+func (g *Getter) Stat() (FileStat, error) {
+	q := g.Querier
+	if nil == q {
+		q = DefaultQuerier()
+	}
+	n := g.ProbeName()
+	as, err := g.controlTXT(q, n)
+	if nil != err {
+		return FileStat{}, fmt.Errorf("querying for %q: %w", n, err)
+	}
+	if 0 == len(as) {
+		return FileStat{}, fmt.Errorf("empty response to query for %q", n)
+	}
+	return ParseStat(as[0])
+}
+
+// ParseStat parses the answer to a probe returned by dnsfserv.
+func ParseStat(txt string) (FileStat, error) {
+	var (
+		s         FileStat
+		gotExists bool
+		err       error
+	)
+	for _, f := range strings.Fields(txt) {
+		parts := strings.SplitN(f, "=", 2)
+		if 2 != len(parts) {
+			return FileStat{}, fmt.Errorf("invalid field %q", f)
+		}
+		switch parts[0] {
+		case "exists":
+			s.Exists = "1" == parts[1]
+			gotExists = true
+		case "size":
+			s.Size, err = strconv.ParseUint(parts[1], 10, 64)
+		case "mtime":
+			var t int64
+			t, err = strconv.ParseInt(parts[1], 10, 64)
+			s.ModTime = time.Unix(t, 0)
+		case "gen":
+			s.Generation, err = strconv.ParseInt(parts[1], 10, 64)
+		default: /* Ignore things we don't know about */
+			continue
+		}
+		if nil != err {
+			return FileStat{}, fmt.Errorf("parsing %s: %w", parts[0], err)
+		}
+	}
+	if !gotExists {
+		return FileStat{}, errors.New("missing existence")
+	}
+	return s, nil
+}
@@ -0,0 +1,49 @@
+package dnsfservget_test
+
+/*
+ * stat_test.go
+ * Tests for probing files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterStat(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens"))
+
+	g := dnsfservget.Getter{Name: "payload", Domain: "example.com", Querier: q}
+	st, err := g.Stat()
+	if nil != err {
+		t.Fatalf("Stat: %s", err)
+	}
+	if !st.Exists || 7 != st.Size || st.ModTime.IsZero() {
+		t.Errorf("Incorrect stat %+v", st)
+	}
+	m, err := g.Meta()
+	if nil != err {
+		t.Fatalf("Meta: %s", err)
+	}
+	if m.Generation != st.Generation {
+		t.Errorf(
+			"Generation %d doesn't match metadata's %d",
+			st.Generation,
+			m.Generation,
+		)
+	}
+
+	g.Name = "nonesuch"
+	if st, err := g.Stat(); nil != err {
+		t.Errorf("Stat for nonexistent file: %s", err)
+	} else if st.Exists {
+		t.Errorf("Nonexistent file exists: %+v", st)
+	}
+}
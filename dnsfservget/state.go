@@ -0,0 +1,120 @@
+package dnsfservget
+
+/*
+ * state.go
+ * Transfer state tracking
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is the state of a transfer started with Getter.Get.
+type State int
+
+// States through which a transfer passes.  A transfer starts Pending and then
+// goes back and forth between Querying and Decoding for every chunk of the
+// file until it is Done or Failed.  If a query takes longer than the Getter's
+// StallAfter, the transfer is Stalled until the query returns.
+const (
+	StatePending State = iota
+	StateQuerying
+	StateDecoding
+	StateStalled
+	StateDone
+	StateFailed
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StatePending:
+		return "Pending"
+	case StateQuerying:
+		return "Querying"
+	case StateDecoding:
+		return "Decoding"
+	case StateStalled:
+		return "Stalled"
+	case StateDone:
+		return "Done"
+	case StateFailed:
+		return "Failed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// StateChange describes a transfer's change from one State to another.
+type StateChange struct {
+	From    State
+	To      State
+	Query   string /* Query being made, if any */
+	Written uint   /* Bytes sent to the io.ReadCloser so far */
+	Err     error  /* Why the transfer failed, for StateFailed */
+}
+
+// State returns the current state of the transfer started with g.Get.
+func (g *Getter) State() State {
+	g.sl.Lock()
+	defer g.sl.Unlock()
+	return g.state
+}
+
+/* setState changes g's state to to and tells g.OnStateChange about it, if it's
+set.  The query q is the query being made, written is the number of bytes sent
+to the io.ReadCloser so far, and err is the reason the transfer failed. */
+func (g *Getter) setState(to State, q string, written uint, err error) {
+	g.changeState(nil, StateChange{
+		To:      to,
+		Query:   q,
+		Written: written,
+		Err:     err,
+	})
+}
+
+/* changeState changes g's state to sc.To and tells g.OnStateChange about it,
+if it's set.  If only is not nil, the state is only changed if only returns
+true when passed the current state and query.  sc.From will be filled in. */
+func (g *Getter) changeState(
+	only func(cur State, q string) bool,
+	sc StateChange,
+) {
+	/* Make sure callbacks happen in order */
+	g.cbl.Lock()
+	defer g.cbl.Unlock()
+
+	/* Update the state */
+	g.sl.Lock()
+	if nil != only && !only(g.state, g.query) {
+		g.sl.Unlock()
+		return
+	}
+	sc.From = g.state
+	g.state = sc.To
+	g.query = sc.Query
+	g.sl.Unlock()
+
+	/* Tell the user */
+	if nil != g.OnStateChange && sc.From != sc.To {
+		g.OnStateChange(sc)
+	}
+}
+
+/* stallTimer returns a timer which marks the transfer as Stalled if the query
+q is still being made after g.StallAfter.  If g.StallAfter isn't set,
+stallTimer returns nil. */
+func (g *Getter) stallTimer(q string, written uint) *time.Timer {
+	if 0 >= g.StallAfter {
+		return nil
+	}
+	return time.AfterFunc(g.StallAfter, func() {
+		g.changeState(func(cur State, cq string) bool {
+			return StateQuerying == cur && q == cq
+		}, StateChange{To: StateStalled, Query: q, Written: written})
+	})
+}
@@ -0,0 +1,169 @@
+package dnsfservget
+
+/*
+ * stream.go
+ * DNS queries over streams, as with TCP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* streamQuerier implements Querier by sending queries over a stream */
+type streamQuerier struct {
+	rw  io.ReadWriter
+	l   sync.Mutex
+	err error /* Sticky non-DNS error */
+}
+
+// NewStreamQuerier returns a Querier which sends queries over rw, prefixed
+// with their lengths as with DNS over TCP.  This allows for queries to be sent
+// over nearly any stream, such as an SSH channel, TLS connection, or named
+// pipe, as long as something on the other end answers them.  Queries are made
+// one at a time.  If rw has a SetDeadline method, as does a net.Conn, each
+// query times out after DefaultTCPTimeout.  After an error other than a DNS
+// error (i.e. one which isn't a *net.DNSError), the stream may be out of sync
+// and all further queries will fail with the same error.  The returned Querier
+// is also a TypeQuerier.
+func NewStreamQuerier(rw io.ReadWriter) Querier {
+	return &streamQuerier{rw: rw}
+}
+
+/* A implements Querier.A */
+func (s *streamQuerier) A(name string) ([]string, error) {
+	return s.Query(name, TypeA)
+}
+
+/* AAAA implements Querier.AAAA */
+func (s *streamQuerier) AAAA(name string) ([]string, error) {
+	return s.Query(name, TypeAAAA)
+}
+
+/* TXT implements Querier.TXT */
+func (s *streamQuerier) TXT(name string) ([]string, error) {
+	return s.Query(name, TypeTXT)
+}
+
+/* Query implements TypeQuerier.Query */
+func (s *streamQuerier) Query(name string, qtype QType) ([]string, error) {
+	as, _, err := s.QueryTTL(name, qtype)
+	return as, err
+}
+
+/* QueryTTL implements TTLQuerier.QueryTTL */
+func (s *streamQuerier) QueryTTL(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	/* Don't bother if the stream's broken */
+	if nil != s.err {
+		return nil, 0, s.err
+	}
+
+	/* Don't wait forever if we can help it */
+	if d, ok := s.rw.(interface{ SetDeadline(time.Time) error }); ok {
+		err := d.SetDeadline(time.Now().Add(DefaultTCPTimeout))
+		if nil != err {
+			return nil, 0, fmt.Errorf("setting timeout: %w", err)
+		}
+	}
+
+	/* Ask the question */
+	as, ttl, err := streamQuery(s.rw, name, qtype, nil)
+	var de *net.DNSError
+	if nil != err && !errors.As(err, &de) {
+		s.err = err
+	}
+	return as, ttl, err
+}
+
+/* streamQuery sends a query for name of type qtype over rw, prefixed with
+its length as with DNS over TCP, and waits for the response.  Responses with
+the wrong ID or question are ignored.  If tsig isn't nil, it's used to sign
+the query and verify the response.  The answer's TTL is returned as well. */
+func streamQuery(
+	rw io.ReadWriter,
+	name string,
+	qtype QType,
+	tsig *TSIGKey,
+) ([]string, time.Duration, error) {
+	/* Random ID for this query */
+	var ib [2]byte
+	if _, err := rand.Read(ib[:]); nil != err {
+		return nil, 0, fmt.Errorf("generating ID: %w", err)
+	}
+	id := binary.BigEndian.Uint16(ib[:])
+
+	/* Roll the query, leaving room for the length */
+	qi, err := lookupQType(qtype)
+	if nil != err {
+		return nil, 0, err
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	b := getBuf()
+	defer putBuf(b)
+	qb, err := appendQuery(name, qtype, id, b[:2])
+	if nil != err {
+		return nil, 0, fmt.Errorf("generating query: %w", err)
+	}
+	var mac []byte
+	if nil != tsig {
+		if qb, mac, err = tsig.SignQuery(qb[2:]); nil != err {
+			return nil, 0, fmt.Errorf("signing query: %w", err)
+		}
+		qb = append([]byte{0, 0}, qb...)
+	}
+	binary.BigEndian.PutUint16(qb, uint16(len(qb)-2))
+	if _, err := rw.Write(qb); nil != err {
+		return nil, 0, fmt.Errorf("sending query: %w", err)
+	}
+
+	/* Wait for a response which goes with our query */
+	rb := getBuf()
+	defer putBuf(rb)
+	for {
+		if _, err := io.ReadFull(rw, rb[:2]); nil != err {
+			return nil, 0, fmt.Errorf(
+				"reading response length: %w",
+				err,
+			)
+		}
+		l := int(binary.BigEndian.Uint16(rb))
+		if _, err := io.ReadFull(rw, rb[:l]); nil != err {
+			return nil, 0, fmt.Errorf("reading response: %w", err)
+		}
+		res, err := DefaultCodec.ParseResponse(rb[:l])
+		if nil != err || !isResponseTo(res, id, name, qi.rrType) {
+			continue
+		}
+		if nil != tsig {
+			if err := tsig.VerifyResponse(rb[:l], mac); nil != err {
+				return nil, 0, fmt.Errorf(
+					"verifying response: %w",
+					err,
+				)
+			}
+		}
+		as, ttl, err := answerRecords(res, name, qi)
+		if nil != err {
+			return nil, 0, fmt.Errorf("parsing response: %w", err)
+		}
+		return as, ttl, nil
+	}
+}
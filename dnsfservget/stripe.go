@@ -0,0 +1,79 @@
+package dnsfservget
+
+/*
+ * stripe.go
+ * Spread files across several names
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// DefaultStripeBlock is the default number of consecutive bytes of a striped
+// file served under one name.  It is a multiple of the payload size of every
+// built-in QType.
+const DefaultStripeBlock = 480
+
+// StripeName returns the name under which stripe i of the file with the given
+// name is served.
+func StripeName(name string, i uint) string {
+	return name + "-" + strconv.FormatUint(uint64(i), 10)
+}
+
+// Stripe splits the file read from r into len(ws) stripes, one written to
+// each of ws, such that the first block bytes of the file are written to
+// ws[0], the next block bytes to ws[1], and so on, wrapping around to ws[0]
+// after the last writer.  Each stripe should be served with the name returned
+// by StripeName.  If block is 0, DefaultStripeBlock is used.
+func Stripe(r io.Reader, ws []io.Writer, block uint) error {
+	if 0 == len(ws) {
+		return errors.New("no stripes")
+	}
+	if 0 == block {
+		block = DefaultStripeBlock
+	}
+	buf := make([]byte, block)
+	for i := 0; ; i = (i + 1) % len(ws) {
+		n, err := io.ReadFull(r, buf)
+		if 0 != n {
+			if _, werr := ws[i].Write(buf[:n]); nil != werr {
+				return fmt.Errorf("writing stripe %d: %w", i, werr)
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return nil
+		case nil != err:
+			return err
+		}
+	}
+}
+
+/* stripeName returns the name and offset from which to retrieve the chunk of
+g's file at offset off.  If g isn't striped, g.Name and off are returned. */
+func (g *Getter) stripeName(off, payloadSize uint) (string, uint, error) {
+	if 1 >= g.Stripes {
+		return g.Name, off, nil
+	}
+	block := g.StripeBlock
+	if 0 == block {
+		block = DefaultStripeBlock
+	}
+	if 0 != block%payloadSize {
+		return "", 0, fmt.Errorf(
+			"stripe block size %d not a multiple of payload size %d",
+			block,
+			payloadSize,
+		)
+	}
+	n := off / block
+	return StripeName(g.Name, n%g.Stripes),
+		(n/g.Stripes)*block + off%block,
+		nil
+}
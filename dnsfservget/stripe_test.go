@@ -0,0 +1,84 @@
+package dnsfservget_test
+
+/*
+ * stripe_test.go
+ * Tests for striped files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestStripe(t *testing.T) {
+	const nStripes = 3
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+
+	for _, size := range []int{0, 1, 479, 480, 481, 2000, 1440} {
+		/* Split up a file */
+		file := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(file)
+		var (
+			bufs [nStripes]bytes.Buffer
+			ws   = make([]io.Writer, nStripes)
+		)
+		for i := range ws {
+			ws[i] = &bufs[i]
+		}
+		if err := dnsfservget.Stripe(
+			bytes.NewReader(file),
+			ws,
+			0,
+		); nil != err {
+			t.Fatalf("Stripe (size %d): %s", size, err)
+		}
+		for i := range bufs {
+			s.SetFile(
+				dnsfservget.StripeName("payload", uint(i)),
+				bufs[i].Bytes(),
+			)
+		}
+
+		/* Get it back */
+		for _, qt := range []dnsfservget.QType{
+			dnsfservget.TypeA,
+			dnsfservget.TypeAAAA,
+			dnsfservget.TypeTXT,
+		} {
+			g := dnsfservget.Getter{
+				Type:    qt,
+				Name:    "payload",
+				Domain:  "example.com",
+				Querier: q,
+				Stripes: nStripes,
+			}
+			got, err := ioutil.ReadAll(g.Get())
+			if nil != err {
+				t.Errorf("Get (size %d, %s): %s", size, qt, err)
+				continue
+			}
+			/* Chunks are padded with NULs */
+			if len(got) < len(file) ||
+				!bytes.Equal(file, got[:len(file)]) ||
+				0 != len(bytes.Trim(got[len(file):], "\x00")) {
+				t.Errorf(
+					"Size %d, %s: got %d bytes, "+
+						"which don't match",
+					size,
+					qt,
+					len(got),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package dnsfservget
+
+/*
+ * tsig.go
+ * TSIG signing and verification
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	/* tsigType is TSIG's RR type */
+	tsigType = 250
+
+	/* tsigAlgorithm is the only algorithm we support */
+	tsigAlgorithm = "hmac-sha256."
+
+	/* rcodeNotAuth is the NOTAUTH RCode, which dnsmessage doesn't have */
+	rcodeNotAuth dnsmessage.RCode = 9
+
+	// TSIGFudge is the number of seconds by which the time in a TSIG
+	// record may differ from the current time.
+	TSIGFudge = 300
+)
+
+// ErrTSIG is wrapped by errors returned when a message's TSIG record is
+// missing or invalid.
+var ErrTSIG = errors.New("TSIG verification failed")
+
+// TSIGKey is a key used to sign and verify DNS messages with TSIG (RFC 8945)
+// using HMAC-SHA256.  Both ends must have the same key.  Recursive resolvers
+// won't pass TSIG records along, so TSIG is only useful when queries are sent
+// directly to dnsfserv, as with UDPQuerier.
+type TSIGKey struct {
+	Name   string /* Key name, e.g. dnsfserv. */
+	Secret []byte /* HMAC secret */
+}
+
+// ParseTSIGKey parses a key of the form [hmac-sha256:]name:base64secret, as
+// used by dig's -y flag.
+func ParseTSIGKey(s string) (*TSIGKey, error) {
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 2:
+	case 3:
+		if !strings.EqualFold(
+			strings.TrimSuffix(tsigAlgorithm, "."),
+			parts[0],
+		) {
+			return nil, fmt.Errorf("unsupported algorithm %q", parts[0])
+		}
+		parts = parts[1:]
+	default:
+		return nil, errors.New("key not of the form name:secret")
+	}
+	if "" == parts[0] {
+		return nil, errors.New("empty key name")
+	}
+	sec, err := base64.StdEncoding.DecodeString(parts[1])
+	if nil != err {
+		return nil, fmt.Errorf("decoding secret: %w", err)
+	}
+	return &TSIGKey{Name: parts[0], Secret: sec}, nil
+}
+
+/* tsigRecord is the parts of a TSIG record we care about */
+type tsigRecord struct {
+	algorithm  string
+	timeSigned uint64
+	fudge      uint16
+	mac        []byte
+	origID     uint16
+	tsigErr    uint16
+	other      []byte
+}
+
+// SignQuery signs the query in m, which must not already have a TSIG record,
+// and returns the signed message and the MAC needed by VerifyResponse.
+func (k *TSIGKey) SignQuery(m []byte) (signed, mac []byte, err error) {
+	return k.sign(m, nil)
+}
+
+// VerifyQuery checks the TSIG record at the end of the query in m and returns
+// its MAC, needed by SignResponse.  Errors caused by a missing or invalid TSIG
+// record wrap ErrTSIG.
+func (k *TSIGKey) VerifyQuery(m []byte) ([]byte, error) {
+	return k.verify(m, nil)
+}
+
+// SignResponse signs the response in m, which must not already have a TSIG
+// record, to the query whose MAC is reqMAC.
+func (k *TSIGKey) SignResponse(m, reqMAC []byte) ([]byte, error) {
+	signed, _, err := k.sign(m, reqMAC)
+	return signed, err
+}
+
+// VerifyResponse checks the TSIG record at the end of the response in m to
+// the query whose MAC is reqMAC.  Errors caused by a missing or invalid TSIG
+// record wrap ErrTSIG.
+func (k *TSIGKey) VerifyResponse(m, reqMAC []byte) error {
+	_, err := k.verify(m, reqMAC)
+	return err
+}
+
+/* sign appends a TSIG record to m.  If reqMAC is not nil, m is taken to be a
+response and reqMAC included in the MAC.  The signed message and MAC are
+returned. */
+func (k *TSIGKey) sign(m, reqMAC []byte) (signed, mac []byte, err error) {
+	if 12 > len(m) {
+		return nil, nil, errors.New("message too short")
+	}
+	kn, err := wireName(k.Name)
+	if nil != err {
+		return nil, nil, fmt.Errorf("key name: %w", err)
+	}
+	tr := tsigRecord{
+		algorithm:  tsigAlgorithm,
+		timeSigned: uint64(time.Now().Unix()),
+		fudge:      TSIGFudge,
+		origID:     binary.BigEndian.Uint16(m),
+	}
+	tr.mac = k.mac(reqMAC, m, kn, tr)
+
+	/* Append the record and count it */
+	rdata, err := tr.marshal()
+	if nil != err {
+		return nil, nil, err
+	}
+	signed = append(append([]byte(nil), m...), kn...)
+	signed = binary.BigEndian.AppendUint16(signed, tsigType)
+	signed = binary.BigEndian.AppendUint16(
+		signed,
+		uint16(dnsmessage.ClassANY),
+	)
+	signed = binary.BigEndian.AppendUint32(signed, 0)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+	binary.BigEndian.PutUint16(
+		signed[10:],
+		binary.BigEndian.Uint16(signed[10:])+1,
+	)
+	return signed, tr.mac, nil
+}
+
+/* verify checks the TSIG record at the end of m.  If reqMAC is not nil, m is
+taken to be a response and reqMAC included in the MAC.  The record's MAC is
+returned. */
+func (k *TSIGKey) verify(m, reqMAC []byte) ([]byte, error) {
+	/* Find the TSIG record, which must be last */
+	var p dnsmessage.Parser
+	h, err := p.Start(m)
+	if nil != err {
+		return nil, fmt.Errorf("parsing header: %w", err)
+	}
+	if err := p.SkipAllQuestions(); nil != err {
+		return nil, fmt.Errorf("skipping questions: %w", err)
+	}
+	if err := p.SkipAllAnswers(); nil != err {
+		return nil, fmt.Errorf("skipping answers: %w", err)
+	}
+	if err := p.SkipAllAuthorities(); nil != err {
+		return nil, fmt.Errorf("skipping authorities: %w", err)
+	}
+	ads, err := p.AllAdditionals()
+	if nil != err {
+		return nil, fmt.Errorf("parsing additionals: %w", err)
+	}
+	if 0 == len(ads) || tsigType != ads[len(ads)-1].Header.Type {
+		/* Servers don't sign rejections of bad signatures */
+		if nil != reqMAC && rcodeNotAuth == h.RCode {
+			return nil, fmt.Errorf(
+				"%w: query signature rejected",
+				ErrTSIG,
+			)
+		}
+		return nil, fmt.Errorf("%w: no TSIG record", ErrTSIG)
+	}
+	rr := ads[len(ads)-1]
+	ur, ok := rr.Body.(*dnsmessage.UnknownResource)
+	if !ok {
+		return nil, fmt.Errorf("%w: unparseable TSIG record", ErrTSIG)
+	}
+	if !strings.EqualFold(
+		strings.TrimSuffix(rr.Header.Name.String(), "."),
+		strings.TrimSuffix(k.Name, "."),
+	) {
+		return nil, fmt.Errorf(
+			"%w: unknown key %s",
+			ErrTSIG,
+			rr.Header.Name,
+		)
+	}
+	tr, err := unmarshalTSIG(ur.Data)
+	if nil != err {
+		return nil, fmt.Errorf("%w: %s", ErrTSIG, err)
+	}
+	if !strings.EqualFold(tsigAlgorithm, tr.algorithm) {
+		return nil, fmt.Errorf(
+			"%w: unsupported algorithm %s",
+			ErrTSIG,
+			tr.algorithm,
+		)
+	}
+
+	/* Work out the message as it was before it was signed */
+	kn, err := wireName(k.Name)
+	if nil != err {
+		return nil, fmt.Errorf("key name: %w", err)
+	}
+	rl := len(kn) + 10 + len(ur.Data)
+	if len(m) < 12+rl {
+		return nil, fmt.Errorf("%w: compressed TSIG record", ErrTSIG)
+	}
+	orig := append([]byte(nil), m[:len(m)-rl]...)
+	binary.BigEndian.PutUint16(orig, tr.origID)
+	binary.BigEndian.PutUint16(
+		orig[10:],
+		binary.BigEndian.Uint16(m[10:])-1,
+	)
+
+	/* Check the MAC and time */
+	if !hmac.Equal(tr.mac, k.mac(reqMAC, orig, kn, tr)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrTSIG)
+	}
+	now := time.Now().Unix()
+	if d := now - int64(tr.timeSigned); d > int64(tr.fudge) ||
+		-d > int64(tr.fudge) {
+		return nil, fmt.Errorf("%w: bad time", ErrTSIG)
+	}
+	return tr.mac, nil
+}
+
+/* mac works out the MAC for m, which is signed with the record tr.  The key
+name kn should be in wire format.  If reqMAC is not nil, it is included. */
+func (k *TSIGKey) mac(reqMAC, m, kn []byte, tr tsigRecord) []byte {
+	an, _ := wireName(tr.algorithm)
+	hm := hmac.New(sha256.New, k.Secret)
+	if nil != reqMAC {
+		hm.Write(binary.BigEndian.AppendUint16(nil, uint16(len(reqMAC))))
+		hm.Write(reqMAC)
+	}
+	hm.Write(m)
+	v := append([]byte(nil), kn...)
+	v = binary.BigEndian.AppendUint16(v, uint16(dnsmessage.ClassANY))
+	v = binary.BigEndian.AppendUint32(v, 0)
+	v = append(v, an...)
+	v = appendUint48(v, tr.timeSigned)
+	v = binary.BigEndian.AppendUint16(v, tr.fudge)
+	v = binary.BigEndian.AppendUint16(v, tr.tsigErr)
+	v = binary.BigEndian.AppendUint16(v, uint16(len(tr.other)))
+	v = append(v, tr.other...)
+	hm.Write(v)
+	return hm.Sum(nil)
+}
+
+/* marshal returns the RDATA for the record */
+func (t tsigRecord) marshal() ([]byte, error) {
+	b, err := wireName(t.algorithm)
+	if nil != err {
+		return nil, fmt.Errorf("algorithm name: %w", err)
+	}
+	b = appendUint48(b, t.timeSigned)
+	b = binary.BigEndian.AppendUint16(b, t.fudge)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(t.mac)))
+	b = append(b, t.mac...)
+	b = binary.BigEndian.AppendUint16(b, t.origID)
+	b = binary.BigEndian.AppendUint16(b, t.tsigErr)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(t.other)))
+	return append(b, t.other...), nil
+}
+
+/* unmarshalTSIG parses a TSIG record's RDATA */
+func unmarshalTSIG(b []byte) (tsigRecord, error) {
+	var t tsigRecord
+	short := errors.New("TSIG record too short")
+
+	/* Algorithm name, which had better not be compressed */
+	var labels []string
+	for {
+		if 0 == len(b) {
+			return t, short
+		}
+		l := int(b[0])
+		if 0xC0&l != 0 {
+			return t, errors.New("compressed algorithm name")
+		}
+		if len(b) < 1+l {
+			return t, short
+		}
+		if 0 == l {
+			b = b[1:]
+			break
+		}
+		labels = append(labels, string(b[1:1+l]))
+		b = b[1+l:]
+	}
+	t.algorithm = strings.Join(labels, ".") + "."
+
+	/* Fixed-length bits and the MAC */
+	if 10 > len(b) {
+		return t, short
+	}
+	t.timeSigned = uint64(binary.BigEndian.Uint16(b))<<32 |
+		uint64(binary.BigEndian.Uint32(b[2:]))
+	t.fudge = binary.BigEndian.Uint16(b[6:])
+	ml := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[10:]
+	if ml+6 > len(b) {
+		return t, short
+	}
+	t.mac = b[:ml]
+	b = b[ml:]
+	t.origID = binary.BigEndian.Uint16(b)
+	t.tsigErr = binary.BigEndian.Uint16(b[2:])
+	ol := int(binary.BigEndian.Uint16(b[4:]))
+	b = b[6:]
+	if ol != len(b) {
+		return t, errors.New("TSIG other data length mismatch")
+	}
+	t.other = b
+	return t, nil
+}
+
+/* wireName returns the lowercase, uncompressed wire format of name */
+func wireName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	var b []byte
+	if "" != name {
+		for _, l := range strings.Split(name, ".") {
+			if 0 == len(l) || 63 < len(l) {
+				return nil, fmt.Errorf("invalid label %q", l)
+			}
+			b = append(b, byte(len(l)))
+			b = append(b, l...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+/* appendUint48 appends the lower 48 bits of v to b */
+func appendUint48(b []byte, v uint64) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(v>>32))
+	return binary.BigEndian.AppendUint32(b, uint32(v))
+}
@@ -0,0 +1,153 @@
+package dnsfservget
+
+/*
+ * tsig_test.go
+ * Tests for TSIG signing and verification
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* testTSIGMessage returns a packed query or response for kittens.example.com */
+func testTSIGMessage(t *testing.T, response bool) []byte {
+	m := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 1234, Response: response},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("kittens.example.com."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	b, err := m.Pack()
+	if nil != err {
+		t.Fatalf("Packing message: %s", err)
+	}
+	return b
+}
+
+func TestTSIG(t *testing.T) {
+	k, err := ParseTSIGKey("hmac-sha256:dnsfserv:a2l0dGVucw==")
+	if nil != err {
+		t.Fatalf("ParseTSIGKey: %s", err)
+	}
+	bad, err := ParseTSIGKey("dnsfserv:cHVwcGllcw==")
+	if nil != err {
+		t.Fatalf("ParseTSIGKey: %s", err)
+	}
+
+	/* Query */
+	q, qmac, err := k.SignQuery(testTSIGMessage(t, false))
+	if nil != err {
+		t.Fatalf("SignQuery: %s", err)
+	}
+	vmac, err := k.VerifyQuery(q)
+	if nil != err {
+		t.Fatalf("VerifyQuery: %s", err)
+	}
+	if string(qmac) != string(vmac) {
+		t.Errorf("Query MAC mismatch")
+	}
+	if _, err := bad.VerifyQuery(q); !errors.Is(err, ErrTSIG) {
+		t.Errorf("Query with wrong key: got %v", err)
+	}
+	q[len(q)/2] ^= 0xff
+	if _, err := k.VerifyQuery(q); nil == err {
+		t.Errorf("Corrupted query verified")
+	}
+
+	/* Response */
+	r, err := k.SignResponse(testTSIGMessage(t, true), qmac)
+	if nil != err {
+		t.Fatalf("SignResponse: %s", err)
+	}
+	if err := k.VerifyResponse(r, qmac); nil != err {
+		t.Errorf("VerifyResponse: %s", err)
+	}
+	if err := k.VerifyResponse(r, []byte("kittens")); nil == err {
+		t.Errorf("Response verified with wrong query MAC")
+	}
+	if err := k.VerifyResponse(
+		testTSIGMessage(t, true),
+		qmac,
+	); !errors.Is(err, ErrTSIG) {
+		t.Errorf("Unsigned response: got %v", err)
+	}
+}
+
+func TestUDPQuerierTSIGSpoofed(t *testing.T) {
+	k, err := ParseTSIGKey("hmac-sha256:dnsfserv:a2l0dGVucw==")
+	if nil != err {
+		t.Fatalf("ParseTSIGKey: %s", err)
+	}
+	bad, err := ParseTSIGKey("hmac-sha256:dnsfserv:cHVwcGllcw==")
+	if nil != err {
+		t.Fatalf("ParseTSIGKey: %s", err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("ListenPacket: %s", err)
+	}
+	defer pc.Close()
+
+	/* Answer with a spoofed response, then the real one */
+	go func() {
+		buf := make([]byte, 65536)
+		n, addr, err := pc.ReadFrom(buf)
+		if nil != err {
+			return
+		}
+		qmac, err := k.VerifyQuery(buf[:n])
+		if nil != err {
+			return
+		}
+		var m dnsmessage.Message
+		if err := m.Unpack(buf[:n]); nil != err {
+			return
+		}
+		m.Response = true
+		m.Additionals = nil
+		for i, key := range []*TSIGKey{bad, k} {
+			m.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:  m.Questions[0].Name,
+					Type:  dnsmessage.TypeA,
+					Class: dnsmessage.ClassINET,
+				},
+				Body: &dnsmessage.AResource{
+					A: [4]byte{192, 0, 2, byte(i)},
+				},
+			}}
+			b, err := m.Pack()
+			if nil != err {
+				return
+			}
+			if b, err = key.SignResponse(b, qmac); nil != err {
+				return
+			}
+			pc.WriteTo(b, addr)
+		}
+	}()
+
+	q, err := UDPQuerier(UDPConfig{
+		Server: pc.LocalAddr().String(),
+		TSIG:   k,
+	})
+	if nil != err {
+		t.Fatalf("UDPQuerier: %s", err)
+	}
+	as, err := q.A("kittens.example.com")
+	if nil != err {
+		t.Fatalf("Query: %s", err)
+	}
+	if 1 != len(as) || "192.0.2.1" != as[0] {
+		t.Errorf("Got %q", as)
+	}
+}
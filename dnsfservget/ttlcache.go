@@ -0,0 +1,123 @@
+package dnsfservget
+
+/*
+ * ttlcache.go
+ * Cache answers to control queries for their TTLs
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultControlCacheSize is the number of answers a ControlCache holds if
+// NewControlCache is passed 0.
+const DefaultControlCacheSize = 64
+
+// TTLQuerier is a TypeQuerier which also returns how long an answer may be
+// cached, which is the smallest TTL of the records in the answer.  The
+// Queriers returned by UDPQuerier, DOHQuerier, SOCKS5Querier, and
+// NewStreamQuerier are TTLQueriers.
+type TTLQuerier interface {
+	TypeQuerier
+	QueryTTL(name string, qtype QType) ([]string, time.Duration, error)
+}
+
+// ControlCache caches answers to a Getter's control queries, i.e. those for
+// the file's metadata and probes, for as long as their TTLs allow, so that
+// repeated checks don't each need a query.  Queries for the file itself are
+// never cached.  Only answers from a TTLQuerier are cached.  A ControlCache
+// may be shared between Getters and its methods may be called concurrently.
+type ControlCache struct {
+	l   sync.Mutex
+	max int
+	m   map[string]controlAnswer
+}
+
+/* controlAnswer is a cached answer */
+type controlAnswer struct {
+	as      []string
+	expires time.Time
+}
+
+// NewControlCache returns a new ControlCache which holds up to max answers,
+// or DefaultControlCacheSize if max is 0.
+func NewControlCache(max int) *ControlCache {
+	if 0 >= max {
+		max = DefaultControlCacheSize
+	}
+	return &ControlCache{max: max, m: make(map[string]controlAnswer)}
+}
+
+/* get returns the unexpired cached answer for name, if there is one. */
+func (c *ControlCache) get(name string) ([]string, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	k := strings.ToLower(name)
+	a, ok := c.m[k]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(a.expires) {
+		delete(c.m, k)
+		return nil, false
+	}
+	return append([]string(nil), a.as...), true
+}
+
+/* put caches as, the answer to a query for name, for ttl.  Expired answers
+are removed to make room and, failing that, the one which expires soonest. */
+func (c *ControlCache) put(name string, as []string, ttl time.Duration) {
+	if 0 >= ttl {
+		return
+	}
+	c.l.Lock()
+	defer c.l.Unlock()
+	now := time.Now()
+	for k, a := range c.m {
+		if !now.Before(a.expires) {
+			delete(c.m, k)
+		}
+	}
+	for len(c.m) >= c.max {
+		var (
+			soonest string
+			st      time.Time
+		)
+		for k, a := range c.m {
+			if "" == soonest || a.expires.Before(st) {
+				soonest, st = k, a.expires
+			}
+		}
+		delete(c.m, soonest)
+	}
+	c.m[strings.ToLower(name)] = controlAnswer{
+		as:      append([]string(nil), as...),
+		expires: now.Add(ttl),
+	}
+}
+
+/* controlTXT makes a TXT query for the control record name with q, using
+g.ControlCache if it's set. */
+func (g *Getter) controlTXT(q Querier, name string) ([]string, error) {
+	if nil == g.ControlCache {
+		return q.TXT(name)
+	}
+	if as, ok := g.ControlCache.get(name); ok {
+		return as, nil
+	}
+	tq, ok := q.(TTLQuerier)
+	if !ok {
+		return q.TXT(name)
+	}
+	as, ttl, err := tq.QueryTTL(name, TypeTXT)
+	if nil != err {
+		return nil, err
+	}
+	g.ControlCache.put(name, as, ttl)
+	return as, nil
+}
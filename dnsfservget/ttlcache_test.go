@@ -0,0 +1,113 @@
+package dnsfservget_test
+
+/*
+ * ttlcache_test.go
+ * Tests for caching control queries
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+/* ttlCountingQuerier counts the queries made with a TTLQuerier */
+type ttlCountingQuerier struct {
+	dnsfservget.TTLQuerier
+	n atomic.Int64
+}
+
+func (c *ttlCountingQuerier) TXT(name string) ([]string, error) {
+	c.n.Add(1)
+	return c.TTLQuerier.TXT(name)
+}
+
+func (c *ttlCountingQuerier) Query(
+	name string,
+	qtype dnsfservget.QType,
+) ([]string, error) {
+	c.n.Add(1)
+	return c.TTLQuerier.Query(name, qtype)
+}
+
+func (c *ttlCountingQuerier) QueryTTL(
+	name string,
+	qtype dnsfservget.QType,
+) ([]string, time.Duration, error) {
+	c.n.Add(1)
+	return c.TTLQuerier.QueryTTL(name, qtype)
+}
+
+func TestControlCache(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens"))
+	tq, ok := q.(dnsfservget.TTLQuerier)
+	if !ok {
+		t.Fatalf("Stream querier isn't a TTLQuerier")
+	}
+
+	/* The answer's TTL should come back */
+	as, ttl, err := tq.QueryTTL(
+		dnsfservget.MetaLabel+"-payload.example.com",
+		dnsfservget.TypeTXT,
+	)
+	if nil != err || 1 != len(as) {
+		t.Fatalf("QueryTTL: %q, %s", as, err)
+	}
+	if 0 == ttl {
+		t.Errorf("No TTL")
+	}
+
+	/* Control queries should only be made once */
+	cq := &ttlCountingQuerier{TTLQuerier: tq}
+	cc := dnsfservget.NewControlCache(0)
+	g := &dnsfservget.Getter{
+		Type:         dnsfservget.TypeTXT,
+		Name:         "payload",
+		Domain:       "example.com",
+		Querier:      cq,
+		ControlCache: cc,
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := g.Meta(); nil != err {
+			t.Fatalf("Meta %d: %s", i, err)
+		}
+		if _, err := g.Stat(); nil != err {
+			t.Fatalf("Stat %d: %s", i, err)
+		}
+	}
+	if n := cq.n.Load(); 2 != n {
+		t.Errorf("Made %d control queries, want 2", n)
+	}
+
+	/* But file chunks should always be asked for */
+	var ns []int64
+	for i := 0; i < 2; i++ {
+		cq.n.Store(0)
+		g := &dnsfservget.Getter{
+			Type:         dnsfservget.TypeTXT,
+			Name:         "payload",
+			Domain:       "example.com",
+			Querier:      cq,
+			ControlCache: cc,
+			UseMeta:      true,
+		}
+		if b, err := ioutil.ReadAll(g.Get()); nil != err {
+			t.Fatalf("Get %d: %s", i, err)
+		} else if "kittens" != string(b) {
+			t.Fatalf("Get %d: got %q", i, b)
+		}
+		ns = append(ns, cq.n.Load())
+	}
+	if 0 == ns[0] || ns[0] != ns[1] {
+		t.Errorf("Made %d and then %d queries for a transfer", ns[0], ns[1])
+	}
+}
@@ -0,0 +1,28 @@
+package dnsfservget
+
+/*
+ * ttlhint.go
+ * Ask for answers' TTLs
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "strconv"
+
+// TTLHintLabel starts a label, followed by a dash and a TTL in seconds, put
+// after the nonce label, if there is one, to ask dnsfserv for answers with
+// that TTL.  dnsfserv only honors hints when started with -ttl-hint-max, and
+// clamps them to its bounds.
+const TTLHintLabel = "_t"
+
+/* ttlHintDomain returns domain with a label for the TTL hint in front of
+it, or just domain if hint is 0. */
+func ttlHintDomain(hint uint32, domain string) string {
+	if 0 == hint {
+		return domain
+	}
+	return TTLHintLabel + "-" +
+		strconv.FormatUint(uint64(hint), 10) + "." +
+		domain
+}
@@ -0,0 +1,58 @@
+package dnsfservget_test
+
+/*
+ * ttlhint_test.go
+ * Tests for asking for TTLs
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func TestGetterTTLHint(t *testing.T) {
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("kittens and puppies"))
+
+	nq := &namingQuerier{Querier: q}
+	g := dnsfservget.Getter{
+		Type:           dnsfservget.TypeA,
+		Name:           "payload",
+		Domain:         "example.com",
+		Querier:        nq,
+		UseMeta:        true,
+		Sequence:       true,
+		Nonce:          true,
+		TTLHint:        86400,
+		ControlTTLHint: 5,
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if "kittens and puppies" != string(b) {
+		t.Errorf("Got %q", b)
+	}
+
+	/* Chunks get the chunk hint, after the nonce */
+	for _, n := range nq.names {
+		ls := strings.Split(n, ".")
+		if 4 > len(ls) || dnsfservget.TTLHintLabel+"-86400" != ls[2] {
+			t.Errorf("No chunk TTL hint in %q", n)
+		}
+	}
+
+	/* Metadata gets the control hint */
+	if want := dnsfservget.MetaLabel + "-payload." +
+		dnsfservget.TTLHintLabel + "-5.example.com"; want != g.MetaName() {
+		t.Errorf("Metadata name %q, want %q", g.MetaName(), want)
+	}
+}
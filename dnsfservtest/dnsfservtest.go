@@ -0,0 +1,481 @@
+// Package dnsfservtest provides an in-memory dnsfserv for testing.
+package dnsfservtest
+
+/*
+ * dnsfservtest.go
+ * In-memory dnsfserv for testing
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* ttl is the TTL of answers */
+const ttl = 1800
+
+// Server answers DNS queries for files held in memory the same way dnsfserv
+// answers queries for files on disk, including queries for metadata and
+// checksums, probes, handshakes, and dnsfservget.Probe's checks.
+type Server struct {
+	l      sync.Mutex
+	files  map[string][]byte
+	gens   map[string]int64
+	mtimes map[string]time.Time
+	gen    int64
+	as     dnsfservget.Aliases
+	c      net.Conn
+	key    *ecdh.PrivateKey /* For handshakes, made when needed */
+	akey   []byte           /* For MACs in query names, if set */
+}
+
+// NewServer returns a new Server with no files.
+func NewServer() *Server {
+	return &Server{
+		files:  make(map[string][]byte),
+		gens:   make(map[string]int64),
+		mtimes: make(map[string]time.Time),
+	}
+}
+
+// Pair returns a Server with no files and a Querier, which is also a
+// dnsfservget.TypeQuerier, which sends queries to it in memory without using
+// any sockets.  Every part of the query and response is packed and parsed as
+// it would be with dnsfserv, but quickly and deterministically.  Queries to
+// which dnsfserv wouldn't respond get a SERVFAIL, as a resolver would return.
+// Files may be added to the Server with SetFile.  The Server's Close method
+// should be called when it's no longer needed.
+func Pair() (*Server, dnsfservget.Querier) {
+	s := NewServer()
+	sc, cc := net.Pipe()
+	s.c = sc
+	go s.serve(sc)
+	return s, dnsfservget.NewStreamQuerier(cc)
+}
+
+// SetFile sets the contents of the named file, which should be lowercase.
+// The contents must not be modified after SetFile is called.
+func (s *Server) SetFile(name string, contents []byte) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.files[name] = contents
+	s.gen++
+	s.gens[name] = s.gen
+	s.mtimes[name] = time.Now()
+}
+
+// RemoveFile removes the named file.
+func (s *Server) RemoveFile(name string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.files, name)
+	delete(s.gens, name)
+	delete(s.mtimes, name)
+}
+
+// SetAliases sets the aliases by which files may be requested, as with
+// dnsfserv's -aliases.  The aliases must not be modified after SetAliases is
+// called.
+func (s *Server) SetAliases(as dnsfservget.Aliases) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.as = as
+}
+
+// SetAuthKey sets the key with which queries for files must be authenticated,
+// as with dnsfserv's -auth-key.  Queries without a good MAC are refused.  A
+// nil key turns off authentication.
+func (s *Server) SetAuthKey(key []byte) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.akey = key
+}
+
+// Close stops the Server from answering queries from the Querier returned by
+// Pair.  It is a no-op for Servers returned by NewServer.
+func (s *Server) Close() error {
+	if nil == s.c {
+		return nil
+	}
+	return s.c.Close()
+}
+
+/* serve answers length-prefixed queries on c until c is closed. */
+func (s *Server) serve(c net.Conn) {
+	defer c.Close()
+	buf := make([]byte, 2+65535)
+	for {
+		if _, err := io.ReadFull(c, buf[:2]); nil != err {
+			return
+		}
+		l := int(binary.BigEndian.Uint16(buf))
+		if _, err := io.ReadFull(c, buf[:l]); nil != err {
+			return
+		}
+		/* dnsfserv doesn't answer what it can't, which a resolver
+		would turn into a SERVFAIL */
+		res, err := s.Answer(buf[:l])
+		if nil != err {
+			if res, err = answer.Servfail(buf[:l]); nil != err {
+				continue
+			}
+		}
+		res = append([]byte{byte(len(res) >> 8), byte(len(res))}, res...)
+		if _, err := c.Write(res); nil != err {
+			return
+		}
+	}
+}
+
+// Answer returns the response to the DNS query in q.  An error is returned
+// in cases where dnsfserv wouldn't respond.
+func (s *Server) Answer(q []byte) ([]byte, error) {
+	/* Parse the DNS query */
+	var msg dnsmessage.Message
+	if err := msg.Unpack(q); nil != err {
+		return nil, fmt.Errorf("unpacking query: %w", err)
+	}
+	msg.Header.Response = true
+	msg.Header.Authoritative = true
+	msg.Header.RecursionAvailable = false
+	msg.Header.RCode = dnsmessage.RCodeSuccess
+	if 0 == len(msg.Questions) {
+		return nil, fmt.Errorf("no questions")
+	}
+
+	/* Get the filename and offset.  Names which aren't files, as with
+	QNAME minimization, get an empty response. */
+	name := strings.ToLower(msg.Questions[0].Name.String())
+	var mac string /* Authenticates the first label */
+	al := dnsfservget.AuthLabel + "-"
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		strings.HasPrefix(ls[1], al) {
+		mac = strings.TrimPrefix(ls[1], al)
+		name = ls[0] + "." + ls[2]
+	}
+	nl := dnsfservget.NonceLabel + "-" /* Nonces are ignored */
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		strings.HasPrefix(ls[1], nl) {
+		name = ls[0] + "." + ls[2]
+	}
+	tl := dnsfservget.TTLHintLabel + "-" /* As are TTL hints */
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		strings.HasPrefix(ls[1], tl) {
+		name = ls[0] + "." + ls[2]
+	}
+	hl := dnsfservget.ShardLabel + "-" /* And shards */
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		strings.HasPrefix(ls[1], hl) {
+		name = ls[0] + "." + ls[2]
+	}
+	var seq bool /* Chunk starts with a sequence byte */
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		dnsfservget.SequenceLabel == ls[1] {
+		seq = true
+		name = ls[0] + "." + ls[2]
+	}
+	var pad bool /* TXT and NULL chunks are padded */
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		dnsfservget.PadLabel == ls[1] {
+		pad = true
+		name = ls[0] + "." + ls[2]
+	}
+	var skey []byte /* Session key, for chunks from a handshake */
+	sl := dnsfservget.SessionLabel + "-"
+	if ls := strings.SplitN(name, ".", 3); 3 == len(ls) &&
+		strings.HasPrefix(ls[1], sl) {
+		var serr error
+		if skey, serr = s.sessionKey(
+			strings.TrimPrefix(ls[1], sl),
+		); nil != serr {
+			return nil, fmt.Errorf("getting session key: %w", serr)
+		}
+		name = ls[0] + "." + ls[2]
+	}
+	parts := strings.SplitN(strings.SplitN(name, ".", 2)[0], "-", 2)
+	if dnsmessage.TypeNS == msg.Questions[0].Type || 2 != len(parts) ||
+		dnsfservget.SessionLabel == parts[0] {
+		return msg.Pack()
+	}
+	if 0 == len(parts[0]) {
+		return nil, fmt.Errorf("badly-formatted query %q", name)
+	}
+	if dnsfservget.CheckLabel == parts[0] {
+		return check(&msg, parts[1], strings.SplitN(name, ".", 2)[1])
+	}
+	s.l.Lock()
+	akey := s.akey
+	s.l.Unlock()
+	if nil != akey && dnsfservget.AuthMAC(
+		akey,
+		strings.SplitN(name, ".", 2)[0],
+	) != mac {
+		msg.Header.RCode = dnsmessage.RCodeRefused
+		return msg.Pack()
+	}
+	if dnsfservget.KeyLabel == parts[0] {
+		return s.keyAnswer(&msg)
+	}
+	var (
+		isMeta   = dnsfservget.MetaLabel == parts[0]
+		isCRC    = dnsfservget.CRCLabel == parts[0]
+		isProbe  = dnsfservget.ProbeLabel == parts[0]
+		isBigTXT = dnsfservget.BigTXTLabel == parts[0]
+		isMulti  = dnsfservget.MultiLabel == parts[0]
+		foff     uint64
+		clen     uint64
+		err      error
+	)
+	switch {
+	case isMeta, isProbe:
+	case isCRC:
+		cparts := strings.SplitN(parts[1], "-", 3)
+		if 3 != len(cparts) {
+			return nil, fmt.Errorf("badly-formatted query %q", name)
+		}
+		foff, err = strconv.ParseUint(cparts[0], 36, 64)
+		if nil == err {
+			clen, err = strconv.ParseUint(cparts[1], 36, 64)
+		}
+		if nil == err && dnsfservget.MaxCRCLen < clen {
+			err = fmt.Errorf("length %d too large", clen)
+		}
+		parts[1] = cparts[2]
+	case isBigTXT, isMulti:
+		bparts := strings.SplitN(parts[1], "-", 2)
+		if 2 != len(bparts) {
+			return nil, fmt.Errorf("badly-formatted query %q", name)
+		}
+		foff, err = strconv.ParseUint(bparts[0], 36, 64)
+		parts[1] = bparts[1]
+	default:
+		foff, err = strconv.ParseUint(parts[0], 36, 64)
+	}
+	if nil != err {
+		return nil, fmt.Errorf("parsing query %q: %w", name, err)
+	}
+
+	/* Get the file */
+	s.l.Lock()
+	fname := s.as.File(parts[1])
+	f, ok := s.files[fname]
+	gen := s.gens[fname]
+	mtime := s.mtimes[fname]
+	s.l.Unlock()
+	if isProbe && dnsmessage.TypeTXT == msg.Questions[0].Type {
+		txt := answer.NoFileTXT
+		if ok {
+			txt = answer.ProbeTXT(int64(len(f)), mtime.Unix(), gen)
+		}
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name:  msg.Questions[0].Name,
+				Type:  msg.Questions[0].Type,
+				Class: msg.Questions[0].Class,
+				TTL:   ttl,
+			},
+			Body: &dnsmessage.TXTResource{TXT: []string{txt}},
+		})
+		return msg.Pack()
+	}
+	if !ok {
+		return nil, fmt.Errorf("no file %q", parts[1])
+	}
+
+	/* Work out the answer */
+	rr := dnsmessage.Resource{Header: dnsmessage.ResourceHeader{
+		Name:  msg.Questions[0].Name,
+		Type:  msg.Questions[0].Type,
+		Class: msg.Questions[0].Class,
+		TTL:   ttl,
+	}}
+	switch {
+	case isMeta && dnsmessage.TypeTXT == rr.Header.Type:
+		sum := sha256.Sum256(f)
+		rr.Body = &dnsmessage.TXTResource{TXT: []string{
+			answer.MetaTXT(int64(len(f)), sum[:], gen),
+		}}
+		msg.Answers = append(msg.Answers, rr)
+		return msg.Pack()
+	case isCRC && dnsmessage.TypeTXT == rr.Header.Type:
+		b := make([]byte, clen)
+		if foff < uint64(len(f)) {
+			copy(b, f[foff:])
+		}
+		rr.Body = &dnsmessage.TXTResource{TXT: []string{
+			answer.CRCTXT(crc32.ChecksumIEEE(b)),
+		}}
+		msg.Answers = append(msg.Answers, rr)
+		return msg.Pack()
+	case isMeta || isCRC || isProbe:
+		return nil, fmt.Errorf("unsupported metadata query type")
+	case isBigTXT && dnsmessage.TypeTXT != rr.Header.Type,
+		isMulti && dnsmessage.TypeA != rr.Header.Type &&
+			dnsmessage.TypeAAAA != rr.Header.Type:
+		/* Not served, so no answer */
+		return msg.Pack()
+	case foff >= uint64(len(f)):
+		msg.RCode = dnsmessage.RCodeNameError
+		return msg.Pack()
+	}
+
+	/* Encode the chunk the same way dnsfserv does */
+	ab := answer.Builder{
+		QType: rr.Header.Type,
+		Zone:  strings.SplitN(name, ".", 2)[1],
+		Off:   foff,
+		SKey:  skey,
+		SName: parts[1],
+		Seq:   seq,
+		Pad:   pad && answer.Padded(rr.Header.Type),
+	}
+	csize := answer.ChunkSize(rr.Header.Type)
+	switch {
+	case isBigTXT:
+		csize = answer.BigTXTMax
+		ab.Max = answer.BigTXTMax
+	case isMulti:
+		csize *= dnsfservget.MultiAnswers
+		ab.Multi = true
+	}
+	if seq && 1 < csize {
+		csize--
+	}
+	if ab.Pad && 1 < csize {
+		csize--
+	}
+	end := foff + csize
+	if uint64(len(f)) < end {
+		end = uint64(len(f))
+	}
+	bodies, _, err := ab.Build(f[foff:end], answer.MaxBudget)
+	if nil != err {
+		return nil, fmt.Errorf("encoding chunk: %w", err)
+	}
+	for _, body := range bodies {
+		rr.Body = body
+		msg.Answers = append(msg.Answers, rr)
+	}
+
+	return msg.Pack()
+}
+
+/* check returns the response to the dnsfservget.Probe query in msg.  The
+query's name after the label is in arg and names holding data are in zone. */
+func check(msg *dnsmessage.Message, arg, zone string) ([]byte, error) {
+	parts := strings.SplitN(arg, "-", 2)
+	if "nx" == parts[0] {
+		msg.RCode = dnsmessage.RCodeNameError
+		return msg.Pack()
+	}
+	size, err := strconv.ParseUint(parts[0], 36, 0)
+	if nil != err {
+		return nil, fmt.Errorf("parsing check size: %w", err)
+	}
+	if dnsfservget.MaxCheckSize < size {
+		return nil, fmt.Errorf("check size %d too large", size)
+	}
+	p := dnsfservget.CheckPattern(uint(size))
+
+	/* Encode it like a file chunk, but with as much in TXT records as was
+	asked for */
+	ab := answer.Builder{QType: msg.Questions[0].Type, Zone: zone}
+	max := answer.ChunkSize(ab.QType)
+	if 0 == max {
+		return msg.Pack()
+	}
+	if dnsmessage.TypeTXT != ab.QType && max < uint64(len(p)) {
+		p = p[:max]
+	}
+	body, err := ab.Record(p, 0)
+	if nil != err {
+		return nil, err
+	}
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+		},
+		Body: body,
+	})
+	return msg.Pack()
+}
+
+/* serverKey returns s's X25519 key, making it if it doesn't exist */
+func (s *Server) serverKey() (*ecdh.PrivateKey, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if nil == s.key {
+		var err error
+		if s.key, err = ecdh.X25519().GenerateKey(rand.Reader); nil != err {
+			return nil, err
+		}
+	}
+	return s.key, nil
+}
+
+/* keyAnswer returns the response to the query in msg for s's public key. */
+func (s *Server) keyAnswer(msg *dnsmessage.Message) ([]byte, error) {
+	if dnsmessage.TypeTXT != msg.Questions[0].Type {
+		return msg.Pack()
+	}
+	k, err := s.serverKey()
+	if nil != err {
+		return nil, fmt.Errorf("getting key: %w", err)
+	}
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{
+			answer.KeyTXT(k.PublicKey().Bytes()),
+		}},
+	})
+	return msg.Pack()
+}
+
+/* sessionKey works out the session key for the client with the
+base32-encoded public key ck. */
+func (s *Server) sessionKey(ck string) ([]byte, error) {
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(
+		strings.ToUpper(ck),
+	)
+	if nil != err {
+		return nil, fmt.Errorf("decoding client key: %w", err)
+	}
+	cpub, err := ecdh.X25519().NewPublicKey(b)
+	if nil != err {
+		return nil, fmt.Errorf("parsing client key: %w", err)
+	}
+	k, err := s.serverKey()
+	if nil != err {
+		return nil, fmt.Errorf("getting key: %w", err)
+	}
+	shared, err := k.ECDH(cpub)
+	if nil != err {
+		return nil, fmt.Errorf("computing shared secret: %w", err)
+	}
+	return dnsfservget.SessionKey(shared, k.PublicKey().Bytes(), b), nil
+}
+
@@ -0,0 +1,50 @@
+package dnsfservtest_test
+
+/*
+ * example_test.go
+ * Example of using Pair
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/dnsfservtest"
+)
+
+func ExamplePair() {
+	/* Serve a file in memory */
+	s, q := dnsfservtest.Pair()
+	defer s.Close()
+	s.SetFile("payload", []byte("Hello, World!"))
+
+	/* Get it with each record type */
+	for _, qt := range []dnsfservget.QType{
+		dnsfservget.TypeA,
+		dnsfservget.TypeAAAA,
+		dnsfservget.TypeTXT,
+	} {
+		g := dnsfservget.Getter{
+			Type:    qt,
+			Name:    "payload",
+			Domain:  "example.com",
+			Querier: q,
+			UseMeta: true,
+		}
+		b, err := ioutil.ReadAll(g.Get())
+		if nil != err {
+			log.Fatalf("Get: %s", err)
+		}
+		fmt.Printf("%s: %s\n", qt, b)
+	}
+
+	// Output:
+	// A: Hello, World!
+	// AAAA: Hello, World!
+	// TXT: Hello, World!
+}
@@ -0,0 +1,245 @@
+package main
+
+/*
+ * doh.go
+ * Serve queries over DNS over HTTPS (RFC 8484)
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+)
+
+const (
+	/* dohPath is the path at which DoH queries are served */
+	dohPath = "/dns-query"
+
+	/* dohContentType is the content type of DoH queries and responses */
+	dohContentType = "application/dns-message"
+
+	/* dohStreamPath is the path at which DoH streams are served, with
+	-doh-stream */
+	dohStreamPath = dnsfservget.DOHStreamPath
+
+	/* dohStreamIdleTimeout is how long a DoH stream may sit idle before
+	we end it.  This is longer than for TCP, as the client may well be
+	pacing its queries. */
+	dohStreamIdleTimeout = time.Minute
+)
+
+/* dohStream is set by -doh-stream to serve DoH streams */
+var dohStream bool
+
+/* captureResponder is a responder which holds on to the last message written
+to it, so handle can answer queries which came in over HTTP. */
+type captureResponder struct {
+	b []byte
+}
+
+/* WriteTo implements responder.WriteTo.  The address is ignored. */
+func (c *captureResponder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.b = append(c.b[:0], b...)
+	return len(b), nil
+}
+
+/* serveDoH serves DoH queries on addr, with TLS if cert and key name a
+certificate and key file.  It never returns. */
+func serveDoH(addr, cert, key string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohPath, handleDoH)
+	if dohStream {
+		mux.HandleFunc(dohStreamPath, handleDoHStream)
+	}
+	var err error
+	if "" != cert {
+		err = http.ListenAndServeTLS(addr, cert, key, mux)
+	} else {
+		err = http.ListenAndServe(addr, mux)
+	}
+	log.Fatalf("Error serving DoH on %s: %s", addr, err)
+}
+
+/* handleDoH answers a DoH query sent either as a POST body or a GET
+parameter. */
+func handleDoH(w http.ResponseWriter, r *http.Request) {
+	/* Work out who's asking */
+	addr := requestAddr(r)
+
+	/* Get the query */
+	buf := bufpool.Get().([]byte)
+	defer bufpool.Put(buf)
+	var n int
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query().Get("dns")
+		if base64.RawURLEncoding.DecodedLen(len(q)) > len(buf) {
+			http.Error(
+				w,
+				"query too large",
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+		var err error
+		if n, err = base64.RawURLEncoding.Decode(
+			buf,
+			[]byte(q),
+		); nil != err {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		/* Not everybody bothers with a Content-Type */
+		ct := r.Header.Get("Content-Type")
+		if mt, _, err := mime.ParseMediaType(ct); "" != ct &&
+			(nil != err || dohContentType != mt) {
+			http.Error(
+				w,
+				"unsupported content type",
+				http.StatusUnsupportedMediaType,
+			)
+			return
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(len(buf)+1)))
+		if nil != err {
+			http.Error(w, "error reading query", http.StatusBadRequest)
+			return
+		}
+		if len(buf) < len(b) {
+			http.Error(
+				w,
+				"query too large",
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+		n = copy(buf, b)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if 0 == n {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+
+	/* Answer it like any other query.  If we'd not answer, a resolver
+	would send back a SERVFAIL. */
+	var pc captureResponder
+	handle(&pc, addr, buf, n)
+	if nil == pc.b {
+		var err error
+		if pc.b, err = answer.Servfail(buf[:n]); nil != err {
+			http.Error(w, "invalid query", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", dohContentType)
+	w.Header().Set(
+		"Cache-Control",
+		fmt.Sprintf("max-age=%d", currentSettings().ttl),
+	)
+	if _, err := w.Write(pc.b); nil != err {
+		log.Printf("[%s] Error sending DoH response: %s", logAddr(addr), err)
+	}
+}
+
+/* requestAddr returns the address of the client which sent r. */
+func requestAddr(r *http.Request) net.Addr {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); nil == err {
+		return net.TCPAddrFromAddrPort(ap)
+	}
+	return &net.TCPAddr{}
+}
+
+/* handleDoHStream answers length-prefixed queries, as with DNS over TCP,
+sent in the body of a long-lived POST request with length-prefixed responses
+in the response body, until the client ends the request or lets it sit idle
+too long.  This only really works over HTTP/2. */
+func handleDoHStream(w http.ResponseWriter, r *http.Request) {
+	if http.MethodPost != r.Method {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	addr := requestAddr(r)
+	la := logAddr(addr)
+
+	/* Let the client know we're ready.  HTTP/2 is always full-duplex, so
+	an error enabling it is fine. */
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", dohContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); nil != err {
+		log.Printf("[%s] Error starting DoH stream: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Started DoH stream", la)
+
+	buf := bufpool.Get().([]byte)
+	defer bufpool.Put(buf)
+	var (
+		pc captureResponder
+		nq int
+	)
+	defer func() { log.Printf("[%s] Ended DoH stream after %d queries", la, nq) }()
+	for {
+		/* Get a query */
+		rc.SetReadDeadline(time.Now().Add(dohStreamIdleTimeout))
+		if _, err := io.ReadFull(r.Body, buf[:2]); nil != err {
+			return
+		}
+		n := int(binary.BigEndian.Uint16(buf))
+		if 0 == n || len(buf) < n {
+			log.Printf("[%s] Got %d byte query in DoH stream", la, n)
+			return
+		}
+		if _, err := io.ReadFull(r.Body, buf[:n]); nil != err {
+			return
+		}
+		nq++
+
+		/* Answer it, or at least tell the client we won't */
+		pc.b = pc.b[:0]
+		handle(&pc, addr, buf, n)
+		if 0 == len(pc.b) {
+			var err error
+			if pc.b, err = answer.Servfail(buf[:n]); nil != err {
+				log.Printf(
+					"[%s] Invalid query in DoH stream: %s",
+					la,
+					err,
+				)
+				return
+			}
+		}
+		m := make([]byte, 2, 2+len(pc.b))
+		binary.BigEndian.PutUint16(m, uint16(len(pc.b)))
+		if _, err := w.Write(append(m, pc.b...)); nil != err {
+			log.Printf("[%s] Error sending DoH response: %s", la, err)
+			return
+		}
+		if err := rc.Flush(); nil != err {
+			log.Printf("[%s] Error flushing DoH response: %s", la, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+/*
+ * doh_test.go
+ * Tests for DNS over HTTPS
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleDoH(t *testing.T) {
+	contents := testServe(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohPath, handleDoH)
+	hs := httptest.NewServer(mux)
+	defer hs.Close()
+
+	/* Get the file with POSTs */
+	g := dnsfservget.Getter{
+		Type:   dnsfservget.TypeTXT,
+		Name:   "payload",
+		Domain: "files.example.com",
+		Querier: dnsfservget.DOHQuerier(dnsfservget.DOHConfig{
+			URL: hs.URL + dohPath,
+		}),
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if string(contents) != string(b) {
+		t.Errorf("Got %q, want %q", b, contents)
+	}
+
+	/* And a GET */
+	q := testMessage("0-payload.files.example.com.", dnsmessage.TypeA)
+	qb, err := q.Pack()
+	if nil != err {
+		t.Fatalf("Packing query: %s", err)
+	}
+	res, err := http.Get(
+		hs.URL + dohPath + "?dns=" + base64.RawURLEncoding.EncodeToString(qb),
+	)
+	if nil != err {
+		t.Fatalf("GET: %s", err)
+	}
+	defer res.Body.Close()
+	if dohContentType != res.Header.Get("Content-Type") {
+		t.Errorf("Content-Type %q", res.Header.Get("Content-Type"))
+	}
+	rb, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		t.Fatalf("Reading response: %s", err)
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(rb); nil != err {
+		t.Fatalf("Unpacking response: %s", err)
+	}
+	if 1 != len(m.Answers) {
+		t.Errorf("Got %d answers to GET", len(m.Answers))
+	}
+
+	/* Garbage gets an error */
+	if res, err := http.Get(hs.URL + dohPath + "?dns=kittens"); nil != err {
+		t.Errorf("GET with bad query: %s", err)
+	} else if res.Body.Close(); http.StatusOK == res.StatusCode {
+		t.Errorf("Bad query got a 200")
+	}
+}
+
+func TestHandleDoHStream(t *testing.T) {
+	contents := testServe(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohStreamPath, handleDoHStream)
+	hs := httptest.NewUnstartedServer(mux)
+	hs.EnableHTTP2 = true
+	hs.StartTLS()
+	defer hs.Close()
+
+	/* Get the file over a single stream */
+	st, err := dnsfservget.DialDOHStream(
+		hs.Client().Do,
+		hs.URL+dohStreamPath,
+		nil,
+	)
+	if nil != err {
+		t.Fatalf("Dialing stream: %s", err)
+	}
+	defer st.Close()
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeTXT,
+		Name:    "payload",
+		Domain:  "files.example.com",
+		Querier: dnsfservget.NewStreamQuerier(st),
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if string(contents) != string(b) {
+		t.Errorf("Got %q, want %q", b, contents)
+	}
+
+	/* Streams need a POST */
+	res, err := hs.Client().Get(hs.URL + dohStreamPath)
+	if nil != err {
+		t.Fatalf("GET: %s", err)
+	}
+	res.Body.Close()
+	if http.StatusMethodNotAllowed != res.StatusCode {
+		t.Errorf("GET got a %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+/*
+ * doq.go
+ * Serve DNS over QUIC
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"github.com/quic-go/quic-go"
+)
+
+/* doqALPN is the ALPN token for DoQ, from RFC 9250 */
+const doqALPN = "doq"
+
+/* DoQ error codes, from RFC 9250 */
+const (
+	doqNoError       = 0x0
+	doqInternalError = 0x1
+	doqProtocolError = 0x2
+)
+
+/* listenDoQ listens for DoQ connections on addr, using cert for TLS. */
+func listenDoQ(addr string, cert tls.Certificate) (*quic.Listener, error) {
+	return quic.ListenAddr(addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{doqALPN},
+		MinVersion:   tls.VersionTLS13,
+	}, &quic.Config{
+		MaxIdleTimeout: tcpIdleTimeout,
+	})
+}
+
+/* serveDoQ accepts connections on l and answers the queries sent on them.  It
+never returns. */
+func serveDoQ(l *quic.Listener) {
+	for {
+		c, err := l.Accept(context.Background())
+		if nil != err {
+			log.Fatalf("Accepting DoQ connection: %s", err)
+		}
+		go handleDoQ(c)
+	}
+}
+
+/* handleDoQ answers the queries sent on c's streams, one per stream, until c
+is closed. */
+func handleDoQ(c *quic.Conn) {
+	for {
+		s, err := c.AcceptStream(context.Background())
+		if nil != err {
+			return
+		}
+		go func() {
+			if err := handleDoQStream(c, s); nil != err {
+				log.Printf(
+					"[%s] DoQ protocol error: %s",
+					logAddr(c.RemoteAddr()),
+					err,
+				)
+				c.CloseWithError(doqProtocolError, err.Error())
+			}
+		}()
+	}
+}
+
+/* handleDoQStream answers the single length-prefixed query sent on s, which
+was accepted on c.  Errors returned by handleDoQStream are protocol errors
+which should close c. */
+func handleDoQStream(c *quic.Conn, s *quic.Stream) error {
+	defer s.Close()
+	if err := s.SetDeadline(time.Now().Add(tcpIdleTimeout)); nil != err {
+		s.CancelRead(doqInternalError)
+		return nil
+	}
+
+	/* Get the query */
+	buf := bufpool.Get().([]byte)
+	defer bufpool.Put(buf)
+	if _, err := io.ReadFull(s, buf[:2]); nil != err {
+		s.CancelRead(doqNoError)
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if 0 == n || len(buf) < n {
+		return errors.New("bad query length")
+	}
+	if _, err := io.ReadFull(s, buf[:n]); nil != err {
+		s.CancelRead(doqNoError)
+		return nil
+	}
+	if 2 > n || 0 != buf[0] || 0 != buf[1] {
+		return errors.New("non-zero message ID")
+	}
+
+	/* Answer it like any other query.  If we'd not answer, a resolver
+	would send back a SERVFAIL. */
+	var pc captureResponder
+	handle(&pc, c.RemoteAddr(), buf, n)
+	if nil == pc.b {
+		var err error
+		if pc.b, err = answer.Servfail(buf[:n]); nil != err {
+			return errors.New("invalid query")
+		}
+	}
+	res := make([]byte, 2+len(pc.b))
+	binary.BigEndian.PutUint16(res, uint16(len(pc.b)))
+	copy(res[2:], pc.b)
+	if _, err := s.Write(res); nil != err {
+		log.Printf(
+			"[%s] Error sending DoQ response: %s",
+			logAddr(c.RemoteAddr()),
+			err,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+/*
+ * doq_test.go
+ * Tests for DNS over QUIC
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServeDoQ(t *testing.T) {
+	contents := testServe(t)
+
+	/* Borrow a certificate from httptest */
+	hs := httptest.NewTLSServer(nil)
+	hs.Close()
+	l, err := listenDoQ("127.0.0.1:0", hs.TLS.Certificates[0])
+	if nil != err {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept(context.Background())
+			if nil != err {
+				return
+			}
+			go handleDoQ(c)
+		}
+	}()
+	roots := x509.NewCertPool()
+	roots.AddCert(hs.Certificate())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	/* exchange sends q on a new stream on c and returns the response */
+	exchange := func(c *quic.Conn, q dnsmessage.Message) ([]byte, error) {
+		t.Helper()
+		b, err := q.AppendPack(make([]byte, 2, netbuflen))
+		if nil != err {
+			t.Fatalf("Packing query: %s", err)
+		}
+		binary.BigEndian.PutUint16(b, uint16(len(b)-2))
+		s, err := c.OpenStreamSync(ctx)
+		if nil != err {
+			t.Fatalf("Opening stream: %s", err)
+		}
+		if _, err := s.Write(b); nil != err {
+			t.Fatalf("Sending query: %s", err)
+		}
+		s.Close()
+		s.SetDeadline(time.Now().Add(time.Second))
+		return io.ReadAll(s)
+	}
+	dial := func() *quic.Conn {
+		t.Helper()
+		c, err := quic.DialAddr(ctx, l.Addr().String(), &tls.Config{
+			RootCAs:    roots,
+			ServerName: "example.com",
+			NextProtos: []string{doqALPN},
+		}, nil)
+		if nil != err {
+			t.Fatalf("Dial: %s", err)
+		}
+		return c
+	}
+
+	/* A query with an ID of 0 should get an answer */
+	c := dial()
+	defer c.CloseWithError(doqNoError, "")
+	q := testMessage("0-payload.files.example.com.", dnsmessage.TypeTXT)
+	q.ID = 0
+	b, err := exchange(c, q)
+	if nil != err {
+		t.Fatalf("Exchange: %s", err)
+	}
+	if 2 > len(b) || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		t.Fatalf("Bad response framing: %02x", b)
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(b[2:]); nil != err {
+		t.Fatalf("Unpacking response: %s", err)
+	}
+	if 1 != len(m.Answers) {
+		t.Fatalf("Got %d answers", len(m.Answers))
+	}
+	txt, ok := m.Answers[0].Body.(*dnsmessage.TXTResource)
+	if !ok || 1 != len(txt.TXT) {
+		t.Fatalf("Unexpected answer %v", m.Answers[0].Body)
+	}
+	if want := base64.RawStdEncoding.EncodeToString(
+		contents,
+	); want != txt.TXT[0] {
+		t.Errorf("Got %q, want %q", txt.TXT[0], want)
+	}
+
+	/* Anything else is a protocol error */
+	c = dial()
+	defer c.CloseWithError(doqNoError, "")
+	q.ID = 1234
+	if b, err := exchange(c, q); nil == err {
+		t.Errorf("No error with non-zero ID, got %02x", b)
+	}
+}
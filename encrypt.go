@@ -0,0 +1,156 @@
+package main
+
+/*
+ * encrypt.go
+ * Encrypt a file to serve
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* passphraseEnv is the environment variable from which the encrypt command
+reads the passphrase if it's not given with -passphrase */
+const passphraseEnv = "DNSFSERV_PASSPHRASE"
+
+/* encryptMain encrypts a file with a passphrase for retrieval with a Getter
+with a Passphrase.  It is called with the arguments after "encrypt" on the
+command line. */
+func encryptMain(args []string) {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	var (
+		in = fs.String(
+			"in",
+			"",
+			"Plaintext `file`",
+		)
+		out = fs.String(
+			"out",
+			"",
+			"Encrypted output `file`, normally in the served directory",
+		)
+		passphrase = fs.String(
+			"passphrase",
+			"",
+			"Encryption `passphrase` (default $"+passphraseEnv+")",
+		)
+		envKey = fs.String(
+			"env-key",
+			"",
+			"Optional comma-separated `attributes` of the target "+
+				"host (e.g. hostname=web1,domain=corp.local) "+
+				"to which to key the passphrase",
+		)
+		kdf = fs.String(
+			"kdf",
+			"argon2id",
+			"Key derivation `function`, argon2id or scrypt",
+		)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v encrypt [options]
+
+Encrypts a file with a key derived from a passphrase.  The passphrase must be
+given to the Getter, or stager, which retrieves the file.  With -env-key, the
+key is also derived from the target host's attributes, and the file will only
+decrypt on a host with those attributes.  The stager must be built with the
+attributes' names.
+
+Options:
+`,
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	/* Make sure we have what we need */
+	if "" == *in || "" == *out {
+		log.Fatalf("Need an input file (-in) and output file (-out)")
+	}
+	if "" == *passphrase {
+		*passphrase = os.Getenv(passphraseEnv)
+	}
+	if "" == *passphrase && "" == *envKey {
+		log.Fatalf(
+			"Need a passphrase (-passphrase or $%s) or "+
+				"host attributes (-env-key)",
+			passphraseEnv,
+		)
+	}
+	if "" != *envKey {
+		attrs, err := parseEnvKey(*envKey)
+		if nil != err {
+			log.Fatalf("Error parsing host attributes: %s", err)
+		}
+		*passphrase = dnsfservget.EnvPassphrase(*passphrase, attrs)
+	}
+	var params dnsfservget.KDFParams
+	switch *kdf {
+	case "argon2id":
+		params = dnsfservget.DefaultArgon2idParams
+	case "scrypt":
+		params = dnsfservget.DefaultScryptParams
+	default:
+		log.Fatalf("Unknown KDF %q", *kdf)
+	}
+
+	/* Encrypt the file */
+	inf, err := os.Open(*in)
+	if nil != err {
+		log.Fatalf("Error opening %s: %s", *in, err)
+	}
+	defer inf.Close()
+	outf, err := os.Create(*out)
+	if nil != err {
+		log.Fatalf("Error creating %s: %s", *out, err)
+	}
+	enc, err := dnsfservget.NewEncrypter(outf, *passphrase, params)
+	if nil != err {
+		log.Fatalf("Error starting encryption: %s", err)
+	}
+	n, err := io.Copy(enc, inf)
+	if nil != err {
+		log.Fatalf("Error encrypting %s: %s", *in, err)
+	}
+	if err := enc.Close(); nil != err {
+		log.Fatalf("Error finishing encryption: %s", err)
+	}
+	if err := outf.Close(); nil != err {
+		log.Fatalf("Error closing %s: %s", *out, err)
+	}
+	log.Printf("Encrypted %d bytes from %s to %s", n, *in, *out)
+}
+
+/* parseEnvKey parses a comma-separated list of name=value host attributes. */
+func parseEnvKey(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(s, ",") {
+		parts := strings.SplitN(a, "=", 2)
+		if 2 != len(parts) || "" == parts[1] {
+			return nil, fmt.Errorf("invalid attribute %q", a)
+		}
+		n := strings.ToLower(strings.TrimSpace(parts[0]))
+		switch n {
+		case dnsfservget.EnvHostname,
+			dnsfservget.EnvDomain,
+			dnsfservget.EnvMachineGUID:
+		default:
+			return nil, fmt.Errorf("unknown attribute %q", n)
+		}
+		attrs[n] = parts[1]
+	}
+	return attrs, nil
+}
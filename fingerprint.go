@@ -0,0 +1,189 @@
+package main
+
+/*
+ * fingerprint.go
+ * Passively fingerprint resolvers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* fpIdle is how long a transfer may go without queries before its
+fingerprint is logged and forgotten */
+const fpIdle = 5 * time.Minute
+
+/* fpKey identifies a transfer */
+type fpKey struct {
+	host  string /* Resolver's address, without port */
+	fname string
+}
+
+/* fingerprint describes the queries a resolver made for a file */
+type fingerprint struct {
+	la        string /* Resolver's address, for logging */
+	last      time.Time
+	queries   int
+	ednsSizes map[uint16]int /* 0 for no EDNS */
+	do        int            /* DNSSEC OK bit set */
+	mixedCase int            /* 0x20 */
+	ports     map[int]struct{}
+	minPort   int
+	maxPort   int
+}
+
+/* String returns fp as a string suitable for logging */
+func (fp *fingerprint) String() string {
+	/* EDNS sizes, most common first */
+	var sizes []uint16
+	for s := range fp.ednsSizes {
+		sizes = append(sizes, s)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		return fp.ednsSizes[sizes[i]] > fp.ednsSizes[sizes[j]]
+	})
+	ss := make([]string, len(sizes))
+	for i, s := range sizes {
+		if 0 == s {
+			ss[i] = "none"
+			continue
+		}
+		ss[i] = strconv.Itoa(int(s))
+	}
+
+	return fmt.Sprintf(
+		"queries=%d edns=%s do=%d/%d 0x20=%d/%d ports=%d(%d-%d)",
+		fp.queries,
+		strings.Join(ss, ","),
+		fp.do, fp.queries,
+		fp.mixedCase, fp.queries,
+		len(fp.ports),
+		fp.minPort,
+		fp.maxPort,
+	)
+}
+
+/* fingerprints tracks the fingerprints of ongoing transfers */
+type fingerprints struct {
+	l         sync.Mutex
+	m         map[fpKey]*fingerprint
+	lastSweep time.Time
+}
+
+/* fps holds fingerprints if -fingerprint is given */
+var fps *fingerprints
+
+/* observe notes the characteristics of the query in msg for fname sent from
+addr. */
+func (f *fingerprints) observe(
+	addr net.Addr,
+	fname string,
+	msg *dnsmessage.Message,
+) {
+	host, port := addr.String(), 0
+	if h, p, err := net.SplitHostPort(host); nil == err {
+		host = h
+		port, _ = strconv.Atoi(p)
+	}
+	k := fpKey{host: host, fname: fname}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	/* Forget about anything which has stopped */
+	now := time.Now()
+	if now.Sub(f.lastSweep) > fpIdle {
+		f.sweep(now)
+		f.lastSweep = now
+	}
+
+	fp, ok := f.m[k]
+	if !ok {
+		fp = &fingerprint{
+			la:        logAddr(addr),
+			ednsSizes: make(map[uint16]int),
+			ports:     make(map[int]struct{}),
+			minPort:   port,
+			maxPort:   port,
+		}
+		f.m[k] = fp
+	}
+	fp.last = now
+	fp.queries++
+
+	/* EDNS0 UDP size and DO bit */
+	var size uint16
+	for _, a := range msg.Additionals {
+		if dnsmessage.TypeOPT != a.Header.Type {
+			continue
+		}
+		size = uint16(a.Header.Class)
+		if a.Header.DNSSECAllowed() {
+			fp.do++
+		}
+		break
+	}
+	fp.ednsSizes[size]++
+
+	/* Randomized case */
+	if n := msg.Questions[0].Name.String(); n != strings.ToLower(n) {
+		fp.mixedCase++
+	}
+
+	/* Source ports */
+	fp.ports[port] = struct{}{}
+	if port < fp.minPort {
+		fp.minPort = port
+	}
+	if port > fp.maxPort {
+		fp.maxPort = port
+	}
+}
+
+/* finish logs and forgets the fingerprint for the transfer of fname to
+addr, if there is one. */
+func (f *fingerprints) finish(addr net.Addr, fname string) {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	k := fpKey{host: host, fname: fname}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+	fp, ok := f.m[k]
+	if !ok {
+		return
+	}
+	delete(f.m, k)
+	log.Printf("[%s] Resolver fingerprint for %s: %s", fp.la, fname, fp)
+}
+
+/* sweep logs and forgets the fingerprints of transfers which haven't seen a
+query in fpIdle.  f.l must be held. */
+func (f *fingerprints) sweep(now time.Time) {
+	for k, fp := range f.m {
+		if now.Sub(fp.last) <= fpIdle {
+			continue
+		}
+		delete(f.m, k)
+		log.Printf(
+			"[%s] Resolver fingerprint for unfinished %s: %s",
+			fp.la,
+			k.fname,
+			fp,
+		)
+	}
+}
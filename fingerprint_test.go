@@ -0,0 +1,99 @@
+package main
+
+/*
+ * fingerprint_test.go
+ * Tests for resolver fingerprinting
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestFingerprints(t *testing.T) {
+	var lb bytes.Buffer
+	log.SetOutput(&lb)
+	defer log.SetOutput(os.Stdout)
+	f := &fingerprints{m: make(map[fpKey]*fingerprint)}
+
+	/* Note a few queries from a couple of resolvers */
+	query := func(ip string, port int, name string, edns, do bool) {
+		t.Helper()
+		msg := &dnsmessage.Message{Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}}}
+		if edns {
+			var rh dnsmessage.ResourceHeader
+			if err := rh.SetEDNS0(
+				1232,
+				dnsmessage.RCodeSuccess,
+				do,
+			); nil != err {
+				t.Fatalf("SetEDNS0: %s", err)
+			}
+			msg.Additionals = []dnsmessage.Resource{{
+				Header: rh,
+				Body:   &dnsmessage.OPTResource{},
+			}}
+		}
+		f.observe(
+			&net.UDPAddr{IP: net.ParseIP(ip), Port: port},
+			"payload",
+			msg,
+		)
+	}
+	query("192.0.2.1", 1000, "0-payload.files.example.com.", true, true)
+	query("192.0.2.1", 2000, "3-PayLoad.files.example.com.", true, false)
+	query("192.0.2.1", 3000, "6-payload.FILES.example.com.", false, false)
+	query("192.0.2.1", 1000, "9-payload.files.example.com.", true, true)
+	query("192.0.2.2", 53, "0-payload.files.example.com.", false, false)
+	if 2 != len(f.m) {
+		t.Fatalf("Got %d fingerprints, want 2", len(f.m))
+	}
+
+	/* Finishing should log the fingerprint, whatever the port */
+	f.finish(
+		&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 9999},
+		"payload",
+	)
+	want := "Resolver fingerprint for payload: queries=4 edns=1232,none " +
+		"do=2/4 0x20=2/4 ports=3(1000-3000)\n"
+	if got := lb.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("Finish logged %q, want %q", got, want)
+	}
+	if 1 != len(f.m) {
+		t.Errorf("%d fingerprints left after finish, want 1", len(f.m))
+	}
+	lb.Reset()
+	f.finish(&net.UDPAddr{IP: net.ParseIP("192.0.2.3"), Port: 53}, "payload")
+	if 0 != lb.Len() {
+		t.Errorf("Finishing an unknown transfer logged %q", lb.String())
+	}
+
+	/* Idle transfers should be forgotten */
+	f.m[fpKey{host: "192.0.2.2", fname: "payload"}].last = time.Now().Add(
+		-2 * fpIdle,
+	)
+	f.lastSweep = time.Time{}
+	query("192.0.2.3", 53, "0-payload.files.example.com.", false, false)
+	want = "Resolver fingerprint for unfinished payload: queries=1 " +
+		"edns=none do=0/1 0x20=0/1 ports=1(53-53)\n"
+	if got := lb.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("Sweep logged %q, want %q", got, want)
+	}
+	if _, ok := f.m[fpKey{host: "192.0.2.2", fname: "payload"}]; ok {
+		t.Errorf("Idle fingerprint not forgotten")
+	}
+}
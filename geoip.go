@@ -0,0 +1,225 @@
+package main
+
+/*
+ * geoip.go
+ * Decide what to do with queries based on where they come from
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+/* geoAction is what to do with a query from a particular place */
+type geoAction int
+
+/* Things we can do with a query */
+const (
+	geoServe  geoAction = iota /* Serve the file */
+	geoRefuse                  /* Send back a REFUSED */
+	geoDecoy                   /* Serve a decoy file */
+)
+
+/* geoActions maps the names of actions in policies to actions */
+var geoActions = map[string]geoAction{
+	"serve":  geoServe,
+	"refuse": geoRefuse,
+	"decoy":  geoDecoy,
+}
+
+/* String implements fmt.Stringer */
+func (a geoAction) String() string {
+	for k, v := range geoActions {
+		if v == a {
+			return k
+		}
+	}
+	return fmt.Sprintf("geoAction(%d)", int(a))
+}
+
+/* geoRecord holds the bits of a MaxMind database record we care about.  Both
+country and ASN databases can be read into it. */
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint `maxminddb:"autonomous_system_number"`
+}
+
+/* geo, if not nil, decides what to do with queries */
+var geo *geoPolicy
+
+/* geoPolicy decides what to do with queries based on the country and ASN from
+which they come.  ASN rules take precedence over country rules. */
+type geoPolicy struct {
+	lookup    func(ip net.IP, rec *geoRecord) error
+	countries map[string]geoAction
+	asns      map[uint]geoAction
+	def       geoAction
+	hasDef    bool /* There's a * rule */
+	hasServe  bool /* Some rule serves files */
+}
+
+/* newGeoPolicy opens the comma-separated MaxMind database files in dbs and
+parses the comma-separated rules in rules with parseGeoRules. */
+func newGeoPolicy(dbs, rules string) (*geoPolicy, error) {
+	/* Open the databases */
+	var rs []*maxminddb.Reader
+	for _, db := range strings.Split(dbs, ",") {
+		if "" == db {
+			continue
+		}
+		r, err := maxminddb.Open(db)
+		if nil != err {
+			return nil, fmt.Errorf("opening %s: %w", db, err)
+		}
+		rs = append(rs, r)
+	}
+	if 0 == len(rs) {
+		return nil, fmt.Errorf("no databases")
+	}
+
+	g, err := parseGeoRules(rules)
+	if nil != err {
+		return nil, err
+	}
+	g.lookup = func(ip net.IP, rec *geoRecord) error {
+		for _, r := range rs {
+			if err := r.Lookup(ip, rec); nil != err {
+				return err
+			}
+		}
+		return nil
+	}
+	return g, nil
+}
+
+/* parseGeoRules parses the comma-separated rules in rules.  Rules are of the
+form where=action, where where is a two-letter country code, an ASN prefixed
+with AS, or * for anything else, and action is one of serve, refuse, or decoy.
+The returned geoPolicy's lookup must be set before use. */
+func parseGeoRules(rules string) (*geoPolicy, error) {
+	g := &geoPolicy{
+		countries: make(map[string]geoAction),
+		asns:      make(map[uint]geoAction),
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		if "" == rule {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if 2 != len(parts) {
+			return nil, fmt.Errorf("invalid rule %q", rule)
+		}
+		act, ok := geoActions[strings.ToLower(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf(
+				"unknown action %q in rule %q",
+				parts[1],
+				rule,
+			)
+		}
+		if geoServe == act {
+			g.hasServe = true
+		}
+		where := strings.ToUpper(parts[0])
+		switch {
+		case "*" == where:
+			g.def = act
+			g.hasDef = true
+		case strings.HasPrefix(where, "AS"):
+			n, err := strconv.ParseUint(where[2:], 10, 32)
+			if nil != err {
+				return nil, fmt.Errorf(
+					"invalid ASN in rule %q: %w",
+					rule,
+					err,
+				)
+			}
+			g.asns[uint(n)] = act
+		case 2 == len(where):
+			g.countries[where] = act
+		default:
+			return nil, fmt.Errorf("invalid rule %q", rule)
+		}
+	}
+
+	return g, nil
+}
+
+/* geoClosed returns what to do with a query which mustn't be served: serve a
+decoy if there's a decoy directory in s, or refuse it otherwise. */
+func geoClosed(s settings) geoAction {
+	if "" != s.decoyDir {
+		return geoDecoy
+	}
+	return geoRefuse
+}
+
+/* fallback returns what to do with a query which doesn't match a rule.  This
+is the * rule's action if there is one, or geoClosed(s) if any rule serves
+files, so that files only go where they're meant to, or serve otherwise. */
+func (g *geoPolicy) fallback(s settings) geoAction {
+	switch {
+	case g.hasDef:
+		return g.def
+	case g.hasServe:
+		return geoClosed(s)
+	default:
+		return geoServe
+	}
+}
+
+/* unknown returns what to do with a query from somewhere we can't work out,
+which is never to serve it. */
+func (g *geoPolicy) unknown(s settings) geoAction {
+	if act := g.fallback(s); geoServe != act {
+		return act
+	}
+	return geoClosed(s)
+}
+
+/* action returns what to do with a query from addr, given the settings in s,
+as well as a description of where addr is, for logging. */
+func (g *geoPolicy) action(s settings, addr net.Addr) (geoAction, string) {
+	/* Work out the IP address */
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		h, _, err := net.SplitHostPort(addr.String())
+		if nil != err {
+			h = addr.String()
+		}
+		ip = net.ParseIP(h)
+	}
+	if nil == ip {
+		return g.unknown(s), "unknown"
+	}
+
+	/* Work out where it is */
+	var rec geoRecord
+	if err := g.lookup(ip, &rec); nil != err {
+		return g.unknown(s), fmt.Sprintf("lookup error (%s)", err)
+	}
+	where := fmt.Sprintf("%s/AS%d", rec.Country.ISOCode, rec.ASN)
+
+	/* Work out what to do */
+	if act, ok := g.asns[rec.ASN]; ok && 0 != rec.ASN {
+		return act, where
+	}
+	if act, ok := g.countries[rec.Country.ISOCode]; ok {
+		return act, where
+	}
+	return g.fallback(s), where
+}
@@ -0,0 +1,119 @@
+package main
+
+/*
+ * geoip_test.go
+ * Tests for geographic policies
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseGeoRules(t *testing.T) {
+	g, err := parseGeoRules("us=serve,AS64496=decoy,ru=refuse")
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if got := g.countries["US"]; geoServe != got {
+		t.Errorf("US: got %s", got)
+	}
+	if got := g.countries["RU"]; geoRefuse != got {
+		t.Errorf("RU: got %s", got)
+	}
+	if got := g.asns[64496]; geoDecoy != got {
+		t.Errorf("AS64496: got %s", got)
+	}
+	if g.hasDef {
+		t.Errorf("Default set without a * rule")
+	}
+	if !g.hasServe {
+		t.Errorf("Serve rule not noticed")
+	}
+
+	for _, rules := range []string{
+		"us",
+		"us=kittens",
+		"usa=serve",
+		"ASkittens=serve",
+	} {
+		if _, err := parseGeoRules(rules); nil == err {
+			t.Errorf("No error parsing %q", rules)
+		}
+	}
+}
+
+func TestGeoPolicyAction(t *testing.T) {
+	recs := map[string]geoRecord{}
+	lookup := func(ip net.IP, rec *geoRecord) error {
+		if ip.Equal(net.IPv4(192, 0, 2, 99)) {
+			return errors.New("corrupt")
+		}
+		*rec = recs[ip.String()]
+		return nil
+	}
+	var us, ru, as geoRecord
+	us.Country.ISOCode = "US"
+	ru.Country.ISOCode = "RU"
+	as.Country.ISOCode = "US"
+	as.ASN = 64496
+	recs["192.0.2.1"] = us
+	recs["192.0.2.2"] = ru
+	recs["192.0.2.3"] = as
+
+	addr := func(ip string) net.Addr {
+		return &net.UDPAddr{IP: net.ParseIP(ip), Port: 53}
+	}
+	for _, c := range []struct {
+		rules string
+		decoy string
+		addr  net.Addr
+		want  geoAction
+	}{
+		/* Rules */
+		{"us=serve", "", addr("192.0.2.1"), geoServe},
+		{"us=serve,as64496=decoy", "", addr("192.0.2.3"), geoDecoy},
+		{"ru=refuse", "", addr("192.0.2.2"), geoRefuse},
+
+		/* Without a * rule, serve rules make everything else closed */
+		{"us=serve", "", addr("192.0.2.2"), geoRefuse},
+		{"us=serve", "d", addr("192.0.2.2"), geoDecoy},
+		{"ru=refuse", "", addr("192.0.2.1"), geoServe},
+		{"us=serve,*=decoy", "", addr("192.0.2.2"), geoDecoy},
+		{"us=refuse,*=serve", "", addr("192.0.2.2"), geoServe},
+
+		/* Unknown places are never served */
+		{"*=serve", "", addr("192.0.2.99"), geoRefuse},
+		{"*=serve", "d", addr("192.0.2.99"), geoDecoy},
+		{"ru=refuse", "", addr("192.0.2.99"), geoRefuse},
+		{"us=serve", "", addr("192.0.2.99"), geoRefuse},
+		{"*=decoy", "", addr("192.0.2.99"), geoDecoy},
+		{"*=serve", "", testAddr, geoServe},
+		{"*=serve", "", &net.UnixAddr{Name: "x"}, geoRefuse},
+	} {
+		g, err := parseGeoRules(c.rules)
+		if nil != err {
+			t.Fatalf("Parsing %q: %s", c.rules, err)
+		}
+		g.lookup = lookup
+		if got, where := g.action(
+			settings{decoyDir: c.decoy},
+			c.addr,
+		); c.want != got {
+			t.Errorf(
+				"Rules %q, decoy dir %q, %s (%s): "+
+					"got %s, want %s",
+				c.rules,
+				c.decoy,
+				c.addr,
+				where,
+				got,
+				c.want,
+			)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+/*
+ * health.go
+ * Make sure we're still serving files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* defaultCanaryDomain is the domain used in canary queries if none is
+configured */
+const defaultCanaryDomain = "canary.invalid"
+
+/* canaryCheck periodically gets the first chunk of the file named canary via
+the DNS server at server, asking for the file under the given domain, and logs
+and sends an alert to webhook, if set, when it stops or starts working again.
+It never returns. */
+func canaryCheck(
+	canary string,
+	server string,
+	domain string,
+	interval time.Duration,
+	webhook string,
+) {
+	failing := false
+	for {
+		time.Sleep(interval)
+
+		/* Failing on purpose isn't failing */
+		if inMaintenance() {
+			continue
+		}
+
+		failing = checkCanary(canary, server, domain, webhook, failing)
+	}
+}
+
+/* checkCanary checks the canary once, as described for canaryCheck, and
+returns whether it's failing.  Logs and alerts only happen if whether it's
+failing isn't what it was, as given by failing. */
+func checkCanary(
+	canary string,
+	server string,
+	domain string,
+	webhook string,
+	failing bool,
+) bool {
+	/* See if it works */
+	err := getCanary(canary, server, domain)
+	if nil != err && !failing {
+		log.Printf("Canary check failing: %s", err)
+	} else if nil == err && failing {
+		log.Printf("Canary check working again")
+	} else {
+		return failing
+	}
+
+	/* Tell someone about it */
+	if "" == webhook {
+		return nil != err
+	}
+	if werr := sendCanaryAlert(webhook, err); nil != werr {
+		log.Printf("Error sending canary alert: %s", werr)
+	}
+	return nil != err
+}
+
+/* getCanary gets the first chunk of the canary file via the server and makes
+sure it matches the file on disk. */
+func getCanary(canary, server, domain string) error {
+	q, err := dnsfservget.UDPQuerier(dnsfservget.UDPConfig{
+		Server:  server,
+		Timeout: 5 * time.Second,
+		TSIG:    tsigKey,
+	})
+	if nil != err {
+		return fmt.Errorf("making querier: %w", err)
+	}
+
+	/* Get the start of the file from us and from disk */
+	want := make([]byte, 8)
+	f, err := os.Open(filepath.Join(
+		currentSettings().fdir,
+		filepath.Clean(canary),
+	))
+	if nil != err {
+		return fmt.Errorf("opening canary file: %w", err)
+	}
+	defer f.Close()
+	n, err := io.ReadFull(f, want)
+	if nil != err && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("reading canary file: %w", err)
+	}
+	want = want[:n]
+	got, err := ioutil.ReadAll((&dnsfservget.Getter{
+		Type:    canaryType(),
+		Name:    canary,
+		Domain:  domain,
+		Querier: q,
+		Max:     uint(len(want)),
+		Key:     authKey,
+		Nonce:   nil != nonces,
+	}).Get())
+	if nil != err {
+		return fmt.Errorf("querying: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("got %02x, expected %02x", got, want)
+	}
+	return nil
+}
+
+/* canaryACL returns what -allow and -deny will do with canary queries sent to
+server, as well as why, for logging.  Nothing is actually sent. */
+func canaryACL(server string) (geoAction, string) {
+	c, err := net.Dial("udp", server)
+	if nil != err {
+		return geoServe, ""
+	}
+	defer c.Close()
+	return aclCheck(currentSettings(), c.LocalAddr())
+}
+
+/* sendCanaryAlert POSTs a bit of JSON describing err, which is nil if things
+are working again, to the webhook URL. */
+func sendCanaryAlert(webhook string, err error) error {
+	a := struct {
+		Time    time.Time `json:"time"`
+		Working bool      `json:"working"`
+		Error   string    `json:"error,omitempty"`
+	}{Time: time.Now(), Working: nil == err}
+	if nil != err {
+		a.Error = err.Error()
+	}
+	b, err := json.Marshal(a)
+	if nil != err {
+		return fmt.Errorf("marshalling alert: %w", err)
+	}
+	res, err := http.Post(webhook, "application/json", bytes.NewReader(b))
+	if nil != err {
+		return err
+	}
+	defer res.Body.Close()
+	if 200 > res.StatusCode || 299 < res.StatusCode {
+		return fmt.Errorf("non-2xx response status %s", res.Status)
+	}
+	return nil
+}
+
+/* canaryType returns the type of query to make for canary checks, which is
+AAAA unless it's been disabled, then A, TXT, and NULL. */
+func canaryType() dnsfservget.QType {
+	switch {
+	case !typeDisabled(dnsmessage.TypeAAAA):
+		return dnsfservget.TypeAAAA
+	case !typeDisabled(dnsmessage.TypeA):
+		return dnsfservget.TypeA
+	case !typeDisabled(dnsmessage.TypeTXT):
+		return dnsfservget.TypeTXT
+	default:
+		return dnsfservget.TypeNULL
+	}
+}
+
+/* canaryServer works out the address to which to send canary queries if
+none's configured, which is the listen address laddr, with the loopback
+address if laddr is unspecified. */
+func canaryServer(laddr net.Addr) string {
+	ua, ok := laddr.(*net.UDPAddr)
+	if !ok || !ua.IP.IsUnspecified() {
+		return laddr.String()
+	}
+	if nil == ua.IP.To4() {
+		return net.JoinHostPort("::1", fmt.Sprint(ua.Port))
+	}
+	return net.JoinHostPort("127.0.0.1", fmt.Sprint(ua.Port))
+}
@@ -0,0 +1,140 @@
+package main
+
+/*
+ * health_test.go
+ * Tests for canary health checks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCanary(t *testing.T) {
+	testServe(t)
+
+	/* Canary queries need fresh nonces if nonces are required */
+	for _, nc := range []*nonceCache{nil, newNonceCache(16, time.Minute)} {
+		nonces = nc
+		server, stop := testUDPServer(t)
+		if err := getCanary(
+			"payload",
+			server,
+			defaultCanaryDomain,
+		); nil != err {
+			t.Errorf("Nonce cache %t: %s", nil != nc, err)
+		}
+		stop()
+	}
+	nonces = nil
+	server, stop := testUDPServer(t)
+	defer stop()
+
+	/* Missing canaries fail */
+	if err := getCanary(
+		"kittens",
+		server,
+		defaultCanaryDomain,
+	); nil == err {
+		t.Errorf("No error for missing canary")
+	}
+}
+
+func TestCheckCanary(t *testing.T) {
+	testServe(t)
+	server, stop := testUDPServer(t)
+	defer stop()
+
+	/* Alerts go here */
+	type alert struct {
+		Working bool   `json:"working"`
+		Error   string `json:"error"`
+	}
+	alerts := make(chan alert, 10)
+	hs := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		var a alert
+		if err := json.NewDecoder(r.Body).Decode(&a); nil != err {
+			t.Errorf("Decoding alert: %s", err)
+		}
+		alerts <- a
+	}))
+	defer hs.Close()
+
+	/* Only changes should be alerted */
+	cpath := filepath.Join(fdir, "canary")
+	for i, c := range []struct {
+		canary  string /* Canary file's contents, none if empty */
+		failing bool   /* Before */
+		want    bool   /* After, and alerted if different */
+	}{
+		{"moose", false, false},
+		{"moose", true, false},
+		{"", false, true},
+		{"", true, true},
+		{"moose", true, false},
+	} {
+		os.Remove(cpath)
+		if "" != c.canary {
+			if err := ioutil.WriteFile(
+				cpath,
+				[]byte(c.canary),
+				0600,
+			); nil != err {
+				t.Fatalf("Writing canary: %s", err)
+			}
+		}
+		if got := checkCanary(
+			"canary",
+			server,
+			defaultCanaryDomain,
+			hs.URL,
+			c.failing,
+		); c.want != got {
+			t.Errorf("Check %d: got failing %t", i, got)
+		}
+		select {
+		case a := <-alerts:
+			if c.failing == c.want {
+				t.Errorf("Check %d: unexpected alert %+v", i, a)
+			} else if a.Working == c.want ||
+				a.Working != ("" == a.Error) {
+				t.Errorf("Check %d: got alert %+v", i, a)
+			}
+		default:
+			if c.failing != c.want {
+				t.Errorf("Check %d: no alert", i)
+			}
+		}
+	}
+}
+
+func TestCanaryACL(t *testing.T) {
+	defer func() { allowNets, denyNets = nil, nil }()
+	if act, why := canaryACL("127.0.0.1:53"); geoServe != act {
+		t.Errorf("Without ACL: got %s (%s)", act, why)
+	}
+	if err := allowNets.Set("192.0.2.0/24"); nil != err {
+		t.Fatalf("Setting -allow: %s", err)
+	}
+	if act, why := canaryACL("127.0.0.1:53"); geoRefuse != act {
+		t.Errorf("Unallowed: got %s (%s)", act, why)
+	}
+	if err := allowNets.Set("127.0.0.0/8"); nil != err {
+		t.Fatalf("Setting -allow: %s", err)
+	}
+	if act, why := canaryACL("127.0.0.1:53"); geoServe != act {
+		t.Errorf("Allowed: got %s (%s)", act, why)
+	}
+}
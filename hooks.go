@@ -0,0 +1,269 @@
+package main
+
+/*
+ * hooks.go
+ * Run commands and webhooks when files are downloaded
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* hookEvent is something which happens to a file which may fire a hook */
+type hookEvent string
+
+/* Events which may fire hooks */
+const (
+	hookFirstChunk hookEvent = "on-first-chunk"
+	hookComplete   hookEvent = "on-complete"
+	hookReplay     hookEvent = "on-replay"
+)
+
+/* hookDedupe is how long to wait before firing the same hook for the same
+client again, as resolvers retry and the stdlib queries for A and AAAA at the
+same time. */
+const hookDedupe = time.Minute
+
+/* hookTimeout is how long a hook's command or webhook may take before it's
+given up on, so hung hooks don't pile up. */
+const hookTimeout = time.Minute
+
+/* hook is a command or webhook to run when an event happens */
+type hook struct {
+	event   hookEvent
+	command string /* Shell command */
+	webhook string /* URL to which to POST */
+}
+
+/* hookKey identifies a fired hook for deduplication */
+type hookKey struct {
+	fname  string
+	event  hookEvent
+	client string
+}
+
+/* hookSet holds the hooks for each file */
+type hookSet struct {
+	hooks   map[string][]hook /* Keyed by filename */
+	timeout time.Duration     /* For each command or webhook */
+	l       sync.Mutex
+	fired   map[hookKey]time.Time
+	wg      sync.WaitGroup /* Running hooks */
+}
+
+/* hooks holds the hooks read from the file given with -hooks, or is nil if
+there are none */
+var hooks *hookSet
+
+/* loadHooks reads hooks from the named file.  Each non-blank, non-comment line
+is of the form
+  filename event action target
+where event is on-first-chunk, on-complete, or on-replay and action is exec,
+in which case target is a shell command, or post, in which case target is a
+webhook URL. */
+func loadHooks(fn string) (*hookSet, error) {
+	f, err := os.Open(fn)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &hookSet{
+		hooks:   make(map[string][]hook),
+		timeout: hookTimeout,
+		fired:   make(map[hookKey]time.Time),
+	}
+	s := bufio.NewScanner(f)
+	var ln int
+	for s.Scan() {
+		ln++
+		l := strings.TrimSpace(s.Text())
+		if "" == l || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fs := strings.Fields(l)
+		if 4 > len(fs) {
+			return nil, fmt.Errorf("line %d: too few fields", ln)
+		}
+		var hk hook
+		switch ev := hookEvent(fs[1]); ev {
+		case hookFirstChunk, hookComplete, hookReplay:
+			hk.event = ev
+		default:
+			return nil, fmt.Errorf(
+				"line %d: unknown event %q",
+				ln,
+				fs[1],
+			)
+		}
+		target := strings.Join(fs[3:], " ")
+		switch fs[2] {
+		case "exec":
+			hk.command = target
+		case "post":
+			hk.webhook = target
+		default:
+			return nil, fmt.Errorf(
+				"line %d: unknown action %q",
+				ln,
+				fs[2],
+			)
+		}
+		fname := strings.ToLower(filepath.Clean(fs[0]))
+		h.hooks[fname] = append(h.hooks[fname], hk)
+	}
+	if err := s.Err(); nil != err {
+		return nil, err
+	}
+	return h, nil
+}
+
+/* fire runs the hooks for event on the served file fname, requested by addr
+with a query of type qtype.  Hooks are run in their own goroutines, which may
+be waited on with h.wait. */
+func (h *hookSet) fire(
+	fname string,
+	event hookEvent,
+	addr net.Addr,
+	qtype dnsmessage.Type,
+) {
+	hks, ok := h.hooks[fname]
+	if !ok {
+		return
+	}
+
+	/* Don't fire more than once per client in a short time */
+	client := addr.String()
+	if host, _, err := net.SplitHostPort(client); nil == err {
+		client = host
+	}
+	k := hookKey{fname: fname, event: event, client: client}
+	now := time.Now()
+	h.l.Lock()
+	for fk, t := range h.fired {
+		if now.Sub(t) > hookDedupe {
+			delete(h.fired, fk)
+		}
+	}
+	_, dupe := h.fired[k]
+	if !dupe {
+		h.fired[k] = now
+	}
+	h.l.Unlock()
+	if dupe {
+		return
+	}
+
+	/* Fire ze hooks */
+	la := logAddr(addr)
+	for _, hk := range hks {
+		if event != hk.event {
+			continue
+		}
+		h.wg.Add(1)
+		go func(hk hook) {
+			defer h.wg.Done()
+			var err error
+			if "" != hk.command {
+				err = h.runCommand(hk, fname, client, qtype)
+			} else {
+				err = h.sendWebhook(hk, fname, client, qtype)
+			}
+			if nil != err {
+				log.Printf(
+					"[%s] Error running %s hook for %s: %s",
+					la,
+					event,
+					fname,
+					err,
+				)
+				return
+			}
+			log.Printf("[%s] Ran %s hook for %s", la, event, fname)
+		}(hk)
+	}
+}
+
+/* wait waits for the hooks started by h.fire to finish. */
+func (h *hookSet) wait() { h.wg.Wait() }
+
+/* runCommand runs hk's command with information about the download in its
+environment. */
+func (h *hookSet) runCommand(
+	hk hook,
+	fname string,
+	client string,
+	qtype dnsmessage.Type,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hk.command)
+	cmd.WaitDelay = time.Second /* In case children hold the output */
+	cmd.Env = append(
+		os.Environ(),
+		"DNSFSERV_FILE="+fname,
+		"DNSFSERV_EVENT="+string(hk.event),
+		"DNSFSERV_CLIENT="+client,
+		"DNSFSERV_QTYPE="+strings.TrimPrefix(qtype.String(), "Type"),
+	)
+	if o, err := cmd.CombinedOutput(); nil != err {
+		return fmt.Errorf("%w (output: %q)", err, o)
+	}
+	return nil
+}
+
+/* sendWebhook POSTs information about the download to hk's webhook. */
+func (h *hookSet) sendWebhook(
+	hk hook,
+	fname string,
+	client string,
+	qtype dnsmessage.Type,
+) error {
+	b, err := json.Marshal(struct {
+		Time   time.Time `json:"time"`
+		File   string    `json:"file"`
+		Event  hookEvent `json:"event"`
+		Client string    `json:"client"`
+		QType  string    `json:"qtype"`
+	}{
+		Time:   time.Now(),
+		File:   fname,
+		Event:  hk.event,
+		Client: client,
+		QType:  strings.TrimPrefix(qtype.String(), "Type"),
+	})
+	if nil != err {
+		return fmt.Errorf("marshalling event: %w", err)
+	}
+	res, err := (&http.Client{Timeout: h.timeout}).Post(
+		hk.webhook,
+		"application/json",
+		bytes.NewReader(b),
+	)
+	if nil != err {
+		return err
+	}
+	defer res.Body.Close()
+	if 200 > res.StatusCode || 299 < res.StatusCode {
+		return fmt.Errorf("non-2xx response status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+/*
+ * hooks_test.go
+ * Tests for event hooks
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLoadHooks(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "hooks")
+	write := func(s string) {
+		if err := ioutil.WriteFile(fn, []byte(s), 0600); nil != err {
+			t.Fatalf("Writing hooks file: %s", err)
+		}
+	}
+
+	write(`# file event action target
+
+payload on-first-chunk exec  echo kittens   and puppies
+PAYLOAD on-complete post http://example.com/hook
+./other on-replay exec true
+`)
+	h, err := loadHooks(fn)
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	want := map[string][]hook{
+		"payload": {
+			{
+				event:   hookFirstChunk,
+				command: "echo kittens and puppies",
+			},
+			{
+				event:   hookComplete,
+				webhook: "http://example.com/hook",
+			},
+		},
+		"other": {{event: hookReplay, command: "true"}},
+	}
+	if fmt.Sprint(want) != fmt.Sprint(h.hooks) {
+		t.Errorf("Got hooks %v, want %v", h.hooks, want)
+	}
+
+	for _, l := range []string{
+		"payload on-first-chunk exec",
+		"payload on-kittens exec true",
+		"payload on-complete mail root",
+	} {
+		write(l + "\n")
+		if _, err := loadHooks(fn); nil == err {
+			t.Errorf("No error for %q", l)
+		}
+	}
+	if _, err := loadHooks(fn + ".nonesuch"); nil == err {
+		t.Errorf("No error for missing file")
+	}
+}
+
+func TestHookFire(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); nil != err {
+		t.Skipf("No shell: %s", err)
+	}
+	testServe(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+
+	/* Webhooks send us what they get */
+	posts := make(chan map[string]any, 10)
+	hs := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		var m map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&m); nil != err {
+			t.Errorf("Decoding webhook body: %s", err)
+		}
+		posts <- m
+	}))
+	defer hs.Close()
+
+	hfile := filepath.Join(dir, "hooks")
+	if err := ioutil.WriteFile(hfile, []byte(fmt.Sprintf(
+		"payload on-first-chunk exec echo $DNSFSERV_FILE "+
+			"$DNSFSERV_EVENT $DNSFSERV_CLIENT $DNSFSERV_QTYPE "+
+			">> %s\npayload on-complete post %s\n",
+		out,
+		hs.URL,
+	)), 0600); nil != err {
+		t.Fatalf("Writing hooks file: %s", err)
+	}
+	h, err := loadHooks(hfile)
+	if nil != err {
+		t.Fatalf("Loading hooks: %s", err)
+	}
+
+	/* Commands fire once per file, event, and client */
+	other := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 53}
+	samehost := &net.UDPAddr{IP: testAddr.IP, Port: testAddr.Port + 1}
+	h.fire("payload", hookFirstChunk, testAddr, dnsmessage.TypeA)
+	h.fire("payload", hookFirstChunk, testAddr, dnsmessage.TypeA)
+	h.fire("payload", hookFirstChunk, samehost, dnsmessage.TypeTXT)
+	h.fire("payload", hookFirstChunk, other, dnsmessage.TypeAAAA)
+	h.fire("nonesuch", hookFirstChunk, testAddr, dnsmessage.TypeA)
+	h.wait()
+	want := []string{
+		"payload on-first-chunk 192.0.2.1 A",
+		"payload on-first-chunk 192.0.2.2 AAAA",
+	}
+	b, _ := ioutil.ReadFile(out)
+	got := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(got)
+	if fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("Commands got %q, want %q", got, want)
+	}
+
+	/* Webhooks, too */
+	h.fire("payload", hookComplete, testAddr, dnsmessage.TypeTXT)
+	h.fire("payload", hookComplete, testAddr, dnsmessage.TypeTXT)
+	h.wait()
+	select {
+	case m := <-posts:
+		for k, v := range map[string]string{
+			"file":   "payload",
+			"event":  "on-complete",
+			"client": "192.0.2.1",
+			"qtype":  "TXT",
+		} {
+			if m[k] != v {
+				t.Errorf(
+					"Webhook got %s %v, want %s",
+					k,
+					m[k],
+					v,
+				)
+			}
+		}
+	default:
+		t.Fatalf("Webhook not called")
+	}
+	select {
+	case m := <-posts:
+		t.Errorf("Webhook called twice, second time with %v", m)
+	default:
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); nil != err {
+		t.Skipf("No shell: %s", err)
+	}
+	h := &hookSet{timeout: 100 * time.Millisecond}
+
+	/* Commands */
+	start := time.Now()
+	if err := h.runCommand(
+		hook{event: hookComplete, command: "sleep 10"},
+		"payload",
+		"192.0.2.1",
+		dnsmessage.TypeA,
+	); nil == err {
+		t.Errorf("Command didn't time out")
+	}
+	if d := time.Since(start); 5*time.Second < d {
+		t.Errorf("Command took %s to time out", d)
+	}
+
+	/* Webhooks */
+	release := make(chan struct{})
+	hs := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		<-release
+	}))
+	defer hs.Close()
+	defer close(release)
+	start = time.Now()
+	if err := h.sendWebhook(
+		hook{event: hookComplete, webhook: hs.URL},
+		"payload",
+		"192.0.2.1",
+		dnsmessage.TypeA,
+	); nil == err {
+		t.Errorf("Webhook didn't time out")
+	}
+	if d := time.Since(start); 5*time.Second < d {
+		t.Errorf("Webhook took %s to time out", d)
+	}
+}
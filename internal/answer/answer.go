@@ -0,0 +1,311 @@
+// Package answer turns file data into DNS answer records.  It's shared by
+// dnsfserv and dnsfservtest so both encode files the same way.
+package answer
+
+/*
+ * answer.go
+ * Turn file data into answer records
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// AFirstByte is the first byte of an A record holding a chunk.
+	AFirstByte = 3
+
+	// MultiAFirstByte plus the record's sequence number is the first
+	// byte of each A record in an answer for several chunks.
+	MultiAFirstByte = 32
+
+	// TXTMax is the maximum amount of a file to put in a TXT record.
+	TXTMax = dnsfservget.MaxDecode
+
+	// BigTXTMax is the maximum amount of a file to put in a TXT record
+	// asked for with dnsfservget.BigTXTLabel, split over several strings.
+	// The answer fits in a 1232-byte EDNS0 buffer with any question.
+	BigTXTMax = dnsfservget.MaxBigTXTDecode
+
+	// NULLMax is the maximum amount of a file to put in a NULL record,
+	// which leaves room for the rest of a maximum-sized message.
+	NULLMax = dnsfservget.MaxNULLDecode
+
+	// MaxSRVOffset is one more than the largest offset an SRV record's
+	// priority and weight can hold.
+	MaxSRVOffset = dnsfservget.MaxSRVOffset
+
+	// MaxBudget is the most space answer records can take up in a
+	// message, less the smallest possible header and question.
+	MaxBudget = 65535 - 12 - 5
+
+	// TypeNULL is the NULL record type, which dnsmessage doesn't have.
+	TypeNULL dnsmessage.Type = 10
+)
+
+/* rrOverhead is the size of an answer record, less its RDATA, when its name
+is compressed to a pointer to the question */
+const rrOverhead = 2 + 10
+
+// AAAAFirstHalf is the first half of an AAAA record holding a chunk.
+var AAAAFirstHalf = []byte{
+	0x26, 0x00, 0x90, 0x00, 0x53, 0x05, 0xce, 0x00,
+}
+
+// ChunkSize returns the number of bytes of a file served in an answer of type
+// qtype, or 0 if files aren't served in records of type qtype.
+func ChunkSize(qtype dnsmessage.Type) uint64 {
+	switch qtype {
+	case dnsmessage.TypeA:
+		return 3
+	case dnsmessage.TypeAAAA:
+		return uint64(16 - len(AAAAFirstHalf))
+	case dnsmessage.TypeTXT:
+		return TXTMax
+	case TypeNULL:
+		return NULLMax
+	case dnsmessage.TypeCNAME, dnsmessage.TypeMX, dnsmessage.TypeSRV:
+		return NameMax
+	default:
+		return 0
+	}
+}
+
+// Builder encodes file data as answer records of a single type.  Every answer
+// holding file data is built with one, whichever listener the query came in
+// on, so the encoding's all in one place.
+type Builder struct {
+	QType     dnsmessage.Type
+	Zone      string /* Fully-qualified, for names holding data */
+	Off       uint64 /* Offset in the file of the data, for MX and SRV */
+	Max       int    /* Most data in a record, if not ChunkSize(QType) */
+	Multi     bool   /* Sequence numbers in A and AAAA records */
+	SKey      []byte /* Session key, if the data's encrypted */
+	SName     string /* File's name in the query, for encryption */
+	Seq       bool   /* Start with a sequence byte */
+	Pad       bool   /* Pad TXT and NULL records */
+	PadBucket int    /* Pad to a multiple of this, if not a full record */
+}
+
+// Build encodes as much of p as fits in budget bytes of answer records and
+// returns the record bodies and the number of bytes of p encoded.  Each record
+// holds no more than ab.Max bytes or a normal chunk of data, and CNAME answers
+// are never more than one record.  If ab.SKey is set, p is encrypted first.
+// If ab.Seq is set, the encoded data starts with the sequence byte for ab.Off,
+// which isn't counted in the number of bytes encoded.  If ab.Pad is set and
+// records are TXT or NULL, the encoded data is padded after p, which must then
+// fit in a single record.
+func (ab Builder) Build(
+	p []byte,
+	budget int,
+) ([]dnsmessage.ResourceBody, int, error) {
+	max := ab.Max
+	if 0 == max {
+		max = int(ChunkSize(ab.QType))
+	}
+	if 0 == max {
+		return nil, 0, fmt.Errorf(
+			"unsupported record type %s",
+			ab.QType,
+		)
+	}
+	if nil != ab.SKey {
+		p = append([]byte(nil), p...)
+		if err := dnsfservget.SessionXOR(
+			ab.SKey,
+			ab.SName,
+			ab.Off,
+			p,
+		); nil != err {
+			return nil, 0, fmt.Errorf("encrypting: %w", err)
+		}
+	}
+	plen := len(p)
+	if ab.Seq {
+		p = append([]byte{dnsfservget.SequenceByte(ab.Off)}, p...)
+	}
+	padding := ab.Pad && Padded(ab.QType)
+	if padding {
+		p = Pad(append([]byte(nil), p...), max, ab.PadBucket)
+	}
+	var (
+		bodies []dnsmessage.ResourceBody
+		used   int
+	)
+	for used < len(p) {
+		if dnsmessage.TypeCNAME == ab.QType && 0 != len(bodies) {
+			break
+		}
+
+		/* Work out how much fits */
+		n := len(p) - used
+		if max < n {
+			n = max
+		}
+		if n = ab.fit(n, budget-rrOverhead); 0 == n {
+			break
+		}
+
+		/* Encode it */
+		b, err := ab.Record(p[used:used+n], ab.Off+uint64(used))
+		if nil != err {
+			return nil, 0, err
+		}
+		bodies = append(bodies, b)
+		budget -= rrOverhead + ab.rdataLen(n)
+		used += n
+	}
+	switch {
+	case padding && len(p) != used:
+		return nil, 0, fmt.Errorf("padded chunk too big for a record")
+	case padding:
+		used = plen
+	case ab.Seq && 0 != used:
+		used--
+	}
+	return bodies, used, nil
+}
+
+/* fit returns the largest number of bytes, not more than n, which fit in
+avail bytes of RDATA, or 0 if none do. */
+func (ab Builder) fit(n, avail int) int {
+	if ab.rdataLen(n) <= avail {
+		return n
+	}
+	lo, hi := 0, n /* lo always fits, hi never does */
+	for lo+1 < hi {
+		mid := (lo + hi) / 2
+		if ab.rdataLen(mid) <= avail {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+/* rdataLen returns the size of the RDATA of a record holding n bytes of
+data.  Names are assumed to be uncompressed. */
+func (ab Builder) rdataLen(n int) int {
+	switch ab.QType {
+	case dnsmessage.TypeA:
+		return 4
+	case dnsmessage.TypeAAAA:
+		return 16
+	case dnsmessage.TypeTXT:
+		e := base64.RawStdEncoding.EncodedLen(n)
+		if 0 == e {
+			return 1
+		}
+		return e + (e+254)/255
+	case TypeNULL:
+		return n
+	case dnsmessage.TypeCNAME:
+		return ab.nameLen(n)
+	case dnsmessage.TypeMX:
+		return 2 + ab.nameLen(n)
+	case dnsmessage.TypeSRV:
+		return 6 + ab.nameLen(n)
+	default:
+		return 0
+	}
+}
+
+/* nameLen returns the wire size of a name in ab.Zone holding n bytes of
+data */
+func (ab Builder) nameLen(n int) int {
+	e := nameEncoding.EncodedLen(n)
+	return e + (e+62)/63 + len(ab.Zone) + 1
+}
+
+// Record encodes b, which is at offset off in the file, as a single record
+// body.
+func (ab Builder) Record(
+	b []byte,
+	off uint64,
+) (dnsmessage.ResourceBody, error) {
+	switch ab.QType {
+	case dnsmessage.TypeA:
+		var ans dnsmessage.AResource
+		ans.A[0] = AFirstByte
+		if ab.Multi {
+			ans.A[0] = MultiAFirstByte + ab.sequence(off)
+		}
+		copy(ans.A[1:], b)
+		return &ans, nil
+	case dnsmessage.TypeAAAA:
+		var ans dnsmessage.AAAAResource
+		copy(ans.AAAA[:], AAAAFirstHalf)
+		if ab.Multi {
+			ans.AAAA[len(AAAAFirstHalf)-1] = ab.sequence(off)
+		}
+		copy(ans.AAAA[len(AAAAFirstHalf):], b)
+		return &ans, nil
+	case dnsmessage.TypeTXT:
+		return &dnsmessage.TXTResource{TXT: SplitTXT(
+			base64.RawStdEncoding.EncodeToString(b),
+		)}, nil
+	case TypeNULL:
+		return &dnsmessage.UnknownResource{
+			Type: TypeNULL,
+			Data: append([]byte(nil), b...),
+		}, nil
+	case dnsmessage.TypeCNAME:
+		target, err := NameChunk(b, ab.Zone)
+		if nil != err {
+			return nil, err
+		}
+		return &dnsmessage.CNAMEResource{CNAME: target}, nil
+	case dnsmessage.TypeMX:
+		target, err := NameChunk(b, ab.Zone)
+		if nil != err {
+			return nil, err
+		}
+		return &dnsmessage.MXResource{
+			Pref: MXSequence(off),
+			MX:   target,
+		}, nil
+	case dnsmessage.TypeSRV:
+		if MaxSRVOffset <= off {
+			return nil, fmt.Errorf(
+				"offset %d too large for SRV",
+				off,
+			)
+		}
+		target, err := NameChunk(b, ab.Zone)
+		if nil != err {
+			return nil, err
+		}
+		return &dnsmessage.SRVResource{
+			Priority: uint16(off >> 16),
+			Weight:   uint16(off),
+			Port:     uint16(len(b)),
+			Target:   target,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported record type %s", ab.QType)
+	}
+}
+
+/* sequence returns the sequence number of the record holding the data at
+offset off in the file, for answers with several A or AAAA records. */
+func (ab Builder) sequence(off uint64) byte {
+	return byte((off - ab.Off) / ChunkSize(ab.QType))
+}
+
+// SplitTXT splits s into TXT character-strings.
+func SplitTXT(s string) []string {
+	ss := make([]string, 0, len(s)/255+1)
+	for 255 < len(s) {
+		ss = append(ss, s[:255])
+		s = s[255:]
+	}
+	return append(ss, s)
+}
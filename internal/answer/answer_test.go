@@ -0,0 +1,181 @@
+package answer
+
+/*
+ * answer_test.go
+ * Tests for turning file data into answer records
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* servedTypes are the record types in which files are served, by name */
+var servedTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"TXT":   dnsmessage.TypeTXT,
+	"NULL":  TypeNULL,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"SRV":   dnsmessage.TypeSRV,
+}
+
+func FuzzBuilder(f *testing.F) {
+	f.Add([]byte("kittens"), uint16(512), uint64(0))
+	f.Add([]byte("kittens"), uint16(0), uint64(0))
+	f.Add([]byte{}, uint16(512), uint64(0))
+	f.Add(bytes.Repeat([]byte("kittens"), 100), uint16(300), uint64(1000))
+	f.Add(bytes.Repeat([]byte{0xff}, 2000), uint16(65535), uint64(1<<40))
+	f.Fuzz(testBuilder)
+}
+
+/* testBuilder checks that Builder builds decodable answers from p
+which fit in budget. */
+func testBuilder(t *testing.T, p []byte, budget uint16, off uint64) {
+	const zone = "files.example.com."
+	qn := dnsmessage.MustNewName("0-payload." + zone)
+	for name, qtype := range servedTypes {
+		ab := Builder{QType: qtype, Zone: zone, Off: off}
+		bodies, used, err := ab.Build(p, int(budget))
+		if dnsmessage.TypeSRV == qtype && MaxSRVOffset <= off {
+			if nil == err && 0 != used {
+				t.Fatalf("%s: encoded offset %d", name, off)
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if 0 > used || len(p) < used {
+			t.Fatalf("%s: used %d of %d bytes", name, used, len(p))
+		}
+		if 0 != len(p) && 1024 <= budget && 0 == used {
+			t.Fatalf("%s: nothing fit in %d bytes", name, budget)
+		}
+
+		/* The records should fit in the budget */
+		m := dnsmessage.Message{Questions: []dnsmessage.Question{{
+			Name:  qn,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}}}
+		empty, err := m.Pack()
+		if nil != err {
+			t.Fatalf("%s: packing empty message: %s", name, err)
+		}
+		for _, b := range bodies {
+			m.Answers = append(m.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  qn,
+					Type:  qtype,
+					Class: dnsmessage.ClassINET,
+				},
+				Body: b,
+			})
+		}
+		full, err := m.Pack()
+		if nil != err {
+			t.Fatalf("%s: packing answers: %s", name, err)
+		}
+		if got := len(full) - len(empty); int(budget) < got {
+			t.Fatalf(
+				"%s: %d bytes of answers for budget %d",
+				name,
+				got,
+				budget,
+			)
+		}
+
+		/* And decode to what was put in */
+		g := dnsfservget.Getter{
+			Type:   dnsfservget.QType(name),
+			Domain: zone,
+		}
+		var got []byte
+		buf := make([]byte, dnsfservget.MaxNULLDecode)
+		for i, b := range bodies {
+			var ans string
+			switch b := b.(type) {
+			case *dnsmessage.AResource:
+				ans = net.IP(b.A[:]).String()
+			case *dnsmessage.AAAAResource:
+				ans = net.IP(b.AAAA[:]).String()
+			case *dnsmessage.TXTResource:
+				ans = strings.Join(b.TXT, "")
+			case *dnsmessage.UnknownResource:
+				ans = string(b.Data)
+			case *dnsmessage.CNAMEResource:
+				ans = b.CNAME.String()
+			case *dnsmessage.MXResource:
+				if want := MXSequence(
+					off + uint64(len(got)),
+				); want != b.Pref {
+					t.Fatalf(
+						"%s: record %d has "+
+							"preference %d, want %d",
+						name,
+						i,
+						b.Pref,
+						want,
+					)
+				}
+				ans = fmt.Sprintf("%d %s", b.Pref, b.MX)
+		case *dnsmessage.SRVResource:
+			if want := uint32(
+				off + uint64(len(got)),
+			); want != uint32(b.Priority)<<16|uint32(b.Weight) {
+				t.Fatalf(
+					"%s: record %d has priority %d and "+
+						"weight %d, want offset %d",
+					name,
+					i,
+					b.Priority,
+					b.Weight,
+					want,
+				)
+			}
+			ans = fmt.Sprintf(
+				"%d %d %d %s",
+				b.Priority,
+				b.Weight,
+				b.Port,
+				b.Target,
+			)
+			default:
+				t.Fatalf("%s: unexpected %T", name, b)
+			}
+			n, err := g.DecodeResponse(buf, ans)
+			if nil != err {
+				t.Fatalf(
+					"%s: decoding record %d (%q): %s",
+					name,
+					i,
+					ans,
+					err,
+				)
+			}
+			got = append(got, buf[:n]...)
+		}
+		if !bytes.HasPrefix(got, p[:used]) ||
+			(len(got) != used &&
+				dnsmessage.TypeA != qtype &&
+				dnsmessage.TypeAAAA != qtype) {
+			t.Fatalf(
+				"%s: decoded %02x, want %02x",
+				name,
+				got,
+				p[:used],
+			)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package answer
+
+/*
+ * name.go
+ * File chunks in domain names
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base32"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// NameMax is the maximum amount of a file to put in a domain name.  It
+// base32-encodes to 160 characters, which leaves room for a zone of up to 90
+// characters.
+const NameMax = dnsfservget.MaxNameDecode
+
+/* nameEncoding is how file chunks are encoded in domain names */
+var nameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MXSequence returns the preference for an MX record holding the chunk at
+// offset foff, which is the chunk's sequence number, wrapped to fit.
+func MXSequence(foff uint64) uint16 {
+	return uint16(foff / NameMax)
+}
+
+// NameChunk returns a name in zone, which must be fully-qualified, made of
+// labels holding b.
+func NameChunk(b []byte, zone string) (dnsmessage.Name, error) {
+	e := strings.ToLower(nameEncoding.EncodeToString(b))
+	var sb strings.Builder
+	for 0 != len(e) {
+		n := len(e)
+		if 63 < n {
+			n = 63
+		}
+		sb.WriteString(e[:n])
+		sb.WriteByte('.')
+		e = e[n:]
+	}
+	sb.WriteString(zone)
+	return dnsmessage.NewName(sb.String())
+}
@@ -0,0 +1,38 @@
+package answer
+
+/*
+ * pad.go
+ * Pad TXT and NULL chunks to hide their sizes
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Padded returns true if chunks in records of type qtype are padded when
+// asked.
+func Padded(qtype dnsmessage.Type) bool {
+	return dnsmessage.TypeTXT == qtype || TypeNULL == qtype
+}
+
+// Pad appends dnsfservget.PadMarker to p and then enough NULs to make it a
+// multiple of bucket bytes long, but not more than max.  If bucket is 0, p is
+// padded to max bytes.
+func Pad(p []byte, max, bucket int) []byte {
+	p = append(p, dnsfservget.PadMarker)
+	want := max
+	if 0 != bucket {
+		want = (len(p) + bucket - 1) / bucket * bucket
+	}
+	if max < want {
+		want = max
+	}
+	for len(p) < want {
+		p = append(p, 0)
+	}
+	return p
+}
@@ -0,0 +1,25 @@
+package answer
+
+/*
+ * servfail.go
+ * Fail queries we can't answer
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "golang.org/x/net/dns/dnsmessage"
+
+// Servfail returns a SERVFAIL response to the query in q.
+func Servfail(q []byte) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(q); nil != err {
+		return nil, err
+	}
+	msg.Header.Response = true
+	msg.Header.RCode = dnsmessage.RCodeServerFailure
+	msg.Answers = nil
+	msg.Authorities = nil
+	msg.Additionals = nil
+	return msg.Pack()
+}
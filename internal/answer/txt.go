@@ -0,0 +1,40 @@
+package answer
+
+/*
+ * txt.go
+ * TXT records describing files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// MetaTXT returns the TXT record served for a file's metadata, given its size,
+// SHA256 hash, and generation.
+func MetaTXT(size int64, sum []byte, gen int64) string {
+	return fmt.Sprintf("size=%d sha256=%x gen=%d", size, sum, gen)
+}
+
+// CRCTXT returns the TXT record served for the checksum c of part of a file.
+func CRCTXT(c uint32) string {
+	return fmt.Sprintf("crc32=%08x", c)
+}
+
+// ProbeTXT returns the TXT record served for a probe for a file which exists,
+// given its size, modification time in Unix seconds, and generation.
+func ProbeTXT(size, mtime, gen int64) string {
+	return fmt.Sprintf("exists=1 size=%d mtime=%d gen=%d", size, mtime, gen)
+}
+
+// NoFileTXT is the TXT record served for a probe for a file which doesn't
+// exist.
+const NoFileTXT = "exists=0"
+
+// KeyTXT returns the TXT record served for the X25519 public key pub.
+func KeyTXT(pub []byte) string {
+	return "x25519=" + base64.RawStdEncoding.EncodeToString(pub)
+}
@@ -0,0 +1,160 @@
+package main
+
+/*
+ * logfile.go
+ * Rotating log file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* rotatedTimeFormat is appended to the name of rotated log files */
+const rotatedTimeFormat = "20060102150405.000000"
+
+/* rotatingLog is an io.Writer which writes to a file which is rotated when
+it gets too big or too old.  Only the newest few rotated files are kept. */
+type rotatingLog struct {
+	path    string        /* Log file path */
+	maxSize int64         /* Rotate after this many bytes, if not 0 */
+	maxAge  time.Duration /* Rotate after this long, if not 0 */
+	keep    int           /* Number of rotated files to keep */
+
+	l      sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+/* newRotatingLog opens the log file at path, creating it if necessary. */
+func newRotatingLog(
+	path string,
+	maxSize int64,
+	maxAge time.Duration,
+	keep int,
+) (*rotatingLog, error) {
+	r := &rotatingLog{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		keep:    keep,
+	}
+	if err := r.open(); nil != err {
+		return nil, err
+	}
+	return r, nil
+}
+
+/* Write implements io.Writer.  The file is rotated first if writing p would
+make it too big or if it's too old.  If rotating fails, p is still written to
+whichever file we have, as losing logs is worse than big logs. */
+func (r *rotatingLog) Write(p []byte) (int, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	/* Rotate if it's time */
+	var rerr error
+	if nil == r.f ||
+		(0 != r.maxSize && r.size+int64(len(p)) > r.maxSize &&
+			0 != r.size) ||
+		(0 != r.maxAge && time.Since(r.opened) > r.maxAge) {
+		if err := r.rotate(); nil != err {
+			rerr = fmt.Errorf("rotating log: %w", err)
+		}
+	}
+	if nil == r.f {
+		return 0, rerr
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if nil == err {
+		err = rerr
+	}
+	return n, err
+}
+
+/* open opens r.path for appending.  r.l must be held. */
+func (r *rotatingLog) open() error {
+	f, err := os.OpenFile(
+		r.path,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		0600,
+	)
+	if nil != err {
+		return err
+	}
+	fi, err := f.Stat()
+	if nil != err {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+/* rotate moves the current log file out of the way, opens a new one, and
+removes all but the newest r.keep rotated log files.  If the file can't be
+moved, it's opened again.  If no file can be opened, r.f is nil.  r.l must be
+held. */
+func (r *rotatingLog) rotate() error {
+	/* Move the old file out of the way */
+	var err error
+	if nil != r.f {
+		if err = r.f.Close(); nil != err {
+			err = fmt.Errorf("closing %s: %w", r.path, err)
+		}
+		r.f = nil
+	}
+	if nil == err {
+		err = os.Rename(
+			r.path,
+			r.path+"."+time.Now().Format(rotatedTimeFormat),
+		)
+	}
+
+	/* Whether or not that worked, we need somewhere to log */
+	if oerr := r.open(); nil != oerr {
+		return errors.Join(err, oerr)
+	} else if nil != err {
+		return err
+	}
+
+	/* Get rid of old files, but not anything else which happens to
+	start with the log file's name.  The names sort by time. */
+	ms, err := filepath.Glob(r.path + ".*")
+	if nil != err {
+		return err
+	}
+	var old []string
+	for _, m := range ms {
+		if _, err := time.Parse(
+			rotatedTimeFormat,
+			strings.TrimPrefix(m, r.path+"."),
+		); nil == err {
+			old = append(old, m)
+		}
+	}
+	sort.Strings(old)
+	if len(old) <= r.keep {
+		return nil
+	}
+	for _, o := range old[:len(old)-r.keep] {
+		if err := os.Remove(o); nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+/*
+ * logfile_test.go
+ * Tests for rotating logfiles
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	/* Files which aren't rotated logs should survive rotation */
+	others := []string{path + ".bak", path + ".20261015"}
+	for _, o := range others {
+		if err := ioutil.WriteFile(o, nil, 0600); nil != err {
+			t.Fatalf("Writing %s: %s", o, err)
+		}
+	}
+
+	r, err := newRotatingLog(path, 10, 0, 2)
+	if nil != err {
+		t.Fatalf("Opening log: %s", err)
+	}
+	defer func() { r.f.Close() }()
+	writes := []string{"0123456789", "abcdefghij", "k", "lmnopqrstu", "v"}
+	for _, w := range writes {
+		/* Rotated names have microseconds */
+		time.Sleep(time.Millisecond)
+		if _, err := r.Write([]byte(w)); nil != err {
+			t.Fatalf("Writing %q: %s", w, err)
+		}
+	}
+
+	/* Should have the newest two rotated files and the current one */
+	old, err := filepath.Glob(path + ".2*.*")
+	if nil != err {
+		t.Fatalf("Glob: %s", err)
+	}
+	if 2 != len(old) {
+		t.Fatalf("Have %d rotated files, want 2: %q", len(old), old)
+	}
+	for i, want := range []string{"k", "lmnopqrstu"} {
+		if got, err := ioutil.ReadFile(old[i]); nil != err {
+			t.Errorf("Reading %s: %s", old[i], err)
+		} else if want != string(got) {
+			t.Errorf("%s has %q, want %q", old[i], got, want)
+		}
+	}
+	if got, err := ioutil.ReadFile(path); nil != err {
+		t.Errorf("Reading log: %s", err)
+	} else if "v" != string(got) {
+		t.Errorf("Log has %q", got)
+	}
+	for _, o := range others {
+		if _, err := os.Stat(o); nil != err {
+			t.Errorf("Non-log %s: %s", o, err)
+		}
+	}
+
+	/* If we can't move the file, we should keep logging */
+	if err := os.Remove(path); nil != err {
+		t.Fatalf("Removing log: %s", err)
+	}
+	if _, err := r.Write([]byte("wxyzabcdef")); nil == err {
+		t.Errorf("No error rotating missing file")
+	}
+	if got, err := ioutil.ReadFile(path); nil != err {
+		t.Errorf("Reading log after failed rotation: %s", err)
+	} else if "wxyzabcdef" != string(got) {
+		t.Errorf("Log after failed rotation has %q", got)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := r.Write([]byte("g")); nil != err {
+		t.Errorf("Writing after failed rotation: %s", err)
+	}
+}
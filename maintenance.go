@@ -0,0 +1,98 @@
+package main
+
+/*
+ * maintenance.go
+ * Stop serving files while they're being changed
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"sync/atomic"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	/* ednsOptionEDE is the EDNS0 option code for Extended DNS Errors
+	(RFC 8914) */
+	ednsOptionEDE = 15
+
+	/* edeNotReady is the Extended DNS Error info code for Not Ready */
+	edeNotReady = 14
+
+	/* maintenanceText is sent along with edeNotReady */
+	maintenanceText = "maintenance"
+)
+
+/* maintenance is nonzero when we're in maintenance mode and shouldn't serve
+files */
+var maintenance int32
+
+/* setMaintenance puts us into or takes us out of maintenance mode. */
+func setMaintenance(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	if atomic.SwapInt32(&maintenance, v) == v {
+		return
+	}
+	if on {
+		log.Printf("Entering maintenance mode")
+	} else {
+		log.Printf("Leaving maintenance mode")
+	}
+}
+
+/* inMaintenance returns true if we're in maintenance mode. */
+func inMaintenance() bool {
+	return 0 != atomic.LoadInt32(&maintenance)
+}
+
+/* sendMaintenance sends a SERVFAIL with an Extended DNS Error saying we're
+not ready in response to the query in msg.  The EDE is only sent if the query
+had an OPT record. */
+func sendMaintenance(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	msg.RCode = dnsmessage.RCodeServerFailure
+
+	/* Replace the query's OPT record with one with the EDE */
+	for i, a := range msg.Additionals {
+		if dnsmessage.TypeOPT != a.Header.Type {
+			continue
+		}
+		ede := make([]byte, 2, 2+len(maintenanceText))
+		binary.BigEndian.PutUint16(ede, edeNotReady)
+		ede = append(ede, maintenanceText...)
+		msg.Additionals[i].Header.TTL = 0
+		msg.Additionals[i].Body = &dnsmessage.OPTResource{
+			Options: []dnsmessage.Option{{
+				Code: ednsOptionEDE,
+				Data: ede,
+			}},
+		}
+		break
+	}
+
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf(
+			"[%s] Error sending maintenance response for %q: %s",
+			la,
+			q,
+			err,
+		)
+		return
+	}
+	log.Printf("[%s] In maintenance, not serving %q", la, q)
+}
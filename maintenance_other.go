@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+/*
+ * maintenance_other.go
+ * No SIGUSR1 to toggle maintenance mode
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+/* watchMaintenanceSignal is a no-op, as there's no SIGUSR1. */
+func watchMaintenanceSignal() {}
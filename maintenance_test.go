@@ -0,0 +1,63 @@
+package main
+
+/*
+ * maintenance_test.go
+ * Tests for maintenance mode
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleMaintenance(t *testing.T) {
+	testServe(t)
+	setMaintenance(true)
+	defer setMaintenance(false)
+
+	/* Query with EDNS0 */
+	q := testMessage("0-payload.files.example.com.", dnsmessage.TypeA)
+	var opt dnsmessage.Resource
+	if err := opt.Header.SetEDNS0(
+		1232,
+		dnsmessage.RCodeSuccess,
+		false,
+	); nil != err {
+		t.Fatalf("SetEDNS0: %s", err)
+	}
+	opt.Body = &dnsmessage.OPTResource{}
+	q.Additionals = append(q.Additionals, opt)
+
+	m := testExchange(t, q)
+	if nil == m {
+		t.Fatalf("No response")
+	}
+	if dnsmessage.RCodeServerFailure != m.RCode {
+		t.Errorf("RCode %s", m.RCode)
+	}
+	if 0 != len(m.Answers) {
+		t.Errorf("Got %d answers", len(m.Answers))
+	}
+	if 1 != len(m.Additionals) {
+		t.Fatalf("Got %d additionals", len(m.Additionals))
+	}
+	o, ok := m.Additionals[0].Body.(*dnsmessage.OPTResource)
+	if !ok || 1 != len(o.Options) || ednsOptionEDE != o.Options[0].Code {
+		t.Fatalf("No EDE in %v", m.Additionals[0].Body)
+	}
+	if d := o.Options[0].Data; 2 > len(d) ||
+		edeNotReady != int(d[0])<<8|int(d[1]) {
+		t.Errorf("Incorrect EDE %02x", d)
+	}
+
+	/* Out of maintenance, the file's back */
+	setMaintenance(false)
+	m = testQuery(t, "0-payload.files.example.com.", dnsmessage.TypeA)
+	if nil == m || 1 != len(m.Answers) {
+		t.Errorf("File not served after maintenance")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+/*
+ * maintenance_unix.go
+ * Toggle maintenance mode with SIGUSR1
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/* watchMaintenanceSignal toggles maintenance mode every time we get a
+SIGUSR1. */
+func watchMaintenanceSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	for range ch {
+		setMaintenance(!inMaintenance())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+/*
+ * meta.go
+ * Serve file metadata
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* metaLabel replaces the offset in queries for a file's metadata.  It's not
+valid base36, so it can't be confused with an offset. */
+const metaLabel = "_meta"
+
+/* metas caches files' metadata */
+var metas = metaCache{m: make(map[string]fileMeta)}
+
+/* fileMeta is the metadata for a file, as well as enough information about
+the file to tell if it's changed since the metadata was generated */
+type fileMeta struct {
+	txt     string
+	size    int64
+	modTime time.Time
+}
+
+/* metaCache caches files' metadata, to save hashing files over and over. */
+type metaCache struct {
+	l sync.Mutex
+	m map[string]fileMeta
+}
+
+/* get returns the metadata for the file named fname, described by fi, in the
+form in which it's served.  Metadata is of the form
+  size=<size> sha256=<hex hash> gen=<modification time in Unix nanoseconds>
+The file is hashed without holding c.l, so a big file doesn't hold up queries
+for other files' metadata. */
+func (c *metaCache) get(fname string, fi os.FileInfo) (string, error) {
+	/* If we already have it and the file hasn't changed, easy day */
+	c.l.Lock()
+	fm, ok := c.m[fname]
+	c.l.Unlock()
+	if ok && fm.size == fi.Size() && fm.modTime.Equal(fi.ModTime()) {
+		return fm.txt, nil
+	}
+
+	/* Hash the file */
+	f, err := openFile(fname)
+	if nil != err {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); nil != err {
+		return "", fmt.Errorf("hashing: %w", err)
+	}
+
+	/* Save the metadata for next time */
+	fm = fileMeta{
+		txt: answer.MetaTXT(
+			fi.Size(),
+			h.Sum(nil),
+			fi.ModTime().UnixNano(),
+		),
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+	}
+	c.l.Lock()
+	c.m[fname] = fm
+	c.l.Unlock()
+	return fm.txt, nil
+}
+
+/* sendMeta responds to the query for the metadata for the file named fname,
+described by fi, in msg, which came from addr via pc.  The buffer buf is used
+to send the response, whose answer has a TTL of rttl.  Only TXT queries get an
+answer. */
+func sendMeta(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	fname string,
+	fi os.FileInfo,
+	rttl uint32,
+) {
+	la := logAddr(addr)
+	if dnsmessage.TypeTXT != msg.Questions[0].Type {
+		log.Printf(
+			"[%s] Unsupported %s metadata request for %q",
+			la,
+			msg.Questions[0].Type,
+			q,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrNeedsTXT)
+		return
+	}
+
+	/* Work out the metadata */
+	txt, err := metas.get(fname, fi)
+	if nil != err {
+		log.Printf(
+			"[%s] Error getting metadata for %s for %q: %s",
+			la,
+			fname,
+			q,
+			err,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrMeta)
+		return
+	}
+
+	/* Send it back */
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+			TTL:   rttl,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{txt}},
+	})
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending metadata: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Sent metadata for %s for %s", la, fname, q)
+}
@@ -0,0 +1,27 @@
+package main
+
+/*
+ * multi.go
+ * Serve several chunks in one answer
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "golang.org/x/net/dns/dnsmessage"
+
+const (
+	/* multiLabel goes before the offset in queries for multiAnswers
+	chunks at once, which are only served in A and AAAA records */
+	multiLabel = "_m"
+
+	/* multiAnswers is the number of records in answers to queries with
+	multiLabel */
+	multiAnswers = 12
+)
+
+/* isMultiType returns true if queries for multiple chunks with multiLabel are
+served in records of type qtype. */
+func isMultiType(qtype dnsmessage.Type) bool {
+	return dnsmessage.TypeA == qtype || dnsmessage.TypeAAAA == qtype
+}
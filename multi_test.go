@@ -0,0 +1,90 @@
+package main
+
+/*
+ * multi_test.go
+ * Tests for multi-record answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleMulti(t *testing.T) {
+	testServe(t)
+	contents := bytes.Repeat([]byte("kittens"), 10)
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "multi"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+	for _, c := range []struct {
+		qtype dnsmessage.Type
+		gtype dnsfservget.QType
+		off   int
+		n     int
+	}{
+		{dnsmessage.TypeA, dnsfservget.TypeMultiA, 0, multiAnswers},
+		{dnsmessage.TypeA, dnsfservget.TypeMultiA, 36, multiAnswers},
+		{dnsmessage.TypeAAAA, dnsfservget.TypeMultiAAAA, 0, 9},
+		{dnsmessage.TypeAAAA, dnsfservget.TypeMultiAAAA, 48, 3},
+	} {
+		m := testQuery(
+			t,
+			fmt.Sprintf(
+				"_m-%s-multi.files.example.com.",
+				strconv.FormatInt(int64(c.off), 36),
+			),
+			c.qtype,
+		)
+		if nil == m || c.n != len(m.Answers) {
+			t.Errorf("%s at %d: wrong number of answers", c.qtype, c.off)
+			continue
+		}
+
+		/* Shuffled answers should still decode */
+		var as []string
+		for i := len(m.Answers) - 1; 0 <= i; i-- {
+			switch b := m.Answers[i].Body.(type) {
+			case *dnsmessage.AResource:
+				as = append(as, netip.AddrFrom4(b.A).String())
+			case *dnsmessage.AAAAResource:
+				as = append(as, netip.AddrFrom16(b.AAAA).String())
+			}
+		}
+		g := dnsfservget.Getter{Type: c.gtype}
+		buf := make([]byte, 8*multiAnswers)
+		n, err := g.DecodeResponse(buf, strings.Join(as, " "))
+		if nil != err {
+			t.Errorf("%s at %d: %s", c.qtype, c.off, err)
+			continue
+		}
+		want := contents[c.off:]
+		if len(want) > n {
+			want = want[:n]
+		}
+		if !bytes.Equal(want, bytes.TrimRight(buf[:n], "\x00")) {
+			t.Errorf("%s at %d: got %q", c.qtype, c.off, buf[:n])
+		}
+	}
+
+	/* Only A and AAAA get several chunks */
+	m := testQuery(t, "_m-0-multi.files.example.com.", dnsmessage.TypeTXT)
+	if nil == m || 0 != len(m.Answers) {
+		t.Errorf("Got TXT answer for multiple chunks: %v", m)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+/*
+ * nonce.go
+ * Only serve chunks to queries with fresh nonces
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* nonceLabel starts the label holding a query's nonce */
+const nonceLabel = dnsfservget.NonceLabel
+
+/* nonces remembers the nonces we've seen, if -nonce-cache is set */
+var nonces *nonceCache
+
+/* nonceCache remembers the most recently seen nonces, forgetting the least
+recently seen when it's full. */
+type nonceCache struct {
+	max   int           /* Most nonces to remember */
+	grace time.Duration /* How long repeats are allowed, for retries */
+
+	l  sync.Mutex
+	ll *list.List /* Of *nonceEntry, most recent first */
+	m  map[string]*list.Element
+}
+
+/* nonceEntry is a nonce in a nonceCache */
+type nonceEntry struct {
+	key string
+	at  time.Time /* First seen */
+}
+
+/* newNonceCache returns a nonceCache which remembers max nonces and allows
+repeats within grace of a nonce first being seen. */
+func newNonceCache(max int, grace time.Duration) *nonceCache {
+	return &nonceCache{
+		max:   max,
+		grace: grace,
+		ll:    list.New(),
+		m:     make(map[string]*list.Element),
+	}
+}
+
+/* nonceZone splits a nonce label off the front of the zone from a query, or
+after the CNAME label for CNAME targets, if there is one, and returns the
+nonce and the rest of the zone. */
+func nonceZone(zone string) (nonce, rest string) {
+	nonce, rest, _ = cutZoneLabel(zone, nonceLabel+"-")
+	return nonce, rest
+}
+
+/* fresh returns true if nonce hasn't been seen before, or was first seen
+within the grace period, and notes it as seen.  If it returns false, it also
+returns why not, for logging.  A nonce may be used once for a query and once
+for its CNAME target, as chosen by target. */
+func (c *nonceCache) fresh(nonce string, target bool) (bool, string) {
+	if "" == nonce {
+		return false, "missing nonce"
+	}
+	k := nonce
+	if target {
+		k = cnameLabel + "." + nonce
+	}
+	now := time.Now()
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	/* Seen it before? */
+	if e, ok := c.m[k]; ok {
+		c.ll.MoveToFront(e)
+		if now.Sub(e.Value.(*nonceEntry).at) <= c.grace {
+			return true, ""
+		}
+		return false, "replayed nonce"
+	}
+
+	/* Nope, remember it */
+	c.m[k] = c.ll.PushFront(&nonceEntry{key: k, at: now})
+	for c.max < c.ll.Len() {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.m, e.Value.(*nonceEntry).key)
+	}
+	return true, ""
+}
@@ -0,0 +1,80 @@
+package main
+
+/*
+ * nonce_test.go
+ * Tests for nonce handling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleNonce(t *testing.T) {
+	testServe(t)
+	nonces = newNonceCache(2, 50*time.Millisecond)
+	decoyDir = t.TempDir()
+	defer func() { nonces, decoyDir = nil, "" }()
+	if err := ioutil.WriteFile(
+		filepath.Join(decoyDir, "payload"),
+		[]byte("puppies"),
+		0600,
+	); nil != err {
+		t.Fatalf("Writing decoy: %s", err)
+	}
+
+	/* served returns the first answer's payload for the name */
+	served := func(name string) string {
+		t.Helper()
+		m := testQuery(t, name, dnsmessage.TypeA)
+		if nil == m || 0 == len(m.Answers) {
+			return ""
+		}
+		return string(m.Answers[0].Body.(*dnsmessage.AResource).A[1:])
+	}
+	nq := func(nonce string) string {
+		return "0-payload." + nonceLabel + "-" + nonce +
+			".files.example.com."
+	}
+
+	if got := served("0-payload.files.example.com."); "pup" != got {
+		t.Errorf("No nonce: got %q", got)
+	}
+	if got := served(nq("abc")); "kit" != got {
+		t.Errorf("New nonce: got %q", got)
+	}
+	if got := served(nq("abc")); "kit" != got {
+		t.Errorf("Retry: got %q", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := served(nq("abc")); "pup" != got {
+		t.Errorf("Replay: got %q", got)
+	}
+
+	/* Old nonces are forgotten */
+	for _, n := range []string{"def", "ghi"} {
+		if got := served(nq(n)); "kit" != got {
+			t.Errorf("Nonce %s: got %q", n, got)
+		}
+	}
+	if got := served(nq("abc")); "kit" != got {
+		t.Errorf("Forgotten nonce: got %q", got)
+	}
+
+	/* Metadata doesn't need a nonce */
+	m := testQuery(
+		t,
+		metaLabel+"-payload.files.example.com.",
+		dnsmessage.TypeTXT,
+	)
+	if nil == m || 0 == len(m.Answers) {
+		t.Errorf("No metadata without nonce: %v", m)
+	}
+}
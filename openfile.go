@@ -0,0 +1,151 @@
+package main
+
+/*
+ * openfile.go
+ * Limit how many files are open at once
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	/* openWait is how long to wait for another file to be closed before
+	giving up on opening a file, with -max-open */
+	openWait = time.Second
+
+	/* resourceInterval is how often cache and open file counts are
+	logged */
+	resourceInterval = time.Hour
+)
+
+/* errTooManyOpen is returned by openFile when we've waited too long for
+another file to be closed */
+var errTooManyOpen = errors.New("too many open files")
+
+/* openSlots limits the number of files opened with openFile, if it's not
+nil.  It's set with -max-open. */
+var openSlots chan struct{}
+
+/* openStats counts files opened with openFile */
+var openStats struct {
+	l       sync.Mutex
+	open    uint64 /* Currently open */
+	peak    uint64 /* Most open at once since the last summary */
+	waited  uint64 /* Opens which had to wait for a slot */
+	refused uint64 /* Opens which gave up waiting */
+}
+
+/* setMaxOpen limits the number of files opened with openFile to n. */
+func setMaxOpen(n uint) {
+	openSlots = make(chan struct{}, n)
+}
+
+/* limitedFile is a file opened with openFile.  Closing it lets another file
+be opened. */
+type limitedFile struct {
+	*os.File
+	once sync.Once
+}
+
+/* Close closes the file and frees its slot. */
+func (f *limitedFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(releaseSlot)
+	return err
+}
+
+/* openFile opens the named file for reading.  If -max-open files are already
+open, it waits up to openWait for one to be closed before returning
+errTooManyOpen. */
+func openFile(fname string) (*limitedFile, error) {
+	if err := acquireSlot(); nil != err {
+		return nil, err
+	}
+	f, err := os.Open(fname)
+	if nil != err {
+		releaseSlot()
+		return nil, err
+	}
+	return &limitedFile{File: f}, nil
+}
+
+/* acquireSlot waits for a slot in openSlots, if there's a limit, and counts
+the soon-to-be-open file. */
+func acquireSlot() error {
+	if nil != openSlots {
+		select {
+		case openSlots <- struct{}{}:
+		default:
+			openStats.l.Lock()
+			openStats.waited++
+			openStats.l.Unlock()
+			t := time.NewTimer(openWait)
+			defer t.Stop()
+			select {
+			case openSlots <- struct{}{}:
+			case <-t.C:
+				openStats.l.Lock()
+				openStats.refused++
+				openStats.l.Unlock()
+				return errTooManyOpen
+			}
+		}
+	}
+	openStats.l.Lock()
+	defer openStats.l.Unlock()
+	openStats.open++
+	if openStats.open > openStats.peak {
+		openStats.peak = openStats.open
+	}
+	return nil
+}
+
+/* releaseSlot frees a slot taken with acquireSlot. */
+func releaseSlot() {
+	openStats.l.Lock()
+	openStats.open--
+	openStats.l.Unlock()
+	if nil != openSlots {
+		<-openSlots
+	}
+}
+
+/* summarizeResources logs the chunk cache's and open files' stats every
+interval, if there was anything going on.  It never returns. */
+func summarizeResources(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		n, bytes, hits, misses, evictions := chunks.stats()
+		openStats.l.Lock()
+		peak, waited, refused := openStats.peak, openStats.waited,
+			openStats.refused
+		openStats.peak = openStats.open
+		openStats.waited, openStats.refused = 0, 0
+		openStats.l.Unlock()
+		if 0 == hits+misses && 0 == peak {
+			continue
+		}
+		log.Printf(
+			"In the last %s: cache held %d chunks (~%d bytes), "+
+				"%d hits, %d misses, %d evictions; at most %d "+
+				"files open, %d opens waited, %d refused",
+			interval,
+			n,
+			bytes,
+			hits,
+			misses,
+			evictions,
+			peak,
+			waited,
+			refused,
+		)
+	}
+}
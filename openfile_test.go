@@ -0,0 +1,60 @@
+package main
+
+/*
+ * openfile_test.go
+ * Tests for opening served files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "f")
+	if err := ioutil.WriteFile(fn, []byte("kittens"), 0600); nil != err {
+		t.Fatalf("Writing file: %s", err)
+	}
+	setMaxOpen(1)
+	defer func() { openSlots = nil }()
+
+	/* With one open, the next open waits */
+	f, err := openFile(fn)
+	if nil != err {
+		t.Fatalf("First open: %s", err)
+	}
+	ech := make(chan error, 1)
+	go func() {
+		f, err := openFile(fn)
+		if nil == err {
+			f.Close()
+		}
+		ech <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case err := <-ech:
+		t.Fatalf("Second open didn't wait: %v", err)
+	default:
+	}
+	f.Close()
+	if err := <-ech; nil != err {
+		t.Errorf("Second open: %s", err)
+	}
+
+	/* Unless nothing's closed */
+	f, err = openFile(fn)
+	if nil != err {
+		t.Fatalf("Third open: %s", err)
+	}
+	defer f.Close()
+	if _, err := openFile(fn); !errors.Is(err, errTooManyOpen) {
+		t.Errorf("Open with no free slots: %v", err)
+	}
+}
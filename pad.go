@@ -0,0 +1,30 @@
+package main
+
+/*
+ * pad.go
+ * Pad TXT and NULL chunks to hide their sizes
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "github.com/magisterquis/dnsfserv/dnsfservget"
+
+/* padLabel, between a query's first label and the zone, asks us to pad the
+chunk */
+const padLabel = dnsfservget.PadLabel
+
+/* padBucket is the multiple of bytes to which padded chunks are padded, up
+to a full chunk.  If it's 0, padded chunks are always a full chunk. */
+var padBucket int
+
+/* padZone removes the pad label from the front of the zone from a query, or
+after the CNAME label for CNAME targets, and returns whether it was there and
+the rest of the zone. */
+func padZone(zone string) (pad bool, rest string) {
+	v, rest, ok := cutZoneLabel(zone, padLabel)
+	if !ok || "" != v {
+		return false, zone
+	}
+	return true, rest
+}
@@ -0,0 +1,103 @@
+package main
+
+/*
+ * pad_test.go
+ * Tests for answer padding
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandlePad(t *testing.T) {
+	contents := testServe(t)
+	defer func() { padBucket = 0 }()
+
+	/* padTo returns b followed by the pad marker and NULs to make it n
+	bytes long */
+	padTo := func(b []byte, n int) []byte {
+		p := make([]byte, n)
+		copy(p, b)
+		p[len(b)] = dnsfservget.PadMarker
+		return p
+	}
+	full := int(answer.ChunkSize(dnsmessage.TypeTXT))
+
+	/* Padded and unpadded chunks shouldn't get mixed up in the cache, so
+	ask for each twice.  The bucket size isn't part of a cached chunk's
+	key, so each bucket size gets its own offset. */
+	for i := 0; i < 2; i++ {
+		for _, c := range []struct {
+			name   string
+			bucket int
+			want   []byte
+		}{{
+			"0-payload.example.com.",
+			0,
+			contents,
+		}, {
+			"0-payload." + padLabel + ".example.com.",
+			0,
+			padTo(contents, full),
+		}, {
+			"0-payload." + sequenceLabel + "." + padLabel +
+				".example.com.",
+			0,
+			padTo(append(
+				[]byte{dnsfservget.SequenceByte(0)},
+				contents...,
+			), full),
+		}, {
+			"1-payload." + padLabel + ".example.com.",
+			16,
+			padTo(contents[1:], 16),
+		}} {
+			padBucket = c.bucket
+			m := testQuery(t, c.name, dnsmessage.TypeTXT)
+			if nil == m || 1 != len(m.Answers) {
+				t.Fatalf("%s: bad response %v", c.name, m)
+			}
+			txt := m.Answers[0].Body.(*dnsmessage.TXTResource).TXT
+			got, err := base64.RawStdEncoding.DecodeString(
+				strings.Join(txt, ""),
+			)
+			if nil != err {
+				t.Fatalf("%s: decoding answer: %s", c.name, err)
+			}
+			if !bytes.Equal(c.want, got) {
+				t.Errorf(
+					"%s (bucket %d): got %02x, want %02x",
+					c.name,
+					c.bucket,
+					got,
+					c.want,
+				)
+			}
+		}
+	}
+
+	/* A records aren't padded */
+	padBucket = 0
+	m := testQuery(
+		t,
+		"0-payload."+padLabel+".example.com.",
+		dnsmessage.TypeA,
+	)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad A response %v", m)
+	}
+	want := [4]byte{answer.AFirstByte, contents[0], contents[1], contents[2]}
+	if got := m.Answers[0].Body.(*dnsmessage.AResource).A; want != got {
+		t.Errorf("A: got %02x, want %02x", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+/*
+ * plan.go
+ * Work out how much it'll take to serve a file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* planType is a query type for which plan reports */
+type planType struct {
+	qt    dnsfservget.QType
+	rtype dnsmessage.Type
+	label string /* Label before the offset, if any */
+}
+
+/* planTypes are the types for which plan reports, by default */
+var planTypes = []planType{
+	{dnsfservget.TypeA, dnsmessage.TypeA, ""},
+	{dnsfservget.TypeAAAA, dnsmessage.TypeAAAA, ""},
+	{dnsfservget.TypeMultiA, dnsmessage.TypeA, multiLabel},
+	{dnsfservget.TypeMultiAAAA, dnsmessage.TypeAAAA, multiLabel},
+	{dnsfservget.TypeTXT, dnsmessage.TypeTXT, ""},
+	{dnsfservget.TypeBigTXT, dnsmessage.TypeTXT, bigTXTLabel},
+	{dnsfservget.TypeNULL, answer.TypeNULL, ""},
+	{dnsfservget.TypeCNAME, dnsmessage.TypeCNAME, ""},
+	{dnsfservget.TypeMX, dnsmessage.TypeMX, ""},
+	{dnsfservget.TypeSRV, dnsmessage.TypeSRV, ""},
+}
+
+/* planMaxUDP is the largest response which fits in UDP without EDNS0 */
+const planMaxUDP = 512
+
+/* planMain reports how many queries and how many bytes on the wire it'd take
+to get a file with each query type.  It is called with the arguments after
+"plan" on the command line. */
+func planMain(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	var (
+		fname = fs.String(
+			"file",
+			"",
+			"File to plan to serve",
+		)
+		name = fs.String(
+			"name",
+			"",
+			"Name with which to serve the file "+
+				"(default the file's name)",
+		)
+		domain = fs.String(
+			"domain",
+			"files.example.com",
+			"Domain from which the file will be served",
+		)
+		qtype = fs.String(
+			"type",
+			"",
+			"Query `type` for which to plan (default all types)",
+		)
+		rates = fs.String(
+			"rates",
+			"1,10,100",
+			"Comma-separated query `rates`, in queries per second, "+
+				"for which to estimate transfer times",
+		)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v plan [options]
+
+Reports how many queries and how many bytes on the wire it would take to get
+a file with each query type, the largest response, and how long the transfer
+would take at a few query rates.  Responses larger than %d bytes need a
+resolver which uses EDNS0 or retries over TCP.
+
+Options:
+`,
+			os.Args[0],
+			planMaxUDP,
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	/* Make sure we have what we need */
+	if "" == *fname {
+		log.Fatalf("Need a file (-file)")
+	}
+	if "" == *name {
+		*name = filepath.Base(*fname)
+	}
+	fi, err := os.Stat(*fname)
+	if nil != err {
+		log.Fatalf("Error getting info about %s: %s", *fname, err)
+	}
+	var qps []float64
+	for _, r := range strings.Split(*rates, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(r), 64)
+		if nil != err || 0 >= f {
+			log.Fatalf("Invalid query rate %q", r)
+		}
+		qps = append(qps, f)
+	}
+	pts := planTypes
+	if "" != *qtype {
+		pts = nil
+		for _, pt := range planTypes {
+			if strings.EqualFold(string(pt.qt), *qtype) {
+				pts = append(pts, pt)
+			}
+		}
+		if 0 == len(pts) {
+			log.Fatalf("Unknown query type %q", *qtype)
+		}
+	}
+
+	if err := writePlan(
+		os.Stdout,
+		pts,
+		uint64(fi.Size()),
+		*name,
+		strings.Trim(strings.ToLower(*domain), ".")+".",
+		qps,
+	); nil != err {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+/* writePlan writes a table to w of what it'd take to get size bytes of the
+file named name in zone with each of the types in pts, including the query
+which finds the end of the file, and how long it would take at each of the
+rates in qps. */
+func writePlan(
+	w io.Writer,
+	pts []planType,
+	size uint64,
+	name string,
+	zone string,
+	qps []float64,
+) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Type\tQueries\tWire Bytes\tOverhead\tMax Response")
+	for _, r := range qps {
+		fmt.Fprintf(tw, "\t@%gq/s", r)
+	}
+	fmt.Fprintf(tw, "\n")
+	for _, pt := range pts {
+		psize, err := pt.qt.PayloadSize()
+		if nil != err {
+			return err
+		}
+		var (
+			queries, wire uint64
+			maxRes        int
+		)
+		add := func(off, n, count uint64) error {
+			if 0 == count {
+				return nil
+			}
+			qlen, rlen, err := planExchange(pt, name, zone, off, n)
+			if nil != err {
+				return fmt.Errorf("planning %s: %w", pt.qt, err)
+			}
+			queries += count
+			wire += count * uint64(qlen+rlen)
+			if rlen > maxRes {
+				maxRes = rlen
+			}
+			return nil
+		}
+		/* Every full chunk is about the same, then there's what's
+		left and the query which finds the end of the file */
+		full, left := size/uint64(psize), size%uint64(psize)
+		if 0 != full {
+			if err := add(
+				(full-1)*uint64(psize),
+				uint64(psize),
+				full,
+			); nil != err {
+				return err
+			}
+		}
+		if 0 != left {
+			if err := add(full*uint64(psize), left, 1); nil != err {
+				return err
+			}
+		}
+		if err := add(size, 0, 1); nil != err {
+			return err
+		}
+		big := ""
+		if planMaxUDP < maxRes {
+			big = "*"
+		}
+		overhead := "-"
+		if 0 != size {
+			overhead = fmt.Sprintf("%.1fx", float64(wire)/float64(size))
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%d\t%s\t%d%s",
+			pt.qt,
+			queries,
+			wire,
+			overhead,
+			maxRes,
+			big,
+		)
+		for _, r := range qps {
+			fmt.Fprintf(tw, "\t%s", time.Duration(
+				float64(queries)/r*float64(time.Second),
+			).Round(time.Second))
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	if err := tw.Flush(); nil != err {
+		return err
+	}
+	_, err := fmt.Fprintf(
+		w,
+		"* Larger than %d bytes, needs EDNS0 or TCP\n",
+		planMaxUDP,
+	)
+	return err
+}
+
+/* planExchange returns the sizes of the query and response for n bytes at
+offset off of the file named name in zone with the type pt.  If n is 0, the
+response is an NXDomain, for the end of the file. */
+func planExchange(
+	pt planType,
+	name string,
+	zone string,
+	off uint64,
+	n uint64,
+) (qlen, rlen int, err error) {
+	_, q, r, err := packExchange(
+		pt,
+		name,
+		zone,
+		off,
+		make([]byte, n),
+		false,
+	)
+	if nil != err {
+		return 0, 0, err
+	}
+	return len(q), len(r), nil
+}
+
+/* packExchange returns the name queried and the packed query and response
+for the bytes of the file named name in p, which start at offset off, in zone
+with the type pt.  If p is empty, the response is an NXDomain, for the end of
+the file.  If seq is set, the query asks for the chunk to start with its
+sequence byte. */
+func packExchange(
+	pt planType,
+	name string,
+	zone string,
+	off uint64,
+	p []byte,
+	seq bool,
+) (qname string, q, r []byte, err error) {
+	label := strconv.FormatUint(off, 36) + "-" + name
+	if "" != pt.label {
+		label = pt.label + "-" + label
+	}
+	if seq {
+		label += "." + sequenceLabel
+	}
+	qn, err := dnsmessage.NewName(label + "." + zone)
+	if nil != err {
+		return "", nil, nil, err
+	}
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 0xffff, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  qn,
+			Type:  pt.rtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	if q, err = msg.Pack(); nil != err {
+		return "", nil, nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	/* Roll an answer the way handle would */
+	msg.Header.Response = true
+	if 0 == len(p) {
+		msg.Header.RCode = dnsmessage.RCodeNameError
+	} else {
+		ab := answer.Builder{
+			QType: pt.rtype,
+			Zone:  zone,
+			Off:   off,
+			Seq:   seq,
+		}
+		switch pt.label {
+		case bigTXTLabel:
+			ab.Max = answer.BigTXTMax
+		case multiLabel:
+			ab.Multi = true
+		}
+		bodies, _, err := ab.Build(p, answer.MaxBudget)
+		if nil != err {
+			return "", nil, nil, fmt.Errorf(
+				"building answer: %w",
+				err,
+			)
+		}
+		for _, body := range bodies {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  qn,
+					Type:  pt.rtype,
+					Class: dnsmessage.ClassINET,
+				},
+				Body: body,
+			})
+		}
+	}
+	if r, err = msg.Pack(); nil != err {
+		return "", nil, nil, fmt.Errorf("packing response: %w", err)
+	}
+	return qn.String(), q, r, nil
+}
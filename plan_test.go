@@ -0,0 +1,61 @@
+package main
+
+/*
+ * plan_test.go
+ * Tests for transfer plans
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+func TestWritePlan(t *testing.T) {
+	var b bytes.Buffer
+	if err := writePlan(
+		&b,
+		planTypes,
+		1000,
+		"payload",
+		"files.example.com.",
+		[]float64{1, 10},
+	); nil != err {
+		t.Fatalf("writePlan: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(planTypes)+2 != len(lines) {
+		t.Fatalf("Got %d lines:\n%s", len(lines), b.String())
+	}
+	for _, c := range []struct {
+		qt      dnsfservget.QType
+		queries string
+		big     bool
+	}{
+		{dnsfservget.TypeA, "335", false},
+		{dnsfservget.TypeTXT, "8", false},
+		{dnsfservget.TypeBigTXT, "4", true},
+	} {
+		var fs []string
+		for _, l := range lines {
+			if f := strings.Fields(l); string(c.qt) == f[0] {
+				fs = f
+			}
+		}
+		if 7 != len(fs) {
+			t.Errorf("%s: bad line %q", c.qt, fs)
+			continue
+		}
+		if c.queries != fs[1] {
+			t.Errorf("%s: got %s queries, want %s", c.qt, fs[1], c.queries)
+		}
+		if big := strings.HasSuffix(fs[4], "*"); c.big != big {
+			t.Errorf("%s: unexpected max response %s", c.qt, fs[4])
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+/*
+ * probe.go
+ * Answer cheap queries about whether a file exists
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* probeLabel replaces the offset in queries probing a file.  Like metaLabel,
+it's not valid base36. */
+const probeLabel = "_probe"
+
+/* probeCacheTime is how long a file's stat() result is cached for probes */
+const probeCacheTime = 5 * time.Second
+
+/* probes caches files' stat() results for probes */
+var probes = probeCache{m: make(map[string]probeResult)}
+
+/* probeResult is the answer to a probe and when it was worked out */
+type probeResult struct {
+	txt string
+	at  time.Time
+}
+
+/* probeCache caches answers to probes, so lots of probes don't turn into lots
+of stat()s. */
+type probeCache struct {
+	l sync.Mutex
+	m map[string]probeResult
+}
+
+/* get returns the answer to a probe for the file named fname.  Answers are of
+the form
+  exists=<0|1> size=<size> mtime=<Unix time> gen=<modification time in Unix nanoseconds>
+and only have exists=0 if the file doesn't exist.  The file is never opened. */
+func (c *probeCache) get(fname string) (string, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	/* If we've asked recently, no need to ask again */
+	now := time.Now()
+	if pr, ok := c.m[fname]; ok && now.Sub(pr.at) < probeCacheTime {
+		return pr.txt, nil
+	}
+
+	/* Forget old answers */
+	for k, pr := range c.m {
+		if now.Sub(pr.at) >= probeCacheTime {
+			delete(c.m, k)
+		}
+	}
+
+	/* Ask the filesystem */
+	var txt string
+	fi, err := os.Stat(fname)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		txt = answer.NoFileTXT
+	case nil != err:
+		return "", err
+	case !fi.Mode().IsRegular():
+		txt = answer.NoFileTXT
+	default:
+		txt = answer.ProbeTXT(
+			fi.Size(),
+			fi.ModTime().Unix(),
+			fi.ModTime().UnixNano(),
+		)
+	}
+	c.m[fname] = probeResult{txt: txt, at: now}
+	return txt, nil
+}
+
+/* sendProbe responds to the probe for the file named fname in msg, which came
+from addr via pc.  The buffer buf is used to send the response, whose answer
+has a TTL of rttl.  Only TXT queries get an answer. */
+func sendProbe(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+	fname string,
+	rttl uint32,
+) {
+	la := logAddr(addr)
+	if dnsmessage.TypeTXT != msg.Questions[0].Type {
+		log.Printf(
+			"[%s] Unsupported %s probe for %q",
+			la,
+			msg.Questions[0].Type,
+			q,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrNeedsTXT)
+		return
+	}
+
+	/* Work out what's there */
+	txt, err := probes.get(fname)
+	if nil != err {
+		log.Printf(
+			"[%s] Error probing %s for %q: %s",
+			la,
+			fname,
+			q,
+			err,
+		)
+		sendDebugError(pc, addr, buf, msg, q, debugErrProbe)
+		return
+	}
+
+	/* Send it back */
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+			TTL:   rttl,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{txt}},
+	})
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending probe answer: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Sent probe answer for %s for %s", la, fname, q)
+}
@@ -0,0 +1,56 @@
+package main
+
+/*
+ * probe_test.go
+ * Tests for file existence probes
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleProbe(t *testing.T) {
+	contents := testServe(t)
+
+	/* probe returns the answer to a probe for the named file */
+	probe := func(name string) string {
+		t.Helper()
+		q := "_probe-" + name + ".files.example.com."
+		m := testQuery(t, q, dnsmessage.TypeTXT)
+		if nil == m || 1 != len(m.Answers) {
+			t.Fatalf("%s: no answer", q)
+		}
+		txt, ok := m.Answers[0].Body.(*dnsmessage.TXTResource)
+		if !ok || 1 != len(txt.TXT) {
+			t.Fatalf("%s: unexpected answer %v", q, m.Answers[0].Body)
+		}
+		return txt.TXT[0]
+	}
+
+	if got := probe("payload"); !strings.HasPrefix(got, "exists=1 size=7 ") {
+		t.Errorf("Probe for payload got %q", got)
+	}
+	if got := probe("nonesuch"); "exists=0" != got {
+		t.Errorf("Probe for nonexistent file got %q", got)
+	}
+
+	/* Answers are cached for a bit */
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "payload"),
+		append(contents, contents...),
+		0600,
+	); nil != err {
+		t.Fatalf("Rewriting payload: %s", err)
+	}
+	if got := probe("payload"); !strings.HasPrefix(got, "exists=1 size=7 ") {
+		t.Errorf("Cached answer not used, got %q", got)
+	}
+}
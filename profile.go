@@ -0,0 +1,143 @@
+package main
+
+/*
+ * profile.go
+ * Traffic profiles, to look like something else
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* profile is a set of settings which together make responses look like they
+came from something else.  Clients ignore the first byte of A records and the
+first eight bytes of AAAA records, so they can be anything. */
+type profile struct {
+	ttl          uint      /* TTL, unless -ttl is given */
+	aFirstBytes  []byte    /* First bytes of A records */
+	aaaaPrefixes [][8]byte /* First eight bytes of AAAA records */
+	jitterMin    time.Duration
+	jitterMax    time.Duration
+}
+
+/* profiles are the profiles selectable with -profile */
+var profiles = map[string]profile{
+	"cdn": {
+		ttl:         60,
+		aFirstBytes: []byte{13, 23, 104, 151, 172},
+		aaaaPrefixes: [][8]byte{
+			{0x26, 0x00, 0x90, 0x00, 0x20, 0x00, 0x00, 0x00},
+			{0x26, 0x06, 0x47, 0x00, 0x00, 0x00, 0x00, 0x00},
+			{0x2a, 0x04, 0x4e, 0x42, 0x00, 0x00, 0x00, 0x00},
+			{0x26, 0x00, 0x14, 0x08, 0x00, 0x00, 0x00, 0x00},
+		},
+		jitterMax: 20 * time.Millisecond,
+	},
+	"corporate": {
+		ttl:         3600,
+		aFirstBytes: []byte{12, 63, 192, 198},
+		aaaaPrefixes: [][8]byte{
+			{0x26, 0x20, 0x01, 0x1a, 0x00, 0x00, 0x00, 0x10},
+		},
+		jitterMin: 5 * time.Millisecond,
+		jitterMax: 50 * time.Millisecond,
+	},
+	"residential": {
+		ttl:         300,
+		aFirstBytes: []byte{24, 67, 73, 98},
+		aaaaPrefixes: [][8]byte{
+			{0x26, 0x01, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x00},
+			{0x26, 0x00, 0x17, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		jitterMin: 20 * time.Millisecond,
+		jitterMax: 150 * time.Millisecond,
+	},
+}
+
+var (
+	/* prof is the profile in use, or nil if there isn't one */
+	prof *profile
+
+	/* profRand is used to pick from profile pools */
+	profRand  = rand.New(rand.NewSource(time.Now().UnixNano()))
+	profRandL sync.Mutex
+)
+
+/* setProfile sets prof to the named profile and, if -ttl wasn't given, sets
+ttl to the profile's TTL.  Likewise, if neither -delay-min nor -delay-max was
+given, the profile's jitter sets delayMin and delayMax. */
+func setProfile(name string) error {
+	p, ok := profiles[name]
+	if !ok {
+		var ns []string
+		for n := range profiles {
+			ns = append(ns, n)
+		}
+		sort.Strings(ns)
+		return fmt.Errorf(
+			"unknown profile %q, known profiles: %s",
+			name,
+			strings.Join(ns, ", "),
+		)
+	}
+	prof = &p
+
+	/* An explicit TTL or delay wins */
+	var ttlSet, delaySet bool
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ttl":
+			ttlSet = true
+		case "delay-min", "delay-max":
+			delaySet = true
+		}
+	})
+	if !ttlSet {
+		ttl = p.ttl
+	}
+	if !delaySet {
+		delayMin, delayMax = p.jitterMin, p.jitterMax
+	}
+	return nil
+}
+
+/* disguise returns a copy of body with its prefix picked from the profile's
+pools, if it's an A or AAAA record.  The body passed in is not modified, as it
+may be cached. */
+func (p *profile) disguise(
+	body dnsmessage.ResourceBody,
+) dnsmessage.ResourceBody {
+	profRandL.Lock()
+	defer profRandL.Unlock()
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		if 0 == len(p.aFirstBytes) {
+			return body
+		}
+		a := *b
+		a.A[0] = p.aFirstBytes[profRand.Intn(len(p.aFirstBytes))]
+		return &a
+	case *dnsmessage.AAAAResource:
+		if 0 == len(p.aaaaPrefixes) {
+			return body
+		}
+		a := *b
+		copy(a.AAAA[:], p.aaaaPrefixes[profRand.Intn(
+			len(p.aaaaPrefixes),
+		)][:])
+		return &a
+	default:
+		return body
+	}
+}
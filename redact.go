@@ -0,0 +1,66 @@
+package main
+
+/*
+ * redact.go
+ * Keep client info out of the logs
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+const (
+	/* redactNameLen is the number of characters of a query name to log
+	when redacting */
+	redactNameLen = 8
+
+	/* redactHashLen is the number of bytes of a client address's hash to
+	log when redacting */
+	redactHashLen = 6
+)
+
+/* redactKey is the key used to hash client addresses.  If it's nil, we're not
+redacting. */
+var redactKey []byte
+
+/* startRedacting makes logAddr and logName start redacting. */
+func startRedacting() error {
+	k := make([]byte, sha256.Size)
+	if _, err := rand.Read(k); nil != err {
+		return err
+	}
+	redactKey = k
+	return nil
+}
+
+/* logAddr returns how addr should be logged.  If we're redacting, this is a
+keyed hash of addr's IP address, which is the same for every query from the
+same address but can't be reversed without the key, which is never saved. */
+func logAddr(addr net.Addr) string {
+	if nil == redactKey {
+		return addr.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if nil != err {
+		host = addr.String()
+	}
+	h := hmac.New(sha256.New, redactKey)
+	h.Write([]byte(host))
+	return hex.EncodeToString(h.Sum(nil)[:redactHashLen])
+}
+
+/* logName returns how the query name name should be logged.  If we're
+redacting, this is the first few characters of the name. */
+func logName(name string) string {
+	if nil == redactKey || redactNameLen >= len(name) {
+		return name
+	}
+	return name[:redactNameLen] + "..."
+}
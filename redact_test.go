@@ -0,0 +1,55 @@
+package main
+
+/*
+ * redact_test.go
+ * Tests for log redaction
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	defer func() { redactKey = nil }()
+	name := "0-payload.files.example.com."
+
+	/* Not redacting */
+	if got := logAddr(testAddr); testAddr.String() != got {
+		t.Errorf("Unredacted address: got %s", got)
+	}
+	if got := logName(name); name != got {
+		t.Errorf("Unredacted name: got %s", got)
+	}
+
+	/* Redacting */
+	if err := startRedacting(); nil != err {
+		t.Fatalf("Starting redaction: %s", err)
+	}
+	got := logAddr(testAddr)
+	if 2*redactHashLen != len(got) || strings.Contains(got, "192.0.2") {
+		t.Errorf("Redacted address: got %s", got)
+	}
+	if o := logAddr(&net.UDPAddr{
+		IP:   testAddr.IP,
+		Port: testAddr.Port + 1,
+	}); got != o {
+		t.Errorf("Other port: got %s, want %s", o, got)
+	}
+	if o := logAddr(&net.UDPAddr{
+		IP:   net.IPv4(192, 0, 2, 2),
+		Port: testAddr.Port,
+	}); got == o {
+		t.Errorf("Other address: got the same hash %s", o)
+	}
+	if got := logName(name); name[:redactNameLen]+"..." != got {
+		t.Errorf("Redacted name: got %s", got)
+	}
+	if got := logName("short."); "short." != got {
+		t.Errorf("Redacted short name: got %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+/*
+ * replay.go
+ * Notice captured queries being replayed
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* replayKey identifies a served chunk */
+type replayKey struct {
+	fname string
+	off   uint64
+	qtype dnsmessage.Type
+}
+
+/* replaySource is a source which asked for a file */
+type replaySource struct {
+	host  string
+	fname string
+}
+
+/* replaySeen is the first source to ask for a chunk and when */
+type replaySeen struct {
+	host string
+	at   time.Time
+}
+
+/* replayDetector watches for sources asking for chunks already served to
+other sources. */
+type replayDetector struct {
+	threshold int           /* Repeats before we get suspicious */
+	window    time.Duration /* How long to remember chunks */
+
+	l         sync.Mutex
+	seen      map[replayKey]replaySeen
+	repeats   map[replaySource]int
+	lastSweep time.Time
+}
+
+/* replays detects replays if -replay-threshold is set */
+var replays *replayDetector
+
+/* newReplayDetector returns a new replayDetector which considers threshold
+repeated queries from a source in window to be a replay. */
+func newReplayDetector(threshold int, window time.Duration) *replayDetector {
+	return &replayDetector{
+		threshold: threshold,
+		window:    window,
+		seen:      make(map[replayKey]replaySeen),
+		repeats:   make(map[replaySource]int),
+	}
+}
+
+/* observe notes that addr asked for the chunk of fname at off with a query
+of type qtype.  It returns true when addr has asked for enough chunks
+already served to other sources to look like it's replaying queries.  It
+only returns true once per source and file per window. */
+func (r *replayDetector) observe(
+	addr net.Addr,
+	fname string,
+	off uint64,
+	qtype dnsmessage.Type,
+) bool {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	k := replayKey{fname: fname, off: off, qtype: qtype}
+	now := time.Now()
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	/* Forget old chunks */
+	if now.Sub(r.lastSweep) > r.window {
+		for k, s := range r.seen {
+			if now.Sub(s.at) > r.window {
+				delete(r.seen, k)
+			}
+		}
+		r.repeats = make(map[replaySource]int)
+		r.lastSweep = now
+	}
+
+	/* If this is the first time we've seen this chunk, note who asked */
+	s, ok := r.seen[k]
+	if !ok || now.Sub(s.at) > r.window {
+		r.seen[k] = replaySeen{host: host, at: now}
+		return false
+	}
+	if host == s.host {
+		return false
+	}
+
+	/* Someone else asked first */
+	rs := replaySource{host: host, fname: fname}
+	r.repeats[rs]++
+	return r.threshold == r.repeats[rs]
+}
+
+/* checkReplay checks whether the query from addr for the chunk of fname at
+off looks like a replay and, if so, logs it and fires hname's replay hooks. */
+func checkReplay(
+	addr net.Addr,
+	fname string,
+	hname string,
+	off uint64,
+	qtype dnsmessage.Type,
+) {
+	if !replays.observe(addr, fname, off, qtype) {
+		return
+	}
+	log.Printf(
+		"[%s] Possible replay: %d queries for chunks of %s already "+
+			"served to others",
+		logAddr(addr),
+		replays.threshold,
+		fname,
+	)
+	if nil != hooks && "" != hname {
+		hooks.fire(hname, hookReplay, addr, qtype)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+/*
+ * replay_test.go
+ * Tests for replay detection
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestReplayDetector(t *testing.T) {
+	var (
+		r     = newReplayDetector(3, time.Minute)
+		orig  = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+		other = &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1234}
+	)
+
+	/* The first client asking, and asking again, isn't a replay */
+	for i := 0; i < 2; i++ {
+		for off := uint64(0); off < 10; off += 3 {
+			if r.observe(orig, "payload", off, dnsmessage.TypeA) {
+				t.Fatalf("Original client flagged at offset %d", off)
+			}
+		}
+	}
+
+	/* Someone else asking for the same chunks is */
+	for i, want := range []bool{false, false, true, false} {
+		off := uint64(3 * i)
+		if got := r.observe(
+			other,
+			"payload",
+			off,
+			dnsmessage.TypeA,
+		); got != want {
+			t.Errorf("Query %d: got %t, want %t", i, got, want)
+		}
+	}
+
+	/* New chunks aren't replays */
+	if r.observe(other, "payload", 12, dnsmessage.TypeA) {
+		t.Errorf("New chunk flagged")
+	}
+}
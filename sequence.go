@@ -0,0 +1,26 @@
+package main
+
+/*
+ * sequence.go
+ * Start chunks with a sequence byte
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "github.com/magisterquis/dnsfserv/dnsfservget"
+
+/* sequenceLabel, between a query's first label and the zone, asks us to
+start the chunk with its sequence byte */
+const sequenceLabel = dnsfservget.SequenceLabel
+
+/* sequenceZone removes the sequence label from the front of the zone from a
+query, or after the CNAME label for CNAME targets, and returns whether it was
+there and the rest of the zone. */
+func sequenceZone(zone string) (seq bool, rest string) {
+	v, rest, ok := cutZoneLabel(zone, sequenceLabel)
+	if !ok || "" != v {
+		return false, zone
+	}
+	return true, rest
+}
@@ -0,0 +1,87 @@
+package main
+
+/*
+ * sequence_test.go
+ * Tests for sequence numbers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleSequence(t *testing.T) {
+	contents := testServe(t)
+
+	/* Chunks with and without sequence bytes shouldn't get mixed up in
+	the cache, so ask for each twice */
+	for i := 0; i < 2; i++ {
+		for _, c := range []struct {
+			name string
+			want []byte
+		}{{
+			"0-payload.example.com.",
+			contents,
+		}, {
+			"0-payload." + sequenceLabel + ".example.com.",
+			append(
+				[]byte{dnsfservget.SequenceByte(0)},
+				contents...,
+			),
+		}, {
+			"2-payload." + sequenceLabel + ".example.com.",
+			append(
+				[]byte{dnsfservget.SequenceByte(2)},
+				contents[2:]...,
+			),
+		}} {
+			m := testQuery(t, c.name, dnsmessage.TypeTXT)
+			if nil == m || 1 != len(m.Answers) {
+				t.Fatalf("%s: bad response %v", c.name, m)
+			}
+			txt := m.Answers[0].Body.(*dnsmessage.TXTResource).TXT
+			got, err := base64.RawStdEncoding.DecodeString(
+				strings.Join(txt, ""),
+			)
+			if nil != err {
+				t.Fatalf("%s: decoding answer: %s", c.name, err)
+			}
+			if !bytes.Equal(c.want, got) {
+				t.Errorf(
+					"%s: got %02x, want %02x",
+					c.name,
+					got,
+					c.want,
+				)
+			}
+		}
+	}
+
+	/* A records only have room for two more bytes */
+	m := testQuery(
+		t,
+		"3-payload."+sequenceLabel+".example.com.",
+		dnsmessage.TypeA,
+	)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad A response %v", m)
+	}
+	want := [4]byte{
+		answer.AFirstByte,
+		dnsfservget.SequenceByte(3),
+		contents[3],
+		contents[4],
+	}
+	if got := m.Answers[0].Body.(*dnsmessage.AResource).A; want != got {
+		t.Errorf("A: got %02x, want %02x", got, want)
+	}
+}
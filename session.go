@@ -0,0 +1,215 @@
+package main
+
+/*
+ * session.go
+ * Handshakes and per-transfer session keys
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	/* keyLabel replaces the offset in queries for our public key */
+	keyLabel = dnsfservget.KeyLabel
+
+	/* sessionLabel starts the label, between the usual query's first
+	label and the zone, holding a client's public key */
+	sessionLabel = dnsfservget.SessionLabel
+
+	/* sessionInterval is how often session counts are logged */
+	sessionInterval = time.Hour
+)
+
+/* sessions holds the keys for recent handshakes.  It's nil if handshakes are
+disabled. */
+var sessions *sessionTable
+
+/* serverSession is our side of one client's session */
+type serverSession struct {
+	key  []byte
+	last time.Time /* Last use */
+}
+
+/* sessionTable holds up to max sessions, each of which is forgotten if it's
+not used for ttl.  Sessions are keyed by the client's public key, as it
+appears in query names, and all use the same ephemeral key, which is made when
+the table is made and never saved. */
+type sessionTable struct {
+	priv *ecdh.PrivateKey
+	max  int
+	ttl  time.Duration
+
+	l sync.Mutex
+	m map[string]*serverSession
+
+	/* Counts since the last summary */
+	started uint64
+	expired uint64
+	evicted uint64
+}
+
+/* newSessionTable returns a new sessionTable with a new key. */
+func newSessionTable(max int, ttl time.Duration) (*sessionTable, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if nil != err {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	return &sessionTable{
+		priv: priv,
+		max:  max,
+		ttl:  ttl,
+		m:    make(map[string]*serverSession),
+	}, nil
+}
+
+/* publicKey returns st's public key, as served in TXT records */
+func (st *sessionTable) publicKey() string {
+	return answer.KeyTXT(st.priv.PublicKey().Bytes())
+}
+
+/* key returns the session key for the client with the base32-encoded public
+key cpub, starting a session if there isn't one.  The returned bool is true if
+the session is new. */
+func (st *sessionTable) key(cpub string) ([]byte, bool, error) {
+	st.l.Lock()
+	defer st.l.Unlock()
+	now := time.Now()
+	if s, ok := st.m[cpub]; ok && now.Sub(s.last) < st.ttl {
+		s.last = now
+		return s.key, false, nil
+	}
+
+	/* New session, work out the key */
+	b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(
+		strings.ToUpper(cpub),
+	)
+	if nil != err {
+		return nil, false, fmt.Errorf("decoding client key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(b)
+	if nil != err {
+		return nil, false, fmt.Errorf("parsing client key: %w", err)
+	}
+	shared, err := st.priv.ECDH(pub)
+	if nil != err {
+		return nil, false, fmt.Errorf(
+			"computing shared secret: %w",
+			err,
+		)
+	}
+
+	/* Make room for it */
+	st.expire(now)
+	for len(st.m) >= st.max {
+		var (
+			oldest string
+			ot     time.Time
+		)
+		for k, s := range st.m {
+			if "" == oldest || s.last.Before(ot) {
+				oldest, ot = k, s.last
+			}
+		}
+		delete(st.m, oldest)
+		st.evicted++
+	}
+	s := &serverSession{
+		key:  dnsfservget.SessionKey(shared, st.priv.PublicKey().Bytes(), b),
+		last: now,
+	}
+	st.m[cpub] = s
+	st.started++
+	return s.key, true, nil
+}
+
+/* expire removes sessions unused since ttl before now.  st.l must be held. */
+func (st *sessionTable) expire(now time.Time) {
+	for k, s := range st.m {
+		if now.Sub(s.last) >= st.ttl {
+			delete(st.m, k)
+			st.expired++
+		}
+	}
+}
+
+/* summarize logs and resets the session counts every interval, if there's
+been any activity.  It never returns. */
+func (st *sessionTable) summarize(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		st.l.Lock()
+		st.expire(time.Now())
+		started, expired, evicted := st.started, st.expired, st.evicted
+		active := len(st.m)
+		st.started, st.expired, st.evicted = 0, 0, 0
+		st.l.Unlock()
+		if 0 == started+expired+evicted && 0 == active {
+			continue
+		}
+		log.Printf(
+			"Sessions in the last %s: active=%d started=%d "+
+				"expired=%d evicted=%d",
+			interval,
+			active,
+			started,
+			expired,
+			evicted,
+		)
+	}
+}
+
+/* sendKey answers a TXT query in msg, which came from addr via pc, with our
+public key.  The buffer buf is used to send the response. */
+func sendKey(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	if nil == sessions || dnsmessage.TypeTXT != msg.Questions[0].Type {
+		sendNoData(pc, addr, buf, msg, q)
+		return
+	}
+	msg.Answers = append(msg.Answers, dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  msg.Questions[0].Name,
+			Type:  msg.Questions[0].Type,
+			Class: msg.Questions[0].Class,
+		},
+		Body: &dnsmessage.TXTResource{TXT: []string{
+			sessions.publicKey(),
+		}},
+	})
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending key: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Sent key for %q", la, q)
+}
+
+/* sessionZone splits the session label off the front of zone, or from after
+the CNAME label for CNAME targets, and returns the client's public key and the
+rest of the zone.  If there's no session label, cpub is empty and zone is
+returned as-is. */
+func sessionZone(zone string) (cpub, rest string) {
+	cpub, rest, _ = cutZoneLabel(zone, sessionLabel+"-")
+	return cpub, rest
+}
@@ -0,0 +1,129 @@
+package main
+
+/*
+ * session_test.go
+ * Tests for handshakes and session keys
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleHandshake(t *testing.T) {
+	testServe(t)
+	contents := bytes.Repeat([]byte("kittens"), 10)
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "secret"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+	var err error
+	if sessions, err = newSessionTable(2, time.Minute); nil != err {
+		t.Fatalf("Making session table: %s", err)
+	}
+	defer func() { sessions = nil }()
+
+	/* Get the server's key */
+	m := testQuery(t, "_kx-secret.files.example.com.", dnsmessage.TypeTXT)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad key response: %v", m)
+	}
+	k := strings.TrimPrefix(
+		m.Answers[0].Body.(*dnsmessage.TXTResource).TXT[0],
+		"x25519=",
+	)
+	b, err := base64.RawStdEncoding.DecodeString(k)
+	if nil != err {
+		t.Fatalf("Decoding key %q: %s", k, err)
+	}
+	spub, err := ecdh.X25519().NewPublicKey(b)
+	if nil != err {
+		t.Fatalf("Parsing key: %s", err)
+	}
+
+	/* Get encrypted chunks with a few keys of our own */
+	for i := 0; i < 3; i++ {
+		priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("Generating key: %s", err)
+		}
+		shared, err := priv.ECDH(spub)
+		if nil != err {
+			t.Fatalf("Computing shared secret: %s", err)
+		}
+		cpub := priv.PublicKey().Bytes()
+		skey := dnsfservget.SessionKey(shared, spub.Bytes(), cpub)
+		sl := "_s-" + strings.ToLower(base32.StdEncoding.WithPadding(
+			base32.NoPadding,
+		).EncodeToString(cpub))
+
+		/* QNAME minimization gets nothing */
+		m = testQuery(t, sl+".files.example.com.", dnsmessage.TypeA)
+		if nil == m || 0 != len(m.Answers) {
+			t.Errorf("Got answer for session label: %v", m)
+		}
+
+		for _, off := range []int{0, 5} {
+			m = testQuery(t, fmt.Sprintf(
+				"%d-secret.%s.files.example.com.",
+				off,
+				sl,
+			), dnsmessage.TypeTXT)
+			if nil == m || 1 != len(m.Answers) {
+				t.Fatalf("Bad chunk response: %v", m)
+			}
+			got, err := base64.RawStdEncoding.DecodeString(strings.Join(
+				m.Answers[0].Body.(*dnsmessage.TXTResource).TXT,
+				"",
+			))
+			if nil != err {
+				t.Fatalf("Decoding chunk: %s", err)
+			}
+			if bytes.Equal(got, contents[off:]) {
+				t.Errorf("Chunk at %d not encrypted", off)
+			}
+			if err := dnsfservget.SessionXOR(
+				skey,
+				"secret",
+				uint64(off),
+				got,
+			); nil != err {
+				t.Fatalf("Decrypting chunk: %s", err)
+			}
+			if !bytes.Equal(got, contents[off:]) {
+				t.Errorf("Chunk at %d decrypted to %q", off, got)
+			}
+		}
+	}
+
+	/* The first session should have been evicted */
+	sessions.l.Lock()
+	defer sessions.l.Unlock()
+	if 2 != len(sessions.m) || 3 != sessions.started ||
+		1 != sessions.evicted {
+		t.Errorf(
+			"Sessions: active=%d started=%d evicted=%d",
+			len(sessions.m),
+			sessions.started,
+			sessions.evicted,
+		)
+	}
+}
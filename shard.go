@@ -0,0 +1,187 @@
+package main
+
+/*
+ * shard.go
+ * Count files split between hosts as one delivery
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* shardLabel starts the label saying which shard of a file a query is for */
+const shardLabel = dnsfservget.ShardLabel
+
+/* shardInterval is how often sharded deliveries in progress are logged, and
+shardIdle is how long one may go without a finished shard before it's
+forgotten. */
+const (
+	shardInterval = time.Hour
+	shardIdle     = 24 * time.Hour
+)
+
+/* shardKey identifies a sharded delivery of a file */
+type shardKey struct {
+	fname string
+	id    string
+	count uint64
+}
+
+/* shardGroup tracks the shards of a delivery which have been served */
+type shardGroup struct {
+	done    map[uint64]bool     /* Finished shards */
+	clients map[string]struct{} /* Clients which finished shards */
+	last    time.Time           /* Last finished shard */
+}
+
+/* shards holds sharded deliveries which aren't yet finished */
+var shards = struct {
+	l sync.Mutex
+	m map[shardKey]*shardGroup
+}{m: make(map[shardKey]*shardGroup)}
+
+/* shardZone splits a shard label off the front of the zone from a query, or
+after the CNAME label for CNAME targets, if there is one, and returns the
+label's value and the rest of the zone. */
+func shardZone(zone string) (shard, rest string) {
+	shard, rest, _ = cutZoneLabel(zone, shardLabel+"-")
+	return shard, rest
+}
+
+/* parseShard parses the value of a shard label, which is a shard's index, the
+number of shards, and optionally an ID, separated by dashes.  The index and
+count are in base 36. */
+func parseShard(v string) (index, count uint64, id string, ok bool) {
+	parts := strings.SplitN(v, "-", 3)
+	if 2 > len(parts) {
+		return 0, 0, "", false
+	}
+	var err error
+	if index, err = strconv.ParseUint(parts[0], 36, 64); nil != err {
+		return 0, 0, "", false
+	}
+	if count, err = strconv.ParseUint(parts[1], 36, 64); nil != err {
+		return 0, 0, "", false
+	}
+	if index >= count {
+		return 0, 0, "", false
+	}
+	if 3 == len(parts) {
+		id = parts[2]
+	}
+	return index, count, id, true
+}
+
+/* shardServed notes that sent bytes starting at offset off of fname, which is
+size bytes long, were sent to addr in a chunk of csize bytes, for the shard
+described by shard, a shard label's value.  It returns whether the chunk
+finished its shard and whether it finished every shard of the delivery, which
+is then forgotten.  Queries from which the shard can't be worked out finish
+nothing. */
+func shardServed(
+	shard string,
+	fname string,
+	addr net.Addr,
+	size uint64,
+	csize uint64,
+	off uint64,
+	sent uint64,
+) (shardDone, allDone bool) {
+	index, count, id, ok := parseShard(shard)
+	if !ok || 0 == csize {
+		return false, false
+	}
+
+	/* Work out if this was the shard's last chunk */
+	start, length, err := dnsfservget.ShardRange(
+		uint(size),
+		uint(csize),
+		uint(index),
+		uint(count),
+	)
+	if nil != err || 0 == length ||
+		off < uint64(start) || off+sent < uint64(start+length) {
+		return false, false
+	}
+
+	/* Shards after the last block are empty and never asked for */
+	want := (size + csize - 1) / csize
+	if count < want {
+		want = count
+	}
+
+	shards.l.Lock()
+	defer shards.l.Unlock()
+	k := shardKey{fname: fname, id: id, count: count}
+	sg, ok := shards.m[k]
+	if !ok {
+		sg = &shardGroup{
+			done:    make(map[uint64]bool),
+			clients: make(map[string]struct{}),
+		}
+		shards.m[k] = sg
+	}
+	sg.done[index] = true
+	sg.clients[campaignClient(addr)] = struct{}{}
+	sg.last = time.Now()
+	if uint64(len(sg.done)) < want {
+		return true, false
+	}
+	delete(shards.m, k)
+	log.Printf(
+		"[%s] Finished sharded delivery of %s%s in %d shards "+
+			"to %d clients",
+		logAddr(addr),
+		fname,
+		shardIDLog(id),
+		want,
+		len(sg.clients),
+	)
+	return true, true
+}
+
+/* shardIDLog returns a string to add to log lines for the sharded delivery
+with the given ID, or the empty string if id is empty. */
+func shardIDLog(id string) string {
+	if "" == id {
+		return ""
+	}
+	return " (ID " + id + ")"
+}
+
+/* summarizeShards logs the sharded deliveries in progress every interval and
+forgets those without a finished shard in the last shardIdle.  It never
+returns. */
+func summarizeShards(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		shards.l.Lock()
+		var lines []string
+		for k, sg := range shards.m {
+			if time.Since(sg.last) > shardIdle {
+				delete(shards.m, k)
+				continue
+			}
+			lines = append(lines, k.fname+shardIDLog(k.id)+": "+
+				strconv.Itoa(len(sg.done))+"/"+
+				strconv.FormatUint(k.count, 10)+" shards, "+
+				strconv.Itoa(len(sg.clients))+" clients")
+		}
+		shards.l.Unlock()
+		sort.Strings(lines)
+		for _, l := range lines {
+			log.Printf("Sharded delivery of %s", l)
+		}
+	}
+}
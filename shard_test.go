@@ -0,0 +1,64 @@
+package main
+
+/*
+ * shard_test.go
+ * Tests for file sharding
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleShards(t *testing.T) {
+	contents := testServe(t)
+	campaigns = &campaignSet{
+		files: map[string]string{"payload": "c"},
+		stats: make(map[string]*campaignStats),
+	}
+	defer func() { campaigns = nil }()
+	completed := func() int {
+		return len(campaigns.statsFor("c").completed)
+	}
+
+	/* Seven bytes in three-byte chunks is three chunks, so with two
+	shards the first gets the first two chunks. */
+	for _, c := range []struct {
+		name string
+		want int
+	}{
+		{"0-payload._h-0-2-x.example.com.", 0},
+		{"6-payload._h-1-2-x.example.com.", 0},
+		{"0-payload._h-0-2-y.example.com.", 0},
+		{"3-payload._h-0-2-x.example.com.", 1},
+		{"3-payload._h-0-2-x.example.com.", 1},
+		{"7-payload._h-1-2-x.example.com.", 1},
+	} {
+		m := testQuery(t, c.name, dnsmessage.TypeA)
+		if nil == m {
+			t.Fatalf("%s: no response", c.name)
+		}
+		if got := completed(); c.want != got {
+			t.Errorf(
+				"%s: %d completed, want %d",
+				c.name,
+				got,
+				c.want,
+			)
+		}
+	}
+
+	/* Shards still serve the file */
+	m := testQuery(t, "6-payload._h-1-2.example.com.", dnsmessage.TypeA)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad response to shard query: %v", m)
+	}
+	if got := m.Answers[0].Body.(*dnsmessage.AResource).A; contents[6] !=
+		got[1] {
+		t.Errorf("A: got %02x, want %02x", got[1], contents[6])
+	}
+}
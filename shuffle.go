@@ -0,0 +1,31 @@
+package main
+
+/*
+ * shuffle.go
+ * Send answer records in a random order
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"math/rand"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* shuffleAnswers is set by -shuffle to send the records in answers with
+several records in a random order, like a DNS server doing round-robin.
+Clients put multi-chunk answers back in order with the sequence numbers in
+each record. */
+var shuffleAnswers bool
+
+/* shuffle shuffles rrs in place if shuffleAnswers is set. */
+func shuffle(rrs []dnsmessage.Resource) {
+	if !shuffleAnswers || 2 > len(rrs) {
+		return
+	}
+	rand.Shuffle(len(rrs), func(i, j int) {
+		rrs[i], rrs[j] = rrs[j], rrs[i]
+	})
+}
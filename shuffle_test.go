@@ -0,0 +1,70 @@
+package main
+
+/*
+ * shuffle_test.go
+ * Tests for answer shuffling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleShuffle(t *testing.T) {
+	testServe(t)
+	shuffleAnswers = true
+	defer func() { shuffleAnswers = false }()
+	contents := bytes.Repeat([]byte("kittens"), 10)
+	if err := ioutil.WriteFile(
+		filepath.Join(fdir, "multi"),
+		contents,
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+
+	/* Answers should come back in different orders but still decode */
+	orders := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		m := testQuery(
+			t,
+			"_m-0-multi.files.example.com.",
+			dnsmessage.TypeA,
+		)
+		if nil == m || multiAnswers != len(m.Answers) {
+			t.Fatalf("Wrong number of answers: %v", m)
+		}
+		var (
+			order []byte
+			as    []string
+		)
+		for _, a := range m.Answers {
+			b := a.Body.(*dnsmessage.AResource).A
+			order = append(order, b[0])
+			as = append(as, netip.AddrFrom4(b).String())
+		}
+		orders[string(order)] = true
+		g := dnsfservget.Getter{Type: dnsfservget.TypeMultiA}
+		buf := make([]byte, 3*multiAnswers)
+		n, err := g.DecodeResponse(buf, strings.Join(as, " "))
+		if nil != err {
+			t.Fatalf("Decoding response: %s", err)
+		}
+		if !bytes.Equal(contents[:n], buf[:n]) {
+			t.Fatalf("Got %q", buf[:n])
+		}
+	}
+	if 2 > len(orders) {
+		t.Errorf("Answers not shuffled")
+	}
+}
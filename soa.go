@@ -0,0 +1,163 @@
+package main
+
+/*
+ * soa.go
+ * SOA and NS records for our zones
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* Set by flags, for our zones' SOA records.  Empty names are relative to the
+zone, as ns1 and hostmaster, and a zero serial is the time we started. */
+var (
+	soaMName  string
+	soaRName  string
+	soaSerial uint
+)
+
+/* zoneOf returns the longest of our zones holding the lowercase,
+fully-qualified name n, or the empty string if there isn't one. */
+func zoneOf(n string) string {
+	var longest string
+	for _, zone := range zones {
+		if (n == zone || strings.HasSuffix(n, "."+zone)) &&
+			len(zone) > len(longest) {
+			longest = zone
+		}
+	}
+	return longest
+}
+
+/* setSOADefaults fills in the SOA serial if it wasn't set, and turns an email
+address in the rname into a name. */
+func setSOADefaults() {
+	if 0 == soaSerial {
+		s, _ := strconv.ParseUint(
+			time.Now().Format("2006010215"),
+			10,
+			32,
+		)
+		soaSerial = uint(s)
+	}
+	soaRName = strings.Replace(soaRName, "@", ".", 1)
+}
+
+/* zoneName returns n as a name in zone.  Names ending in a dot are already
+fully-qualified and an empty n is replaced with def. */
+func zoneName(n, def, zone string) (dnsmessage.Name, error) {
+	switch {
+	case "" == n:
+		n = def + "." + zone
+	case !strings.HasSuffix(n, "."):
+		n += "."
+	}
+	return dnsmessage.NewName(n)
+}
+
+/* soaResource returns the SOA record for zone.  The minimum TTL is the TTL
+of our answers, so nonexistent chunks aren't remembered for longer than the
+ones which exist. */
+func soaResource(zone string) (dnsmessage.Resource, error) {
+	var r dnsmessage.Resource
+	name, err := dnsmessage.NewName(zone)
+	if nil != err {
+		return r, err
+	}
+	mname, err := zoneName(soaMName, "ns1", zone)
+	if nil != err {
+		return r, err
+	}
+	rname, err := zoneName(soaRName, "hostmaster", zone)
+	if nil != err {
+		return r, err
+	}
+	ttl := currentSettings().ttl
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  name,
+			Type:  dnsmessage.TypeSOA,
+			Class: dnsmessage.ClassINET,
+			TTL:   uint32(ttl),
+		},
+		Body: &dnsmessage.SOAResource{
+			NS:      mname,
+			MBox:    rname,
+			Serial:  uint32(soaSerial),
+			Refresh: 7200,
+			Retry:   3600,
+			Expire:  1209600,
+			MinTTL:  uint32(ttl),
+		},
+	}, nil
+}
+
+/* addSOA adds the SOA record for the zone holding the name in msg's question
+to msg's authority section, as for negative responses, if it's one of our
+zones. */
+func addSOA(msg *dnsmessage.Message) {
+	zone := zoneOf(strings.ToLower(msg.Questions[0].Name.String()))
+	if "" == zone {
+		return
+	}
+	soa, err := soaResource(zone)
+	if nil != err {
+		log.Printf("Error making SOA record for %s: %s", zone, err)
+		return
+	}
+	msg.Authorities = append(msg.Authorities, soa)
+}
+
+/* sendApex answers an SOA or NS query in msg, which came from addr via pc.
+Queries for the apex of one of our zones get its SOA or NS record, and the
+rest get no data.  The buffer buf is used to send the response. */
+func sendApex(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	n := strings.ToLower(msg.Questions[0].Name.String())
+	if zoneOf(n) != n {
+		sendNoData(pc, addr, buf, msg, q)
+		return
+	}
+	la := logAddr(addr)
+	soa, err := soaResource(n)
+	if nil != err {
+		log.Printf("[%s] Error making SOA record for %q: %s", la, q, err)
+		return
+	}
+	switch msg.Questions[0].Type {
+	case dnsmessage.TypeSOA:
+		msg.Answers = append(msg.Answers, soa)
+	case dnsmessage.TypeNS:
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name:  soa.Header.Name,
+				Type:  dnsmessage.TypeNS,
+				Class: dnsmessage.ClassINET,
+				TTL:   soa.Header.TTL,
+			},
+			Body: &dnsmessage.NSResource{
+				NS: soa.Body.(*dnsmessage.SOAResource).NS,
+			},
+		})
+	}
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending apex answer: %s", la, err)
+		return
+	}
+	log.Printf("[%s] Sent apex answer for %q", la, q)
+}
@@ -0,0 +1,80 @@
+package main
+
+/*
+ * soa_test.go
+ * Tests for SOA answers
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleSOA(t *testing.T) {
+	testServe(t)
+	defer func() { zones, soaMName, soaRName, soaSerial = nil, "", "", 0 }()
+	if err := zones.Set("files.example.com"); nil != err {
+		t.Fatalf("Setting zone: %s", err)
+	}
+	soaRName = "me@example.org."
+	soaSerial = 2026101500
+	setSOADefaults()
+
+	/* The apex has SOA and NS records */
+	m := testQuery(t, "files.example.com.", dnsmessage.TypeSOA)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad SOA response: %v", m)
+	}
+	soa, ok := m.Answers[0].Body.(*dnsmessage.SOAResource)
+	if !ok {
+		t.Fatalf("Got %T, not an SOA record", m.Answers[0].Body)
+	}
+	if "ns1.files.example.com." != soa.NS.String() ||
+		"me.example.org." != soa.MBox.String() ||
+		2026101500 != soa.Serial || uint32(ttl) != soa.MinTTL {
+		t.Errorf("Unexpected SOA record %s", soa.GoString())
+	}
+	m = testQuery(t, "files.example.com.", dnsmessage.TypeNS)
+	if nil == m || 1 != len(m.Answers) {
+		t.Fatalf("Bad NS response: %v", m)
+	}
+	if ns, ok := m.Answers[0].Body.(*dnsmessage.NSResource); !ok ||
+		"ns1.files.example.com." != ns.NS.String() {
+		t.Errorf("Unexpected NS record %s", m.Answers[0].GoString())
+	}
+
+	/* Negative responses have the SOA */
+	for _, c := range []struct {
+		name  string
+		qtype dnsmessage.Type
+		rcode dnsmessage.RCode
+	}{
+		{"0-payload.files.example.com.", dnsmessage.TypeNS, 0},
+		{"sub.files.example.com.", dnsmessage.TypeSOA, 0},
+		{"_.files.example.com.", dnsmessage.TypeA, 0},
+		{"z-payload.files.example.com.", dnsmessage.TypeA, 3},
+	} {
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Errorf("%s %s: no response", c.name, c.qtype)
+			continue
+		}
+		if c.rcode != m.RCode || 0 != len(m.Answers) {
+			t.Errorf(
+				"%s %s: got %s and %d answers",
+				c.name,
+				c.qtype,
+				m.RCode,
+				len(m.Answers),
+			)
+		}
+		if 1 != len(m.Authorities) ||
+			dnsmessage.TypeSOA != m.Authorities[0].Header.Type {
+			t.Errorf("%s %s: no SOA", c.name, c.qtype)
+		}
+	}
+}
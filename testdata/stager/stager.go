@@ -0,0 +1,40 @@
+// Program stager is a stand-in for dnsfservstager which prints its config
+package main
+
+/*
+ * stager.go
+ * Stand-in stager for testing the stager command
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import "fmt"
+
+var (
+	dohURL      = ""
+	dohSNI      = ""
+	dohECH      = ""
+	domain      = ""
+	fname       = ""
+	passEnv     = ""
+	envKey      = ""
+	maxBytes    = ""
+	maxDuration = ""
+)
+
+func main() {
+	fmt.Printf(
+		"fname=%s domain=%s dohURL=%s dohSNI=%s dohECH=%s passEnv=%s "+
+			"envKey=%s maxBytes=%s maxDuration=%s\n",
+		fname,
+		domain,
+		dohURL,
+		dohSNI,
+		dohECH,
+		passEnv,
+		envKey,
+		maxBytes,
+		maxDuration,
+	)
+}
@@ -0,0 +1,82 @@
+package main
+
+/*
+ * throttle.go
+ * Limit how fast we send files
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/* throttleInterval is how often the time spent throttling is logged */
+const throttleInterval = time.Hour
+
+/* maxBPS is set by -max-bps to the most bytes of files we'll send each
+second, to all clients together.  0 means no limit. */
+var maxBPS uint64
+
+/* throttled tracks when we may next send a chunk and how long we've spent
+waiting. */
+var throttled struct {
+	l       sync.Mutex
+	next    time.Time     /* When the next chunk may be sent */
+	n       uint64        /* Responses delayed */
+	delayed time.Duration /* Total delay */
+}
+
+/* throttle waits until n more bytes of a file may be sent without going over
+maxBPS.  Chunks are scheduled one after another, so a chunk sent when we've
+been idle goes right away and the ones after it are spaced out to keep the
+average under maxBPS. */
+func throttle(n uint64) {
+	if 0 == maxBPS || 0 == n {
+		return
+	}
+	d := time.Duration(n) * time.Second / time.Duration(maxBPS)
+
+	/* Work out when we can send */
+	throttled.l.Lock()
+	now := time.Now()
+	if throttled.next.Before(now) {
+		throttled.next = now
+	}
+	at := throttled.next
+	throttled.next = throttled.next.Add(d)
+	wait := at.Sub(now)
+	if 0 < wait {
+		throttled.n++
+		throttled.delayed += wait
+	}
+	throttled.l.Unlock()
+
+	time.Sleep(wait)
+}
+
+/* summarizeThrottled logs and resets the count of delayed responses every
+interval, if there were any.  It never returns. */
+func summarizeThrottled(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		throttled.l.Lock()
+		n, delayed := throttled.n, throttled.delayed
+		throttled.n, throttled.delayed = 0, 0
+		throttled.l.Unlock()
+		if 0 == n {
+			continue
+		}
+		log.Printf(
+			"Delayed %d responses by a total of %s to stay under "+
+				"%d bytes/second in the last %s",
+			n,
+			delayed.Round(time.Millisecond),
+			maxBPS,
+			interval,
+		)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+/*
+ * throttle_test.go
+ * Tests for send rate limiting
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleMaxBPS(t *testing.T) {
+	testServe(t)
+	maxBPS = 30
+	defer func() { maxBPS = 0 }()
+
+	/* Three-byte chunks at 30 bytes/second are 100ms apart */
+	start := time.Now()
+	for _, off := range []string{"0", "3", "6"} {
+		qn := off + "-payload.files.example.com."
+		if m := testQuery(t, qn, dnsmessage.TypeA); nil == m ||
+			0 == len(m.Answers) {
+			t.Fatalf("%s: bad response: %v", qn, m)
+		}
+	}
+	if d := time.Since(start); 200*time.Millisecond > d {
+		t.Errorf("Sent three chunks in %s", d)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+/*
+ * tsig.go
+ * Require queries be signed with TSIG
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"log"
+	"net"
+	"sync"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* rcodeNotAuth is the NOTAUTH RCode, which dnsmessage doesn't have */
+const rcodeNotAuth dnsmessage.RCode = 9
+
+var (
+	/* tsigKey, if set, is the key with which all queries must be signed
+	and with which we sign responses */
+	tsigKey *dnsfservget.TSIGKey
+
+	/* tsigMACs holds the MACs of verified queries, keyed by the
+	*dnsmessage.Message holding the response */
+	tsigMACs sync.Map
+)
+
+/* setTSIGKey parses the key given with -tsig-key and sets tsigKey. */
+func setTSIGKey(s string) error {
+	k, err := dnsfservget.ParseTSIGKey(s)
+	if nil != err {
+		return err
+	}
+	tsigKey = k
+	return nil
+}
+
+/* verifyTSIG checks that the n-byte query in buf, unpacked into msg, was
+signed with tsigKey and removes the TSIG record from msg.  If not, a NOTAUTH
+response is sent to addr via pc and verifyTSIG returns false.  Otherwise,
+the query's MAC is stored for sendResponse, and forgetTSIG should be called
+after the response is sent. */
+func verifyTSIG(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	n int,
+	msg *dnsmessage.Message,
+) bool {
+	/* Check the signature */
+	mac, err := tsigKey.VerifyQuery(buf[:n])
+
+	/* Don't send back the TSIG record */
+	if l := len(msg.Additionals); 0 != l &&
+		dnsmessage.Type(250) == msg.Additionals[l-1].Header.Type {
+		msg.Additionals = msg.Additionals[:l-1]
+	}
+
+	/* If it's good, note the MAC for signing the response */
+	if nil == err {
+		tsigMACs.Store(msg, mac)
+		return true
+	}
+
+	/* If not, tell the client */
+	la := logAddr(addr)
+	log.Printf("[%s] Rejecting query: %s", la, err)
+	msg.RCode = rcodeNotAuth
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending TSIG rejection: %s", la, err)
+	}
+	return false
+}
+
+/* forgetTSIG removes the MAC stored for msg by verifyTSIG. */
+func forgetTSIG(msg *dnsmessage.Message) {
+	tsigMACs.Delete(msg)
+}
+
+/* signTSIG signs the packed response p to the query which was unpacked into
+msg, if the query was verified by verifyTSIG.  If not, p is returned
+unchanged. */
+func signTSIG(msg *dnsmessage.Message, p []byte) ([]byte, error) {
+	mac, ok := tsigMACs.Load(msg)
+	if !ok {
+		return p, nil
+	}
+	return tsigKey.SignResponse(p, mac.([]byte))
+}
@@ -0,0 +1,51 @@
+package main
+
+/*
+ * ttlhint.go
+ * Let clients ask for answers' TTLs
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"strconv"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* ttlHintLabel starts the label holding the TTL a client would like for the
+answer to its query */
+const ttlHintLabel = dnsfservget.TTLHintLabel
+
+/* ttlHintMin and ttlHintMax bound the TTLs clients may ask for.  If
+ttlHintMax is 0, TTL hints are ignored. */
+var ttlHintMin, ttlHintMax uint
+
+/* ttlHintZone splits a TTL hint label off the front of the zone from a query,
+or after the CNAME label for CNAME targets, if there is one, and returns the
+hint and the rest of the zone. */
+func ttlHintZone(zone string) (hint, rest string) {
+	hint, rest, _ = cutZoneLabel(zone, ttlHintLabel+"-")
+	return hint, rest
+}
+
+/* answerTTL returns the TTL to use for answers to a query with the TTL hint
+hint, which may be empty.  Hints are clamped to ttlHintMin and ttlHintMax, and
+if there's no usable hint, the answer gets the usual TTL, def. */
+func answerTTL(def uint, hint string) uint32 {
+	if 0 == ttlHintMax || "" == hint {
+		return uint32(def)
+	}
+	h, err := strconv.ParseUint(hint, 10, 32)
+	if nil != err {
+		return uint32(def)
+	}
+	switch {
+	case h < uint64(ttlHintMin):
+		h = uint64(ttlHintMin)
+	case h > uint64(ttlHintMax):
+		h = uint64(ttlHintMax)
+	}
+	return uint32(h)
+}
@@ -0,0 +1,56 @@
+package main
+
+/*
+ * ttlhint_test.go
+ * Tests for TTL hints
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleTTLHint(t *testing.T) {
+	testServe(t)
+	ottl := ttl
+	ttl = 1800
+	defer func() { ttl, ttlHintMin, ttlHintMax = ottl, 0, 0 }()
+
+	d := uint32(ttl)
+	for _, c := range []struct {
+		min, max uint
+		name     string
+		want     uint32
+	}{
+		{0, 0, "0-payload._t-30.example.com.", d},
+		{10, 600, "0-payload.example.com.", d},
+		{10, 600, "0-payload._t-30.example.com.", 30},
+		{10, 600, "0-payload._t-5.example.com.", 10},
+		{10, 600, "0-payload._t-900.example.com.", 600},
+		{10, 600, "0-payload._t-x.example.com.", d},
+		{10, 600, "0-payload._t-30._q.example.com.", 30},
+		{10, 600, "_meta-payload._t-20.example.com.", 20},
+		{10, 600, "_probe-payload._t-20.example.com.", 20},
+		{10, 600, "_crc-0-3-payload._t-20.example.com.", 20},
+	} {
+		ttlHintMin, ttlHintMax = c.min, c.max
+		m := testQuery(t, c.name, dnsmessage.TypeTXT)
+		if nil == m || 1 != len(m.Answers) {
+			t.Fatalf("%s: bad response %v", c.name, m)
+		}
+		if got := m.Answers[0].Header.TTL; c.want != got {
+			t.Errorf(
+				"%s (%d-%d): got TTL %d, want %d",
+				c.name,
+				c.min,
+				c.max,
+				got,
+				c.want,
+			)
+		}
+	}
+}
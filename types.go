@@ -0,0 +1,74 @@
+package main
+
+/*
+ * types.go
+ * Which record types we serve
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/internal/answer"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* servedTypes are the record types in which we can serve files */
+var servedTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"TXT":   dnsmessage.TypeTXT,
+	"NULL":  answer.TypeNULL,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"SRV":   dnsmessage.TypeSRV,
+}
+
+/* enabledTypes are the types we'll actually serve, or nil for all of
+servedTypes */
+var enabledTypes map[dnsmessage.Type]bool
+
+/* setEnabledTypes sets enabledTypes from a comma-separated list of type
+names. */
+func setEnabledTypes(list string) error {
+	ets := make(map[dnsmessage.Type]bool)
+	for _, n := range strings.Split(list, ",") {
+		n = strings.ToUpper(strings.TrimSpace(n))
+		if "" == n {
+			continue
+		}
+		t, ok := servedTypes[n]
+		if !ok {
+			return fmt.Errorf("unsupported type %q", n)
+		}
+		ets[t] = true
+	}
+	if 0 == len(ets) {
+		return fmt.Errorf("no types enabled")
+	}
+	enabledTypes = ets
+	return nil
+}
+
+/* typeDisabled returns true if t is a type in which we could serve files but
+which has been disabled with -enable-types. */
+func typeDisabled(t dnsmessage.Type) bool {
+	if nil == enabledTypes || !typeServable(t) {
+		return false
+	}
+	return !enabledTypes[t]
+}
+
+/* typeServable returns true if t is a type in which we can serve files,
+whether or not it's been disabled. */
+func typeServable(t dnsmessage.Type) bool {
+	for _, st := range servedTypes {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package main
+
+/*
+ * types_test.go
+ * Tests for enabled record types
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleEnableTypes(t *testing.T) {
+	testServe(t)
+	if err := setEnabledTypes("A,aaaa"); nil != err {
+		t.Fatalf("setEnabledTypes: %s", err)
+	}
+	defer func() { enabledTypes = nil }()
+
+	/* Disabled types get nothing */
+	for _, n := range []string{
+		"0-payload.files.example.com.",
+		"_meta-payload.files.example.com.",
+	} {
+		m := testQuery(t, n, dnsmessage.TypeTXT)
+		if nil == m {
+			t.Fatalf("No response for %s", n)
+		}
+		if dnsmessage.RCodeSuccess != m.RCode || 0 != len(m.Answers) {
+			t.Errorf(
+				"%s: got RCode %s and %d answers",
+				n,
+				m.RCode,
+				len(m.Answers),
+			)
+		}
+	}
+
+	/* Enabled types still work */
+	m := testQuery(t, "0-payload.files.example.com.", dnsmessage.TypeAAAA)
+	if nil == m || 1 != len(m.Answers) {
+		t.Errorf("Enabled type not served")
+	}
+
+	if err := setEnabledTypes("A,HINFO"); nil == err {
+		t.Errorf("No error enabling HINFO")
+	}
+}
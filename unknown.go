@@ -0,0 +1,155 @@
+package main
+
+/*
+ * unknown.go
+ * Answer queries we can't answer like a normal zone would
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* defaultDecoyAnswers are the decoy records sent in answer to queries we
+can't answer if -unknown-answers isn't given. */
+const defaultDecoyAnswers = `
+*    A     192.0.2.10
+*    AAAA  2001:db8::10
+*    TXT   v=spf1 -all
+`
+
+/* Things to do with queries we can't answer */
+const (
+	unknownDrop  = "drop"
+	unknownDecoy = "decoy"
+)
+
+/* decoyAnswers are the records used to answer queries we can't answer, or
+nil to drop them.  They're all named *, and answer for any name. */
+var decoyAnswers []zoneRecord
+
+/* setUnknown sets what to do with queries we can't answer.  With
+unknownDecoy, decoy records are read from the named file, or
+defaultDecoyAnswers if afile is empty. */
+func setUnknown(mode, afile string) error {
+	switch mode {
+	case unknownDrop:
+		decoyAnswers = nil
+		return nil
+	case unknownDecoy:
+	default:
+		return fmt.Errorf("unknown action %q", mode)
+	}
+
+	/* Load the records */
+	var r io.Reader = strings.NewReader(defaultDecoyAnswers)
+	if "" != afile {
+		f, err := os.Open(afile)
+		if nil != err {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	zrs, err := parseZone(r)
+	if nil != err {
+		return err
+	}
+	if 0 == len(zrs) {
+		return errors.New("no records")
+	}
+	for _, zr := range zrs {
+		if "*" != zr.name {
+			return fmt.Errorf("record for %q not named *", zr.name)
+		}
+	}
+
+	/* Make sure they work */
+	if _, err := zoneResources(zrs, dnsmessage.MustNewName(
+		"example.com.",
+	)); nil != err {
+		return err
+	}
+	decoyAnswers = zrs
+
+	return nil
+}
+
+/* decoyRecords returns the decoy records for the name and type in the
+question q.  Names in records' data are relative to q's zone, if it's one of
+ours. */
+func decoyRecords(q dnsmessage.Question) ([]dnsmessage.Resource, error) {
+	zone := zoneOf(strings.ToLower(q.Name.String()))
+	fqdn := func(n string) (dnsmessage.Name, error) {
+		switch {
+		case "*" == n:
+			return q.Name, nil
+		case strings.HasSuffix(n, "."):
+			return dnsmessage.NewName(n)
+		case "" == zone:
+			return dnsmessage.Name{}, fmt.Errorf("no zone for %q", n)
+		case "@" == n:
+			return dnsmessage.NewName(zone)
+		default:
+			return dnsmessage.NewName(n + "." + zone)
+		}
+	}
+	var (
+		rs  []dnsmessage.Resource
+		ttl = uint32(currentSettings().ttl)
+	)
+	for _, zr := range decoyAnswers {
+		if q.Type != zr.rtype {
+			continue
+		}
+		r, err := zr.resource(fqdn, ttl)
+		if nil != err {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+/* sendDecoyAnswer answers the query in msg, which came from addr via pc and
+which we can't otherwise answer, with decoy records, as a normal zone would.
+The buffer buf is used to send the response. */
+func sendDecoyAnswer(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	rs, err := decoyRecords(msg.Questions[0])
+	if nil != err {
+		log.Printf("[%s] Error making decoy answer for %q: %s", la, q, err)
+		return
+	}
+	msg.RCode = dnsmessage.RCodeSuccess
+	msg.Answers = append(msg.Answers[:0], rs...)
+	if 0 == len(rs) {
+		addSOA(msg)
+	}
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf(
+			"[%s] Error sending decoy answer for %q: %s",
+			la,
+			q,
+			err,
+		)
+		return
+	}
+	log.Printf("[%s] Sent decoy answer for %q", la, q)
+}
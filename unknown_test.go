@@ -0,0 +1,124 @@
+package main
+
+/*
+ * unknown_test.go
+ * Tests for unknown name handling
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"io/ioutil"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleUnknown(t *testing.T) {
+	testServe(t)
+	defer func() { decoyAnswers = nil }()
+
+	/* Without decoys, unanswerable queries are dropped */
+	if m := testQuery(
+		t,
+		"0-nope.files.example.com.",
+		dnsmessage.TypeA,
+	); nil != m {
+		t.Errorf("Got response without decoys: %v", m)
+	}
+
+	/* With them, they get plausible answers */
+	if err := setUnknown(unknownDecoy, ""); nil != err {
+		t.Fatalf("Setting default decoys: %s", err)
+	}
+	for _, c := range []struct {
+		name  string
+		qtype dnsmessage.Type
+		want  string
+	}{
+		{"0-nope.files.example.com.", dnsmessage.TypeA, "192.0.2.10"},
+		{"-payload.files.example.com.", dnsmessage.TypeA, "192.0.2.10"},
+		{
+			"0-nope.files.example.com.",
+			dnsmessage.TypeAAAA,
+			"2001:db8::10",
+		},
+		{
+			"0-nope.files.example.com.",
+			dnsmessage.TypeTXT,
+			"v=spf1 -all",
+		},
+		{"0-nope.files.example.com.", dnsmessage.TypeMX, ""},
+	} {
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Errorf("%s/%s: no response", c.name, c.qtype)
+			continue
+		}
+		if dnsmessage.RCodeSuccess != m.RCode {
+			t.Errorf("%s/%s: got %s", c.name, c.qtype, m.RCode)
+			continue
+		}
+		var got string
+		if 0 != len(m.Answers) {
+			switch b := m.Answers[0].Body.(type) {
+			case *dnsmessage.AResource:
+				got = netip.AddrFrom4(b.A).String()
+			case *dnsmessage.AAAAResource:
+				got = netip.AddrFrom16(b.AAAA).String()
+			case *dnsmessage.TXTResource:
+				got = strings.Join(b.TXT, "")
+			}
+			if c.name != m.Answers[0].Header.Name.String() {
+				t.Errorf(
+					"%s/%s: answer for %s",
+					c.name,
+					c.qtype,
+					m.Answers[0].Header.Name,
+				)
+			}
+		}
+		if c.want != got {
+			t.Errorf(
+				"%s/%s: got %q, want %q",
+				c.name,
+				c.qtype,
+				got,
+				c.want,
+			)
+		}
+	}
+
+	/* Real files are still served */
+	if m := testQuery(
+		t,
+		"0-payload.files.example.com.",
+		dnsmessage.TypeA,
+	); nil == m || 1 != len(m.Answers) || "kit" != string(
+		m.Answers[0].Body.(*dnsmessage.AResource).A[1:],
+	) {
+		t.Errorf("Bad response for real file: %v", m)
+	}
+
+	/* Decoys may come from a file, but only for any name */
+	fn := filepath.Join(t.TempDir(), "decoys")
+	for _, c := range []struct {
+		s  string
+		ok bool
+	}{
+		{"* A 203.0.113.7\n", true},
+		{"www A 203.0.113.7\n", false},
+		{"# Nothing\n", false},
+	} {
+		if err := ioutil.WriteFile(fn, []byte(c.s), 0600); nil != err {
+			t.Fatalf("Writing decoys: %s", err)
+		}
+		if err := setUnknown(unknownDecoy, fn); c.ok != (nil == err) {
+			t.Errorf("Decoy file %q: %v", c.s, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+/*
+ * vectors.go
+ * Export canonical test vectors
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+)
+
+/* vector is a query for a chunk of a file and its canonical response */
+type vector struct {
+	Type     dnsfservget.QType `json:"type"`
+	Offset   uint64            `json:"offset"`
+	Name     string            `json:"name"`     /* Fully-qualified */
+	Query    string            `json:"query"`    /* Hex-encoded */
+	Response string            `json:"response"` /* Hex-encoded */
+	Payload  string            `json:"payload"`  /* Hex, empty at EOF */
+}
+
+/* vectorsMain writes test vectors for getting a file to stdout.  It is called
+with the arguments after "vectors" on the command line. */
+func vectorsMain(args []string) {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	var (
+		fname = fs.String(
+			"file",
+			"",
+			"Optional `file` for which to write vectors, instead "+
+				"of a pattern of -size bytes",
+		)
+		size = fs.Uint(
+			"size",
+			1000,
+			"Size of the pattern for which to write vectors, "+
+				"without -file",
+		)
+		name = fs.String(
+			"name",
+			"payload",
+			"Name with which the file is served",
+		)
+		domain = fs.String(
+			"domain",
+			"files.example.com",
+			"Domain from which the file is served",
+		)
+		qtype = fs.String(
+			"type",
+			"",
+			"Query `type` for which to write vectors "+
+				"(default all types)",
+		)
+		seq = fs.Bool(
+			"sequence",
+			false,
+			"Ask for chunks to start with sequence bytes",
+		)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: %v vectors [options]
+
+Writes canonical test vectors for getting a file with each query type, as
+lines of JSON, to stdout.  Each has the query type, the offset of the chunk,
+the name queried, the query and response as raw DNS messages in hex, and the
+chunk's bytes in hex, which are empty for the query which finds the end of the
+file.  Client implementations may use these to check they ask the same
+questions and understand the answers.  Without -file, the vectors are for
+dnsfservget.CheckPattern(-size).
+
+Options:
+`,
+			os.Args[0],
+		)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	/* Work out for what to write vectors */
+	file := dnsfservget.CheckPattern(*size)
+	if "" != *fname {
+		var err error
+		if file, err = ioutil.ReadFile(*fname); nil != err {
+			log.Fatalf("Error reading %s: %s", *fname, err)
+		}
+	}
+	pts := planTypes
+	if "" != *qtype {
+		pts = nil
+		for _, pt := range planTypes {
+			if strings.EqualFold(string(pt.qt), *qtype) {
+				pts = append(pts, pt)
+			}
+		}
+		if 0 == len(pts) {
+			log.Fatalf("Unknown query type %q", *qtype)
+		}
+	}
+
+	if err := writeVectors(
+		os.Stdout,
+		pts,
+		file,
+		strings.ToLower(*name),
+		strings.Trim(strings.ToLower(*domain), ".")+".",
+		*seq,
+	); nil != err {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+/* writeVectors writes a vector to w for each chunk of file, served as name in
+zone, for each of the types in pts, including the query which finds the end
+of the file.  If seq is set, chunks start with sequence bytes. */
+func writeVectors(
+	w io.Writer,
+	pts []planType,
+	file []byte,
+	name string,
+	zone string,
+	seq bool,
+) error {
+	enc := json.NewEncoder(w)
+	for _, pt := range pts {
+		psize, err := pt.qt.PayloadSize()
+		if nil != err {
+			return err
+		}
+		if seq && 1 < psize {
+			psize--
+		}
+		for off := uint64(0); ; off += uint64(psize) {
+			var p []byte
+			if off < uint64(len(file)) {
+				p = file[off:]
+			}
+			if uint64(psize) < uint64(len(p)) {
+				p = p[:psize]
+			}
+			qn, q, r, err := packExchange(
+				pt,
+				name,
+				zone,
+				off,
+				p,
+				seq,
+			)
+			if nil != err {
+				return fmt.Errorf(
+					"%s at offset %d: %w",
+					pt.qt,
+					off,
+					err,
+				)
+			}
+			if err := enc.Encode(vector{
+				Type:     pt.qt,
+				Offset:   off,
+				Name:     qn,
+				Query:    hex.EncodeToString(q),
+				Response: hex.EncodeToString(r),
+				Payload:  hex.EncodeToString(p),
+			}); nil != err {
+				return err
+			}
+			if 0 == len(p) {
+				break
+			}
+		}
+	}
+	return nil
+}
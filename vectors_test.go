@@ -0,0 +1,110 @@
+package main
+
+/*
+ * vectors_test.go
+ * Tests for test vector generation
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/magisterquis/dnsfserv/dnsfservget"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestWriteVectors(t *testing.T) {
+	contents := testServe(t)
+	var pts []planType
+	for _, pt := range planTypes {
+		if dnsfservget.TypeA == pt.qt || dnsfservget.TypeTXT == pt.qt {
+			pts = append(pts, pt)
+		}
+	}
+	for _, seq := range []bool{false, true} {
+		var b bytes.Buffer
+		if err := writeVectors(
+			&b,
+			pts,
+			contents,
+			"payload",
+			"files.example.com.",
+			seq,
+		); nil != err {
+			t.Fatalf("writeVectors (seq:%t): %s", seq, err)
+		}
+
+		/* Each vector should match what we'd actually send */
+		dec := json.NewDecoder(&b)
+		var n int
+		for ; dec.More(); n++ {
+			var v vector
+			if err := dec.Decode(&v); nil != err {
+				t.Fatalf("Decoding vector: %s", err)
+			}
+			rb, err := hex.DecodeString(v.Response)
+			if nil != err {
+				t.Fatalf(
+					"%s: decoding response: %s",
+					v.Name,
+					err,
+				)
+			}
+			var want dnsmessage.Message
+			if err := want.Unpack(rb); nil != err {
+				t.Fatalf(
+					"%s: unpacking response: %s",
+					v.Name,
+					err,
+				)
+			}
+			got := testQuery(t, v.Name, want.Questions[0].Type)
+			if nil == got {
+				t.Fatalf("%s: no response", v.Name)
+			}
+			if got.RCode != want.RCode ||
+				len(got.Answers) != len(want.Answers) {
+				t.Errorf(
+					"%s: got %s with %d answers, want %s "+
+						"with %d",
+					v.Name,
+					got.RCode,
+					len(got.Answers),
+					want.RCode,
+					len(want.Answers),
+				)
+				continue
+			}
+			for i, a := range want.Answers {
+				if a.Body.GoString() !=
+					got.Answers[i].Body.GoString() {
+					t.Errorf(
+						"%s: got answer %s, want %s",
+						v.Name,
+						got.Answers[i].Body.GoString(),
+						a.Body.GoString(),
+					)
+				}
+			}
+		}
+		/* Seven bytes is three A chunks, or four with sequence
+		bytes, one TXT chunk, and an EOF for each */
+		want := 6
+		if seq {
+			want++
+		}
+		if want != n {
+			t.Errorf(
+				"Got %d vectors (seq:%t), want %d",
+				n,
+				seq,
+				want,
+			)
+		}
+	}
+}
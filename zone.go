@@ -0,0 +1,113 @@
+package main
+
+/*
+ * zone.go
+ * Only answer for our own zones
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/* outOfZoneInterval is how often counts of out-of-zone queries are logged */
+const outOfZoneInterval = time.Hour
+
+/* zoneList is a flag.Value holding the zones set with -domain, lowercase and
+fully-qualified.  If it's empty, we answer for any zone. */
+type zoneList []string
+
+/* zones are the zones for which we answer */
+var zones zoneList
+
+/* String implements flag.Value. */
+func (z *zoneList) String() string { return strings.Join(*z, ",") }
+
+/* Set implements flag.Value.  It adds the zone in v to z. */
+func (z *zoneList) Set(v string) error {
+	v = strings.Trim(strings.ToLower(v), ".")
+	if "" == v {
+		return fmt.Errorf("empty zone")
+	}
+	*z = append(*z, v+".")
+	return nil
+}
+
+/* contains returns true if the name n, which should be lowercase and
+fully-qualified, is in one of the zones in z or z is empty. */
+func (z zoneList) contains(n string) bool {
+	if 0 == len(z) {
+		return true
+	}
+	for _, zone := range z {
+		if n == zone || strings.HasSuffix(n, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+/* outOfZone counts queries for names outside of our zones, which are
+refused.  Only the first from each client between summaries is logged, to
+keep scanners from filling the logs. */
+var outOfZone = struct {
+	l    sync.Mutex
+	n    uint64
+	seen map[string]bool
+}{seen: make(map[string]bool)}
+
+/* summarizeOutOfZone logs and resets the count of out-of-zone queries every
+interval, if there were any.  It never returns. */
+func summarizeOutOfZone(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		outOfZone.l.Lock()
+		n, clients := outOfZone.n, len(outOfZone.seen)
+		outOfZone.n = 0
+		outOfZone.seen = make(map[string]bool)
+		outOfZone.l.Unlock()
+		if 0 == n {
+			continue
+		}
+		log.Printf(
+			"Refused %d out-of-zone queries from %d clients in the "+
+				"last %s",
+			n,
+			clients,
+			interval,
+		)
+	}
+}
+
+/* sendOutOfZone refuses the query in msg, which came from addr via pc, for a
+name outside of our zones.  The buffer buf is used to send the response. */
+func sendOutOfZone(
+	pc responder,
+	addr net.Addr,
+	buf []byte,
+	msg *dnsmessage.Message,
+	q string,
+) {
+	la := logAddr(addr)
+	outOfZone.l.Lock()
+	outOfZone.n++
+	first := !outOfZone.seen[campaignClient(addr)]
+	outOfZone.seen[campaignClient(addr)] = true
+	outOfZone.l.Unlock()
+	if first {
+		log.Printf("[%s] Refusing out-of-zone query for %q", la, q)
+	}
+	msg.RCode = dnsmessage.RCodeRefused
+	if err := sendResponse(pc, addr, buf, msg); nil != err {
+		log.Printf("[%s] Error sending refusal: %s", la, err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+/*
+ * zone_test.go
+ * Tests for only answering for our zones
+ * By J. Stuart McMurray
+ * Created 20261015
+ * Last Modified 20261015
+ */
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestHandleZones(t *testing.T) {
+	testServe(t)
+	defer func() { zones = nil }()
+	for _, z := range []string{"Files.Example.com.", "other.test"} {
+		if err := zones.Set(z); nil != err {
+			t.Fatalf("Setting zone %q: %s", z, err)
+		}
+	}
+	for _, c := range []struct {
+		name    string
+		qtype   dnsmessage.Type
+		refused bool
+		answers int
+	}{
+		{"0-payload.files.example.com.", dnsmessage.TypeA, false, 1},
+		{"0-payload.other.test.", dnsmessage.TypeAAAA, false, 1},
+		{"files.example.com.", dnsmessage.TypeNS, false, 1},
+		{"0-payload.example.com.", dnsmessage.TypeA, true, 0},
+		{"0-payload.notfiles.example.com.", dnsmessage.TypeA, true, 0},
+		{"example.com.", dnsmessage.TypeNS, true, 0},
+		{"files.example.com.", dnsmessage.TypeAXFR, true, 0},
+	} {
+		m := testQuery(t, c.name, c.qtype)
+		if nil == m {
+			t.Errorf("%s %s: no response", c.name, c.qtype)
+			continue
+		}
+		if c.refused != (dnsmessage.RCodeRefused == m.RCode) {
+			t.Errorf("%s %s: got RCode %s", c.name, c.qtype, m.RCode)
+		}
+		if c.answers != len(m.Answers) {
+			t.Errorf(
+				"%s %s: got %d answers",
+				c.name,
+				c.qtype,
+				len(m.Answers),
+			)
+		}
+	}
+}